@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"schedule-app/internal/accountmail"
+	"schedule-app/internal/clock"
 	"schedule-app/internal/config"
 	"schedule-app/internal/db"
+	"schedule-app/internal/events"
 	"schedule-app/internal/handler"
+	"schedule-app/internal/invite"
+	"schedule-app/internal/jwtkeys"
+	"schedule-app/internal/mail"
 	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/oidc"
+	"schedule-app/internal/reminder"
 	"schedule-app/internal/repository"
+	"schedule-app/internal/webhook"
+	"time"
 )
 
 func main() {
@@ -22,12 +34,80 @@ func main() {
 	}
 	defer conn.Close()
 
+	// アクセストークンの署名鍵・検証鍵を読み込み
+	keys, err := loadJWTKeys(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// 外部IDプロバイダーのディスカバリー文書を取得 (OpenID Connect ログインが設定されている場合)
+	var oidcProvider *oidc.Provider
+	if cfg.OIDC.Enabled() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		oidcProvider, err = oidc.Discover(ctx, &http.Client{Timeout: 10 * time.Second}, oidc.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to configure OpenID Connect: %v", err)
+		}
+	}
+
 	// 2. 依存関係を注入 (DI)
 	userRepo := repository.NewUserRepository(conn)
-	userHandler := handler.NewUserHandler(userRepo, cfg.JWTSecret)
+	sessionRepo := repository.NewSessionRepository(conn)
+	oidcRepo := repository.NewOIDCRepository(conn)
+	accountTokenRepo := repository.NewAccountTokenRepository(conn)
+	mailer := newMailer(cfg.Mail)
+	loginThrottleRepo := repository.NewLoginThrottleRepository(conn, model.LoginThrottlePolicy{
+		Window:             cfg.LoginThrottle.Window,
+		MaxAccountFailures: cfg.LoginThrottle.MaxAccountFailures,
+		MaxIPFailures:      cfg.LoginThrottle.MaxIPFailures,
+		LockoutBase:        cfg.LoginThrottle.LockoutBase,
+		LockoutMax:         cfg.LoginThrottle.LockoutMax,
+		MaxAccountResets:   cfg.LoginThrottle.MaxAccountResets,
+		MaxIPResets:        cfg.LoginThrottle.MaxIPResets,
+	})
+	// パスワード再設定のメールは送信キューに追加し、accountMailWorker が送信
+	outboxRepo := repository.NewOutboxRepository(conn)
+	accountHandler := handler.NewAccountHandler(userRepo, accountTokenRepo, mailer, outboxRepo, loginThrottleRepo, cfg.AppBaseURL)
+	mfaRepo := repository.NewMFARepository(conn)
+	userHandler := handler.NewUserHandler(userRepo, sessionRepo, oidcRepo, oidcProvider, keys, accountHandler, loginThrottleRepo, mfaRepo)
+	mfaHandler := handler.NewMFAHandler(userRepo, mfaRepo, loginThrottleRepo)
 	scheduleRepo := repository.NewScheduleRepository(conn)
-	scheduleHandler := handler.NewScheduleHandler(scheduleRepo)
-	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret)
+	shareRepo := repository.NewShareRepository(conn)
+	groupRepo := repository.NewGroupRepository(conn)
+	// スケジュールの変更の配信 (再接続したクライアントのために直近1000件のイベントを保持)
+	eventHub := events.NewHub(1000)
+	webhookRepo := repository.NewWebhookRepository(conn)
+	invitationRepo := repository.NewInvitationRepository(conn)
+	invitations := invite.NewSender(invitationRepo, userRepo, cfg.AppBaseURL)
+	scheduleHandler := handler.NewScheduleHandler(scheduleRepo, shareRepo, groupRepo, eventHub, invitations)
+	eventHandler := handler.NewEventHandler(eventHub, shareRepo, cfg.EventHeartbeatInterval)
+	shareHandler := handler.NewShareHandler(shareRepo, userRepo, groupRepo)
+	groupHandler := handler.NewGroupHandler(groupRepo, userRepo)
+	adminHandler := handler.NewAdminHandler(userRepo, loginThrottleRepo, cfg.AdminBootstrapToken)
+	feedTokenRepo := repository.NewFeedTokenRepository(conn)
+	calendarFeedHandler := handler.NewCalendarFeedHandler(scheduleRepo, userRepo, feedTokenRepo, shareRepo)
+	calendarImportHandler := handler.NewCalendarImportHandler(scheduleRepo, userRepo)
+	caldavHandler := handler.NewCalDAVHandler(scheduleRepo, userRepo, shareRepo)
+	freeBusyHandler := handler.NewFreeBusyHandler(scheduleRepo, userRepo, shareRepo)
+	jwksHandler := handler.NewJWKSHandler(keys)
+	personalTokenRepo := repository.NewPersonalTokenRepository(conn)
+	personalTokenHandler := handler.NewPersonalTokenHandler(personalTokenRepo)
+	reminderRepo := repository.NewReminderRepository(conn)
+	reminderHandler := handler.NewReminderHandler(reminderRepo, scheduleRepo)
+	notificationRepo := repository.NewNotificationRepository(conn)
+	notificationHandler := handler.NewNotificationHandler(notificationRepo)
+	webhookHandler := handler.NewWebhookHandler(webhookRepo, model.WebhookScopeUser)
+	adminWebhookHandler := handler.NewWebhookHandler(webhookRepo, model.WebhookScopeAll)
+	authMiddleware := middleware.NewAuthMiddleware(keys, sessionRepo.CheckActive, personalTokenRepo.Authenticate)
+	requireAdmin := middleware.RequireRole(model.UserRoleAdmin)
+	// CalDAV クライアントは JWT を送信できないため、メールアドレスとパスワード (またはパーソナルアクセストークン) による Basic 認証を使用
+	caldavAuth := middleware.BasicAuthentication(handler.CalDAVRealm, userHandler.CheckCredentials, personalTokenRepo.Authenticate)
 
 	// 3. HTTPルーターをセットアップ
 	mux := http.NewServeMux()
@@ -35,32 +115,211 @@ func main() {
 	// --- ユーザー認証エンドポイント ---
 	mux.HandleFunc("POST /api/users/register", userHandler.Register)
 	mux.HandleFunc("POST /api/users/login", userHandler.Login)
+	// 二要素認証のコードによるログインの完了 (Login が返したチャレンジで認証)
+	mux.HandleFunc("POST /api/users/login/mfa", userHandler.LoginMFA)
+	// アクセストークンの再発行 (リフレッシュトークンで認証)
+	mux.HandleFunc("POST /api/users/refresh", userHandler.Refresh)
+	// ログアウト (要認証)
+	mux.Handle("POST /api/users/logout", authMiddleware.JwtAuthentication(http.HandlerFunc(userHandler.Logout)))
+	// パーソナルアクセストークンの一覧・発行・取り消し (要認証、ログインのセッションのみ)
+	mux.Handle("GET /api/users/tokens", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.ListTokens))))
+	mux.Handle("POST /api/users/tokens", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.CreateToken))))
+	mux.Handle("DELETE /api/users/tokens/{tokenID}", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.RevokeToken))))
+	// 二要素認証 (TOTP) の登録・無効化とリカバリーコードの再発行 (要認証、ログインのセッションのみ)
+	mux.Handle("GET /api/users/mfa", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.GetStatus))))
+	mux.Handle("POST /api/users/mfa/totp", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.StartTOTPEnrollment))))
+	mux.Handle("POST /api/users/mfa/totp/confirm", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.ConfirmTOTPEnrollment))))
+	mux.Handle("POST /api/users/mfa/disable", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.Disable))))
+	mux.Handle("POST /api/users/mfa/recovery-codes", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.RegenerateRecoveryCodes))))
+	// メールアドレスの確認 (確認メールの再送信は要認証)
+	mux.Handle("POST /api/users/verify-email/send", authMiddleware.JwtAuthentication(http.HandlerFunc(accountHandler.RequestEmailVerification)))
+	mux.HandleFunc("POST /api/users/verify-email", accountHandler.VerifyEmail)
+	// パスワードの再設定 (メールで送信したトークンで認証)
+	mux.HandleFunc("POST /api/users/forgot-password", accountHandler.RequestPasswordReset)
+	mux.HandleFunc("POST /api/users/reset-password", accountHandler.ResetPassword)
+	// 外部IDプロバイダー (OpenID Connect) によるログイン
+	mux.HandleFunc("GET /api/auth/oidc/login", userHandler.OIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/callback", userHandler.OIDCCallback)
+	// アクセストークンの検証用の公開鍵 (JWKS)
+	mux.HandleFunc("GET /.well-known/jwks.json", jwksHandler.GetJWKS)
 
 	// --- スケジュール管理エンドポイント ---
 	// 作成 (要認証)
 	mux.Handle("POST /api/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.CreateSchedule)))
-	// 取得 (公開)
-	mux.HandleFunc("GET /api/users/{ownerID}/schedules", scheduleHandler.GetSchedulesByOwner)
-	mux.HandleFunc("GET /api/schedules/{scheduleID}", scheduleHandler.GetScheduleByID)
+	// 取得 (要認証、read 権限が必要)
+	mux.Handle("GET /api/users/{ownerID}/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetSchedulesByOwner)))
+	mux.Handle("GET /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetScheduleByID)))
+	// iCalendar からの一括取り込み (要認証)
+	mux.Handle("POST /api/users/{ownerID}/schedules/import", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarImportHandler.ImportSchedules)))
 	// 更新 (要認証)
 	mux.Handle("PUT /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.UpdateSchedule)))
 	// 削除 (要認証)
 	mux.Handle("DELETE /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.DeleteSchedule)))
+	// 参加者の出欠の回答 (要認証)
+	mux.Handle("POST /api/schedules/{scheduleID}/rsvp", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.RespondToSchedule)))
+	// 閲覧できるカレンダーのスケジュールの変更をリアルタイムに受信 (要認証、Server-Sent Events)
+	mux.Handle("GET /api/events/stream", authMiddleware.JwtAuthentication(http.HandlerFunc(eventHandler.Stream)))
+
+	// --- リマインダー・通知エンドポイント ---
+	// 既定のリマインダーと webhook URL の取得・更新 (要認証)
+	mux.Handle("GET /api/users/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.GetSettings)))
+	mux.Handle("PUT /api/users/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.UpdateSettings)))
+	// スケジュールごとのリマインダーの取得・設定・削除 (要認証、所有者と参加者のみ)
+	mux.Handle("GET /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.GetScheduleReminders)))
+	mux.Handle("PUT /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.UpdateScheduleReminders)))
+	mux.Handle("DELETE /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.DeleteScheduleReminders)))
+	// アプリ内通知の一覧・既読にする (要認証)
+	mux.Handle("GET /api/notifications", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.ListNotifications)))
+	mux.Handle("POST /api/notifications/{notificationID}/read", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.MarkRead)))
+	mux.Handle("POST /api/notifications/read-all", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.MarkAllRead)))
 
-	// --- 管理者用エンドポイント ---
-	// 全ユーザー取得 (要認証)
-	mux.Handle("GET /api/admin/users", authMiddleware.JwtAuthentication(http.HandlerFunc(userHandler.GetAllUsers)))
+	// --- webhook エンドポイント ---
+	// 閲覧できるカレンダーの変更を受信する webhook の登録・一覧・削除 (要認証、登録したユーザーのみ)
+	mux.Handle("GET /api/webhooks", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.ListWebhooks)))
+	mux.Handle("POST /api/webhooks", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.CreateWebhook)))
+	mux.Handle("DELETE /api/webhooks/{webhookID}", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.DeleteWebhook)))
+	// 配信の送信ログ・再送信 (要認証、登録したユーザーのみ)
+	mux.Handle("GET /api/webhooks/{webhookID}/deliveries", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.ListDeliveries)))
+	mux.Handle("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.Redeliver)))
 
+	// --- カレンダー共有エンドポイント ---
+	// 共有設定の一覧・付与・取り消し (要認証、manage 権限が必要)
+	mux.Handle("GET /api/users/{ownerID}/shares", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.ListShares)))
+	mux.Handle("POST /api/users/{ownerID}/shares", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.GrantShare)))
+	mux.Handle("DELETE /api/users/{ownerID}/shares/{shareID}", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.RevokeShare)))
+
+	// --- グループエンドポイント ---
+	// グループの作成・一覧・取得・更新・削除 (要認証、変更には admin 以上、削除には owner の役割が必要)
+	mux.Handle("POST /api/groups", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.CreateGroup)))
+	mux.Handle("GET /api/groups", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.ListGroups)))
+	mux.Handle("GET /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.GetGroup)))
+	mux.Handle("PUT /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.UpdateGroup)))
+	mux.Handle("DELETE /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.DeleteGroup)))
+	// メンバーの追加・役割の変更・削除 (要認証)
+	mux.Handle("POST /api/groups/{groupID}/members", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.AddMember)))
+	mux.Handle("DELETE /api/groups/{groupID}/members/{userID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.RemoveMember)))
+	// グループとメンバーのスケジュールをまとめて取得 (要認証、メンバーのみ)
+	mux.Handle("GET /api/groups/{groupID}/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetSchedulesByGroup)))
+
+	// --- 空き状況 (free/busy) エンドポイント ---
+	// 複数ユーザーの埋まっている時間帯を取得 (要認証)
+	mux.Handle("POST /api/freebusy", authMiddleware.JwtAuthentication(http.HandlerFunc(freeBusyHandler.GetFreeBusy)))
+	// 参加者の空き状況から会議の候補時間を提案 (要認証)
+	mux.Handle("POST /api/schedules/suggest", authMiddleware.JwtAuthentication(http.HandlerFunc(freeBusyHandler.SuggestSlots)))
+
+	// --- カレンダー購読 (iCalendar) エンドポイント ---
+	// フィードトークンの発行・無効化 (要認証)
+	mux.Handle("POST /api/users/feed-token", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarFeedHandler.CreateFeedToken)))
+	mux.Handle("DELETE /api/users/feed-token", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarFeedHandler.RevokeFeedToken)))
+	// フィード取得 (フィードトークンで認証)
+	mux.HandleFunc("GET /api/users/{ownerID}/calendar.ics", calendarFeedHandler.GetCalendarFeed)
+
+	// --- CalDAV エンドポイント (Basic 認証) ---
+	mux.Handle("/.well-known/caldav", http.RedirectHandler("/caldav/", http.StatusMovedPermanently))
+	mux.HandleFunc("OPTIONS /caldav/", caldavHandler.Options)
+	mux.Handle("PROPFIND /caldav/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindRoot)))
+	mux.Handle("PROPFIND /caldav/principals/{userID}/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindPrincipal)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindHome)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/default/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindCalendar)))
+	mux.Handle("REPORT /caldav/calendars/{userID}/default/{$}", caldavAuth(http.HandlerFunc(caldavHandler.Report)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindObject)))
+	mux.Handle("GET /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.GetObject)))
+	mux.Handle("PUT /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.PutObject)))
+	mux.Handle("DELETE /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.DeleteObject)))
+
+	// --- 管理者用エンドポイント (要認証、admin ロールが必要) ---
+	// 全ユーザー取得
+	mux.Handle("GET /api/admin/users", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(userHandler.GetAllUsers))))
+	// ログインの監査ログ
+	mux.Handle("GET /api/admin/login-audit", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminHandler.GetLoginAudit))))
+	// ユーザーのスケジュールの閲覧 (共有の権限によらず取得、変更はできません)
+	mux.Handle("GET /api/admin/users/{ownerID}/schedules", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(scheduleHandler.GetSchedulesByOwnerAsAdmin))))
+	// ユーザーの昇格・降格
+	mux.Handle("PUT /api/admin/users/{userID}/role", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminHandler.UpdateUserRole))))
+	// すべての変更を受信する webhook の登録・一覧・削除と、配信の送信ログ・再送信
+	mux.Handle("GET /api/admin/webhooks", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.ListWebhooks))))
+	mux.Handle("POST /api/admin/webhooks", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.CreateWebhook))))
+	mux.Handle("DELETE /api/admin/webhooks/{webhookID}", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.DeleteWebhook))))
+	mux.Handle("GET /api/admin/webhooks/{webhookID}/deliveries", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.ListDeliveries))))
+	mux.Handle("POST /api/admin/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.Redeliver))))
+	// 最初の管理者の作成 (要認証、ブートストラップトークンが必要)
+	mux.Handle("POST /api/bootstrap/admin", authMiddleware.JwtAuthentication(http.HandlerFunc(adminHandler.BootstrapAdmin)))
 
 	// --- 静的ファイル配信 ---
 	// API以外のリクエストはwebディレクトリの静적ファイルとして配信
 	mux.Handle("/", http.FileServer(http.Dir("web")))
 
+	// リバースプロキシを経由する場合、プロキシが設定した送信元のアドレスを使用 (ログインの試行回数の制限に使用)
+	var root http.Handler = mux
+	if cfg.TrustProxyHeaders {
+		root = middleware.TrustProxyHeaders(mux)
+	}
 
-	// 4. HTTPサーバーを起動
+	// 4. リマインダー、webhook と招待メールを送信するワーカーを起動
+	// webhook の URL は利用者が登録するため、内部のネットワークに接続しないクライアントで送信
+	reminderWorker := reminder.NewWorker(reminderRepo, map[model.ReminderChannel]reminder.Channel{
+		model.ReminderEmail:   reminder.NewEmailChannel(mailer, cfg.AppBaseURL),
+		model.ReminderWebhook: reminder.NewWebhookChannel(webhook.NewClient(10 * time.Second)),
+		model.ReminderInApp:   reminder.NewInAppChannel(notificationRepo),
+	}, clock.Real{}, cfg.ReminderInterval)
+	go reminderWorker.Run(context.Background())
+	webhookWorker := webhook.NewWorker(webhookRepo, webhook.NewClient(15*time.Second), clock.Real{}, cfg.WebhookInterval)
+	go webhookWorker.Run(context.Background())
+	invitationWorker := invite.NewWorker(invitationRepo, mailer, clock.Real{}, cfg.InvitationInterval)
+	go invitationWorker.Run(context.Background())
+	// アカウントのメールは招待メールと同じ間隔で送信
+	accountMailWorker := accountmail.NewWorker(outboxRepo, mailer, clock.Real{}, cfg.InvitationInterval)
+	go accountMailWorker.Run(context.Background())
+
+	// 5. HTTPサーバーを起動
 	port := "8080"
 	log.Printf("Server starting on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := http.ListenAndServe(":"+port, root); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// loadJWTKeys は設定からアクセストークンの鍵を読み込みます。
+// 署名鍵のファイルが設定されていない場合は、JWT_SECRET による HS256 で署名します (この場合、JWKS は空です)。
+func loadJWTKeys(cfg *config.Config) (*jwtkeys.KeySet, error) {
+	if cfg.JWTSigningKeyFile == "" {
+		if len(cfg.JWTVerificationKeyFiles) > 0 {
+			log.Println("WARNING: JWT_VERIFICATION_KEY_FILES is ignored because JWT_SIGNING_KEY_FILE is not set.")
+		}
+		return jwtkeys.NewKeySet(jwtkeys.NewHMACKey([]byte(cfg.JWTSecret)))
+	}
+
+	signing, err := jwtkeys.LoadFile(cfg.JWTSigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var verificationKeys []*jwtkeys.Key
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		key, err := jwtkeys.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+	keys, err := jwtkeys.NewKeySet(signing, verificationKeys...)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Signing access tokens with %s key %s\n", signing.Algorithm, signing.ID)
+	return keys, nil
+}
+
+// newMailer は設定に応じてメールの送信方法を選択します。
+// SMTP サーバーが設定されていない場合は、メールを送信せずにファイルとして保存します (開発用)。
+func newMailer(cfg config.MailConfig) mail.Sender {
+	if cfg.SMTPAddr == "" {
+		log.Printf("WARNING: SMTP_ADDR is not set. Emails are not sent but saved to %s.\n", cfg.OutboxDir)
+		return mail.NewOutbox(cfg.From, cfg.OutboxDir)
+	}
+	return mail.NewSMTPSender(mail.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
+	})
+}
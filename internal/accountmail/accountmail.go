@@ -0,0 +1,127 @@
+// Package accountmail はアカウントのメール (パスワードの再設定など) の送信キューを処理するバックグラウンドのワーカーを提供します。
+//
+// ハンドラーはメールを送信キュー (outbox_emails) に追加するだけで、リクエストの処理中にメールサーバーへ接続しません。
+// そのため、応答時間や送信の失敗から宛先のアカウントが存在するかを推測されません。
+// 失敗したメールは間隔を倍々に延ばして再送信しますが、メールの有効期限 (リンクの有効期限) を過ぎてからは送信しません。
+// 現在時刻は clock.Clock から取得するため、テストでは clock.Fake で時刻を進めて RunOnce を呼び出します。
+package accountmail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"schedule-app/internal/clock"
+	"schedule-app/internal/mail"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"time"
+)
+
+const (
+	// batchSize は1回の RunOnce で送信するメールの最大件数です。
+	batchSize = 50
+	// sendTimeout はメール1通の送信にかける時間の上限です。
+	sendTimeout = 30 * time.Second
+	// lease は送信中のメールを確保する期間です。sendTimeout より長くします。
+	lease = 2 * time.Minute
+	// backoffBase と backoffMax は再送信までの待ち時間の初期値と上限です。
+	backoffBase = time.Minute
+	backoffMax  = 30 * time.Minute
+	// emailRetention は送信済み・失敗したメール (本文は消去済み) を保持する期間です。
+	emailRetention = 7 * 24 * time.Hour
+)
+
+// ErrExpired は有効期限までに送信できなかったメールの最後のエラーです。
+var ErrExpired = errors.New("email expired before it could be sent")
+
+// Backoff は attempts 回目の送信に失敗した後、再送信するまでの待ち時間を返します (1分から倍々、最大30分)。
+func Backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, backoffMax)
+}
+
+// Worker は一定間隔で送信キューのメールを mail.Sender で送信します。
+// 送信の前にメールを確保するため、複数のワーカーがあっても同時に同じメールを送信しません。
+type Worker struct {
+	repo     *repository.OutboxRepository
+	mailer   mail.Sender
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewWorker は Worker の新しいインスタンスを生成します。
+func NewWorker(repo *repository.OutboxRepository, mailer mail.Sender, clk clock.Clock, interval time.Duration) *Worker {
+	return &Worker{repo: repo, mailer: mailer, clock: clk, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("ERROR: Failed to send account emails: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce は送信予定の日時を過ぎたメールを送信し、送信に成功した件数を返します。
+// 失敗したメールは MaxOutboxEmailAttempts 回に達するか、次の送信が有効期限を過ぎるまで Backoff の後に再送信します。
+// 有効期限を過ぎたメールは送信せずに失敗にします。
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := w.clock.Now()
+	due, err := w.repo.DueEmails(now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range due {
+		claimed, err := w.repo.Claim(e, now.Add(lease))
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		var sendErr error
+		if now.Before(e.ExpiresAt) {
+			sendErr = w.send(ctx, e)
+		} else {
+			sendErr = ErrExpired
+		}
+		var retryAt *time.Time
+		if sendErr == nil {
+			sent++
+		} else {
+			log.Printf("WARNING: Failed to send email %d to %s: %v", e.ID, e.Recipient, sendErr)
+			if t := w.clock.Now().Add(Backoff(e.Attempts + 1)); e.Attempts+1 < model.MaxOutboxEmailAttempts && t.Before(e.ExpiresAt) {
+				retryAt = &t
+			}
+		}
+		if err := w.repo.RecordAttempt(e, sendErr, retryAt); err != nil {
+			return sent, err
+		}
+	}
+
+	if err := w.repo.PruneEmails(now.Add(-emailRetention)); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+// send はメールを1回送信します。
+func (w *Worker) send(ctx context.Context, e *model.OutboxEmail) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return w.mailer.Send(ctx, &mail.Message{To: e.Recipient, Subject: e.Subject, Body: e.Body})
+}
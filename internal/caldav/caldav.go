@@ -0,0 +1,402 @@
+// Package caldav は CalDAV (RFC 4791) と、その土台となる WebDAV (RFC 4918) の XML の解析と生成を提供します。
+// サーバーが対応する範囲 (PROPFIND と REPORT の calendar-query / calendar-multiget) に必要な要素のみを扱います。
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// XML 名前空間
+const (
+	NamespaceDAV            = "DAV:"
+	NamespaceCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NamespaceCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// prefixes は応答で使用する名前空間の接頭辞です。
+var prefixes = map[string]string{
+	NamespaceDAV:            "d",
+	NamespaceCalDAV:         "c",
+	NamespaceCalendarServer: "cs",
+}
+
+// サーバーが扱うプロパティ名
+var (
+	ResourceType                  = xml.Name{Space: NamespaceDAV, Local: "resourcetype"}
+	DisplayName                   = xml.Name{Space: NamespaceDAV, Local: "displayname"}
+	GetETag                       = xml.Name{Space: NamespaceDAV, Local: "getetag"}
+	GetContentType                = xml.Name{Space: NamespaceDAV, Local: "getcontenttype"}
+	CurrentUserPrincipal          = xml.Name{Space: NamespaceDAV, Local: "current-user-principal"}
+	PrincipalURL                  = xml.Name{Space: NamespaceDAV, Local: "principal-URL"}
+	Owner                         = xml.Name{Space: NamespaceDAV, Local: "owner"}
+	CurrentUserPrivilegeSet       = xml.Name{Space: NamespaceDAV, Local: "current-user-privilege-set"}
+	SupportedReportSet            = xml.Name{Space: NamespaceDAV, Local: "supported-report-set"}
+	CalendarHomeSet               = xml.Name{Space: NamespaceCalDAV, Local: "calendar-home-set"}
+	CalendarUserAddressSet        = xml.Name{Space: NamespaceCalDAV, Local: "calendar-user-address-set"}
+	SupportedCalendarComponentSet = xml.Name{Space: NamespaceCalDAV, Local: "supported-calendar-component-set"}
+	CalendarData                  = xml.Name{Space: NamespaceCalDAV, Local: "calendar-data"}
+	GetCTag                       = xml.Name{Space: NamespaceCalendarServer, Local: "getctag"}
+)
+
+// DAV:resourcetype の値
+var (
+	Collection = xml.Name{Space: NamespaceDAV, Local: "collection"}
+	Principal  = xml.Name{Space: NamespaceDAV, Local: "principal"}
+	Calendar   = xml.Name{Space: NamespaceCalDAV, Local: "calendar"}
+)
+
+// 事前条件 (エラー応答の本文に含める要素名)
+var (
+	SupportedCalendarData       = xml.Name{Space: NamespaceCalDAV, Local: "supported-calendar-data"}
+	SupportedFilter             = xml.Name{Space: NamespaceCalDAV, Local: "supported-filter"}
+	SupportedReport             = xml.Name{Space: NamespaceDAV, Local: "supported-report"}
+	ValidCalendarData           = xml.Name{Space: NamespaceCalDAV, Local: "valid-calendar-data"}
+	ValidCalendarObjectResource = xml.Name{Space: NamespaceCalDAV, Local: "valid-calendar-object-resource"}
+	NoUIDConflict               = xml.Name{Space: NamespaceCalDAV, Local: "no-uid-conflict"}
+	NeedPrivileges              = xml.Name{Space: NamespaceDAV, Local: "need-privileges"}
+)
+
+// ErrUnsupportedReport は対応していない REPORT が要求された場合に返されます。
+var ErrUnsupportedReport = errors.New("unsupported report")
+
+// ErrUnsupportedFilter は calendar-query に対応していないフィルターが含まれる場合に返されます。
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+var (
+	reportCalendarQuery    = xml.Name{Space: NamespaceCalDAV, Local: "calendar-query"}
+	reportCalendarMultiget = xml.Name{Space: NamespaceCalDAV, Local: "calendar-multiget"}
+)
+
+// timeRangeLayout は time-range 要素の start / end 属性の形式 (UTC の DATE-TIME) です。
+const timeRangeLayout = "20060102T150405Z"
+
+// ContentType は XML 応答の Content-Type です。
+const ContentType = "application/xml; charset=utf-8"
+
+// Element は要素 name を生成します。inner は要素の内容の XML です。
+func Element(name xml.Name, inner string) string {
+	tag, decl := qualify(name)
+	if inner == "" {
+		return "<" + tag + decl + "/>"
+	}
+	return "<" + tag + decl + ">" + inner + "</" + tag + ">"
+}
+
+// Href は DAV:href 要素を生成します。
+func Href(href string) string {
+	return Element(xml.Name{Space: NamespaceDAV, Local: "href"}, Text(href))
+}
+
+// Privileges は DAV:current-user-privilege-set の値 (DAV:privilege 要素の並び) を生成します。
+func Privileges(names ...string) string {
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(Element(xml.Name{Space: NamespaceDAV, Local: "privilege"}, Element(xml.Name{Space: NamespaceDAV, Local: name}, "")))
+	}
+	return sb.String()
+}
+
+// SupportedReports は DAV:supported-report-set の値 (対応する REPORT の一覧) を生成します。
+func SupportedReports() string {
+	var sb strings.Builder
+	for _, report := range []xml.Name{reportCalendarQuery, reportCalendarMultiget} {
+		sb.WriteString(Element(xml.Name{Space: NamespaceDAV, Local: "supported-report"}, Element(xml.Name{Space: NamespaceDAV, Local: "report"}, Element(report, ""))))
+	}
+	return sb.String()
+}
+
+// Text は文字列を XML の文字データとしてエスケープします。
+func Text(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// qualify は要素名を接頭辞付きの名前に変換します。既知でない名前空間の場合は名前空間宣言も返します。
+func qualify(name xml.Name) (tag, decl string) {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local, ""
+	}
+	if name.Space == "" {
+		return name.Local, ""
+	}
+	return "x:" + name.Local, ` xmlns:x="` + Text(name.Space) + `"`
+}
+
+// Resource はマルチステータス応答に含めるリソースです。
+type Resource struct {
+	Href string
+	// Props はプロパティ名から値 (要素の内容の XML) への対応です。
+	Props map[xml.Name]string
+}
+
+// PropRequest は PROPFIND や REPORT で要求されたプロパティです。
+type PropRequest struct {
+	// AllProp は DAV:allprop (または本文なし) の場合に true です。
+	AllProp bool
+	// PropName は DAV:propname の場合に true で、プロパティ名のみを返します。
+	PropName bool
+	Names    []xml.Name
+}
+
+// anyElement は名前のみを読み取る任意の要素です。
+type anyElement struct {
+	XMLName xml.Name
+}
+
+type propElement struct {
+	Names []anyElement `xml:",any"`
+}
+
+type propfindElement struct {
+	XMLName  xml.Name     `xml:"DAV: propfind"`
+	AllProp  *struct{}    `xml:"DAV: allprop"`
+	PropName *struct{}    `xml:"DAV: propname"`
+	Prop     *propElement `xml:"DAV: prop"`
+}
+
+// ParsePropfind は PROPFIND の本文を解析します。本文が空の場合は DAV:allprop として扱います (RFC 4918 9.1)。
+func ParsePropfind(body []byte) (*PropRequest, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return &PropRequest{AllProp: true}, nil
+	}
+	var el propfindElement
+	if err := xml.Unmarshal(body, &el); err != nil {
+		return nil, fmt.Errorf("invalid propfind body: %w", err)
+	}
+	return newPropRequest(el.AllProp != nil, el.PropName != nil, el.Prop), nil
+}
+
+func newPropRequest(allProp, propName bool, prop *propElement) *PropRequest {
+	req := &PropRequest{AllProp: allProp, PropName: propName}
+	if prop != nil {
+		for _, n := range prop.Names {
+			req.Names = append(req.Names, n.XMLName)
+		}
+	}
+	if !req.PropName && len(req.Names) == 0 {
+		req.AllProp = true
+	}
+	return req
+}
+
+// TimeRange は CALDAV:time-range で指定された期間です。ゼロ値の端は無制限を表します。
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CompFilter は CALDAV:comp-filter 要素です。
+type CompFilter struct {
+	Name      string
+	TimeRange *TimeRange
+	Filters   []*CompFilter
+}
+
+// Report は REPORT の要求です。
+type Report struct {
+	// Multiget は calendar-multiget の場合に true、calendar-query の場合に false です。
+	Multiget bool
+	Props    *PropRequest
+	// Hrefs は calendar-multiget で要求されたリソースの URL です。
+	Hrefs []string
+	// Filter は calendar-query の最上位の comp-filter (VCALENDAR) です。
+	Filter *CompFilter
+}
+
+type timeRangeElement struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+type compFilterElement struct {
+	Name         string              `xml:"name,attr"`
+	IsNotDefined *struct{}           `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *timeRangeElement   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters  []compFilterElement `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters  []anyElement        `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+type reportElement struct {
+	XMLName  xml.Name
+	AllProp  *struct{}          `xml:"DAV: allprop"`
+	PropName *struct{}          `xml:"DAV: propname"`
+	Prop     *propElement       `xml:"DAV: prop"`
+	Hrefs    []string           `xml:"DAV: href"`
+	Filter   *compFilterElement `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+// ParseReport は REPORT の本文を解析します。
+// calendar-query / calendar-multiget 以外のレポートには ErrUnsupportedReport を、
+// comp-filter と time-range 以外のフィルター (prop-filter など) には ErrUnsupportedFilter を返します。
+func ParseReport(body []byte) (*Report, error) {
+	var el reportElement
+	if err := xml.Unmarshal(body, &el); err != nil {
+		return nil, fmt.Errorf("invalid report body: %w", err)
+	}
+
+	report := &Report{Props: newPropRequest(el.AllProp != nil, el.PropName != nil, el.Prop)}
+	switch el.XMLName {
+	case reportCalendarMultiget:
+		report.Multiget = true
+		report.Hrefs = el.Hrefs
+	case reportCalendarQuery:
+		if el.Filter == nil {
+			return nil, fmt.Errorf("calendar-query requires a filter")
+		}
+		filter, err := parseCompFilter(el.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Name != "VCALENDAR" {
+			return nil, fmt.Errorf("%w: top-level comp-filter must be VCALENDAR", ErrUnsupportedFilter)
+		}
+		report.Filter = filter
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedReport, el.XMLName.Local)
+	}
+	return report, nil
+}
+
+func parseCompFilter(el *compFilterElement) (*CompFilter, error) {
+	if el.IsNotDefined != nil || len(el.PropFilters) > 0 {
+		return nil, fmt.Errorf("%w: only comp-filter and time-range are supported", ErrUnsupportedFilter)
+	}
+	f := &CompFilter{Name: strings.ToUpper(el.Name)}
+	if el.TimeRange != nil {
+		tr := &TimeRange{}
+		var err error
+		if el.TimeRange.Start != "" {
+			if tr.Start, err = time.Parse(timeRangeLayout, el.TimeRange.Start); err != nil {
+				return nil, fmt.Errorf("invalid time-range start %q", el.TimeRange.Start)
+			}
+		}
+		if el.TimeRange.End != "" {
+			if tr.End, err = time.Parse(timeRangeLayout, el.TimeRange.End); err != nil {
+				return nil, fmt.Errorf("invalid time-range end %q", el.TimeRange.End)
+			}
+		}
+		f.TimeRange = tr
+	}
+	for i := range el.CompFilters {
+		child, err := parseCompFilter(&el.CompFilters[i])
+		if err != nil {
+			return nil, err
+		}
+		f.Filters = append(f.Filters, child)
+	}
+	return f, nil
+}
+
+// EventTimeRange は VCALENDAR の comp-filter から VEVENT に対する条件を取り出します。
+// matches は VEVENT が対象になり得るかを、tr は VEVENT の time-range (指定がない場合は nil) を表します。
+func (f *CompFilter) EventTimeRange() (tr *TimeRange, matches bool) {
+	if len(f.Filters) == 0 {
+		return nil, true
+	}
+	for _, child := range f.Filters {
+		if child.Name == "VEVENT" {
+			return child.TimeRange, true
+		}
+	}
+	return nil, false
+}
+
+// MultiStatus は DAV:multistatus 応答を組み立てます。
+type MultiStatus struct {
+	buf bytes.Buffer
+}
+
+// AddResource は要求されたプロパティを持つリソースの DAV:response を追加します。
+// 存在するプロパティは 200、存在しないプロパティは 404 の propstat にまとめます。
+// allprop では calendar-data は返しません (RFC 4791 9.6)。
+func (m *MultiStatus) AddResource(res *Resource, req *PropRequest) {
+	var found, missing []string
+	switch {
+	case req.PropName:
+		for _, name := range sortedNames(res.Props) {
+			found = append(found, Element(name, ""))
+		}
+	case req.AllProp:
+		for _, name := range sortedNames(res.Props) {
+			if name != CalendarData {
+				found = append(found, Element(name, res.Props[name]))
+			}
+		}
+	default:
+		for _, name := range req.Names {
+			if value, ok := res.Props[name]; ok {
+				found = append(found, Element(name, value))
+			} else {
+				missing = append(missing, Element(name, ""))
+			}
+		}
+	}
+
+	m.buf.WriteString("<d:response>" + Href(res.Href))
+	writePropStat(&m.buf, found, http.StatusOK)
+	writePropStat(&m.buf, missing, http.StatusNotFound)
+	m.buf.WriteString("</d:response>")
+}
+
+// AddStatus はプロパティを持たない DAV:response (存在しないリソースなど) を追加します。
+func (m *MultiStatus) AddStatus(href string, status int) {
+	m.buf.WriteString("<d:response>" + Href(href) + statusElement(status) + "</d:response>")
+}
+
+// WriteTo は 207 Multi-Status 応答を書き込みます。
+func (m *MultiStatus) WriteTo(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, xml.Header+`<d:multistatus`+namespaceDecls()+`>`)
+	w.Write(m.buf.Bytes())
+	fmt.Fprint(w, `</d:multistatus>`)
+}
+
+// WriteError は事前条件の違反を表す DAV:error 応答を書き込みます (RFC 4918 16)。
+func WriteError(w http.ResponseWriter, status int, condition xml.Name) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	fmt.Fprint(w, xml.Header+`<d:error`+namespaceDecls()+`>`+Element(condition, "")+`</d:error>`)
+}
+
+func writePropStat(buf *bytes.Buffer, props []string, status int) {
+	if len(props) == 0 {
+		return
+	}
+	buf.WriteString("<d:propstat><d:prop>" + strings.Join(props, "") + "</d:prop>" + statusElement(status) + "</d:propstat>")
+}
+
+func statusElement(status int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+func namespaceDecls() string {
+	var sb strings.Builder
+	for _, ns := range []string{NamespaceDAV, NamespaceCalDAV, NamespaceCalendarServer} {
+		sb.WriteString(` xmlns:` + prefixes[ns] + `="` + ns + `"`)
+	}
+	return sb.String()
+}
+
+// sortedNames は応答の順序を安定させるため、プロパティ名を並べ替えて返します。
+func sortedNames(props map[xml.Name]string) []xml.Name {
+	names := make([]xml.Name, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
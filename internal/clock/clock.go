@@ -0,0 +1,53 @@
+// Package clock は現在時刻の取得を抽象化します。
+// 本番環境では Real を、テストでは時刻を自由に進められる Fake を使用します。
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock は現在時刻を返します。
+type Clock interface {
+	Now() time.Time
+}
+
+// Real はシステムの時刻を返す Clock です。
+type Real struct{}
+
+// Now は現在時刻を返します。
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Fake は Set・Advance で設定した時刻を返す Clock です。複数のゴルーチンから使用できます。
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake は now を返す Fake を生成します。
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now は設定された時刻を返します。
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set は時刻を now に設定します。
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// Advance は時刻を d だけ進めます。
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
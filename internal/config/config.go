@@ -3,22 +3,171 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the application configuration.
 type Config struct {
 	JWTSecret string
+	// JWTSigningKeyFile はアクセストークンの署名に使う秘密鍵 (RSA または Ed25519、PEM 形式) のファイルです。
+	// 空の場合は JWTSecret による HS256 で署名します。
+	JWTSigningKeyFile string
+	// JWTVerificationKeyFiles はローテーション前の鍵のファイルです。これらの鍵で署名されたトークンも受け付けます。
+	JWTVerificationKeyFiles []string
+	// AdminBootstrapToken は最初の管理者を作成するためのトークンです。空の場合、この機能は無効になります。
+	AdminBootstrapToken string
+	OIDC                OIDCConfig
+	Mail                MailConfig
+	// AppBaseURL はメールに記載するリンクのベースURLです (例: https://schedule.example.com)。
+	AppBaseURL    string
+	LoginThrottle LoginThrottleConfig
+	// TrustProxyHeaders が true の場合、X-Forwarded-For ヘッダーのアドレスをクライアントIPとして扱います。
+	// リバースプロキシを経由する場合にのみ有効にしてください。
+	TrustProxyHeaders bool
+	// ReminderInterval はリマインダーのワーカーが送信するリマインダーを探す間隔です。
+	ReminderInterval time.Duration
+	// EventHeartbeatInterval はスケジュールの変更のストリーム (Server-Sent Events) で接続を維持するコメントを送信する間隔です。
+	EventHeartbeatInterval time.Duration
+	// WebhookInterval は webhook のワーカーが送信する配信を探す間隔です。
+	WebhookInterval time.Duration
+	// InvitationInterval は招待メールのワーカーが送信するメールを探す間隔です。
+	InvitationInterval time.Duration
+}
+
+// LoginThrottleConfig はパスワードによるログインの総当たり攻撃の対策の設定です。
+// Window の間に MaxAccountFailures 回 (アカウントごと) または MaxIPFailures 回 (クライアントIPごと) 失敗するとロックします。
+// ロックの期間は LockoutBase から始まり、連続してロックされるたびに倍になります (最大 LockoutMax)。
+// パスワード再設定の要求は、Window の間にメールアドレスごとに MaxAccountResets 回、クライアントIPごとに MaxIPResets 回までです。
+type LoginThrottleConfig struct {
+	Window             time.Duration
+	MaxAccountFailures int
+	MaxIPFailures      int
+	LockoutBase        time.Duration
+	LockoutMax         time.Duration
+	MaxAccountResets   int
+	MaxIPResets        int
+}
+
+// MailConfig はメール (メールアドレスの確認・パスワードの再設定) の送信の設定です。
+// SMTPAddr が空の場合、メールは送信せずに OutboxDir に .eml ファイルとして保存します (開発用)。
+type MailConfig struct {
+	From         string
+	SMTPAddr     string // host:port
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string
+}
+
+// OIDCConfig は外部IDプロバイダー (Keycloak など) による OpenID Connect ログインの設定です。
+// エンドポイントは IssuerURL のディスカバリー文書 (/.well-known/openid-configuration) から取得します。
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL はIDプロバイダーに登録したコールバックURL (例: http://localhost:8080/api/auth/oidc/callback) です。
+	RedirectURL string
+}
+
+// Enabled は OpenID Connect ログインが設定されているかどうかを返します。
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
 }
 
 // LoadConfig loads configuration from environment variables.
 func LoadConfig() *Config {
+	signingKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
 	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
+	if secret == "" && signingKeyFile == "" {
 		log.Println("WARNING: JWT_SECRET environment variable not set. Using a default, insecure key. Please set a strong secret in production.")
 		secret = "a-very-insecure-default-secret-key" // This should not be used in production
 	}
 
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Schedule App <no-reply@localhost>"
+	}
+	outboxDir := os.Getenv("MAIL_OUTBOX_DIR")
+	if outboxDir == "" {
+		outboxDir = "/tmp/schedule-mail"
+	}
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
 	return &Config{
-		JWTSecret: secret,
+		JWTSecret:               secret,
+		JWTSigningKeyFile:       signingKeyFile,
+		JWTVerificationKeyFiles: splitList(os.Getenv("JWT_VERIFICATION_KEY_FILES")),
+		AdminBootstrapToken:     os.Getenv("ADMIN_BOOTSTRAP_TOKEN"),
+		OIDC: OIDCConfig{
+			IssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		},
+		Mail: MailConfig{
+			From:         mailFrom,
+			SMTPAddr:     os.Getenv("SMTP_ADDR"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			OutboxDir:    outboxDir,
+		},
+		AppBaseURL: strings.TrimSuffix(baseURL, "/"),
+		LoginThrottle: LoginThrottleConfig{
+			Window:             durationEnv("LOGIN_THROTTLE_WINDOW", 15*time.Minute),
+			MaxAccountFailures: intEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			MaxIPFailures:      intEnv("LOGIN_MAX_IP_FAILURES", 20),
+			LockoutBase:        durationEnv("LOGIN_LOCKOUT_BASE", time.Minute),
+			LockoutMax:         durationEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+			MaxAccountResets:   intEnv("PASSWORD_RESET_MAX_ACCOUNT_REQUESTS", 3),
+			MaxIPResets:        intEnv("PASSWORD_RESET_MAX_IP_REQUESTS", 10),
+		},
+		TrustProxyHeaders:      os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		ReminderInterval:       durationEnv("REMINDER_INTERVAL", 30*time.Second),
+		EventHeartbeatInterval: durationEnv("EVENT_HEARTBEAT_INTERVAL", 25*time.Second),
+		WebhookInterval:        durationEnv("WEBHOOK_INTERVAL", 10*time.Second),
+		InvitationInterval:     durationEnv("INVITATION_INTERVAL", 10*time.Second),
+	}
+}
+
+// splitList はカンマ区切りの値を分割し、空の要素を除いて返します。
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// durationEnv は環境変数の期間 (例: 15m) を読み込みます。未設定または不正な値の場合は def を返します。
+func durationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("WARNING: Invalid %s %q. Using the default %s.", name, value, def)
+		return def
+	}
+	return d
+}
+
+// intEnv は環境変数の正の整数を読み込みます。未設定または不正な値の場合は def を返します。
+func intEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: Invalid %s %q. Using the default %d.", name, value, def)
+		return def
 	}
+	return n
 }
\ No newline at end of file
@@ -11,13 +11,23 @@ import (
 //go:embed schema.sql
 var schemaFS embed.FS
 
+// dataSourceName はデータベースファイルに接続する DSN を返します。
+// URI形式のDSNとmode=rwcを指定して、読み書き可能・作成モードでデータベースを開きます。
+// _time_format=sqlite を指定し、日時を SQLite の日付関数 (unixepoch など) で扱える形式で保存します。
+//
+// リクエストとバックグラウンドのワーカー (リマインダー・Webhook・招待メール) は、同時に別の接続から書き込みます。
+// journal_mode(WAL) で書き込み中も読み取りを続けられるようにし、busy_timeout(5000) で他の接続の書き込みを最大5秒待ちます。
+// _txlock=immediate でトランザクションの開始時に書き込みのロックを取得し、読み取りの後に書き込むトランザクションが
+// ロックの取得で競合した場合も、待たずに SQLITE_BUSY で失敗しないようにします。
+func dataSourceName(dbPath string) string {
+	return fmt.Sprintf("file:%s?mode=rwc&_time_format=sqlite&_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", dbPath)
+}
+
 // InitDB はデータベース接続を初期化し、スキーマを適用します。
 // database/sql の標準インターフェースを使用します。
 func InitDB(dbPath string) (*sql.DB, error) {
 	// データベースファイルに接続します。ファイルが存在しない場合は作成されます。
-	// URI形式のDSNとmode=rwcを指定して、読み書き可能・作成モードでデータベースを開きます。
-	dsn := fmt.Sprintf("file:%s?mode=rwc", dbPath)
-	conn, err := sql.Open("sqlite", dsn)
+	conn, err := sql.Open("sqlite", dataSourceName(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
@@ -35,12 +45,31 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to read schema.sql: %w", err)
 	}
 
+	// 既存のデータベースには、schema.sql を実行する前に未適用のスキーマの変更を適用します。
+	existing, err := tableExists(conn, "users")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if existing {
+		if err := migrate(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
 	// スキーマを実行してテーブルを作成します。
 	// トランザクション内で実行することもできますが、ここでは単純にExecします。
 	if _, err = conn.Exec(string(schema)); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to execute schema: %w", err)
 	}
+	if !existing {
+		if err := setSchemaVersion(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 
 	fmt.Println("Database initialized successfully with modernc.org/sqlite.")
 	return conn, nil
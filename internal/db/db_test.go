@@ -0,0 +1,176 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// baselineSchema is the schema of databases created before schema migrations were introduced.
+const baselineSchema = `
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    description TEXT,
+    location TEXT,
+    owner_id INTEGER NOT NULL,
+    creator_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE schedule_participants (
+    schedule_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (schedule_id, user_id)
+);`
+
+// legacyStart is the start time of the schedule stored in the baseline database.
+var legacyStart = time.Date(2025, 11, 3, 10, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+
+// createBaseline creates a database file with the baseline schema and a schedule, written without the _time_format DSN option.
+func createBaseline(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schedule.db")
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=rwc")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(baselineSchema); err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+	if _, err := conn.Exec("INSERT INTO users (username, email, password_hash) VALUES ('alice', 'alice@example.com', 'hash')"); err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	if _, err := conn.Exec("INSERT INTO schedules (title, start_time, end_time, owner_id, creator_id) VALUES ('Planning', ?, ?, 1, 1)",
+		legacyStart, legacyStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to insert schedule: %v", err)
+	}
+	if _, err := conn.Exec("INSERT INTO schedule_participants (schedule_id, user_id) VALUES (1, 1)"); err != nil {
+		t.Fatalf("Failed to insert participant: %v", err)
+	}
+	return path
+}
+
+// openDatabase opens a database file with the DSN used by InitDB.
+func openDatabase(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite", dataSourceName(path))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// columnsOf returns the column names of a table.
+func columnsOf(t *testing.T, conn *sql.DB, table string) map[string]bool {
+	t.Helper()
+	rows, err := conn.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("Failed to get columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		columns[name] = true
+	}
+	return columns
+}
+
+func TestMigrate(t *testing.T) {
+	conn := openDatabase(t, createBaseline(t))
+
+	t.Run("Should add the new columns to existing tables", func(t *testing.T) {
+		if err := migrate(conn); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		expected := map[string][]string{
+			"schedules":             {"rrule", "exdates", "series_id", "recurrence_id", "uid", "owner_type", "sequence"},
+			"schedule_participants": {"status", "comment", "responded_at", "direct"},
+			"users":                 {"role", "email_verified_at"},
+		}
+		for table, names := range expected {
+			columns := columnsOf(t, conn, table)
+			for _, name := range names {
+				if !columns[name] {
+					t.Errorf("Expected column %s.%s", table, name)
+				}
+			}
+		}
+		var version int
+		conn.QueryRow("PRAGMA user_version").Scan(&version)
+		if version != len(migrations) {
+			t.Errorf("Expected schema version %d, got %d", len(migrations), version)
+		}
+	})
+
+	t.Run("Should rewrite schedule times for SQLite date functions", func(t *testing.T) {
+		var start time.Time
+		var startEpoch, endEpoch sql.NullInt64
+		if err := conn.QueryRow("SELECT start_time, unixepoch(start_time), unixepoch(end_time) FROM schedules WHERE id = 1").Scan(&start, &startEpoch, &endEpoch); err != nil {
+			t.Fatalf("Failed to get schedule: %v", err)
+		}
+		if !start.Equal(legacyStart) || startEpoch.Int64 != legacyStart.Unix() || endEpoch.Int64 != legacyStart.Add(time.Hour).Unix() {
+			t.Errorf("Unexpected schedule times: %v, %v, %v", start, startEpoch, endEpoch)
+		}
+	})
+
+	t.Run("Should not apply migrations twice", func(t *testing.T) {
+		if _, err := conn.Exec("PRAGMA user_version = 0"); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrate(conn); err != nil {
+			t.Errorf("Expected migrations to skip existing columns, got %v", err)
+		}
+	})
+}
+
+func TestInitDB(t *testing.T) {
+	t.Run("Should upgrade a database created before schema migrations", func(t *testing.T) {
+		conn, err := InitDB(createBaseline(t))
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer conn.Close()
+
+		var title, ownerType, status string
+		var sequence int
+		err = conn.QueryRow(`SELECT s.title, s.owner_type, s.sequence, p.status
+			FROM schedules s JOIN schedule_participants p ON p.schedule_id = s.id
+			WHERE unixepoch(s.start_time) >= ? AND unixepoch(s.end_time) <= ?`,
+			legacyStart.Unix(), legacyStart.Add(time.Hour).Unix()).Scan(&title, &ownerType, &sequence, &status)
+		if err != nil {
+			t.Fatalf("Failed to get migrated schedule: %v", err)
+		}
+		if title != "Planning" || ownerType != "user" || sequence != 0 || status != "needs-action" {
+			t.Errorf("Unexpected migrated schedule: %s, %s, %d, %s", title, ownerType, sequence, status)
+		}
+	})
+
+	t.Run("Should record all migrations as applied for a new database", func(t *testing.T) {
+		conn, err := InitDB(filepath.Join(t.TempDir(), "schedule.db"))
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer conn.Close()
+
+		var version int
+		conn.QueryRow("PRAGMA user_version").Scan(&version)
+		if version != len(migrations) {
+			t.Errorf("Expected schema version %d, got %d", len(migrations), version)
+		}
+	})
+}
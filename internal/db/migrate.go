@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration は既存のデータベースに適用するスキーマの変更1件です。
+type migration struct {
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// migrations は schema.sql の既存のテーブルへの変更を、既存のデータベースに適用する手順です。
+// 適用済みの件数を PRAGMA user_version に記録するため、既存の手順は変更・削除せず、末尾に追加してください。
+// schema.sql の CREATE TABLE にも同じ列を追加し、新しいデータベースは schema.sql のみで最新の状態になるようにします。
+var migrations = []migration{
+	{"add recurrence columns to schedules", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedules",
+			"rrule TEXT NOT NULL DEFAULT ''",
+			"exdates TEXT NOT NULL DEFAULT ''",
+			"series_id INTEGER",
+			"recurrence_id DATETIME")
+	}},
+	{"rewrite schedule times in the SQLite format", rewriteScheduleTimes},
+	{"add the iCalendar UID to schedules", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedules", "uid TEXT NOT NULL DEFAULT ''")
+	}},
+	{"add RSVP columns to schedule participants", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedule_participants",
+			"status TEXT NOT NULL DEFAULT 'needs-action'",
+			"comment TEXT NOT NULL DEFAULT ''",
+			"responded_at DATETIME")
+	}},
+	{"add the owner type to schedules", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedules", "owner_type TEXT NOT NULL DEFAULT 'user'")
+	}},
+	{"mark participants invited through linked groups", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedule_participants", "direct INTEGER NOT NULL DEFAULT 1")
+	}},
+	{"add the role to users", func(tx *sql.Tx) error {
+		return addColumns(tx, "users", "role TEXT NOT NULL DEFAULT 'user'")
+	}},
+	{"add the email verification time to users", func(tx *sql.Tx) error {
+		return addColumns(tx, "users", "email_verified_at DATETIME")
+	}},
+	{"add the actor to notifications", func(tx *sql.Tx) error {
+		return addColumns(tx, "notifications", "actor_id INTEGER")
+	}},
+	{"add the iCalendar sequence to schedules", func(tx *sql.Tx) error {
+		return addColumns(tx, "schedules", "sequence INTEGER NOT NULL DEFAULT 0")
+	}},
+}
+
+// migrate は未適用の手順を順に適用します。手順ごとにトランザクションで実行し、user_version を更新します。
+// schema.sql のインデックスが新しい列を参照するため、schema.sql を実行する前に呼び出してください。
+func migrate(conn *sql.DB) error {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		tx, err := conn.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err := m.apply(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s) failed: %w", i+1, m.description, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to set schema version: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d (%s): %w", i+1, m.description, err)
+		}
+	}
+	return nil
+}
+
+// setSchemaVersion は schema.sql で作成したばかりのデータベースを、すべての手順を適用済みとして記録します。
+func setSchemaVersion(conn *sql.DB) error {
+	if _, err := conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations))); err != nil {
+		return fmt.Errorf("failed to set schema version: %w", err)
+	}
+	return nil
+}
+
+// rowQuerier は *sql.DB と *sql.Tx の共通インターフェースです。
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// tableExists はテーブルが存在するかを返します。
+func tableExists(q rowQuerier, table string) (bool, error) {
+	var n int
+	if err := q.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", table, err)
+	}
+	return n > 0, nil
+}
+
+// addColumns はテーブルに列を追加します。definitions は "名前 型 制約" の形式です。
+// テーブルがない場合 (schema.sql で作成される) と、列が既にある場合は何もしません。
+func addColumns(tx *sql.Tx, table string, definitions ...string) error {
+	exists, err := tableExists(tx, table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during column rows iteration: %w", err)
+	}
+
+	for _, definition := range definitions {
+		var name string
+		fmt.Sscan(definition, &name)
+		if columns[name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, definition)); err != nil {
+			return fmt.Errorf("failed to add column %s to %s: %w", name, table, err)
+		}
+	}
+	return nil
+}
+
+// rewriteScheduleTimes は _time_format=sqlite を指定する前に保存した開始・終了日時 (Go の time.Time.String() の形式) を、
+// unixepoch などの SQLite の日付関数で扱える形式で保存し直します。
+// 期間での検索や重複の判定は unixepoch で比較するため、古い形式のままのスケジュールは検索されません。
+func rewriteScheduleTimes(tx *sql.Tx) error {
+	exists, err := tableExists(tx, "schedules")
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := tx.Query("SELECT id, start_time, end_time FROM schedules WHERE unixepoch(start_time) IS NULL OR unixepoch(end_time) IS NULL")
+	if err != nil {
+		return fmt.Errorf("query for schedule times failed: %w", err)
+	}
+	type scheduleTimes struct {
+		id         int64
+		start, end time.Time
+	}
+	var legacy []scheduleTimes
+	for rows.Next() {
+		var st scheduleTimes
+		if err := rows.Scan(&st.id, &st.start, &st.end); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan schedule times: %w", err)
+		}
+		legacy = append(legacy, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during schedule rows iteration: %w", err)
+	}
+
+	// 接続の DSN の形式 (_time_format=sqlite) で保存し直す
+	for _, st := range legacy {
+		if _, err := tx.Exec("UPDATE schedules SET start_time = ?, end_time = ? WHERE id = ?", st.start, st.end, st.id); err != nil {
+			return fmt.Errorf("failed to rewrite times of schedule %d: %w", st.id, err)
+		}
+	}
+	return nil
+}
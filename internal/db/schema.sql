@@ -4,6 +4,10 @@ CREATE TABLE IF NOT EXISTS users (
     username TEXT NOT NULL UNIQUE,
     email TEXT NOT NULL UNIQUE,
     password_hash TEXT NOT NULL,
+    -- システム全体のロール ('user' または 'admin')。管理者用エンドポイントには 'admin' が必要です。
+    role TEXT NOT NULL DEFAULT 'user',
+    -- メールアドレスを確認した日時。未確認の場合は NULL です。
+    email_verified_at DATETIME,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -15,18 +19,37 @@ CREATE TABLE IF NOT EXISTS schedules (
     end_time DATETIME NOT NULL,
     description TEXT,
     location TEXT,
-    owner_id INTEGER NOT NULL, -- このスケジュールが属するカレンダーの所有者
+    owner_id INTEGER NOT NULL, -- このスケジュールが属するカレンダーの所有者 (ユーザーIDまたはグループID)
+    owner_type TEXT NOT NULL DEFAULT 'user', -- 所有者の種類 (user: ユーザーのカレンダー, group: グループのカレンダー)
     creator_id INTEGER NOT NULL, -- このスケジュールを作成したユーザー
+    uid TEXT NOT NULL DEFAULT '', -- iCalendar の UID (単一発生の変更は系列と同じ UID を持つ)
+    rrule TEXT NOT NULL DEFAULT '', -- 繰り返しルール (RFC 5545 RRULE)。空文字列は単発の予定
+    exdates TEXT NOT NULL DEFAULT '', -- 除外する発生の開始日時 (EXDATE, RFC 3339 のカンマ区切り)
+    series_id INTEGER, -- 元になった繰り返しスケジュール (単一発生の変更、または分割された系列)
+    recurrence_id DATETIME, -- 単一発生の変更の場合、元の発生の開始日時 (RECURRENCE-ID)
+    sequence INTEGER NOT NULL DEFAULT 0, -- iCalendar の SEQUENCE (参加者に招待の更新を送る変更ごとに増加)
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (owner_id) REFERENCES users(id),
-    FOREIGN KEY (creator_id) REFERENCES users(id)
+    FOREIGN KEY (creator_id) REFERENCES users(id),
+    FOREIGN KEY (series_id) REFERENCES schedules(id)
 );
 
+-- 所有者ごとの期間検索・ページネーション用インデックス
+-- 日時はタイムゾーン付きで保存されるため、unixepoch() の式インデックスで比較します。
+CREATE INDEX IF NOT EXISTS idx_schedules_owner_start ON schedules(owner_type, owner_id, rrule, unixepoch(start_time), id);
+CREATE INDEX IF NOT EXISTS idx_schedules_owner_end ON schedules(owner_type, owner_id, unixepoch(end_time));
+CREATE INDEX IF NOT EXISTS idx_schedules_series ON schedules(series_id);
+-- 所有者のカレンダー内で UID (単一発生の変更は UID と RECURRENCE-ID の組) は一意
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schedules_owner_uid ON schedules(owner_type, owner_id, uid, ifnull(unixepoch(recurrence_id), 0)) WHERE uid != '';
+
 -- スケジュール参加者テーブル (多対多)
 CREATE TABLE IF NOT EXISTS schedule_participants (
     schedule_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'needs-action', -- 出欠の回答 (needs-action, accepted, declined, tentative)
+    comment TEXT NOT NULL DEFAULT '', -- 回答に添えるコメント
+    responded_at DATETIME, -- 回答日時 (未回答の場合は NULL)
+    direct INTEGER NOT NULL DEFAULT 1, -- 個別に招待された参加者は 1、リンクしたグループのメンバーとしてのみ参加している場合は 0
     PRIMARY KEY (schedule_id, user_id),
     FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -38,4 +61,375 @@ AFTER UPDATE ON schedules
 FOR EACH ROW
 BEGIN
     UPDATE schedules SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.id;
-END;
\ No newline at end of file
+END;
+
+-- カレンダー購読用フィードトークンテーブル
+-- ユーザーごとに1つ。トークン自体は保存せず、SHA-256 ハッシュのみを保存します。
+CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+    user_id INTEGER PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- ログインセッションテーブル
+-- アクセストークン (JWT) の jti にセッションIDを設定し、ログアウトしたセッションのトークンを拒否します。
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+-- リフレッシュトークンテーブル
+-- リフレッシュのたびに新しいトークンを発行し、古いトークンは使用済みにします (ローテーション)。
+-- 使用済みのトークンが再び使われた場合は漏洩とみなし、セッションを無効にします。
+-- トークン自体は保存せず、SHA-256 ハッシュのみを保存します。
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session ON refresh_tokens(session_id);
+
+-- パーソナルアクセストークンテーブル
+-- スクリプトや外部サービスから API を呼び出すための、ユーザーが発行するトークンです。Authorization ヘッダーで JWT の代わりに使用できます。
+-- トークン自体は保存せず、SHA-256 ハッシュと、トークンを見分けるための先頭の数文字のみを保存します。
+-- scopes は許可する操作 (read, write, admin) を空白で区切ったものです。expires_at が NULL のトークンは期限切れになりません。
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id);
+
+-- アカウント用トークンテーブル (メールアドレスの確認・パスワードの再設定)
+-- メールで送信する1回限りのトークンです。トークン自体は保存せず、SHA-256 ハッシュのみを保存します。
+-- email は発行時のメールアドレスで、その後メールアドレスが変わった場合はメールアドレスの確認に使用できません。
+CREATE TABLE IF NOT EXISTS account_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    purpose TEXT NOT NULL, -- verify_email, reset_password
+    email TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_id, purpose);
+
+-- ログイン失敗の記録テーブル (総当たり攻撃の対策)
+-- スライディングウィンドウ内の失敗回数を、アカウント (小文字のメールアドレス) とクライアントIPごとに数えます。
+CREATE TABLE IF NOT EXISTS login_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope TEXT NOT NULL, -- account, ip
+    identifier TEXT NOT NULL,
+    failed_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_identifier ON login_failures(scope, identifier, unixepoch(failed_at));
+
+-- ログインの一時的なロックテーブル
+-- lockouts は連続したロックの回数で、ロックの期間はロックのたびに倍になります (指数バックオフ)。
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    scope TEXT NOT NULL, -- account, ip
+    identifier TEXT NOT NULL,
+    locked_until DATETIME NOT NULL,
+    lockouts INTEGER NOT NULL,
+    PRIMARY KEY (scope, identifier)
+);
+
+-- ログインの監査ログテーブル
+CREATE TABLE IF NOT EXISTS login_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event TEXT NOT NULL, -- success, failure, lockout, blocked
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_id INTEGER,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_audit_log_created ON login_audit_log(unixepoch(created_at));
+
+-- 二要素認証 (TOTP) の設定テーブル
+-- enabled_at が NULL の間は登録中で、認証アプリのコードを1回確認すると有効になります。
+-- secret はコードの計算に必要なため、ハッシュ化せずに保存します。
+-- last_used_step は最後に使用したコードのタイムステップで、同じコードの再利用を防ぎます。
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id INTEGER PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled_at DATETIME,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 二要素認証のリカバリーコードテーブル
+-- 認証アプリを使えない場合に、コードの代わりに1回だけ使用できます。SHA-256 ハッシュのみを保存します。
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+-- 二要素認証のチャレンジテーブル
+-- パスワードの確認後に発行する短期間のトークンで、コードとともに送信するとログインが完了します。
+-- attempts はコードを間違えた回数で、上限に達したチャレンジは使用できません。
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 外部IDプロバイダー (OpenID Connect) のアカウントとの紐付けテーブル
+-- issuer と sub (プロバイダー内で一意なユーザーID) の組でユーザーを識別します。
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- OpenID Connect ログインの認可リクエストの状態テーブル
+-- コールバックで state を照合し、nonce と PKCE のコード検証子を取り出します。1回のみ使用できます。
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- カレンダーの共有設定テーブル
+-- 所有者のカレンダーへのアクセス権 (free-busy < read < write < manage) を他のユーザーまたはグループに付与します。
+-- グループに付与した権限は、そのグループのメンバー全員に適用されます。
+-- 所有者自身は常に manage 権限を持ちます。
+CREATE TABLE IF NOT EXISTS calendar_shares (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL, -- 共有するカレンダーの所有者
+    grantee_type TEXT NOT NULL DEFAULT 'user', -- 共有先の種類 (user, group)
+    grantee_id INTEGER NOT NULL, -- 共有先のID
+    permission TEXT NOT NULL, -- free-busy, read, write, manage
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_id, grantee_type, grantee_id),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_calendar_shares_grantee ON calendar_shares(grantee_type, grantee_id);
+
+-- グループテーブル
+-- グループは共有のカレンダーを持ち、メンバーは role に応じてグループのカレンダーを編集・管理できます。
+CREATE TABLE IF NOT EXISTS groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- グループメンバーテーブル (多対多)
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member', -- owner, admin, member
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);
+
+-- スケジュールにリンクしたグループ (参加者として招待したグループ)
+-- リンクしたグループのメンバーは schedule_participants に direct = 0 で追加され、
+-- グループへの参加・脱退にあわせて追加・削除されます。
+CREATE TABLE IF NOT EXISTS schedule_participant_groups (
+    schedule_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    PRIMARY KEY (schedule_id, group_id),
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_schedule_participant_groups_group ON schedule_participant_groups(group_id);
+
+-- リマインダーの設定テーブル
+-- default_reminders はスケジュールごとのリマインダーを設定していないスケジュールに適用するリマインダーで、
+-- 「チャネル:何分前」を空白区切りで保存します (例: "email:10 in_app:60")。
+-- webhook_url は webhook チャネルのリマインダーの送信先です。
+CREATE TABLE IF NOT EXISTS reminder_settings (
+    user_id INTEGER PRIMARY KEY,
+    default_reminders TEXT NOT NULL DEFAULT '',
+    webhook_url TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- スケジュールごとのリマインダーテーブル
+-- ユーザーがスケジュールに設定したリマインダーで、既定のリマインダーの代わりに使用します (空の場合はリマインダーなし)。
+-- 形式は reminder_settings.default_reminders と同じです。
+CREATE TABLE IF NOT EXISTS schedule_reminders (
+    schedule_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    reminders TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (schedule_id, user_id),
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_schedule_reminders_user ON schedule_reminders(user_id);
+
+-- リマインダーの送信記録テーブル
+-- 送信する前に行を追加し、主キーの重複で同じリマインダーが2回送信されないようにします (再起動後も有効)。
+-- occurrence_start は発生の開始日時 (Unix 時間) です。status は pending, sent, failed のいずれかです。
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    schedule_id INTEGER NOT NULL,
+    occurrence_start INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    channel TEXT NOT NULL,
+    minutes_before INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME,
+    PRIMARY KEY (schedule_id, occurrence_start, user_id, channel, minutes_before)
+);
+
+-- アプリ内通知テーブル
+-- リマインダー (in_app チャネル) と、他のユーザーによるスケジュールの作成・更新・削除・出欠の回答を通知します。
+-- actor_id は通知のきっかけとなる操作をしたユーザーです (リマインダーの場合は NULL)。
+-- read_at は既読にした日時です (未読の場合は NULL)。
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL, -- reminder, schedule_created, schedule_updated, schedule_deleted, rsvp
+    schedule_id INTEGER,
+    actor_id INTEGER,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    read_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);
+
+-- webhook の購読テーブル
+-- scope が user の購読は、登録したユーザーが閲覧できるカレンダーの変更のみを受信します。all の購読 (管理者が登録) はすべての変更を受信します。
+-- secret はペイロードの HMAC-SHA256 署名の鍵です。署名に使用するため、ハッシュではなくそのまま保存します。
+-- event_types は受信するイベントの種類 (スペース区切り) で、空の場合はすべての種類を受信します。
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    scope TEXT NOT NULL, -- user, all
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_user ON webhook_subscriptions(user_id);
+
+-- 招待メール (iMIP) の送信キューテーブル
+-- スケジュールの作成・更新・削除のたびに宛先ごとに1行を追加し、ワーカーが next_attempt_at を過ぎた pending の行を送信します。
+-- 削除したスケジュールの取り消しも送信するため、schedules への外部キーは設定しません。
+-- status は pending, sent, failed のいずれかです。last_error は最後に失敗した送信のエラーです。
+CREATE TABLE IF NOT EXISTS invitation_emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    method TEXT NOT NULL, -- iTIP のメソッド (REQUEST, CANCEL)
+    calendar TEXT NOT NULL, -- text/calendar のパート
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitation_emails_due ON invitation_emails(status, next_attempt_at);
+
+-- アカウントのメール (パスワードの再設定など) の送信キューテーブル
+-- リクエストの処理中にメールサーバーへ接続しないよう1通ごとに1行を追加し、ワーカーが next_attempt_at を過ぎた pending の行を送信します。
+-- 本文にはトークンを含むリンクがあるため、送信済み・失敗にした時点で body を消去します。
+-- expires_at を過ぎたメールは (リンクが無効なため) 送信せずに failed にします。
+-- status は pending, sent, failed のいずれかです。last_error は最後に失敗した送信のエラーです。
+CREATE TABLE IF NOT EXISTS outbox_emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME,
+    expires_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_emails_due ON outbox_emails(status, next_attempt_at);
+
+-- webhook の配信キューテーブル
+-- イベントごと・購読ごとに1行を追加し、ワーカーが next_attempt_at を過ぎた pending の行を送信します。
+-- 送信中の行は next_attempt_at を先に延ばして確保するため、送信中にプロセスが終了した場合も後で再送信します。
+-- status は pending, succeeded, failed のいずれかです。attempts は再送信 (redeliver) 以降の試行回数です。
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+
+-- webhook の送信ログテーブル (送信の試行ごとに1行)
+-- status_code は応答のステータスコードです (接続できなかった場合は NULL)。
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id);
@@ -0,0 +1,136 @@
+// Package events はスケジュールの変更をプロセス内の購読者に配信する pub/sub のハブを提供します。
+// 直近のイベントを保持するため、切断したクライアントは最後に受信したイベントのIDから再開できます。
+package events
+
+import (
+	"fmt"
+	"schedule-app/internal/model"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer は購読者ごとに配信を待てるイベントの件数です。
+// これを超えて受信が遅れた購読者は購読を解除します (クライアントは再接続して再開します)。
+const subscriberBuffer = 64
+
+// entry はハブが保持するイベントと、その通し番号です。
+type entry struct {
+	seq   int64
+	event *model.ScheduleEvent
+}
+
+// Hub は発行されたイベントをすべての購読者に配信します。
+// イベントIDは "<ハブの起動時刻>-<通し番号>" の形式で、プロセスの再起動をまたいで重複しません。
+type Hub struct {
+	mu          sync.Mutex
+	epoch       int64
+	seq         int64
+	history     []entry // 古い順、最大 historySize 件
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub は直近の historySize 件のイベントを再開のために保持する Hub を生成します。
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		epoch:       time.Now().UnixNano(),
+		historySize: historySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription はハブの購読です。Events からイベントを受信し、不要になったら Close を呼び出します。
+type Subscription struct {
+	hub    *Hub
+	events chan *model.ScheduleEvent
+}
+
+// Events は発行されたイベントを受信するチャネルを返します。
+// 受信が遅れて購読が解除された場合、チャネルは閉じられます。
+func (s *Subscription) Events() <-chan *model.ScheduleEvent {
+	return s.events
+}
+
+// Close は購読を解除します。
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish はイベントにIDを割り当て、すべての購読者に配信します。発行後のイベントは変更しないでください。
+func (h *Hub) Publish(e *model.ScheduleEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.ID = fmt.Sprintf("%d-%d", h.epoch, h.seq)
+	h.history = append(h.history, entry{seq: h.seq, event: e})
+	if len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+
+	for s := range h.subscribers {
+		select {
+		case s.events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribe は購読を開始します。lastEventID が指定された場合は、そのイベントより後に発行されたイベントを missed として返します。
+// lastEventID が古すぎて保持していない場合や、再起動前のイベントの場合は resumed が false になり、
+// 購読者は表示中のデータを取得し直す必要があります。
+func (h *Hub) Subscribe(lastEventID string) (sub *Subscription, missed []*model.ScheduleEvent, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{hub: h, events: make(chan *model.ScheduleEvent, subscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	seq, ok := h.parseID(lastEventID)
+	if !ok || seq > h.seq {
+		return sub, nil, false
+	}
+	// 保持している最も古いイベントより前のイベントが失われていないか確認
+	oldest := h.seq + 1
+	if len(h.history) > 0 {
+		oldest = h.history[0].seq
+	}
+	if seq < oldest-1 {
+		return sub, nil, false
+	}
+	for _, e := range h.history {
+		if e.seq > seq {
+			missed = append(missed, e.event)
+		}
+	}
+	return sub, missed, true
+}
+
+// parseID はこのハブが発行したイベントIDから通し番号を取り出します。
+func (h *Hub) parseID(id string) (int64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != strconv.FormatInt(h.epoch, 10) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// remove は購読を解除してチャネルを閉じます。h.mu を保持して呼び出します。
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,123 @@
+// Package freebusy は予定の時間帯から空き時間・埋まっている時間を計算します。
+package freebusy
+
+import (
+	"schedule-app/internal/model"
+	"sort"
+	"time"
+)
+
+// Merge は時間帯を期間 [from, to) に切り詰め、重なる・隣接する時間帯を結合して開始日時の順に返します。
+// 長さが0の時間帯は含めません。
+func Merge(intervals []model.BusyInterval, from, to time.Time) []model.BusyInterval {
+	clipped := make([]model.BusyInterval, 0, len(intervals))
+	for _, iv := range intervals {
+		if iv.Start.Before(from) {
+			iv.Start = from
+		}
+		if iv.End.After(to) {
+			iv.End = to
+		}
+		if iv.End.After(iv.Start) {
+			clipped = append(clipped, model.BusyInterval{Start: iv.Start.UTC(), End: iv.End.UTC()})
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool {
+		return clipped[i].Start.Before(clipped[j].Start)
+	})
+
+	merged := []model.BusyInterval{}
+	for _, iv := range clipped {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// WorkingHours は候補とする曜日と時間帯です。Start と End は Location における 0:00 からの経過時間です。
+type WorkingHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Days     map[time.Weekday]bool
+	Location *time.Location
+}
+
+// SuggestOptions は Suggest の検索条件です。
+type SuggestOptions struct {
+	From         time.Time
+	To           time.Time
+	Duration     time.Duration
+	Step         time.Duration
+	WorkingHours WorkingHours
+	MinAttendees int
+	Limit        int
+}
+
+// Suggest は期間内の勤務時間から、少なくとも MinAttendees 人のユーザーが空いている長さ Duration の時間帯を探します。
+// 候補の開始日時は各日の勤務開始から Step ごとに並べ、空いているユーザーが多い順、開始日時の早い順に最大 Limit 件を返します。
+// busy はユーザーIDごとの埋まっている時間帯です (結合されていなくても構いません)。
+func Suggest(userIDs []int64, busy map[int64][]model.BusyInterval, opts SuggestOptions) []*model.SuggestedSlot {
+	merged := make(map[int64][]model.BusyInterval, len(userIDs))
+	for _, id := range userIDs {
+		merged[id] = Merge(busy[id], opts.From, opts.To)
+	}
+
+	var slots []*model.SuggestedSlot
+	wh := opts.WorkingHours
+	from := opts.From.In(wh.Location)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, wh.Location)
+	for ; day.Before(opts.To); day = day.AddDate(0, 0, 1) {
+		if !wh.Days[day.Weekday()] {
+			continue
+		}
+		// 夏時間の切り替えに対応するため、時刻は日付ごとに組み立てる
+		dayStart := localTime(day, wh.Start)
+		dayEnd := localTime(day, wh.End)
+		for start := dayStart; !start.Add(opts.Duration).After(dayEnd); start = start.Add(opts.Step) {
+			end := start.Add(opts.Duration)
+			if start.Before(opts.From) || end.After(opts.To) {
+				continue
+			}
+			slot := &model.SuggestedSlot{Start: start.UTC(), End: end.UTC(), AvailableUserIDs: []int64{}, UnavailableUserIDs: []int64{}}
+			for _, id := range userIDs {
+				if isFree(merged[id], start, end) {
+					slot.AvailableUserIDs = append(slot.AvailableUserIDs, id)
+				} else {
+					slot.UnavailableUserIDs = append(slot.UnavailableUserIDs, id)
+				}
+			}
+			slot.AttendeeCount = len(slot.AvailableUserIDs)
+			if slot.AttendeeCount >= opts.MinAttendees {
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].AttendeeCount != slots[j].AttendeeCount {
+			return slots[i].AttendeeCount > slots[j].AttendeeCount
+		}
+		return slots[i].Start.Before(slots[j].Start)
+	})
+	if opts.Limit > 0 && len(slots) > opts.Limit {
+		slots = slots[:opts.Limit]
+	}
+	return slots
+}
+
+// localTime は日付 day (0:00) から offset 経過した壁時計の時刻を返します。
+func localTime(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, day.Location())
+}
+
+// isFree は結合済みの時間帯 busy が [start, end) と重ならないかを判定します。
+func isFree(busy []model.BusyInterval, start, end time.Time) bool {
+	// start より後に終わる最初の時間帯だけを調べればよい
+	i := sort.Search(len(busy), func(i int) bool { return busy[i].End.After(start) })
+	return i == len(busy) || !busy[i].Start.Before(end)
+}
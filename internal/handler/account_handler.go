@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"schedule-app/internal/mail"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// emailVerificationTTL はメールアドレスの確認トークンの有効期間です。
+	emailVerificationTTL = 24 * time.Hour
+	// passwordResetTTL はパスワード再設定トークンの有効期間です。
+	passwordResetTTL = time.Hour
+	// mailSendTimeout はメール1通の送信にかける時間の上限です。
+	mailSendTimeout = 30 * time.Second
+)
+
+// AccountHandler はメールアドレスの確認とパスワードの再設定を処理します。
+// 1回限りのトークンを含むリンクをメールで送信し、そのトークンで確認・再設定を行います。
+type AccountHandler struct {
+	userRepo  *repository.UserRepository
+	tokenRepo *repository.AccountTokenRepository
+	mailer    mail.Sender
+	outbox    *repository.OutboxRepository
+	throttle  *repository.LoginThrottleRepository
+	baseURL   string
+}
+
+// NewAccountHandler は AccountHandler の新しいインスタンスを生成します。
+// mailer は確認メールをすぐに送信し、パスワード再設定のメールは outbox の送信キューに追加します。
+// baseURL はメールに記載するリンクのベースURL (例: https://schedule.example.com) です。
+func NewAccountHandler(userRepo *repository.UserRepository, tokenRepo *repository.AccountTokenRepository, mailer mail.Sender, outbox *repository.OutboxRepository, throttle *repository.LoginThrottleRepository, baseURL string) *AccountHandler {
+	return &AccountHandler{userRepo: userRepo, tokenRepo: tokenRepo, mailer: mailer, outbox: outbox, throttle: throttle, baseURL: baseURL}
+}
+
+// SendVerificationEmail はユーザーのメールアドレスに確認用のリンクを送信します。ユーザー登録時にも使用します。
+func (h *AccountHandler) SendVerificationEmail(ctx context.Context, user *model.User) error {
+	token, err := h.tokenRepo.Create(user, model.TokenPurposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := h.link("verify_email_token", token)
+	return h.send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in 24 hours. If you did not create an account, you can ignore this email.\n",
+			user.Username, link),
+	})
+}
+
+// RequestEmailVerification はログイン中のユーザーに確認メールを再送信します。
+func (h *AccountHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	user, err := h.userRepo.FindUserByID(userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: Failed to find user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to send verification email")
+		}
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		errorJSON(w, http.StatusConflict, "Email address is already verified")
+		return
+	}
+
+	if err := h.SendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("ERROR: Failed to send verification email to user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, nil)
+}
+
+// VerifyEmail は確認メールのトークンでメールアドレスを確認済みにします。認証は不要です。
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req model.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := h.tokenRepo.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidAccountToken) {
+			errorJSON(w, http.StatusBadRequest, "Invalid or expired token")
+		} else {
+			log.Printf("ERROR: Failed to verify email: %v", err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to verify email")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, user.ToUserResponse())
+}
+
+// RequestPasswordReset はメールアドレスにパスワード再設定用のリンクを送信します。認証は不要です。
+// 登録されているメールアドレスかどうかを推測されないよう、ユーザーが存在しない場合やエラーの場合も同じ応答 (202) を返します。
+// メールは送信キューに追加して Worker が送信するため、応答時間もメールサーバーの状態や登録の有無に左右されません。
+// 要求の回数はメールアドレスごととクライアントIPごとに制限します。
+func (h *AccountHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if !emailRegex.MatchString(req.Email) {
+		errorJSON(w, http.StatusBadRequest, "Invalid email format")
+		return
+	}
+
+	err := h.throttle.RecordPasswordResetRequest(req.Email, middleware.ClientIP(r))
+	var throttled *model.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(throttled.RetryAfterSeconds()))
+		errorJSON(w, http.StatusTooManyRequests, "Too many password reset requests. Please try again later.")
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to record password reset request: %v", err)
+	}
+
+	if err := h.queuePasswordReset(req.Email); err != nil {
+		log.Printf("ERROR: Failed to queue password reset email: %v", err)
+	}
+	writeJSON(w, http.StatusAccepted, nil)
+}
+
+// queuePasswordReset は email のユーザーのパスワード再設定トークンを作成し、リンクを含むメールを送信キューに追加します。
+// メールはトークンの有効期限までに送信できなければ送信しません。ユーザーが存在しない場合は何もしません。
+func (h *AccountHandler) queuePasswordReset(email string) error {
+	user, err := h.userRepo.FindUserByEmail(email)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+
+	expiresAt := time.Now().Add(passwordResetTTL)
+	token, err := h.tokenRepo.Create(user, model.TokenPurposeResetPassword, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return h.outbox.Enqueue(&model.OutboxEmail{
+		Recipient: user.Email,
+		Subject:   "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"We received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in 1 hour and can be used only once. If you did not request a password reset, you can ignore this email.\n",
+			user.Username, h.link("reset_password_token", token)),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ResetPassword はパスワード再設定メールのトークンで新しいパスワードを設定します。認証は不要です。
+// ユーザーのすべてのセッションはログアウトされます。
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		errorJSON(w, http.StatusBadRequest, "Password must be at least 8 characters long")
+		return
+	}
+
+	if _, err := h.tokenRepo.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, repository.ErrInvalidAccountToken) {
+			errorJSON(w, http.StatusBadRequest, "Invalid or expired token")
+		} else {
+			log.Printf("ERROR: Failed to reset password: %v", err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to reset password")
+		}
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// link はトークンを含む Web 画面へのリンクを返します。
+func (h *AccountHandler) link(param, token string) string {
+	return h.baseURL + "/?" + url.Values{param: {token}}.Encode()
+}
+
+// send はメールを送信します。クライアントが切断しても送信を続けるよう、リクエストのキャンセルは引き継ぎません。
+func (h *AccountHandler) send(ctx context.Context, msg *mail.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailSendTimeout)
+	defer cancel()
+	return h.mailer.Send(ctx, msg)
+}
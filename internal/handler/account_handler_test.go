@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"schedule-app/internal/accountmail"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// mailTokenRegex extracts the token from a link in an account email.
+var mailTokenRegex = regexp.MustCompile(`\?(verify_email_token|reset_password_token)=([A-Za-z0-9_-]+)`)
+
+func TestAccountHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+	// Run the worker a little ahead of the wall clock so that queued password reset emails are due immediately,
+	// but well before their links expire.
+	server.clock.Set(time.Now().Add(time.Minute))
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	// forgot requests a password reset from the given client IP and returns the status and the Retry-After header.
+	forgot := func(ip, email string) (int, string) {
+		req, _ := http.NewRequest("POST", "/api/users/forgot-password", bytes.NewBufferString(fmt.Sprintf(`{"email": "%s"}`, email)))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":12345"
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Header().Get("Retry-After")
+	}
+	// lastToken sends the queued emails and returns the recipient of the most recent email and the token in its link.
+	lastToken := func(t *testing.T, param string) (to, token string) {
+		t.Helper()
+		if _, err := server.accountMail.RunOnce(context.Background()); err != nil {
+			t.Fatalf("Failed to send queued emails: %v", err)
+		}
+		messages := server.outbox.Messages()
+		if len(messages) == 0 {
+			t.Fatal("Expected an email to be sent")
+		}
+		msg := messages[len(messages)-1]
+		m := mailTokenRegex.FindStringSubmatch(msg.Body)
+		if m == nil || m[1] != param {
+			t.Fatalf("Expected a link with %s in the email, got: %s", param, msg.Body)
+		}
+		return msg.To, m[2]
+	}
+	verify := func(token string) (int, model.UserResponse) {
+		code, body := send("POST", "/api/users/verify-email", "", fmt.Sprintf(`{"token": "%s"}`, token))
+		var user model.UserResponse
+		json.Unmarshal([]byte(body), &user)
+		return code, user
+	}
+	reset := func(token, password string) int {
+		code, _ := send("POST", "/api/users/reset-password", "", fmt.Sprintf(`{"token": "%s", "password": "%s"}`, token, password))
+		return code
+	}
+
+	// --- Test Cases ---
+	t.Run("Should send a verification email on registration", func(t *testing.T) {
+		code, body := send("POST", "/api/users/register", "", `{"username": "alice", "email": "alice@example.com", "password": "password123"}`)
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to register: %s", body)
+		}
+		var user model.UserResponse
+		json.Unmarshal([]byte(body), &user)
+		if user.EmailVerified {
+			t.Error("Expected a new user's email to be unverified")
+		}
+
+		to, token := lastToken(t, "verify_email_token")
+		if to != "alice@example.com" {
+			t.Errorf("Expected the email to be sent to alice@example.com, got %s", to)
+		}
+		code, user = verify(token)
+		if code != http.StatusOK || !user.EmailVerified {
+			t.Fatalf("Expected the email to be verified, got %d %+v", code, user)
+		}
+		if code, _ := verify(token); code != http.StatusBadRequest {
+			t.Errorf("Expected a used token to be rejected with %d, got %d", http.StatusBadRequest, code)
+		}
+
+		aliceToken := loginUser(t, server, "alice@example.com", "password123")
+		if code, _ := send("POST", "/api/users/verify-email/send", aliceToken, ""); code != http.StatusConflict {
+			t.Errorf("Expected %d when the email is already verified, got %d", http.StatusConflict, code)
+		}
+	})
+
+	t.Run("Should only accept the latest verification link", func(t *testing.T) {
+		createUser(t, server, "bob", "bob@example.com", "password123")
+		_, first := lastToken(t, "verify_email_token")
+		bobToken := loginUser(t, server, "bob@example.com", "password123")
+		if code, body := send("POST", "/api/users/verify-email/send", bobToken, ""); code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, code, body)
+		}
+		_, second := lastToken(t, "verify_email_token")
+
+		if code, _ := verify(first); code != http.StatusBadRequest {
+			t.Errorf("Expected a superseded token to be rejected, got %d", code)
+		}
+		if code, user := verify(second); code != http.StatusOK || !user.EmailVerified {
+			t.Errorf("Expected the latest token to verify the email, got %d %+v", code, user)
+		}
+		if code, _ := send("POST", "/api/users/verify-email/send", "", ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected %d without a token, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("Should not reveal whether an email is registered", func(t *testing.T) {
+		sent := len(server.outbox.Messages())
+		if code, _ := send("POST", "/api/users/forgot-password", "", `{"email": "nobody@example.com"}`); code != http.StatusAccepted {
+			t.Errorf("Expected status %d, got %d", http.StatusAccepted, code)
+		}
+		if _, err := server.accountMail.RunOnce(context.Background()); err != nil {
+			t.Fatalf("Failed to send queued emails: %v", err)
+		}
+		if len(server.outbox.Messages()) != sent {
+			t.Error("Expected no email to be sent for an unknown address")
+		}
+		if code, _ := send("POST", "/api/users/forgot-password", "", `{"email": "not-an-email"}`); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("Should reset the password and log out all sessions", func(t *testing.T) {
+		aliceToken := loginUser(t, server, "alice@example.com", "password123")
+		if code, _ := send("POST", "/api/users/forgot-password", "", `{"email": "alice@example.com"}`); code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, code)
+		}
+		to, token := lastToken(t, "reset_password_token")
+		if to != "alice@example.com" {
+			t.Errorf("Expected the email to be sent to alice@example.com, got %s", to)
+		}
+
+		if code := reset(token, "short"); code != http.StatusBadRequest {
+			t.Errorf("Expected a short password to be rejected with %d, got %d", http.StatusBadRequest, code)
+		}
+		if code := reset(token, "new-password456"); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+		if code := reset(token, "another-password789"); code != http.StatusBadRequest {
+			t.Errorf("Expected a used token to be rejected with %d, got %d", http.StatusBadRequest, code)
+		}
+
+		if code, _ := send("GET", "/api/groups", aliceToken, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected existing sessions to be revoked, got %d", code)
+		}
+		if code, _ := send("POST", "/api/users/login", "", `{"email": "alice@example.com", "password": "password123"}`); code != http.StatusUnauthorized {
+			t.Errorf("Expected the old password to be rejected, got %d", code)
+		}
+		loginUser(t, server, "alice@example.com", "new-password456")
+	})
+
+	t.Run("Should verify the email with a password reset", func(t *testing.T) {
+		createUser(t, server, "carol", "carol@example.com", "password123")
+		send("POST", "/api/users/forgot-password", "", `{"email": "carol@example.com"}`)
+		_, token := lastToken(t, "reset_password_token")
+		if code := reset(token, "new-password456"); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+
+		var verified bool
+		server.db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE email = ?", "carol@example.com").Scan(&verified)
+		if !verified {
+			t.Error("Expected the email to be verified after a password reset")
+		}
+	})
+
+	t.Run("Should reject expired tokens and tokens for another purpose", func(t *testing.T) {
+		send("POST", "/api/users/forgot-password", "", `{"email": "bob@example.com"}`)
+		_, token := lastToken(t, "reset_password_token")
+		if code, _ := verify(token); code != http.StatusBadRequest {
+			t.Errorf("Expected a password reset token to be rejected for email verification, got %d", code)
+		}
+
+		if _, err := server.db.Exec("UPDATE account_tokens SET expires_at = '2000-01-01 00:00:00' WHERE used_at IS NULL"); err != nil {
+			t.Fatalf("Failed to expire tokens: %v", err)
+		}
+		if code := reset(token, "new-password456"); code != http.StatusBadRequest {
+			t.Errorf("Expected an expired token to be rejected with %d, got %d", http.StatusBadRequest, code)
+		}
+		if code := reset("unknown-token", "new-password456"); code != http.StatusBadRequest {
+			t.Errorf("Expected an unknown token to be rejected with %d, got %d", http.StatusBadRequest, code)
+		}
+		loginUser(t, server, "bob@example.com", "password123")
+	})
+
+	// queued returns the state of the most recent email queued for the recipient.
+	queued := func(t *testing.T, recipient string) (status string, attempts int, body string, retry bool, lastError string) {
+		t.Helper()
+		err := server.db.QueryRow("SELECT status, attempts, body, next_attempt_at IS NOT NULL, last_error FROM outbox_emails WHERE recipient = ? ORDER BY id DESC LIMIT 1",
+			recipient).Scan(&status, &attempts, &body, &retry, &lastError)
+		if err != nil {
+			t.Fatalf("Failed to get queued email: %v", err)
+		}
+		return status, attempts, body, retry, lastError
+	}
+
+	t.Run("Should clear the body of sent emails", func(t *testing.T) {
+		var sent, withBody int
+		server.db.QueryRow("SELECT COUNT(*), COUNT(NULLIF(body, '')) FROM outbox_emails WHERE status = ?", model.InvitationSent).Scan(&sent, &withBody)
+		if sent == 0 || withBody != 0 {
+			t.Errorf("Expected the sent emails to have no body, got %d of %d", withBody, sent)
+		}
+		var invitations int
+		server.db.QueryRow("SELECT COUNT(*) FROM invitation_emails").Scan(&invitations)
+		if invitations != 0 {
+			t.Errorf("Expected no account emails in the invitation queue, got %d", invitations)
+		}
+	})
+
+	t.Run("Should not retry a reset email after its link expires", func(t *testing.T) {
+		createUser(t, server, "erin", "erin@example.com", "password123")
+		// A worker on the same queue whose mail server is down
+		failing := accountmail.NewWorker(repository.NewOutboxRepository(server.db), failingMailer{}, server.clock, time.Minute)
+		start := server.clock.Now()
+
+		forgot("198.51.100.200", "erin@example.com")
+		if sent, err := failing.RunOnce(context.Background()); sent != 0 || err != nil {
+			t.Fatalf("Expected the email to fail, got %d sent: %v", sent, err)
+		}
+		if status, attempts, body, retry, _ := queued(t, "erin@example.com"); status != string(model.InvitationPending) || attempts != 1 || body == "" || !retry {
+			t.Fatalf("Expected a retry after the first failure, got %s %d %v", status, attempts, retry)
+		}
+
+		// The next retry would be after the link expires
+		server.clock.Set(start.Add(passwordResetTTL - time.Minute - 30*time.Second))
+		failing.RunOnce(context.Background())
+		if status, attempts, body, retry, _ := queued(t, "erin@example.com"); status != string(model.InvitationFailed) || attempts != 2 || body != "" || retry {
+			t.Errorf("Expected the email to fail without a retry and without its body, got %s %d %q %v", status, attempts, body, retry)
+		}
+
+		// An email that is due only after its link expired is not sent
+		server.clock.Set(start)
+		forgot("198.51.100.201", "erin@example.com")
+		server.clock.Set(start.Add(passwordResetTTL))
+		messages := len(server.outbox.Messages())
+		if sent, err := server.accountMail.RunOnce(context.Background()); sent != 0 || err != nil || len(server.outbox.Messages()) != messages {
+			t.Errorf("Expected the expired email not to be sent, got %d sent: %v", sent, err)
+		}
+		if status, _, body, retry, lastError := queued(t, "erin@example.com"); status != string(model.InvitationFailed) || body != "" || retry || lastError != accountmail.ErrExpired.Error() {
+			t.Errorf("Expected the expired email to fail, got %s %q %v %q", status, body, retry, lastError)
+		}
+	})
+
+	t.Run("Should limit password reset requests per email and per IP", func(t *testing.T) {
+		// Unknown addresses are limited like registered ones, so the limit does not reveal them either
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountResets; i++ {
+			if code, _ := forgot(fmt.Sprintf("198.51.100.%d", i+1), "dave@example.com"); code != http.StatusAccepted {
+				t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusAccepted, code)
+			}
+		}
+		code, retryAfter := forgot("198.51.100.99", "Dave@Example.com")
+		if code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, code)
+		}
+		if seconds, _ := strconv.Atoi(retryAfter); seconds < 1 || seconds > int(testLoginThrottlePolicy.Window.Seconds()) {
+			t.Errorf("Expected Retry-After within the window, got %q", retryAfter)
+		}
+
+		for i := 0; i < testLoginThrottlePolicy.MaxIPResets; i++ {
+			if code, _ := forgot("203.0.113.7", fmt.Sprintf("user%d@example.com", i)); code != http.StatusAccepted {
+				t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusAccepted, code)
+			}
+		}
+		if code, _ := forgot("203.0.113.7", "another@example.com"); code != http.StatusTooManyRequests {
+			t.Errorf("Expected status %d from a throttled IP, got %d", http.StatusTooManyRequests, code)
+		}
+		if code, _ := forgot("203.0.113.8", "another@example.com"); code != http.StatusAccepted {
+			t.Errorf("Expected status %d from another IP, got %d", http.StatusAccepted, code)
+		}
+
+		// Reset requests do not count as failed logins
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountResets; i++ {
+			forgot("192.0.2.50", "bob@example.com")
+		}
+		loginUser(t, server, "bob@example.com", "password123")
+	})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+)
+
+// ログインの監査ログの取得件数
+const (
+	defaultLoginAuditLimit = 100
+	maxLoginAuditLimit     = 1000
+)
+
+// AdminHandler は管理者によるユーザーのロール管理、ログインの監査ログの閲覧と、最初の管理者の作成を処理します。
+// ロールの変更は次回のログインで発行されるトークンから反映されます。
+type AdminHandler struct {
+	userRepo       *repository.UserRepository
+	throttleRepo   *repository.LoginThrottleRepository
+	bootstrapToken string
+}
+
+// NewAdminHandler は AdminHandler の新しいインスタンスを生成します。
+// bootstrapToken が空の場合、最初の管理者の作成 (BootstrapAdmin) は無効になります。
+func NewAdminHandler(userRepo *repository.UserRepository, throttleRepo *repository.LoginThrottleRepository, bootstrapToken string) *AdminHandler {
+	return &AdminHandler{userRepo: userRepo, throttleRepo: throttleRepo, bootstrapToken: bootstrapToken}
+}
+
+// GetLoginAudit はログインの監査ログ (成功・失敗・ロック) を新しい順に返します。管理者のみが実行できます。
+func (h *AdminHandler) GetLoginAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLoginAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLoginAuditLimit {
+			errorJSON(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLoginAuditLimit))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.throttleRepo.AuditLog(limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to get login audit log: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve login audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// UpdateUserRole はユーザーを管理者に昇格、または一般ユーザーに降格します。管理者のみが実行できます。
+func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req model.UpdateUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !req.Role.Valid() {
+		errorJSON(w, http.StatusBadRequest, "role must be user or admin")
+		return
+	}
+
+	user, err := h.userRepo.UpdateRole(userID, req.Role)
+	if err != nil {
+		if errors.Is(err, repository.ErrLastAdmin) {
+			errorJSON(w, http.StatusConflict, "At least one admin is required")
+		} else if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: Failed to update role of user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to update user role")
+		}
+		return
+	}
+	if actorID, err := middleware.GetUserIDFromContext(r.Context()); err == nil {
+		log.Printf("INFO: User %d changed the role of user %d to %s", actorID, userID, req.Role)
+	}
+
+	writeJSON(w, http.StatusOK, user.ToAdminUserResponse())
+}
+
+// BootstrapAdmin は管理者がまだいない場合に、ログイン中のユーザーを最初の管理者にします。
+// サーバーに設定したブートストラップトークンをリクエストボディで指定する必要があります。
+func (h *AdminHandler) BootstrapAdmin(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	if h.bootstrapToken == "" {
+		errorJSON(w, http.StatusForbidden, "Admin bootstrap is not enabled")
+		return
+	}
+
+	var req model.BootstrapAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// タイミング攻撃を防ぐため、一定時間で比較する
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.bootstrapToken)) != 1 {
+		errorJSON(w, http.StatusForbidden, "Invalid bootstrap token")
+		return
+	}
+
+	user, err := h.userRepo.BootstrapAdmin(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAdminExists) {
+			errorJSON(w, http.StatusConflict, "An admin already exists")
+		} else {
+			log.Printf("ERROR: Failed to bootstrap admin %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to bootstrap admin")
+		}
+		return
+	}
+	log.Printf("INFO: User %d became the first admin", userID)
+
+	writeJSON(w, http.StatusOK, user.ToAdminUserResponse())
+}
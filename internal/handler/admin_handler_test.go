@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"testing"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	rolePath := func(userID int64) string {
+		return fmt.Sprintf("/api/admin/users/%d/role", userID)
+	}
+
+	// --- Test Cases ---
+	t.Run("Should forbid non-admins from admin endpoints", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			method, path string
+			token, body  string
+			want         int
+		}{
+			{"list without token", "GET", "/api/admin/users", "", "", http.StatusUnauthorized},
+			{"list as user", "GET", "/api/admin/users", aliceToken, "", http.StatusForbidden},
+			{"promote as user", "PUT", rolePath(aliceID), aliceToken, `{"role": "admin"}`, http.StatusForbidden},
+			{"list schedules as user", "GET", fmt.Sprintf("/api/admin/users/%d/schedules", bobID), aliceToken, "", http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			if code, body := send(tt.method, tt.path, tt.token, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, code, tt.want, body)
+			}
+		}
+	})
+
+	t.Run("Should bootstrap the first admin", func(t *testing.T) {
+		if code, _ := send("POST", "/api/bootstrap/admin", aliceToken, `{"token": "wrong"}`); code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a wrong bootstrap token, got %d", code)
+		}
+		code, body := send("POST", "/api/bootstrap/admin", aliceToken, fmt.Sprintf(`{"token": "%s"}`, testBootstrapToken))
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var user model.AdminUserResponse
+		json.Unmarshal([]byte(body), &user)
+		if user.ID != aliceID || user.Role != model.UserRoleAdmin {
+			t.Errorf("Expected alice to become admin: %s", body)
+		}
+		if code, _ := send("POST", "/api/bootstrap/admin", bobToken, fmt.Sprintf(`{"token": "%s"}`, testBootstrapToken)); code != http.StatusConflict {
+			t.Errorf("Expected 409 once an admin exists, got %d", code)
+		}
+	})
+
+	t.Run("Should apply the role from the next login", func(t *testing.T) {
+		if code, _ := send("GET", "/api/admin/users", aliceToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected the old token to keep the user role, got %d", code)
+		}
+		aliceToken = loginUser(t, server, "alice@example.com", "password123")
+		code, body := send("GET", "/api/admin/users", aliceToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var users []model.AdminUserResponse
+		json.Unmarshal([]byte(body), &users)
+		if len(users) != 2 || users[0].Role != model.UserRoleAdmin || users[1].Role != model.UserRoleUser {
+			t.Errorf("Unexpected users: %s", body)
+		}
+	})
+
+	t.Run("Should list the schedules of any user for admins", func(t *testing.T) {
+		scheduleID := createSchedule(t, server, bobToken, fmt.Sprintf(`{"title": "Dentist", "owner_id": %d,
+			"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z"}`, bobID))
+
+		if code, _ := send("GET", fmt.Sprintf("/api/users/%d/schedules", bobID), aliceToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected the calendar API to require a share for admins, got %d", code)
+		}
+		code, body := send("GET", fmt.Sprintf("/api/admin/users/%d/schedules", bobID), aliceToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var page model.ScheduleListResponse
+		json.Unmarshal([]byte(body), &page)
+		if len(page.Schedules) != 1 || page.Schedules[0].ID != scheduleID {
+			t.Errorf("Unexpected schedules: %s", body)
+		}
+	})
+
+	t.Run("Should promote and demote users", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			userID int64
+			body   string
+			want   int
+		}{
+			{"invalid role", bobID, `{"role": "root"}`, http.StatusBadRequest},
+			{"unknown user", 999, `{"role": "admin"}`, http.StatusNotFound},
+			{"demote last admin", aliceID, `{"role": "user"}`, http.StatusConflict},
+			{"promote", bobID, `{"role": "admin"}`, http.StatusOK},
+			{"demote", aliceID, `{"role": "user"}`, http.StatusOK},
+		}
+		for _, tt := range tests {
+			if code, body := send("PUT", rolePath(tt.userID), aliceToken, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, code, tt.want, body)
+			}
+		}
+
+		bobToken = loginUser(t, server, "bob@example.com", "password123")
+		if code, body := send("GET", "/api/admin/users", bobToken, ""); code != http.StatusOK {
+			t.Errorf("Expected a promoted user to access admin endpoints, got %d: %s", code, body)
+		}
+		aliceToken = loginUser(t, server, "alice@example.com", "password123")
+		if code, _ := send("GET", "/api/admin/users", aliceToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected a demoted user to lose access to admin endpoints, got %d", code)
+		}
+	})
+}
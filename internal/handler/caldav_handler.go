@@ -0,0 +1,680 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"schedule-app/internal/caldav"
+	"schedule-app/internal/ical"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CalDAVRealm は CalDAV の Basic 認証で使用する realm です。
+const CalDAVRealm = "schedule-app CalDAV"
+
+// maxDAVRequestBytes は PROPFIND / REPORT のリクエストボディの最大サイズです。
+const maxDAVRequestBytes = 1 << 20
+
+// calendarContentType はカレンダーオブジェクトリソースの Content-Type です。
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// CalDAVHandler はネイティブのカレンダークライアント向けに CalDAV (RFC 4791) のサブセットを提供します。
+// 各ユーザーは "default" という1つのカレンダーを持ち、同じ UID のスケジュール (系列と単一発生の変更) を
+// 1つのカレンダーオブジェクトリソース "{UID}.ics" として公開します。
+// 他のユーザーのカレンダーは、共有設定の read 権限で参照、write 権限で変更できます。
+//
+//	/caldav/                                  ルート (current-user-principal の検出)
+//	/caldav/principals/{userID}/              プリンシパル
+//	/caldav/calendars/{userID}/               カレンダーホーム
+//	/caldav/calendars/{userID}/default/       カレンダー
+//	/caldav/calendars/{userID}/default/{name} カレンダーオブジェクトリソース
+type CalDAVHandler struct {
+	scheduleRepo *repository.ScheduleRepository
+	userRepo     *repository.UserRepository
+	shareRepo    *repository.ShareRepository
+}
+
+// NewCalDAVHandler は CalDAVHandler の新しいインスタンスを生成します。
+func NewCalDAVHandler(scheduleRepo *repository.ScheduleRepository, userRepo *repository.UserRepository, shareRepo *repository.ShareRepository) *CalDAVHandler {
+	return &CalDAVHandler{scheduleRepo: scheduleRepo, userRepo: userRepo, shareRepo: shareRepo}
+}
+
+func caldavPrincipalPath(userID int64) string {
+	return fmt.Sprintf("/caldav/principals/%d/", userID)
+}
+
+func caldavHomePath(userID int64) string {
+	return fmt.Sprintf("/caldav/calendars/%d/", userID)
+}
+
+func caldavCalendarPath(userID int64) string {
+	return fmt.Sprintf("/caldav/calendars/%d/default/", userID)
+}
+
+func caldavObjectPath(userID int64, uid string) string {
+	return caldavCalendarPath(userID) + url.PathEscape(uid) + ".ics"
+}
+
+// calendarObject は同じ UID を持つスケジュールをまとめたカレンダーオブジェクトリソースです。
+type calendarObject struct {
+	uid       string
+	schedules []*model.Schedule
+	data      string
+	etag      string
+}
+
+// newCalendarObject はスケジュールを iCalendar 形式に変換し、その内容から ETag を計算します。
+// ETag が内容だけで決まるよう、DTSTAMP には最終更新日時を使用します。
+func newCalendarObject(uid string, schedules []*model.Schedule) *calendarObject {
+	dtstamp := schedules[0].UpdatedAt
+	for _, s := range schedules[1:] {
+		if s.UpdatedAt.After(dtstamp) {
+			dtstamp = s.UpdatedAt
+		}
+	}
+	cal := &ical.Calendar{Events: ical.EventsFromSchedules(schedules, dtstamp)}
+	data := cal.String()
+	sum := sha256.Sum256([]byte(data))
+	return &calendarObject{
+		uid:       uid,
+		schedules: schedules,
+		data:      data,
+		etag:      `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+}
+
+// groupCalendarObjects はスケジュールを UID ごとのカレンダーオブジェクトにまとめます。
+// 各オブジェクトでは系列を先頭に、単一発生の変更を元の開始日時の順に並べます。
+func groupCalendarObjects(schedules []*model.Schedule) []*calendarObject {
+	var uids []string
+	byUID := make(map[string][]*model.Schedule)
+	for _, s := range schedules {
+		if _, ok := byUID[s.UID]; !ok {
+			uids = append(uids, s.UID)
+		}
+		byUID[s.UID] = append(byUID[s.UID], s)
+	}
+
+	objects := make([]*calendarObject, 0, len(uids))
+	for _, uid := range uids {
+		group := byUID[uid]
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := group[i].RecurrenceID, group[j].RecurrenceID
+			if a == nil || b == nil {
+				return a == nil && b != nil
+			}
+			return a.Before(*b)
+		})
+		objects = append(objects, newCalendarObject(uid, group))
+	}
+	return objects
+}
+
+// Options は CalDAV の対応状況 (DAV ヘッダー) を返します。
+// calendar-auto-schedule を含めないため、クライアントは招待メールを自身で送信します (PutObject を参照)。
+func (h *CalDAVHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// PropfindRoot はクライアントが current-user-principal を検出するためのルートのプロパティを返します。
+func (h *CalDAVHandler) PropfindRoot(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.parsePropfind(w, r)
+	if !ok {
+		return
+	}
+
+	var ms caldav.MultiStatus
+	ms.AddResource(&caldav.Resource{
+		Href: "/caldav/",
+		Props: map[xml.Name]string{
+			caldav.ResourceType:         caldav.Element(caldav.Collection, ""),
+			caldav.CurrentUserPrincipal: caldav.Href(caldavPrincipalPath(userID)),
+		},
+	}, req)
+	ms.WriteTo(w)
+}
+
+// PropfindPrincipal はプリンシパルのプロパティ (カレンダーホームの場所など) を返します。
+func (h *CalDAVHandler) PropfindPrincipal(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.parsePropfind(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var ms caldav.MultiStatus
+	ms.AddResource(&caldav.Resource{
+		Href: caldavPrincipalPath(owner.ID),
+		Props: map[xml.Name]string{
+			caldav.ResourceType:           caldav.Element(caldav.Collection, "") + caldav.Element(caldav.Principal, ""),
+			caldav.DisplayName:            caldav.Text(owner.Username),
+			caldav.CurrentUserPrincipal:   caldav.Href(caldavPrincipalPath(userID)),
+			caldav.PrincipalURL:           caldav.Href(caldavPrincipalPath(owner.ID)),
+			caldav.CalendarHomeSet:        caldav.Href(caldavHomePath(owner.ID)),
+			caldav.CalendarUserAddressSet: caldav.Href("mailto:"+owner.Email) + caldav.Href(caldavPrincipalPath(owner.ID)),
+		},
+	}, req)
+	ms.WriteTo(w)
+}
+
+// PropfindHome はカレンダーホームのプロパティを返します。Depth が 0 でない場合はカレンダーも含めます。
+func (h *CalDAVHandler) PropfindHome(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.parsePropfind(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return
+	}
+	permission, ok := h.checkPermission(w, owner.ID, userID, model.PermissionRead)
+	if !ok {
+		return
+	}
+
+	var ms caldav.MultiStatus
+	ms.AddResource(&caldav.Resource{
+		Href: caldavHomePath(owner.ID),
+		Props: map[xml.Name]string{
+			caldav.ResourceType:         caldav.Element(caldav.Collection, ""),
+			caldav.DisplayName:          caldav.Text(owner.Username),
+			caldav.CurrentUserPrincipal: caldav.Href(caldavPrincipalPath(userID)),
+			caldav.Owner:                caldav.Href(caldavPrincipalPath(owner.ID)),
+		},
+	}, req)
+	if r.Header.Get("Depth") != "0" {
+		objects, err := h.loadCalendarObjects(owner.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get calendar objects for owner %d: %v", owner.ID, err)
+			http.Error(w, "Failed to retrieve calendar", http.StatusInternalServerError)
+			return
+		}
+		ms.AddResource(h.calendarResource(userID, owner, permission, objects), req)
+	}
+	ms.WriteTo(w)
+}
+
+// PropfindCalendar はカレンダーのプロパティを返します。Depth が 0 でない場合はカレンダーオブジェクトも含めます。
+func (h *CalDAVHandler) PropfindCalendar(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.parsePropfind(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return
+	}
+	permission, ok := h.checkPermission(w, owner.ID, userID, model.PermissionRead)
+	if !ok {
+		return
+	}
+
+	objects, err := h.loadCalendarObjects(owner.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get calendar objects for owner %d: %v", owner.ID, err)
+		http.Error(w, "Failed to retrieve calendar", http.StatusInternalServerError)
+		return
+	}
+
+	var ms caldav.MultiStatus
+	ms.AddResource(h.calendarResource(userID, owner, permission, objects), req)
+	if r.Header.Get("Depth") != "0" {
+		for _, obj := range objects {
+			ms.AddResource(objectResource(userID, owner.ID, obj), req)
+		}
+	}
+	ms.WriteTo(w)
+}
+
+// PropfindObject はカレンダーオブジェクトリソースのプロパティを返します。
+func (h *CalDAVHandler) PropfindObject(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.parsePropfind(w, r)
+	if !ok {
+		return
+	}
+	obj, ok := h.findObject(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var ms caldav.MultiStatus
+	ms.AddResource(objectResource(userID, obj.schedules[0].OwnerID, obj), req)
+	ms.WriteTo(w)
+}
+
+// Report はカレンダーに対する calendar-query (時間範囲による検索) と
+// calendar-multiget (URL を指定した一括取得) を処理します。
+func (h *CalDAVHandler) Report(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := h.checkPermission(w, owner.ID, userID, model.PermissionRead); !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDAVRequestBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	report, err := caldav.ParseReport(body)
+	if err != nil {
+		switch {
+		case errors.Is(err, caldav.ErrUnsupportedReport):
+			caldav.WriteError(w, http.StatusForbidden, caldav.SupportedReport)
+		case errors.Is(err, caldav.ErrUnsupportedFilter):
+			caldav.WriteError(w, http.StatusForbidden, caldav.SupportedFilter)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	var ms caldav.MultiStatus
+	if report.Multiget {
+		for _, href := range report.Hrefs {
+			uid, ok := uidFromHref(owner.ID, href)
+			if !ok {
+				ms.AddStatus(href, http.StatusNotFound)
+				continue
+			}
+			schedules, err := h.scheduleRepo.FindByUID(owner.ID, uid)
+			if err != nil {
+				if !strings.Contains(err.Error(), "not found") {
+					log.Printf("ERROR: Failed to get calendar object %q for owner %d: %v", uid, owner.ID, err)
+				}
+				ms.AddStatus(href, http.StatusNotFound)
+				continue
+			}
+			ms.AddResource(objectResource(userID, owner.ID, newCalendarObject(uid, schedules)), report.Props)
+		}
+		ms.WriteTo(w)
+		return
+	}
+
+	objects, err := h.queryCalendarObjects(owner.ID, report.Filter)
+	if err != nil {
+		log.Printf("ERROR: Failed to query calendar objects for owner %d: %v", owner.ID, err)
+		http.Error(w, "Failed to query calendar", http.StatusInternalServerError)
+		return
+	}
+	for _, obj := range objects {
+		ms.AddResource(objectResource(userID, owner.ID, obj), report.Props)
+	}
+	ms.WriteTo(w)
+}
+
+// GetObject はカレンダーオブジェクトリソースを iCalendar 形式で返します。
+func (h *CalDAVHandler) GetObject(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	obj, ok := h.findObject(w, r, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", calendarContentType)
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, obj.data)
+}
+
+// PutObject はカレンダーオブジェクトリソースを作成または置き換えます。
+// リソース名は "{UID}.ics" で、本文のすべての VEVENT が同じ UID を持つ必要があります。
+// カレンダーへの write 権限が必要です (Update と同じ規則)。
+// If-Match / If-None-Match による条件付きリクエストに対応します。
+// 保存時に内容を正規化するため、応答には ETag を含めません (RFC 4791 5.3.4)。
+// 招待メール (iMIP) は送信しません。DAV ヘッダーで calendar-auto-schedule (RFC 6638) を通知していないため、
+// 参加者への招待はクライアントが送信します。サーバーからも送信すると、参加者に同じ招待が重複して届きます。
+func (h *CalDAVHandler) PutObject(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return
+	}
+	uid, ok := strings.CutSuffix(r.PathValue("name"), ".ics")
+	if !ok || uid == "" {
+		caldav.WriteError(w, http.StatusForbidden, caldav.ValidCalendarObjectResource)
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "text/calendar" {
+		caldav.WriteError(w, http.StatusUnsupportedMediaType, caldav.SupportedCalendarData)
+		return
+	}
+	cal, eventErrs, err := ical.Decode(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil || len(eventErrs) > 0 || len(cal.Events) == 0 {
+		caldav.WriteError(w, http.StatusBadRequest, caldav.ValidCalendarData)
+		return
+	}
+
+	// VEVENT をリクエストに変換 (取り消された発生は系列の EXDATE として扱う)
+	usersByEmail := make(map[string]*model.User)
+	var reqs []*model.CreateScheduleRequest
+	var cancelled []*ical.Event
+	for _, ev := range cal.Events {
+		if ev.UID != uid {
+			caldav.WriteError(w, http.StatusForbidden, caldav.ValidCalendarObjectResource)
+			return
+		}
+		if ev.RecurrenceID != nil && ev.Status == "CANCELLED" {
+			cancelled = append(cancelled, ev)
+			continue
+		}
+		req, _, reason := scheduleRequestFromEvent(h.userRepo, ev, owner.ID, usersByEmail)
+		if reason != "" {
+			log.Printf("INFO: Rejected calendar object %q for owner %d: %s", uid, owner.ID, reason)
+			caldav.WriteError(w, http.StatusForbidden, caldav.ValidCalendarObjectResource)
+			return
+		}
+		reqs = append(reqs, req)
+	}
+	for _, req := range reqs {
+		if req.RecurrenceID == nil && req.RecurrenceRule != "" {
+			for _, ev := range cancelled {
+				req.ExDates = append(req.ExDates, *ev.RecurrenceID)
+			}
+		}
+	}
+	if len(reqs) == 0 {
+		caldav.WriteError(w, http.StatusForbidden, caldav.ValidCalendarObjectResource)
+		return
+	}
+
+	created, err := h.scheduleRepo.SaveByUID(owner.ID, uid, reqs, userID, preconditionFor(r, uid))
+	if err != nil {
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		} else if strings.Contains(err.Error(), "not authorized") {
+			caldav.WriteError(w, http.StatusForbidden, caldav.NeedPrivileges)
+		} else {
+			log.Printf("ERROR: Failed to save calendar object %q for owner %d: %v", uid, owner.ID, err)
+			http.Error(w, "Failed to save calendar object", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteObject はカレンダーオブジェクトリソース (系列と単一発生の変更のすべて) を削除します。
+// カレンダーへの write 権限が必要です (Delete と同じ規則)。
+// PutObject と同じ理由で、取り消しの招待メール (CANCEL) は送信しません。
+func (h *CalDAVHandler) DeleteObject(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	obj, ok := h.findObject(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleRepo.DeleteByUID(obj.schedules[0].OwnerID, obj.uid, userID, preconditionFor(r, obj.uid)); err != nil {
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		} else if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Calendar object not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "not authorized") {
+			caldav.WriteError(w, http.StatusForbidden, caldav.NeedPrivileges)
+		} else {
+			log.Printf("ERROR: Failed to delete calendar object %q: %v", obj.uid, err)
+			http.Error(w, "Failed to delete calendar object", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parsePropfind は認証済みのユーザーIDと PROPFIND の本文を取得します。失敗した場合は応答を書き込み false を返します。
+func (h *CalDAVHandler) parsePropfind(w http.ResponseWriter, r *http.Request) (int64, *caldav.PropRequest, bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return 0, nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDAVRequestBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return 0, nil, false
+	}
+	req, err := caldav.ParsePropfind(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, nil, false
+	}
+	return userID, req, true
+}
+
+// findOwner はパスの {userID} のユーザーを取得します。見つからない場合は応答を書き込み false を返します。
+func (h *CalDAVHandler) findOwner(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	ownerID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusNotFound)
+		return nil, false
+	}
+	owner, err := h.userRepo.FindUserByID(ownerID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			log.Printf("ERROR: Failed to get user %d: %v", ownerID, err)
+			http.Error(w, "Failed to retrieve calendar", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return owner, true
+}
+
+// checkPermission はユーザー userID が所有者 ownerID のカレンダーに required 以上の権限を持つかを確認し、その権限を返します。
+// 持たない場合は DAV:need-privileges を書き込み false を返します。
+func (h *CalDAVHandler) checkPermission(w http.ResponseWriter, ownerID, userID int64, required model.SharePermission) (model.SharePermission, bool) {
+	permission, err := h.shareRepo.Permission(model.OwnerUser, ownerID, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get permission of user %d on calendar %d: %v", userID, ownerID, err)
+		http.Error(w, "Failed to check calendar permission", http.StatusInternalServerError)
+		return model.PermissionNone, false
+	}
+	if !permission.Allows(required) {
+		caldav.WriteError(w, http.StatusForbidden, caldav.NeedPrivileges)
+		return model.PermissionNone, false
+	}
+	return permission, true
+}
+
+// findObject はパスの {name} のカレンダーオブジェクトを取得します。
+// ユーザー userID がカレンダーへの read 権限を持たない場合や、見つからない場合は応答を書き込み false を返します。
+func (h *CalDAVHandler) findObject(w http.ResponseWriter, r *http.Request, userID int64) (*calendarObject, bool) {
+	owner, ok := h.findOwner(w, r)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := h.checkPermission(w, owner.ID, userID, model.PermissionRead); !ok {
+		return nil, false
+	}
+	uid, ok := strings.CutSuffix(r.PathValue("name"), ".ics")
+	if !ok {
+		http.Error(w, "Calendar object not found", http.StatusNotFound)
+		return nil, false
+	}
+	schedules, err := h.scheduleRepo.FindByUID(owner.ID, uid)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Calendar object not found", http.StatusNotFound)
+		} else {
+			log.Printf("ERROR: Failed to get calendar object %q for owner %d: %v", uid, owner.ID, err)
+			http.Error(w, "Failed to retrieve calendar object", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return newCalendarObject(uid, schedules), true
+}
+
+// loadCalendarObjects は所有者のカレンダーのすべてのカレンダーオブジェクトを取得します。
+func (h *CalDAVHandler) loadCalendarObjects(ownerID int64) ([]*calendarObject, error) {
+	schedules, _, err := h.scheduleRepo.FindByOwnerID(ownerID, &model.ScheduleQuery{KeepSeries: true})
+	if err != nil {
+		return nil, err
+	}
+	return groupCalendarObjects(schedules), nil
+}
+
+// queryCalendarObjects は calendar-query のフィルターに一致するカレンダーオブジェクトを返します。
+// time-range はいずれかの発生 (単一発生の変更を含む) が期間と重なるオブジェクトに一致します。
+func (h *CalDAVHandler) queryCalendarObjects(ownerID int64, filter *caldav.CompFilter) ([]*calendarObject, error) {
+	tr, matches := filter.EventTimeRange()
+	if !matches {
+		return nil, nil
+	}
+	objects, err := h.loadCalendarObjects(ownerID)
+	if err != nil || tr == nil {
+		return objects, err
+	}
+
+	inRange, _, err := h.scheduleRepo.FindByOwnerID(ownerID, &model.ScheduleQuery{From: tr.Start, To: tr.End, KeepSeries: true})
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[string]bool)
+	for _, s := range inRange {
+		uids[s.UID] = true
+	}
+	var matched []*calendarObject
+	for _, obj := range objects {
+		if uids[obj.uid] {
+			matched = append(matched, obj)
+		}
+	}
+	return matched, nil
+}
+
+// calendarResource はカレンダーのプロパティを組み立てます。
+// getctag はカレンダー内のいずれかのオブジェクトが変更されると変わります。
+// current-user-privilege-set はユーザーの権限 (read または write 以上) を反映します。
+func (h *CalDAVHandler) calendarResource(userID int64, owner *model.User, permission model.SharePermission, objects []*calendarObject) *caldav.Resource {
+	ctag := sha256.New()
+	for _, obj := range objects {
+		io.WriteString(ctag, obj.uid+obj.etag)
+	}
+	privileges := []string{"read"}
+	if permission.Allows(model.PermissionWrite) {
+		privileges = append(privileges, "write-content", "bind", "unbind")
+	}
+	return &caldav.Resource{
+		Href: caldavCalendarPath(owner.ID),
+		Props: map[xml.Name]string{
+			caldav.ResourceType:                  caldav.Element(caldav.Collection, "") + caldav.Element(caldav.Calendar, ""),
+			caldav.DisplayName:                   caldav.Text(owner.Username),
+			caldav.CurrentUserPrincipal:          caldav.Href(caldavPrincipalPath(userID)),
+			caldav.Owner:                         caldav.Href(caldavPrincipalPath(owner.ID)),
+			caldav.SupportedCalendarComponentSet: `<c:comp name="VEVENT"/>`,
+			caldav.SupportedReportSet:            caldav.SupportedReports(),
+			caldav.CurrentUserPrivilegeSet:       caldav.Privileges(privileges...),
+			caldav.GetCTag:                       caldav.Text(`"` + hex.EncodeToString(ctag.Sum(nil)[:16]) + `"`),
+		},
+	}
+}
+
+// objectResource はカレンダーオブジェクトリソースのプロパティを組み立てます。
+func objectResource(userID, ownerID int64, obj *calendarObject) *caldav.Resource {
+	return &caldav.Resource{
+		Href: caldavObjectPath(ownerID, obj.uid),
+		Props: map[xml.Name]string{
+			caldav.ResourceType:         "",
+			caldav.CurrentUserPrincipal: caldav.Href(caldavPrincipalPath(userID)),
+			caldav.GetETag:              caldav.Text(obj.etag),
+			caldav.GetContentType:       caldav.Text(calendarContentType),
+			caldav.CalendarData:         caldav.Text(obj.data),
+		},
+	}
+}
+
+// uidFromHref は calendar-multiget の href を所有者のカレンダーのオブジェクトの UID に変換します。
+func uidFromHref(ownerID int64, href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	dir, name := path.Split(u.Path)
+	if dir != caldavCalendarPath(ownerID) {
+		return "", false
+	}
+	return strings.CutSuffix(name, ".ics")
+}
+
+// preconditionFor は If-Match / If-None-Match を、保存・削除と同じトランザクション内で取得した
+// 現在のリソースの ETag で判定する関数を返します。同じ ETag を指定した同時の更新の一方は 412 になります。
+func preconditionFor(r *http.Request, uid string) repository.UIDPrecondition {
+	return func(current []*model.Schedule) bool {
+		var currentETag string
+		if len(current) > 0 {
+			currentETag = newCalendarObject(uid, current).etag
+		}
+		return checkPreconditions(r, currentETag)
+	}
+}
+
+// checkPreconditions は If-Match / If-None-Match ヘッダーを現在の ETag (リソースがない場合は空) と比較します。
+func checkPreconditions(r *http.Request, currentETag string) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if currentETag == "" {
+			return false
+		}
+		if ifMatch != "*" && !containsETag(ifMatch, currentETag) {
+			return false
+		}
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && currentETag != "" {
+		if ifNoneMatch == "*" || containsETag(ifNoneMatch, currentETag) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsETag はカンマ区切りの ETag のリストに etag が含まれるかを判定します。
+func containsETag(list, etag string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
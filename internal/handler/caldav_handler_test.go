@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"schedule-app/internal/model"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const caldavWeeklyEvent = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Native Client//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1@client.example\r\n" +
+	"DTSTAMP:20251101T000000Z\r\n" +
+	"DTSTART:20251103T090000Z\r\n" +
+	"DTEND:20251103T091500Z\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=4\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"ATTENDEE;CN=davguest:mailto:davguest@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1@client.example\r\n" +
+	"DTSTAMP:20251101T000000Z\r\n" +
+	"RECURRENCE-ID:20251110T090000Z\r\n" +
+	"DTSTART:20251110T100000Z\r\n" +
+	"DTEND:20251110T101500Z\r\n" +
+	"SUMMARY:Standup (late)\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestCalDAVHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	ownerID := createUser(t, server, "davowner", "davowner@example.com", "password123")
+	guestID := createUser(t, server, "davguest", "davguest@example.com", "password456")
+	ownerToken := loginUser(t, server, "davowner@example.com", "password123")
+	calendarPath := fmt.Sprintf("/caldav/calendars/%d/default/", ownerID)
+	objectPath := calendarPath + "standup-1@client.example.ics"
+
+	davRequest := func(method, path, email, password, body string, header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if email != "" {
+			req.SetBasicAuth(email, password)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return server.executeRequest(req)
+	}
+	asOwner := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		return davRequest(method, path, "davowner@example.com", "password123", body, header)
+	}
+	asGuest := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		return davRequest(method, path, "davguest@example.com", "password456", body, header)
+	}
+	icsHeader := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+
+	var etag string
+
+	// --- Test Cases ---
+	t.Run("Should require basic authentication", func(t *testing.T) {
+		rr := davRequest("PROPFIND", "/caldav/", "", "", "", nil)
+		if rr.Code != http.StatusUnauthorized || !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Basic") {
+			t.Errorf("Expected 401 with a Basic challenge, got %d %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+		}
+		rr = davRequest("PROPFIND", "/caldav/", "davowner@example.com", "wrong-password", "", nil)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code for a wrong password: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("Should discover the principal and calendar home", func(t *testing.T) {
+		body := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`
+		rr := asOwner("PROPFIND", "/caldav/", body, map[string]string{"Depth": "0"})
+		if rr.Code != http.StatusMultiStatus {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+		}
+		principal := fmt.Sprintf("/caldav/principals/%d/", ownerID)
+		if !strings.Contains(rr.Body.String(), "<d:href>"+principal+"</d:href>") {
+			t.Errorf("Expected current-user-principal %s, got %s", principal, rr.Body.String())
+		}
+
+		body = `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/><d:unknown-prop/></d:prop></d:propfind>`
+		rr = asOwner("PROPFIND", principal, body, map[string]string{"Depth": "0"})
+		home := fmt.Sprintf("<c:calendar-home-set><d:href>/caldav/calendars/%d/</d:href></c:calendar-home-set>", ownerID)
+		if !strings.Contains(rr.Body.String(), home) {
+			t.Errorf("Expected calendar-home-set in response, got %s", rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "<d:unknown-prop/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status>") {
+			t.Errorf("Expected unknown property to be reported as 404, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Should create a calendar object with PUT", func(t *testing.T) {
+		rr := asOwner("PUT", calendarPath+"other-name.ics", caldavWeeklyEvent, icsHeader)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 when the resource name does not match the UID, got %d", rr.Code)
+		}
+
+		rr = asOwner("PUT", objectPath, caldavWeeklyEvent, map[string]string{"Content-Type": "text/calendar", "If-None-Match": "*"})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+		}
+
+		rr = asOwner("PUT", objectPath, caldavWeeklyEvent, map[string]string{"Content-Type": "text/calendar", "If-None-Match": "*"})
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected 412 when creating an existing resource, got %d", rr.Code)
+		}
+
+		// The client sends the invitation to davguest itself, since the server does not advertise calendar-auto-schedule
+		var queued int
+		server.db.QueryRow("SELECT COUNT(*) FROM invitation_emails").Scan(&queued)
+		if queued != 0 {
+			t.Errorf("Expected no invitation emails to be queued for a CalDAV upload, got %d", queued)
+		}
+	})
+
+	t.Run("Should expose the object through the REST API", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?from=2025-11-01T00:00:00Z&to=2025-12-01T00:00:00Z", ownerID), nil)
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		rr := server.executeRequest(req)
+		var resp model.ScheduleListResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+
+		var titles []string
+		for _, s := range resp.Schedules {
+			titles = append(titles, s.Title+"@"+s.StartTime.UTC().Format("01-02T15"))
+			if s.Title == "Standup" && (len(s.Participants) != 1 || s.Participants[0].ID != guestID) {
+				t.Errorf("Expected davguest as the participant of %q, got %+v", s.Title, s.Participants)
+			}
+		}
+		expected := "[Standup@11-03T09 Standup (late)@11-10T10 Standup@11-17T09 Standup@11-24T09]"
+		if fmt.Sprint(titles) != expected {
+			t.Errorf("Expected %s, got %v", expected, titles)
+		}
+	})
+
+	t.Run("Should deny access to a calendar that is not shared", func(t *testing.T) {
+		rr := asGuest("PROPFIND", calendarPath, "", map[string]string{"Depth": "1"})
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "need-privileges") {
+			t.Errorf("Expected 403 need-privileges, got %d %s", rr.Code, rr.Body.String())
+		}
+		rr = asGuest("GET", objectPath, "", nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for GET, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Should list objects with their ETags", func(t *testing.T) {
+		shareCalendar(t, server, ownerToken, ownerID, guestID, model.PermissionRead)
+
+		body := `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><d:resourcetype/><d:getetag/><cs:getctag/><d:current-user-privilege-set/></d:prop></d:propfind>`
+		rr := asGuest("PROPFIND", calendarPath, body, map[string]string{"Depth": "1"})
+		if rr.Code != http.StatusMultiStatus {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+		}
+		got := rr.Body.String()
+		if !strings.Contains(got, "<c:calendar/>") || !strings.Contains(got, "<cs:getctag>") {
+			t.Errorf("Expected the calendar collection with a ctag, got %s", got)
+		}
+		if !strings.Contains(got, "<d:read/>") || strings.Contains(got, "<d:write-content/>") {
+			t.Errorf("Expected read-only privileges for a read share, got %s", got)
+		}
+		if strings.Count(got, "<d:response>") != 2 || !strings.Contains(got, "<d:href>"+objectPath+"</d:href>") {
+			t.Errorf("Expected the calendar and one object, got %s", got)
+		}
+
+		rr = asGuest("GET", objectPath, "", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		etag = rr.Header().Get("ETag")
+		if etag == "" || !strings.Contains(got, strings.Trim(etag, `"`)+"&#34;</d:getetag>") {
+			t.Errorf("Expected ETag %q to match the PROPFIND response", etag)
+		}
+		data := rr.Body.String()
+		if strings.Count(data, "BEGIN:VEVENT") != 2 || !strings.Contains(data, "RECURRENCE-ID:20251110T090000Z") {
+			t.Errorf("Expected the series and its override in one object, got %s", data)
+		}
+		if strings.Contains(data, "EXDATE") {
+			t.Errorf("Expected the overridden occurrence not to be listed as EXDATE, got %s", data)
+		}
+	})
+
+	t.Run("Should find objects with calendar-query and calendar-multiget", func(t *testing.T) {
+		query := func(start, end string) string {
+			return `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+				<d:prop><d:getetag/></d:prop>
+				<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+					<c:time-range start="` + start + `" end="` + end + `"/>
+				</c:comp-filter></c:comp-filter></c:filter>
+			</c:calendar-query>`
+		}
+		rr := asOwner("REPORT", calendarPath, query("20251110T100000Z", "20251110T101000Z"), map[string]string{"Depth": "1"})
+		if rr.Code != http.StatusMultiStatus || !strings.Contains(rr.Body.String(), objectPath) {
+			t.Errorf("Expected the overridden occurrence to match, got %d %s", rr.Code, rr.Body.String())
+		}
+		rr = asOwner("REPORT", calendarPath, query("20251201T000000Z", "20251231T000000Z"), map[string]string{"Depth": "1"})
+		if strings.Contains(rr.Body.String(), "<d:response>") {
+			t.Errorf("Expected no objects after the series ends, got %s", rr.Body.String())
+		}
+
+		unsupported := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><c:filter><c:comp-filter name="VCALENDAR">
+			<c:comp-filter name="VEVENT"><c:prop-filter name="SUMMARY"/></c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+		rr = asOwner("REPORT", calendarPath, unsupported, nil)
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "supported-filter") {
+			t.Errorf("Expected 403 supported-filter, got %d %s", rr.Code, rr.Body.String())
+		}
+
+		multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+			<d:prop><d:getetag/><c:calendar-data/></d:prop>
+			<d:href>` + objectPath + `</d:href>
+			<d:href>` + calendarPath + `missing.ics</d:href>
+		</c:calendar-multiget>`
+		rr = asOwner("REPORT", calendarPath, multiget, nil)
+		got := rr.Body.String()
+		if !strings.Contains(got, "SUMMARY:Standup (late)") {
+			t.Errorf("Expected calendar-data in multiget response, got %s", got)
+		}
+		if !strings.Contains(got, "missing.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>") {
+			t.Errorf("Expected 404 for the missing object, got %s", got)
+		}
+	})
+
+	t.Run("Should require write access to modify the object", func(t *testing.T) {
+		updated := strings.Replace(caldavWeeklyEvent, "SUMMARY:Standup\r\n", "SUMMARY:Daily standup\r\n", 1)
+
+		rr := asGuest("PUT", objectPath, updated, icsHeader)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a read-only share, got %d", rr.Code)
+		}
+		rr = asGuest("DELETE", objectPath, "", nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a read-only share, got %d", rr.Code)
+		}
+
+		rr = asOwner("PUT", objectPath, updated, map[string]string{"Content-Type": "text/calendar", "If-Match": `"stale"`})
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected 412 for a stale ETag, got %d", rr.Code)
+		}
+		rr = asOwner("PUT", objectPath, updated, map[string]string{"Content-Type": "text/calendar", "If-Match": etag})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+		}
+
+		rr = asOwner("GET", objectPath, "", nil)
+		if rr.Header().Get("ETag") == etag || !strings.Contains(rr.Body.String(), "SUMMARY:Daily standup") {
+			t.Errorf("Expected the object to be updated with a new ETag, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Should apply only one of concurrent updates with the same ETag", func(t *testing.T) {
+		current := asOwner("GET", objectPath, "", nil).Header().Get("ETag")
+		const clients = 8
+		var wg sync.WaitGroup
+		codes := make([]int, clients)
+		for i := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				body := strings.Replace(caldavWeeklyEvent, "SUMMARY:Standup\r\n", fmt.Sprintf("SUMMARY:Standup %d\r\n", i), 1)
+				codes[i] = asOwner("PUT", objectPath, body, map[string]string{"Content-Type": "text/calendar", "If-Match": current}).Code
+			}()
+		}
+		wg.Wait()
+
+		updated := 0
+		for _, code := range codes {
+			switch code {
+			case http.StatusNoContent:
+				updated++
+			case http.StatusPreconditionFailed:
+			default:
+				t.Errorf("Unexpected status code %d", code)
+			}
+		}
+		if updated != 1 {
+			t.Errorf("Expected exactly one update to succeed, got %d (%v)", updated, codes)
+		}
+
+		rr := asOwner("DELETE", objectPath, "", map[string]string{"If-Match": current})
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected 412 when deleting with a stale ETag, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Should delete the object", func(t *testing.T) {
+		rr := asOwner("DELETE", objectPath, "", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+		rr = asOwner("GET", objectPath, "", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 after delete, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Should export a recurring object in the offset of the series", func(t *testing.T) {
+		path := calendarPath + "tokyo-1@client.example.ics"
+		body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Native Client//EN\r\n" +
+			"BEGIN:VEVENT\r\nUID:tokyo-1@client.example\r\nDTSTAMP:20251101T000000Z\r\n" +
+			"DTSTART;TZID=Asia/Tokyo:20251103T080000\r\nDTEND;TZID=Asia/Tokyo:20251103T090000\r\n" +
+			"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=3\r\nSUMMARY:Tokyo sync\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+		if rr := asOwner("PUT", path, body, icsHeader); rr.Code != http.StatusCreated {
+			t.Fatalf("PUT returned status %d: %s", rr.Code, rr.Body.String())
+		}
+
+		expectZoned := func(t *testing.T, rr *httptest.ResponseRecorder) {
+			t.Helper()
+			data := strings.ReplaceAll(rr.Body.String(), "\r\n ", "")
+			for _, line := range []string{"TZID:UTC+0900", "TZOFFSETTO:+0900", "DTSTART;TZID=UTC+0900:20251103T080000", "RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=3"} {
+				if !strings.Contains(data, "\r\n"+line+"\r\n") {
+					t.Errorf("Expected %q in the object:\n%s", line, data)
+				}
+			}
+		}
+		rr := asOwner("GET", path, "", nil)
+		expectZoned(t, rr)
+
+		// A client saves the object as it was exported
+		if rr := asOwner("PUT", path, rr.Body.String(), map[string]string{"Content-Type": "text/calendar", "If-Match": rr.Header().Get("ETag")}); rr.Code != http.StatusNoContent {
+			t.Fatalf("PUT returned status %d: %s", rr.Code, rr.Body.String())
+		}
+		expectZoned(t, asOwner("GET", path, "", nil))
+	})
+}
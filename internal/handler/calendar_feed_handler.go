@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"schedule-app/internal/ical"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarFeedHandler は iCalendar (.ics) フィードの配信と、フィードトークンの管理を行います。
+type CalendarFeedHandler struct {
+	scheduleRepo  *repository.ScheduleRepository
+	userRepo      *repository.UserRepository
+	feedTokenRepo *repository.FeedTokenRepository
+	shareRepo     *repository.ShareRepository
+}
+
+// NewCalendarFeedHandler は CalendarFeedHandler の新しいインスタンスを生成します。
+func NewCalendarFeedHandler(scheduleRepo *repository.ScheduleRepository, userRepo *repository.UserRepository, feedTokenRepo *repository.FeedTokenRepository, shareRepo *repository.ShareRepository) *CalendarFeedHandler {
+	return &CalendarFeedHandler{
+		scheduleRepo:  scheduleRepo,
+		userRepo:      userRepo,
+		feedTokenRepo: feedTokenRepo,
+		shareRepo:     shareRepo,
+	}
+}
+
+// CreateFeedToken はログイン中のユーザーのフィードトークンを発行します。
+// 既存のトークンは無効になり、そのトークンを使った購読はすべて停止します。
+func (h *CalendarFeedHandler) CreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	token, err := h.feedTokenRepo.Rotate(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to create feed token for user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create feed token")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"token": token})
+}
+
+// RevokeFeedToken はログイン中のユーザーのフィードトークンを無効にします。
+func (h *CalendarFeedHandler) RevokeFeedToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	if err := h.feedTokenRepo.Revoke(userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Feed token not found")
+		} else {
+			log.Printf("ERROR: Failed to revoke feed token for user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to revoke feed token")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// GetCalendarFeed は指定されたユーザーのカレンダーを iCalendar 形式で返します。
+// カレンダークライアントは Authorization ヘッダーを送信できないため、
+// 購読するユーザー自身のフィードトークンを "token" クエリパラメータで受け取ります。
+// トークンの持ち主が所有者のカレンダーへの read 権限を持つ必要があります。
+func (h *CalendarFeedHandler) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		errorJSON(w, http.StatusUnauthorized, "Feed token required")
+		return
+	}
+	subscriberID, err := h.feedTokenRepo.FindUserIDByToken(token)
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Invalid feed token")
+		return
+	}
+
+	ownerIDStr := r.PathValue("ownerID")
+	ownerID, err := strconv.ParseInt(ownerIDStr, 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid owner ID")
+		return
+	}
+	owner, err := h.userRepo.FindUserByID(ownerID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: Failed to get user %d: %v", ownerID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve calendar")
+		}
+		return
+	}
+	if !requireCalendarPermission(w, h.shareRepo, model.OwnerUser, ownerID, subscriberID, model.PermissionRead) {
+		return
+	}
+
+	// 繰り返しスケジュールは展開せず、RRULE を持つ VEVENT として出力します。
+	schedules, _, err := h.scheduleRepo.FindByOwnerID(ownerID, &model.ScheduleQuery{KeepSeries: true})
+	if err != nil {
+		log.Printf("ERROR: Failed to get schedules for owner %d: %v", ownerID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve calendar")
+		return
+	}
+
+	cal := &ical.Calendar{Name: owner.Username, Events: ical.EventsFromSchedules(schedules, time.Now())}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	w.WriteHeader(http.StatusOK)
+	if err := cal.Encode(w); err != nil {
+		log.Printf("ERROR: Failed to write calendar feed for owner %d: %v", ownerID, err)
+	}
+}
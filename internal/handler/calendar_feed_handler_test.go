@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestCalendarFeedHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	ownerID := createUser(t, server, "feedowner", "feedowner@example.com", "password123")
+	participantID := createUser(t, server, "feedguest", "feedguest@example.com", "password123")
+	ownerToken := loginUser(t, server, "feedowner@example.com", "password123")
+	guestToken := loginUser(t, server, "feedguest@example.com", "password123")
+
+	requestBody := fmt.Sprintf(
+		`{"title": "Planning; Q4, all hands", "description": "Line one\nLine two", "location": "Room 1", "owner_id": %d, "start_time": "2025-11-03T09:00:00Z", "end_time": "2025-11-03T10:00:00Z", "participant_ids": [%d], "recurrence_rule": "FREQ=WEEKLY;COUNT=4"}`,
+		ownerID, participantID,
+	)
+	req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	if rr := server.executeRequest(req); rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create schedule: %s", rr.Body.String())
+	}
+
+	var feedToken string
+
+	// --- Test Cases ---
+	t.Run("Should require a feed token", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/calendar.ics", ownerID), nil)
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+		req, _ = http.NewRequest("GET", fmt.Sprintf("/api/users/%d/calendar.ics?token=bogus", ownerID), nil)
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("Should issue a feed token", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/users/feed-token", nil)
+		req.Header.Set("Authorization", "Bearer "+guestToken)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+		}
+		var resp map[string]string
+		json.NewDecoder(rr.Body).Decode(&resp)
+		feedToken = resp["token"]
+		if feedToken == "" {
+			t.Fatalf("Expected a feed token, but got none")
+		}
+	})
+
+	t.Run("Should render another user's calendar as iCalendar", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/calendar.ics?token=%s", ownerID, feedToken), nil)
+		if rr := server.executeRequest(req); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 before the calendar is shared, got %d", rr.Code)
+		}
+
+		shareCalendar(t, server, ownerToken, ownerID, participantID, model.PermissionRead)
+		req, _ = http.NewRequest("GET", fmt.Sprintf("/api/users/%d/calendar.ics?token=%s", ownerID, feedToken), nil)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("Expected text/calendar content type, got %q", ct)
+		}
+
+		body := rr.Body.String()
+		for _, want := range []string{
+			"BEGIN:VCALENDAR\r\n",
+			"VERSION:2.0\r\n",
+			"BEGIN:VEVENT\r\n",
+			"DTSTART:20251103T090000Z\r\n",
+			"DTEND:20251103T100000Z\r\n",
+			"RRULE:FREQ=WEEKLY;COUNT=4\r\n",
+			`SUMMARY:Planning\; Q4\, all hands` + "\r\n",
+			`DESCRIPTION:Line one\nLine two` + "\r\n",
+			"LOCATION:Room 1\r\n",
+			"ATTENDEE;CN=feedguest;PARTSTAT=NEEDS-ACTION:mailto:feedguest@example.com\r\n",
+			"END:VCALENDAR\r\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected feed to contain %q, got:\n%s", want, body)
+			}
+		}
+		if strings.Count(body, "BEGIN:VEVENT") != 1 {
+			t.Errorf("Expected the recurring schedule to be exported as a single VEVENT")
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("Line exceeds 75 octets: %q", line)
+			}
+		}
+	})
+
+	t.Run("Should reject the feed token after revocation", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/users/feed-token", nil)
+		req.Header.Set("Authorization", "Bearer "+guestToken)
+		if rr := server.executeRequest(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("/api/users/%d/calendar.ics?token=%s", ownerID, feedToken), nil)
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	})
+}
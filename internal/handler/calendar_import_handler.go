@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"schedule-app/internal/ical"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxImportBytes は取り込むカレンダーデータの最大サイズです。
+const maxImportBytes = 10 << 20
+
+// CalendarImportHandler は iCalendar (.ics) データからのスケジュールの一括取り込みを処理します。
+type CalendarImportHandler struct {
+	scheduleRepo *repository.ScheduleRepository
+	userRepo     *repository.UserRepository
+}
+
+// NewCalendarImportHandler は CalendarImportHandler の新しいインスタンスを生成します。
+func NewCalendarImportHandler(scheduleRepo *repository.ScheduleRepository, userRepo *repository.UserRepository) *CalendarImportHandler {
+	return &CalendarImportHandler{scheduleRepo: scheduleRepo, userRepo: userRepo}
+}
+
+// importCandidate は取り込み対象の VEVENT と、変換したリクエスト・結果をまとめたものです。
+type importCandidate struct {
+	req    *model.CreateScheduleRequest
+	result *model.ImportEventResult
+}
+
+// ImportSchedules は text/calendar のリクエストボディに含まれる VEVENT を、
+// 指定されたユーザーのカレンダーにスケジュールとして取り込みます。
+// ATTENDEE のメールアドレスは既存のユーザーに対応付け、すべての作成を単一トランザクションで行います。
+// 結果は作成 (created)、スキップ (skipped: UID の重複など)、失敗 (failed) に分けて返します。
+// 既存の予定の一括コピーのため、ScheduleHandler.CreateSchedule と異なり、重複の確認、通知、イベントの配信 (SSE・Webhook)、
+// 招待メールの送信は行いません。取り込む予定の招待は元のカレンダーで送信済みです
+// (CalDAV の PutObject / DeleteObject も、招待はクライアントが送信するため招待メールを送信しません)。
+func (h *CalendarImportHandler) ImportSchedules(w http.ResponseWriter, r *http.Request) {
+	creatorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	ownerIDStr := r.PathValue("ownerID")
+	ownerID, err := strconv.ParseInt(ownerIDStr, 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid owner ID")
+		return
+	}
+	if _, err := h.userRepo.FindUserByID(ownerID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: Failed to get user %d: %v", ownerID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to import schedules")
+		}
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "text/calendar" {
+		errorJSON(w, http.StatusUnsupportedMediaType, "Content-Type must be text/calendar")
+		return
+	}
+
+	cal, eventErrs, err := ical.Decode(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid iCalendar data: "+err.Error())
+		return
+	}
+
+	resp := model.ImportSchedulesResponse{
+		Created: []*model.ImportEventResult{},
+		Skipped: []*model.ImportEventResult{},
+		Failed:  []*model.ImportEventResult{},
+	}
+	for _, e := range eventErrs {
+		resp.Failed = append(resp.Failed, &model.ImportEventResult{UID: e.UID, Title: e.Summary, Reason: e.Err.Error()})
+	}
+
+	// VEVENT をリクエストに変換 (ATTENDEE はメールアドレスでユーザーに対応付け)
+	usersByEmail := make(map[string]*model.User)
+	var candidates []*importCandidate
+	for _, ev := range cal.Events {
+		result := &model.ImportEventResult{UID: ev.UID, RecurrenceID: ev.RecurrenceID, Title: ev.Summary}
+		if ev.Status == "CANCELLED" {
+			result.Reason = "event is cancelled"
+			resp.Skipped = append(resp.Skipped, result)
+			continue
+		}
+		req, unmatched, reason := scheduleRequestFromEvent(h.userRepo, ev, ownerID, usersByEmail)
+		result.UnmatchedAttendees = unmatched
+		if reason != "" {
+			result.Reason = reason
+			resp.Failed = append(resp.Failed, result)
+			continue
+		}
+		candidates = append(candidates, &importCandidate{req: req, result: result})
+	}
+
+	// 単一発生の変更を系列に紐付けられるよう、系列を先に作成する
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].req.RecurrenceID == nil && candidates[j].req.RecurrenceID != nil
+	})
+	reqs := make([]*model.CreateScheduleRequest, len(candidates))
+	for i, c := range candidates {
+		reqs[i] = c.req
+	}
+
+	ids, err := h.scheduleRepo.Import(reqs, creatorID)
+	if err != nil {
+		log.Printf("ERROR: Failed to import schedules for owner %d: %v", ownerID, err)
+		if strings.Contains(err.Error(), "not authorized") {
+			errorJSON(w, http.StatusForbidden, "Forbidden: You do not have write access to this calendar")
+		} else {
+			errorJSON(w, http.StatusInternalServerError, "Failed to import schedules")
+		}
+		return
+	}
+	for i, c := range candidates {
+		if ids[i] == 0 {
+			c.result.Reason = "duplicate UID"
+			resp.Skipped = append(resp.Skipped, c.result)
+			continue
+		}
+		c.result.ScheduleID = ids[i]
+		resp.Created = append(resp.Created, c.result)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// scheduleRequestFromEvent は VEVENT を作成リクエストに変換します。
+// ATTENDEE のメールアドレスは既存のユーザーに対応付け (usersByEmail に結果をキャッシュ)、
+// 対応するユーザーがいないアドレスを unmatched として返します。変換できない場合は失敗の理由を返します。
+func scheduleRequestFromEvent(userRepo *repository.UserRepository, ev *ical.Event, ownerID int64, usersByEmail map[string]*model.User) (req *model.CreateScheduleRequest, unmatched []string, reason string) {
+	req = &model.CreateScheduleRequest{
+		UID:          ev.UID,
+		RecurrenceID: ev.RecurrenceID,
+		Title:        strings.TrimSpace(ev.Summary),
+		StartTime:    ev.Start,
+		EndTime:      ev.End,
+		Description:  ev.Description,
+		Location:     ev.Location,
+		OwnerID:      ownerID,
+		ExDates:      ev.ExDates,
+	}
+	if req.Title == "" {
+		return nil, nil, "SUMMARY is required"
+	}
+	if ev.RRule != "" {
+		if ev.RecurrenceID != nil {
+			return nil, nil, "RRULE on an overridden occurrence is not supported"
+		}
+		rule, err := normalizeRecurrenceRule(ev.RRule)
+		if err != nil {
+			return nil, nil, "unsupported RRULE: " + err.Error()
+		}
+		req.RecurrenceRule = rule
+	} else if len(ev.ExDates) > 0 {
+		req.ExDates = nil
+	}
+
+	seen := make(map[int64]bool)
+	for _, a := range ev.Attendees {
+		user, ok := usersByEmail[a.Email]
+		if !ok {
+			// 見つからない場合も nil を記録し、同じアドレスの再検索を避ける
+			user, _ = userRepo.FindUserByEmail(a.Email)
+			usersByEmail[a.Email] = user
+		}
+		if user == nil {
+			unmatched = append(unmatched, a.Email)
+			continue
+		}
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			req.ParticipantIDs = append(req.ParticipantIDs, user.ID)
+		}
+	}
+	return req, unmatched, ""
+}
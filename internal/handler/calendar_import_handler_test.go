@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+)
+
+const importCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Other Tool//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Asia/Tokyo\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:kickoff-1@other.example\r\n" +
+	"DTSTAMP:20251001T000000Z\r\n" +
+	"DTSTART;TZID=Asia/Tokyo:20251105T100000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"SUMMARY:Project kickoff\\, phase 1\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Intro\r\n" +
+	"ATTENDEE;CN=\"Guest, Known\":mailto:importguest@example.com\r\n" +
+	"ATTENDEE:mailto:stranger@example.org\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT10M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly-1@other.example\r\n" +
+	"RECURRENCE-ID:20251110T090000Z\r\n" +
+	"DTSTART:20251110T130000Z\r\n" +
+	"DTEND:20251110T133000Z\r\n" +
+	"SUMMARY:Weekly sync (moved)\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly-1@other.example\r\n" +
+	"DTSTART:20251103T090000Z\r\n" +
+	"DTEND:20251103T093000Z\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=3\r\n" +
+	"SUMMARY:Weekly sync\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:broken-1@other.example\r\n" +
+	"SUMMARY:No start\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:hourly-1@other.example\r\n" +
+	"DTSTART:20251103T090000Z\r\n" +
+	"RRULE:FREQ=HOURLY\r\n" +
+	"SUMMARY:Too often\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestCalendarImportHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	ownerID := createUser(t, server, "importer", "importer@example.com", "password123")
+	guestID := createUser(t, server, "importguest", "importguest@example.com", "password123")
+	token := loginUser(t, server, "importer@example.com", "password123")
+
+	importICS := func(t *testing.T, body string) model.ImportSchedulesResponse {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/users/%d/schedules/import", ownerID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var resp model.ImportSchedulesResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Could not decode response: %v", err)
+		}
+		return resp
+	}
+
+	// --- Test Cases ---
+	t.Run("Should reject a non-calendar content type", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/users/%d/schedules/import", ownerID), strings.NewReader(importCalendar))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnsupportedMediaType)
+		}
+	})
+
+	t.Run("Should import events and report failures", func(t *testing.T) {
+		resp := importICS(t, importCalendar)
+		if len(resp.Created) != 3 {
+			t.Fatalf("Expected 3 created events, got %+v", resp.Created)
+		}
+		if len(resp.Failed) != 2 {
+			t.Fatalf("Expected 2 failed events, got %+v", resp.Failed)
+		}
+		for _, f := range resp.Failed {
+			if f.Reason == "" {
+				t.Errorf("Expected a reason for failed event %s", f.UID)
+			}
+		}
+		for _, c := range resp.Created {
+			if c.UID == "kickoff-1@other.example" && (len(c.UnmatchedAttendees) != 1 || c.UnmatchedAttendees[0] != "stranger@example.org") {
+				t.Errorf("Expected stranger@example.org to be reported as unmatched, got %v", c.UnmatchedAttendees)
+			}
+		}
+	})
+
+	t.Run("Should map attendees and time zones onto the imported schedule", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?from=2025-11-05T00:00:00Z&to=2025-11-06T00:00:00Z", ownerID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		var resp model.ScheduleListResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if len(resp.Schedules) != 1 {
+			t.Fatalf("Expected 1 schedule, got %d", len(resp.Schedules))
+		}
+		s := resp.Schedules[0]
+		if s.Title != "Project kickoff, phase 1" || s.Description != "Agenda:\n1. Intro" {
+			t.Errorf("Unexpected title/description: %q / %q", s.Title, s.Description)
+		}
+		if got := s.StartTime.UTC().Format("15:04"); got != "01:00" {
+			t.Errorf("Expected 10:00 Asia/Tokyo to be 01:00 UTC, got %s", got)
+		}
+		if s.EndTime.Sub(s.StartTime).Minutes() != 90 {
+			t.Errorf("Expected a 90 minute duration, got %v", s.EndTime.Sub(s.StartTime))
+		}
+		if len(s.Participants) != 1 || s.Participants[0].ID != guestID {
+			t.Errorf("Expected the known attendee to be a participant, got %+v", s.Participants)
+		}
+	})
+
+	t.Run("Should link overridden occurrences to their series", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?from=2025-11-03T00:00:00Z&to=2025-11-30T00:00:00Z", ownerID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		var resp model.ScheduleListResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+
+		var titles []string
+		for _, s := range resp.Schedules {
+			if strings.HasPrefix(s.Title, "Weekly sync") {
+				titles = append(titles, s.Title+"@"+s.StartTime.UTC().Format("01-02T15"))
+			}
+		}
+		expected := "[Weekly sync@11-03T09 Weekly sync (moved)@11-10T13 Weekly sync@11-17T09]"
+		if fmt.Sprint(titles) != expected {
+			t.Errorf("Expected %s, got %v", expected, titles)
+		}
+	})
+
+	t.Run("Should skip events whose UID was already imported", func(t *testing.T) {
+		resp := importICS(t, importCalendar)
+		if len(resp.Created) != 0 || len(resp.Skipped) != 3 {
+			t.Fatalf("Expected 0 created and 3 skipped events, got %d created and %d skipped", len(resp.Created), len(resp.Skipped))
+		}
+		if resp.Skipped[0].Reason != "duplicate UID" {
+			t.Errorf("Expected reason 'duplicate UID', got %q", resp.Skipped[0].Reason)
+		}
+	})
+
+	t.Run("Should import without conflict checks or notifications", func(t *testing.T) {
+		// Overlaps the imported kickoff of the owner and the guest
+		overlapping := "BEGIN:VCALENDAR\r\n" +
+			"VERSION:2.0\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:overlap-1@other.example\r\n" +
+			"DTSTART:20251105T013000Z\r\n" +
+			"DTEND:20251105T020000Z\r\n" +
+			"SUMMARY:Overlapping review\r\n" +
+			"ATTENDEE:mailto:importguest@example.com\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"
+		resp := importICS(t, overlapping)
+		if len(resp.Created) != 1 {
+			t.Fatalf("Expected the overlapping event to be imported, got %+v", resp)
+		}
+		var notifications int
+		server.db.QueryRow("SELECT count(*) FROM notifications WHERE user_id = ?", guestID).Scan(&notifications)
+		if notifications != 0 {
+			t.Errorf("Expected no notifications for imported events, got %d", notifications)
+		}
+	})
+}
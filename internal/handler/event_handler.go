@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"schedule-app/internal/events"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"time"
+)
+
+// eventRetryMillis は切断したクライアントが再接続するまでの待ち時間 (ミリ秒) です。
+const eventRetryMillis = 3000
+
+// EventHandler はスケジュールの変更を Server-Sent Events で配信します。
+type EventHandler struct {
+	hub       *events.Hub
+	shareRepo *repository.ShareRepository
+	heartbeat time.Duration
+}
+
+// NewEventHandler は EventHandler の新しいインスタンスを生成します。
+// heartbeat の間隔で、プロキシなどに接続を切断されないためのコメントを送信します。
+func NewEventHandler(hub *events.Hub, shareRepo *repository.ShareRepository, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{hub: hub, shareRepo: shareRepo, heartbeat: heartbeat}
+}
+
+// Stream はログイン中のユーザーが閲覧できるカレンダーのスケジュールの変更を text/event-stream で配信します。
+// Last-Event-ID ヘッダーが指定された場合は、そのイベント以降に見逃したイベントから配信します。
+// 再開できない場合は reset イベントを送信するため、クライアントは表示中のスケジュールを取得し直します。
+// 認証は接続時だけでなく、トークンの有効期限に配信を終了し、ハートビートのたびにセッションやトークンが無効にされていないかを確認します。
+// 終了した場合、クライアントは新しいトークンで再接続します。
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sub, missed, resumed := h.hub.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx のバッファリングを無効化
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+	if !resumed {
+		// 空のIDで、クライアントが保持している最後のイベントIDを消去
+		fmt.Fprint(w, "id: \nevent: reset\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		if err := h.writeEvent(w, userID, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("ERROR: Failed to flush event stream: %v", err)
+		return
+	}
+
+	var expired <-chan time.Time
+	if expiresAt, ok := middleware.GetExpiryFromContext(r.Context()); ok {
+		timer := time.NewTimer(time.Until(expiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-ticker.C:
+			if err := middleware.RecheckCredentials(r.Context()); err != nil {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				// 受信が遅れて購読が解除された (クライアントは Last-Event-ID で再開する)
+				return
+			}
+			if err := h.writeEvent(w, userID, e); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent はユーザーが閲覧できるイベントを1件書き込みます。閲覧できないイベントは読み飛ばします。
+func (h *EventHandler) writeEvent(w io.Writer, userID int64, e *model.ScheduleEvent) error {
+	if !h.canSee(userID, e) {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// canSee はユーザーがイベントを受信できるかを判定します。
+// カレンダーの所有者とスケジュールの参加者 (変更前の参加者を含む) のほか、所有者のカレンダーへの read 権限を持つユーザーが受信できます。
+// 共有は配信時に確認するため、取り消された共有のイベントは配信しません。
+func (h *EventHandler) canSee(userID int64, e *model.ScheduleEvent) bool {
+	if e.VisibleTo(userID) {
+		return true
+	}
+	permission, err := h.shareRepo.Permission(e.OwnerType, e.OwnerID, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get permission of user %d on calendar %s %d: %v", userID, e.OwnerType, e.OwnerID, err)
+		return false
+	}
+	return permission.Allows(model.PermissionRead)
+}
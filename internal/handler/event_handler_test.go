@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sseMessage is an event or a comment read from an event stream.
+type sseMessage struct {
+	id      string
+	hasID   bool
+	event   string
+	data    string
+	comment string
+}
+
+// openEventStream connects to the event stream of the server and returns the messages read from it.
+// The connection is closed when the test ends.
+func openEventStream(t *testing.T, ts *httptest.Server, token, lastEventID string) <-chan sseMessage {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	ch := make(chan sseMessage, 100)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+		scanner := bufio.NewScanner(resp.Body)
+		var msg sseMessage
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				if msg.event != "" || msg.comment != "" {
+					ch <- msg
+				}
+				msg = sseMessage{}
+				continue
+			}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "":
+				msg.comment = value
+			case "id":
+				msg.id, msg.hasID = value, true
+			case "event":
+				msg.event = value
+			case "data":
+				msg.data = value
+			}
+		}
+	}()
+	return ch
+}
+
+// nextEvent returns the next event of the stream, skipping heartbeats.
+func nextEvent(t *testing.T, messages <-chan sseMessage) sseMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				t.Fatal("Event stream closed")
+			}
+			if msg.event != "" {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for an event")
+		}
+	}
+}
+
+// expectClosed waits until the server ends the event stream.
+func expectClosed(t *testing.T, messages <-chan sseMessage) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the event stream to end")
+		}
+	}
+}
+
+// expectEvent reads the next event and checks its type and schedule.
+func expectEvent(t *testing.T, messages <-chan sseMessage, eventType model.ScheduleEventType, scheduleID int64) *model.ScheduleEvent {
+	t.Helper()
+	msg := nextEvent(t, messages)
+	var e model.ScheduleEvent
+	if err := json.Unmarshal([]byte(msg.data), &e); err != nil {
+		t.Fatalf("Failed to decode event %q: %v", msg.data, err)
+	}
+	if msg.event != string(eventType) || e.Type != eventType || e.ScheduleID != scheduleID || msg.id == "" {
+		t.Fatalf("Expected %s of schedule %d, got %s %s", eventType, scheduleID, msg.event, msg.data)
+	}
+	e.ID = msg.id
+	return &e
+}
+
+func TestEventStream(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+	ts := httptest.NewServer(server.router)
+	// Registered first so that it runs after the streams are closed.
+	t.Cleanup(ts.Close)
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	createUser(t, server, "dave", "dave@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	carolToken := loginUser(t, server, "carol@example.com", "password123")
+	daveToken := loginUser(t, server, "dave@example.com", "password123")
+	shareCalendar(t, server, bobToken, bobID, carolID, model.PermissionRead)
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	scheduleBody := func(title string, ownerID int64, participantIDs string) string {
+		start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+		return fmt.Sprintf(`{"title": %q, "start_time": "%s", "end_time": "%s", "owner_id": %d, "participant_ids": [%s], "allow_conflicts": true}`,
+			title, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), ownerID, participantIDs)
+	}
+
+	// --- Test Cases ---
+	t.Run("Should require authentication", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/api/events/stream")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	})
+
+	var firstBobEventID string
+	var aliceScheduleID int64
+	t.Run("Should stream changes of visible calendars only", func(t *testing.T) {
+		alice := openEventStream(t, ts, aliceToken, "")
+		bob := openEventStream(t, ts, bobToken, "")
+		carol := openEventStream(t, ts, carolToken, "")
+		dave := openEventStream(t, ts, daveToken, "")
+
+		aliceScheduleID = createSchedule(t, server, aliceToken, scheduleBody("Planning", aliceID, fmt.Sprint(bobID)))
+		bobScheduleID := createSchedule(t, server, bobToken, scheduleBody("Focus time", bobID, ""))
+		if code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, `{"title": "Planning v2", "participant_ids": []}`); code != http.StatusOK {
+			t.Fatalf("Failed to update schedule: %s", body)
+		}
+		if code, _ := send("DELETE", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Failed to delete schedule: %d", code)
+		}
+		if code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", bobScheduleID), bobToken, `{"title": "Deep work"}`); code != http.StatusOK {
+			t.Fatalf("Failed to update schedule: %s", body)
+		}
+
+		// alice owns her calendar
+		created := expectEvent(t, alice, model.EventScheduleCreated, aliceScheduleID)
+		if created.ActorID != aliceID || created.OwnerID != aliceID || created.Schedule == nil || created.Schedule.Title != "Planning" {
+			t.Errorf("Unexpected event: %+v", created)
+		}
+		expectEvent(t, alice, model.EventScheduleUpdated, aliceScheduleID)
+		deleted := expectEvent(t, alice, model.EventScheduleDeleted, aliceScheduleID)
+		if deleted.Schedule != nil {
+			t.Errorf("Expected no schedule in deletion events, got %+v", deleted.Schedule)
+		}
+
+		// bob is notified as a participant until he is removed
+		firstBobEventID = expectEvent(t, bob, model.EventScheduleCreated, aliceScheduleID).ID
+		expectEvent(t, bob, model.EventScheduleCreated, bobScheduleID)
+		if updated := expectEvent(t, bob, model.EventScheduleUpdated, aliceScheduleID); updated.Schedule.Title != "Planning v2" {
+			t.Errorf("Expected the updated schedule, got %+v", updated.Schedule)
+		}
+		expectEvent(t, bob, model.EventScheduleUpdated, bobScheduleID)
+
+		// carol can read bob's calendar only
+		expectEvent(t, carol, model.EventScheduleCreated, bobScheduleID)
+		expectEvent(t, carol, model.EventScheduleUpdated, bobScheduleID)
+
+		// dave sees nothing but heartbeats
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case msg := <-dave:
+				if msg.event != "" {
+					t.Fatalf("Expected no events for dave, got %s %s", msg.event, msg.data)
+				}
+				if msg.comment != "heartbeat" {
+					continue
+				}
+			case <-timeout:
+				t.Fatal("Timed out waiting for a heartbeat")
+			}
+			break
+		}
+	})
+
+	t.Run("Should resume from Last-Event-ID", func(t *testing.T) {
+		// bob missed everything after his first event while he was disconnected
+		bob := openEventStream(t, ts, bobToken, firstBobEventID)
+		next := nextEvent(t, bob)
+		if next.event != string(model.EventScheduleCreated) || next.id == firstBobEventID {
+			t.Errorf("Expected the events after %s, got %s %s", firstBobEventID, next.id, next.event)
+		}
+		expectEvent(t, bob, model.EventScheduleUpdated, aliceScheduleID)
+	})
+
+	t.Run("Should end the stream when the session is logged out", func(t *testing.T) {
+		token := loginUser(t, server, "dave@example.com", "password123")
+		dave := openEventStream(t, ts, token, "")
+		if code, body := send("POST", "/api/users/logout", token, ""); code != http.StatusOK && code != http.StatusNoContent {
+			t.Fatalf("Failed to log out: %d %s", code, body)
+		}
+		expectClosed(t, dave)
+	})
+
+	t.Run("Should end the stream when a personal access token is revoked", func(t *testing.T) {
+		code, body := send("POST", "/api/users/tokens", daveToken, `{"name": "dashboard", "scopes": ["read"]}`)
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to create token: %d %s", code, body)
+		}
+		var created model.CreatePersonalAccessTokenResponse
+		json.Unmarshal([]byte(body), &created)
+		dave := openEventStream(t, ts, created.Token, "")
+		if code, body := send("DELETE", fmt.Sprintf("/api/users/tokens/%d", created.ID), daveToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Failed to revoke token: %d %s", code, body)
+		}
+		expectClosed(t, dave)
+	})
+
+	t.Run("Should end the stream when the access token expires", func(t *testing.T) {
+		claims := &model.Claims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(daveToken, claims); err != nil {
+			t.Fatalf("Failed to parse token: %v", err)
+		}
+		expiresAt := time.Now().Add(time.Second)
+		claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		token, err := testKeySet.Sign(claims)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		dave := openEventStream(t, ts, token, "")
+		expectClosed(t, dave)
+		if time.Now().Before(expiresAt.Truncate(time.Second)) {
+			t.Errorf("Expected the stream to stay open until the token expires at %s", expiresAt)
+		}
+	})
+
+	t.Run("Should reset unknown Last-Event-IDs", func(t *testing.T) {
+		for _, lastEventID := range []string{"1-1", "invalid"} {
+			bob := openEventStream(t, ts, bobToken, lastEventID)
+			msg := nextEvent(t, bob)
+			if msg.event != "reset" || !msg.hasID || msg.id != "" {
+				t.Errorf("%s: expected a reset event clearing the ID, got %+v", lastEventID, msg)
+			}
+		}
+	})
+}
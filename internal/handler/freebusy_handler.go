@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"schedule-app/internal/freebusy"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFreeBusyUsers は1回の問い合わせで指定できるユーザー数の上限です。
+	maxFreeBusyUsers = 50
+	// maxFreeBusyWindow は問い合わせできる期間の上限です。
+	maxFreeBusyWindow = 90 * 24 * time.Hour
+)
+
+// FreeBusyHandler は複数ユーザーの空き状況 (free/busy) の問い合わせを処理します。
+type FreeBusyHandler struct {
+	scheduleRepo *repository.ScheduleRepository
+	userRepo     *repository.UserRepository
+	shareRepo    *repository.ShareRepository
+}
+
+// NewFreeBusyHandler は FreeBusyHandler の新しいインスタンスを生成します。
+func NewFreeBusyHandler(scheduleRepo *repository.ScheduleRepository, userRepo *repository.UserRepository, shareRepo *repository.ShareRepository) *FreeBusyHandler {
+	return &FreeBusyHandler{scheduleRepo: scheduleRepo, userRepo: userRepo, shareRepo: shareRepo}
+}
+
+// GetFreeBusy は指定されたユーザーそれぞれについて、期間内の埋まっている時間帯を結合して返します。
+// ユーザーが所有者または参加者であるスケジュールを対象とし、タイトルや説明などの内容は返しません。
+// 各ユーザーのカレンダーへの free-busy 以上の権限が必要です。
+func (h *FreeBusyHandler) GetFreeBusy(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	var req model.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	userIDs, err := validateFreeBusyRequest(&req)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.checkUsersVisible(w, requesterID, userIDs) {
+		return
+	}
+
+	busy, err := h.scheduleRepo.FindBusyIntervals(userIDs, req.From, req.To)
+	if err != nil {
+		log.Printf("ERROR: Failed to get busy intervals: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve free/busy information")
+		return
+	}
+
+	resp := model.FreeBusyResponse{From: req.From, To: req.To, Users: []*model.UserFreeBusy{}}
+	for _, id := range userIDs {
+		resp.Users = append(resp.Users, &model.UserFreeBusy{
+			UserID: id,
+			Busy:   freebusy.Merge(busy[id], req.From, req.To),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkUsersVisible はすべてのユーザーが存在し、requesterID がその空き状況を参照できるかを確認します。
+// 確認できない場合は応答を書き込み false を返します。
+func (h *FreeBusyHandler) checkUsersVisible(w http.ResponseWriter, requesterID int64, userIDs []int64) bool {
+	for _, id := range userIDs {
+		if _, err := h.userRepo.FindUserByID(id); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				errorJSON(w, http.StatusNotFound, fmt.Sprintf("User %d not found", id))
+			} else {
+				log.Printf("ERROR: Failed to get user %d: %v", id, err)
+				errorJSON(w, http.StatusInternalServerError, "Failed to retrieve free/busy information")
+			}
+			return false
+		}
+		permission, err := h.shareRepo.Permission(model.OwnerUser, id, requesterID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get permission of user %d on calendar %d: %v", requesterID, id, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve free/busy information")
+			return false
+		}
+		if !permission.Allows(model.PermissionFreeBusy) {
+			errorJSON(w, http.StatusForbidden, fmt.Sprintf("Forbidden: You do not have free-busy access to user %d", id))
+			return false
+		}
+	}
+	return true
+}
+
+// validateFreeBusyRequest はリクエストを検証し、重複を除いたユーザーIDを指定順に返します。
+func validateFreeBusyRequest(req *model.FreeBusyRequest) ([]int64, error) {
+	if err := validateFreeBusyWindow(req.From, req.To); err != nil {
+		return nil, err
+	}
+	return uniqueUserIDs(req.UserIDs, "user_ids")
+}
+
+// validateFreeBusyWindow は問い合わせる期間を検証します。
+func validateFreeBusyWindow(from, to time.Time) error {
+	if from.IsZero() || to.IsZero() {
+		return fmt.Errorf("from and to are required")
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > maxFreeBusyWindow {
+		return fmt.Errorf("time window must not exceed %d days", int(maxFreeBusyWindow.Hours()/24))
+	}
+	return nil
+}
+
+// uniqueUserIDs は重複を除いたユーザーIDを指定順に返します。field はエラーメッセージに使うフィールド名です。
+func uniqueUserIDs(ids []int64, field string) ([]int64, error) {
+	seen := make(map[int64]bool)
+	var userIDs []int64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil, fmt.Errorf("%s is required", field)
+	}
+	if len(userIDs) > maxFreeBusyUsers {
+		return nil, fmt.Errorf("%s must not contain more than %d users", field, maxFreeBusyUsers)
+	}
+	return userIDs, nil
+}
+
+const (
+	defaultSuggestStep  = 30 * time.Minute
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// weekdayCodes は RFC 5545 の曜日コードと time.Weekday の対応です。
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// SuggestSlots は参加者の空き状況から会議の候補時間を探し、空いている参加者が多い順に返します。
+// 勤務時間 (曜日・時間帯・タイムゾーン) と、最低限空いている必要がある参加者数を指定できます。
+// 各参加者のカレンダーへの free-busy 以上の権限が必要です。
+func (h *FreeBusyHandler) SuggestSlots(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	var req model.SuggestSlotsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	userIDs, opts, err := parseSuggestSlotsRequest(&req)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.checkUsersVisible(w, requesterID, userIDs) {
+		return
+	}
+
+	busy, err := h.scheduleRepo.FindBusyIntervals(userIDs, opts.From, opts.To)
+	if err != nil {
+		log.Printf("ERROR: Failed to get busy intervals: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to suggest meeting times")
+		return
+	}
+
+	resp := model.SuggestSlotsResponse{Slots: freebusy.Suggest(userIDs, busy, *opts)}
+	if resp.Slots == nil {
+		resp.Slots = []*model.SuggestedSlot{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseSuggestSlotsRequest はリクエストを検証し、重複を除いた参加者IDと検索条件を返します。
+func parseSuggestSlotsRequest(req *model.SuggestSlotsRequest) ([]int64, *freebusy.SuggestOptions, error) {
+	if err := validateFreeBusyWindow(req.From, req.To); err != nil {
+		return nil, nil, err
+	}
+	userIDs, err := uniqueUserIDs(req.ParticipantIDs, "participant_ids")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &freebusy.SuggestOptions{
+		From:         req.From,
+		To:           req.To,
+		Duration:     time.Duration(req.DurationMinutes) * time.Minute,
+		Step:         defaultSuggestStep,
+		MinAttendees: req.MinAttendees,
+		Limit:        req.Limit,
+	}
+	if req.DurationMinutes <= 0 || opts.Duration > 24*time.Hour {
+		return nil, nil, fmt.Errorf("duration_minutes must be between 1 and 1440")
+	}
+	if req.StepMinutes != 0 {
+		if req.StepMinutes < 5 || req.StepMinutes > 1440 {
+			return nil, nil, fmt.Errorf("step_minutes must be between 5 and 1440")
+		}
+		opts.Step = time.Duration(req.StepMinutes) * time.Minute
+	}
+	if opts.MinAttendees == 0 {
+		opts.MinAttendees = len(userIDs)
+	}
+	if opts.MinAttendees < 1 || opts.MinAttendees > len(userIDs) {
+		return nil, nil, fmt.Errorf("min_attendees must be between 1 and the number of participants")
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultSuggestLimit
+	}
+	if opts.Limit < 1 || opts.Limit > maxSuggestLimit {
+		return nil, nil, fmt.Errorf("limit must be between 1 and %d", maxSuggestLimit)
+	}
+
+	wh, err := parseWorkingHours(req.WorkingHours)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.WorkingHours = *wh
+	return userIDs, opts, nil
+}
+
+// parseWorkingHours は勤務時間の指定を解析します。指定がない場合は全曜日の終日 (UTC) を返します。
+func parseWorkingHours(req *model.WorkingHours) (*freebusy.WorkingHours, error) {
+	wh := &freebusy.WorkingHours{Start: 0, End: 24 * time.Hour, Days: map[time.Weekday]bool{}, Location: time.UTC}
+	if req == nil {
+		for _, d := range weekdayCodes {
+			wh.Days[d] = true
+		}
+		return wh, nil
+	}
+
+	var err error
+	if wh.Start, err = parseClock(req.Start); err != nil {
+		return nil, fmt.Errorf("invalid working_hours.start: %w", err)
+	}
+	if wh.End, err = parseClock(req.End); err != nil {
+		return nil, fmt.Errorf("invalid working_hours.end: %w", err)
+	}
+	if wh.Start >= wh.End {
+		return nil, fmt.Errorf("working_hours.start must be before working_hours.end")
+	}
+
+	days := req.Days
+	if len(days) == 0 {
+		days = []string{"MO", "TU", "WE", "TH", "FR"}
+	}
+	for _, code := range days {
+		d, ok := weekdayCodes[strings.ToUpper(code)]
+		if !ok {
+			return nil, fmt.Errorf("invalid working_hours.days: %q", code)
+		}
+		wh.Days[d] = true
+	}
+
+	if req.TimeZone != "" {
+		if wh.Location, err = time.LoadLocation(req.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid working_hours.time_zone: %q", req.TimeZone)
+		}
+	}
+	return wh, nil
+}
+
+// parseClock は "HH:MM" 形式の時刻を 0:00 からの経過時間に変換します。"24:00" も受け付けます。
+func parseClock(s string) (time.Duration, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, fmt.Errorf("must be HH:MM")
+	}
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("must be HH:MM")
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
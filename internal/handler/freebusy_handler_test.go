@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestFreeBusyHandler(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	token := loginUser(t, server, "alice@example.com", "password123")
+	// bob and carol let alice manage their schedules (which includes their free/busy)
+	shareCalendar(t, server, loginUser(t, server, "bob@example.com", "password123"), bobID, aliceID, model.PermissionWrite)
+	shareCalendar(t, server, loginUser(t, server, "carol@example.com", "password123"), carolID, aliceID, model.PermissionWrite)
+
+	// alice: 10:00-11:00 (bob participates), bob: 10:30-12:00 and 13:00-13:30, carol: daily 09:00-09:30
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Secret review", "description": "confidential", "owner_id": %d, "participant_ids": [%d],
+		"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z"}`, aliceID, bobID))
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Bob focus", "owner_id": %d, "start_time": "2025-11-03T10:30:00Z", "end_time": "2025-11-03T12:00:00Z", "allow_conflicts": true}`, bobID))
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Bob lunch", "owner_id": %d, "start_time": "2025-11-03T13:00:00Z", "end_time": "2025-11-03T13:30:00Z"}`, bobID))
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Carol daily", "owner_id": %d, "start_time": "2025-11-01T09:00:00Z", "end_time": "2025-11-01T09:30:00Z", "recurrence_rule": "FREQ=DAILY"}`, carolID))
+
+	postFreeBusy := func(token, body string) (int, string) {
+		req, _ := http.NewRequest("POST", "/api/freebusy", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	formatBusy := func(u *model.UserFreeBusy) string {
+		var parts []string
+		for _, b := range u.Busy {
+			parts = append(parts, b.Start.Format("02T15:04")+"-"+b.End.Format("02T15:04"))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	// --- Test Cases ---
+	t.Run("Should require authentication", func(t *testing.T) {
+		code, _ := postFreeBusy("", `{"user_ids": [1], "from": "2025-11-03T00:00:00Z", "to": "2025-11-04T00:00:00Z"}`)
+		if code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code: got %v want %v", code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("Should return merged busy intervals per user", func(t *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": [%d, %d, %d], "from": "2025-11-03T09:15:00Z", "to": "2025-11-04T09:15:00Z"}`, bobID, aliceID, carolID)
+		code, respBody := postFreeBusy(token, body)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, respBody)
+		}
+		if strings.Contains(respBody, "Secret") || strings.Contains(respBody, "confidential") {
+			t.Errorf("Expected no schedule details in the response, got %s", respBody)
+		}
+
+		var resp model.FreeBusyResponse
+		json.Unmarshal([]byte(respBody), &resp)
+		if len(resp.Users) != 3 || resp.Users[0].UserID != bobID || resp.Users[1].UserID != aliceID {
+			t.Fatalf("Expected users in request order, got %+v", resp.Users)
+		}
+		expected := map[int64]string{
+			bobID:   "03T10:00-03T12:00,03T13:00-03T13:30",
+			aliceID: "03T10:00-03T11:00",
+			carolID: "03T09:15-03T09:30,04T09:00-04T09:15", // clipped to the window
+		}
+		for _, u := range resp.Users {
+			if got := formatBusy(u); got != expected[u.UserID] {
+				t.Errorf("User %d: expected busy %s, got %s", u.UserID, expected[u.UserID], got)
+			}
+		}
+	})
+
+	t.Run("Should not report declined schedules as busy", func(t *testing.T) {
+		scheduleID := createSchedule(t, server, token, fmt.Sprintf(`{"title": "Offsite", "owner_id": %d, "participant_ids": [%d, %d],
+			"start_time": "2025-11-05T15:00:00Z", "end_time": "2025-11-05T16:00:00Z"}`, aliceID, bobID, carolID))
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/schedules/%d/rsvp", scheduleID), bytes.NewBufferString(`{"status": "declined"}`))
+		req.Header.Set("Authorization", "Bearer "+loginUser(t, server, "carol@example.com", "password123"))
+		if rr := server.executeRequest(req); rr.Code != http.StatusOK {
+			t.Fatalf("Failed to decline: %s", rr.Body.String())
+		}
+
+		body := fmt.Sprintf(`{"user_ids": [%d, %d], "from": "2025-11-05T12:00:00Z", "to": "2025-11-05T18:00:00Z"}`, bobID, carolID)
+		code, respBody := postFreeBusy(token, body)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, respBody)
+		}
+		var resp model.FreeBusyResponse
+		json.Unmarshal([]byte(respBody), &resp)
+		if len(resp.Users) != 2 || formatBusy(resp.Users[0]) != "05T15:00-05T16:00" || formatBusy(resp.Users[1]) != "" {
+			t.Errorf("Expected only bob to be busy, got %s", respBody)
+		}
+	})
+
+	t.Run("Should reject invalid requests", func(t *testing.T) {
+		cases := []struct {
+			body string
+			want int
+		}{
+			{`{"user_ids": [], "from": "2025-11-03T00:00:00Z", "to": "2025-11-04T00:00:00Z"}`, http.StatusBadRequest},
+			{fmt.Sprintf(`{"user_ids": [%d], "from": "2025-11-04T00:00:00Z", "to": "2025-11-03T00:00:00Z"}`, aliceID), http.StatusBadRequest},
+			{fmt.Sprintf(`{"user_ids": [%d], "from": "2025-01-01T00:00:00Z", "to": "2026-01-01T00:00:00Z"}`, aliceID), http.StatusBadRequest},
+			{`{"user_ids": [9999], "from": "2025-11-03T00:00:00Z", "to": "2025-11-04T00:00:00Z"}`, http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			if code, body := postFreeBusy(token, tc.body); code != tc.want {
+				t.Errorf("Request %s: got %v want %v: %s", tc.body, code, tc.want, body)
+			}
+		}
+	})
+}
+
+func TestSuggestSlots(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	token := loginUser(t, server, "alice@example.com", "password123")
+	// bob and carol let alice manage their schedules (which includes their free/busy)
+	shareCalendar(t, server, loginUser(t, server, "bob@example.com", "password123"), bobID, aliceID, model.PermissionWrite)
+	shareCalendar(t, server, loginUser(t, server, "carol@example.com", "password123"), carolID, aliceID, model.PermissionWrite)
+
+	// Monday 2025-11-03 in Asia/Tokyo: alice is busy 09:00-10:00, bob 10:00-11:00, carol is free.
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Alice", "owner_id": %d, "start_time": "2025-11-03T09:00:00+09:00", "end_time": "2025-11-03T10:00:00+09:00"}`, aliceID))
+	createSchedule(t, server, token, fmt.Sprintf(`{"title": "Bob", "owner_id": %d, "start_time": "2025-11-03T10:00:00+09:00", "end_time": "2025-11-03T11:00:00+09:00"}`, bobID))
+
+	suggest := func(t *testing.T, extra string) (int, model.SuggestSlotsResponse) {
+		body := fmt.Sprintf(`{"participant_ids": [%d, %d, %d], "duration_minutes": 60, "step_minutes": 60,
+			"from": "2025-11-02T15:00:00Z", "to": "2025-11-03T15:00:00Z"%s}`, aliceID, bobID, carolID, extra)
+		req, _ := http.NewRequest("POST", "/api/schedules/suggest", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		var resp model.SuggestSlotsResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+	workingHours := `, "working_hours": {"start": "09:00", "end": "12:00", "time_zone": "Asia/Tokyo"}`
+
+	// --- Test Cases ---
+	t.Run("Should suggest slots where everyone is free by default", func(t *testing.T) {
+		code, resp := suggest(t, workingHours)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", code, http.StatusOK)
+		}
+		if len(resp.Slots) != 1 || resp.Slots[0].Start.Format("15:04Z07:00") != "02:00Z" || resp.Slots[0].AttendeeCount != 3 {
+			t.Errorf("Expected a single slot at 11:00 JST, got %+v", resp.Slots)
+		}
+	})
+
+	t.Run("Should rank slots by the number of available participants", func(t *testing.T) {
+		_, resp := suggest(t, workingHours+`, "min_attendees": 2`)
+		var got []string
+		for _, s := range resp.Slots {
+			got = append(got, fmt.Sprintf("%s/%d/%v", s.Start.Format("15:04"), s.AttendeeCount, s.UnavailableUserIDs))
+		}
+		expected := fmt.Sprintf("[02:00/3/[] 00:00/2/[%d] 01:00/2/[%d]]", aliceID, bobID)
+		if fmt.Sprint(got) != expected {
+			t.Errorf("Expected %s, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should only suggest slots on working days", func(t *testing.T) {
+		_, resp := suggest(t, `, "working_hours": {"start": "09:00", "end": "12:00", "time_zone": "Asia/Tokyo", "days": ["SA", "SU"]}`)
+		if len(resp.Slots) != 0 {
+			t.Errorf("Expected no slots on a Monday, got %+v", resp.Slots)
+		}
+	})
+
+	t.Run("Should reject invalid constraints", func(t *testing.T) {
+		for _, extra := range []string{
+			`, "working_hours": {"start": "12:00", "end": "09:00"}`,
+			`, "working_hours": {"start": "09:00", "end": "12:00", "time_zone": "Mars/Base"}`,
+			`, "working_hours": {"start": "9", "end": "12:00"}`,
+			`, "min_attendees": 4`,
+			`, "limit": 500`,
+		} {
+			if code, _ := suggest(t, extra); code != http.StatusBadRequest {
+				t.Errorf("Request with %s: got %v want %v", extra, code, http.StatusBadRequest)
+			}
+		}
+	})
+}
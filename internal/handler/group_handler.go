@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxGroupNameLength はグループ名の最大文字数です。
+const maxGroupNameLength = 100
+
+// GroupHandler はグループとメンバーの管理に関するHTTPリクエストを処理します。
+// 役割 (role) による権限チェックはリポジトリ層で行います。
+type GroupHandler struct {
+	groupRepo *repository.GroupRepository
+	userRepo  *repository.UserRepository
+}
+
+// NewGroupHandler は GroupHandler の新しいインスタンスを生成します。
+func NewGroupHandler(groupRepo *repository.GroupRepository, userRepo *repository.UserRepository) *GroupHandler {
+	return &GroupHandler{groupRepo: groupRepo, userRepo: userRepo}
+}
+
+// CreateGroup は新しいグループを作成します。作成したユーザーがグループの owner になります。
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	var req model.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if msg := validateGroupName(req.Name); msg != "" {
+		errorJSON(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	group, err := h.groupRepo.Create(&req, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to create group: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, group.ToGroupResponse())
+}
+
+// ListGroups はログイン中のユーザーが所属するグループの一覧を返します。
+func (h *GroupHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	groups, err := h.groupRepo.FindByUserID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get groups of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve groups")
+		return
+	}
+
+	resp := make([]*model.GroupResponse, len(groups))
+	for i, g := range groups {
+		resp[i] = g.ToGroupResponse()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetGroup はグループをメンバー一覧とともに返します。グループのメンバーのみが取得できます。
+func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	group, ok := findGroupForMember(w, h.groupRepo, groupID, userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, group.ToGroupResponse())
+}
+
+// UpdateGroup はグループの名前・説明を更新します。admin 以上の役割が必要です。
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	var req model.UpdateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if msg := validateGroupName(name); msg != "" {
+			errorJSON(w, http.StatusBadRequest, msg)
+			return
+		}
+		req.Name = &name
+	}
+
+	group, err := h.groupRepo.Update(groupID, &req, userID)
+	if err != nil {
+		writeGroupError(w, err, "update group")
+		return
+	}
+	writeJSON(w, http.StatusOK, group.ToGroupResponse())
+}
+
+// DeleteGroup はグループと、グループのカレンダーのスケジュールを削除します。owner の役割が必要です。
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	if err := h.groupRepo.Delete(groupID, userID); err != nil {
+		writeGroupError(w, err, "delete group")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// AddMember はユーザーをグループに追加するか、既存のメンバーの役割を変更します。
+// 新しく追加した場合は 201 を、役割を変更した場合は 200 を返します。
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	var req model.GroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Role == model.RoleNone {
+		req.Role = model.RoleMember
+	}
+	if !req.Role.Valid() {
+		errorJSON(w, http.StatusBadRequest, "role must be one of member, admin, owner")
+		return
+	}
+	if req.UserID == 0 {
+		errorJSON(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+	if _, err := h.userRepo.FindUserByID(req.UserID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: Failed to get user %d: %v", req.UserID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to add group member")
+		}
+		return
+	}
+
+	group, created, err := h.groupRepo.SetMember(groupID, &req, userID)
+	if err != nil {
+		writeGroupError(w, err, "add group member")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, group.ToGroupResponse())
+}
+
+// RemoveMember はユーザーをグループから外します。メンバーは自分自身を外す (グループから抜ける) こともできます。
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	memberID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.groupRepo.RemoveMember(groupID, memberID, userID); err != nil {
+		writeGroupError(w, err, "remove group member")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// validateGroupName はグループ名を検証し、不正な場合はエラーメッセージを返します。
+func validateGroupName(name string) string {
+	if name == "" {
+		return "Name is required"
+	}
+	if utf8.RuneCountInString(name) > maxGroupNameLength {
+		return "Name must be at most " + strconv.Itoa(maxGroupNameLength) + " characters"
+	}
+	return ""
+}
+
+// writeGroupError はグループの変更に失敗したエラーを HTTP ステータスに対応付けて書き込みます。
+func writeGroupError(w http.ResponseWriter, err error, action string) {
+	log.Printf("ERROR: Failed to %s: %v", action, err)
+	switch {
+	case errors.Is(err, repository.ErrLastOwner):
+		errorJSON(w, http.StatusConflict, "A group must have at least one owner")
+	case strings.Contains(err.Error(), "not found"):
+		errorJSON(w, http.StatusNotFound, "Group or member not found")
+	case strings.Contains(err.Error(), "not authorized"):
+		errorJSON(w, http.StatusForbidden, "Forbidden: Your role in this group does not allow this action")
+	default:
+		errorJSON(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// findGroupForMember はグループを取得し、ユーザー userID がそのメンバーであるかを確認します。
+// 失敗した場合は応答を書き込み false を返します。
+func findGroupForMember(w http.ResponseWriter, groupRepo *repository.GroupRepository, groupID, userID int64) (*model.Group, bool) {
+	group, err := groupRepo.FindByID(groupID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Group not found")
+		} else {
+			log.Printf("ERROR: Failed to get group %d: %v", groupID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve group")
+		}
+		return nil, false
+	}
+	for _, m := range group.Members {
+		if m.ID == userID {
+			return group, true
+		}
+	}
+	errorJSON(w, http.StatusForbidden, "Forbidden: You are not a member of this group")
+	return nil, false
+}
@@ -0,0 +1,402 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"testing"
+)
+
+// Helper function to create a group and return its ID
+func createGroup(t *testing.T, server *testServer, token, name string) int64 {
+	req, _ := http.NewRequest("POST", "/api/groups", bytes.NewBufferString(fmt.Sprintf(`{"name": "%s"}`, name)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := server.executeRequest(req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create group %s: %s", name, rr.Body.String())
+	}
+	var group model.GroupResponse
+	json.NewDecoder(rr.Body).Decode(&group)
+	return group.ID
+}
+
+// Helper function to add a user to a group with the given role
+func addGroupMember(t *testing.T, server *testServer, token string, groupID, userID int64, role model.GroupRole) {
+	requestBody := fmt.Sprintf(`{"user_id": %d, "role": "%s"}`, userID, role)
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/groups/%d/members", groupID), bytes.NewBufferString(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := server.executeRequest(req)
+	if rr.Code != http.StatusCreated && rr.Code != http.StatusOK {
+		t.Fatalf("Failed to add user %d to group %d: %s", userID, groupID, rr.Body.String())
+	}
+}
+
+func TestGroupHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	daveID := createUser(t, server, "dave", "dave@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	carolToken := loginUser(t, server, "carol@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+
+	var groupID int64
+	var groupPath, membersPath string
+
+	// --- Test Cases ---
+	t.Run("Should create a group with the creator as owner", func(t *testing.T) {
+		if code, _ := send("POST", "/api/groups", aliceToken, `{"name": "  "}`); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an empty name, got %d", code)
+		}
+
+		code, body := send("POST", "/api/groups", aliceToken, `{"name": "Team", "description": "Our team"}`)
+		if code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusCreated, body)
+		}
+		var group model.GroupResponse
+		json.Unmarshal([]byte(body), &group)
+		if group.Name != "Team" || len(group.Members) != 1 || group.Members[0].ID != aliceID || group.Members[0].Role != model.RoleOwner {
+			t.Errorf("Unexpected group: %s", body)
+		}
+		groupID = group.ID
+		groupPath = fmt.Sprintf("/api/groups/%d", groupID)
+		membersPath = groupPath + "/members"
+	})
+
+	t.Run("Should manage members according to roles", func(t *testing.T) {
+		addGroupMember(t, server, aliceToken, groupID, bobID, model.RoleMember)
+		addGroupMember(t, server, aliceToken, groupID, carolID, model.RoleAdmin)
+
+		tests := []struct {
+			name, token, body string
+			want              int
+		}{
+			{"invalid role", aliceToken, fmt.Sprintf(`{"user_id": %d, "role": "boss"}`, daveID), http.StatusBadRequest},
+			{"unknown user", aliceToken, `{"user_id": 999}`, http.StatusNotFound},
+			{"member adds", bobToken, fmt.Sprintf(`{"user_id": %d}`, daveID), http.StatusForbidden},
+			{"admin adds owner", carolToken, fmt.Sprintf(`{"user_id": %d, "role": "owner"}`, daveID), http.StatusForbidden},
+			{"admin adds member", carolToken, fmt.Sprintf(`{"user_id": %d}`, daveID), http.StatusCreated},
+			{"admin changes role", carolToken, fmt.Sprintf(`{"user_id": %d, "role": "admin"}`, daveID), http.StatusOK},
+			{"admin changes owner", carolToken, fmt.Sprintf(`{"user_id": %d, "role": "member"}`, aliceID), http.StatusForbidden},
+			{"last owner steps down", aliceToken, fmt.Sprintf(`{"user_id": %d, "role": "admin"}`, aliceID), http.StatusConflict},
+		}
+		for _, tt := range tests {
+			if code, body := send("POST", membersPath, tt.token, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, code, tt.want, body)
+			}
+		}
+
+		code, body := send("GET", groupPath, bobToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var group model.GroupResponse
+		json.Unmarshal([]byte(body), &group)
+		roles := make(map[int64]model.GroupRole)
+		for _, m := range group.Members {
+			roles[m.ID] = m.Role
+		}
+		if len(roles) != 4 || roles[aliceID] != model.RoleOwner || roles[bobID] != model.RoleMember ||
+			roles[carolID] != model.RoleAdmin || roles[daveID] != model.RoleAdmin {
+			t.Errorf("Unexpected members: %s", body)
+		}
+	})
+
+	t.Run("Should list and update groups", func(t *testing.T) {
+		createGroup(t, server, carolToken, "Other")
+		code, body := send("GET", "/api/groups", bobToken, "")
+		var groups []*model.GroupResponse
+		json.Unmarshal([]byte(body), &groups)
+		if code != http.StatusOK || len(groups) != 1 || groups[0].ID != groupID {
+			t.Errorf("Unexpected groups of bob: %d %s", code, body)
+		}
+
+		if code, _ := send("PUT", groupPath, bobToken, `{"name": "Renamed"}`); code != http.StatusForbidden {
+			t.Errorf("Expected a member to be forbidden from renaming the group, got %d", code)
+		}
+		code, body = send("PUT", groupPath, carolToken, `{"name": "Renamed"}`)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var group model.GroupResponse
+		json.Unmarshal([]byte(body), &group)
+		if group.Name != "Renamed" || group.Description != "Our team" {
+			t.Errorf("Unexpected group after update: %s", body)
+		}
+		if code, _ := send("PUT", "/api/groups/999", carolToken, `{"name": "X"}`); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown group, got %d", code)
+		}
+	})
+
+	var groupScheduleID int64
+	t.Run("Should let members edit the group calendar", func(t *testing.T) {
+		code, body := send("POST", "/api/schedules", bobToken, fmt.Sprintf(`{"title": "Team sync", "owner_type": "group", "owner_id": %d,
+			"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z"}`, groupID))
+		if code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusCreated, body)
+		}
+		var schedule model.ScheduleResponse
+		json.Unmarshal([]byte(body), &schedule)
+		if schedule.OwnerType != model.OwnerGroup || schedule.OwnerID != groupID {
+			t.Errorf("Expected the schedule to belong to group %d, got %s", groupID, body)
+		}
+		groupScheduleID = schedule.ID
+
+		createUser(t, server, "eve", "eve@example.com", "password123")
+		outsiderToken := loginUser(t, server, "eve@example.com", "password123")
+		if code, _ := send("GET", fmt.Sprintf("/api/schedules/%d", groupScheduleID), outsiderToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected a non-member to be forbidden from reading the group schedule, got %d", code)
+		}
+		if code, _ := send("POST", "/api/schedules", outsiderToken, fmt.Sprintf(`{"title": "Intrusion", "owner_type": "group", "owner_id": %d,
+			"start_time": "2025-11-03T12:00:00Z", "end_time": "2025-11-03T13:00:00Z"}`, groupID)); code != http.StatusForbidden {
+			t.Errorf("Expected a non-member to be forbidden from creating group schedules, got %d", code)
+		}
+		if code, _ := send("GET", groupPath, outsiderToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected a non-member to be forbidden from reading the group, got %d", code)
+		}
+	})
+
+	t.Run("Should merge the group calendar with readable member calendars", func(t *testing.T) {
+		aliceScheduleID := createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Alice", "owner_id": %d,
+			"start_time": "2025-11-04T10:00:00Z", "end_time": "2025-11-04T11:00:00Z"}`, aliceID))
+		bobScheduleID := createSchedule(t, server, bobToken, fmt.Sprintf(`{"title": "Bob", "owner_id": %d,
+			"start_time": "2025-11-05T10:00:00Z", "end_time": "2025-11-05T11:00:00Z"}`, bobID))
+
+		// alice shares her calendar with the whole group; bob shares with nobody
+		code, body := send("POST", fmt.Sprintf("/api/users/%d/shares", aliceID), aliceToken, fmt.Sprintf(`{"group_id": %d, "permission": "read"}`, groupID))
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to share with the group: %d %s", code, body)
+		}
+		var share model.ShareResponse
+		json.Unmarshal([]byte(body), &share)
+		if share.GroupID != groupID || share.UserID != 0 {
+			t.Errorf("Unexpected share: %s", body)
+		}
+
+		merged := func(token string) []int64 {
+			code, body := send("GET", groupPath+"/schedules?from=2025-11-01T00:00:00Z&to=2025-12-01T00:00:00Z", token, "")
+			if code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+			}
+			var resp model.ScheduleListResponse
+			json.Unmarshal([]byte(body), &resp)
+			var ids []int64
+			for _, s := range resp.Schedules {
+				ids = append(ids, s.ID)
+			}
+			return ids
+		}
+		if got, want := merged(bobToken), []int64{groupScheduleID, aliceScheduleID, bobScheduleID}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected bob to see %v, got %v", want, got)
+		}
+		if got, want := merged(carolToken), []int64{groupScheduleID, aliceScheduleID}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected carol to see %v, got %v", want, got)
+		}
+
+		// The group calendar is separate from alice's personal calendar, even though both have ID 1
+		code, body = send("GET", fmt.Sprintf("/api/users/%d/schedules", aliceID), aliceToken, "")
+		var resp model.ScheduleListResponse
+		json.Unmarshal([]byte(body), &resp)
+		if code != http.StatusOK || len(resp.Schedules) != 1 || resp.Schedules[0].ID != aliceScheduleID {
+			t.Errorf("Expected only alice's own schedule in her calendar, got %d %s", code, body)
+		}
+	})
+
+	t.Run("Should remove members", func(t *testing.T) {
+		tests := []struct {
+			name, token string
+			userID      int64
+			want        int
+		}{
+			{"admin removes owner", carolToken, aliceID, http.StatusForbidden},
+			{"member removes admin", bobToken, carolID, http.StatusForbidden},
+			{"last owner leaves", aliceToken, aliceID, http.StatusConflict},
+			{"member leaves", bobToken, bobID, http.StatusNoContent},
+			{"former member leaves again", bobToken, bobID, http.StatusForbidden},
+			{"admin removes admin", carolToken, daveID, http.StatusNoContent},
+			{"not a member", aliceToken, daveID, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			if code, body := send("DELETE", fmt.Sprintf("%s/%d", membersPath, tt.userID), tt.token, ""); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, code, tt.want, body)
+			}
+		}
+		if code, _ := send("GET", groupPath+"/schedules", bobToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected a former member to lose access to the group calendar, got %d", code)
+		}
+	})
+
+	t.Run("Should delete a group with its calendar", func(t *testing.T) {
+		if code, _ := send("DELETE", groupPath, carolToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected an admin to be forbidden from deleting the group, got %d", code)
+		}
+		if code, body := send("DELETE", groupPath, aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusNoContent, body)
+		}
+		if code, _ := send("GET", groupPath, aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a deleted group, got %d", code)
+		}
+		if code, _ := send("GET", fmt.Sprintf("/api/schedules/%d", groupScheduleID), aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected the group schedule to be deleted, got %d", code)
+		}
+		if code, body := send("GET", fmt.Sprintf("/api/users/%d/shares", aliceID), aliceToken, ""); code != http.StatusOK || body != "[]\n" {
+			t.Errorf("Expected the share with the group to be deleted, got %d %s", code, body)
+		}
+	})
+}
+
+func TestGroupParticipants(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	daveID := createUser(t, server, "dave", "dave@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	daveToken := loginUser(t, server, "dave@example.com", "password123")
+
+	groupID := createGroup(t, server, aliceToken, "Team")
+	addGroupMember(t, server, aliceToken, groupID, bobID, model.RoleMember)
+
+	send := func(method, path, token, body string) (int, *model.ScheduleResponse, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		var schedule model.ScheduleResponse
+		json.Unmarshal(rr.Body.Bytes(), &schedule)
+		return rr.Code, &schedule, rr.Body.String()
+	}
+	participantIDs := func(scheduleID int64) map[int64]bool {
+		_, schedule, _ := send("GET", fmt.Sprintf("/api/schedules/%d", scheduleID), aliceToken, "")
+		ids := make(map[int64]bool)
+		for _, p := range schedule.Participants {
+			ids[p.ID] = true
+		}
+		return ids
+	}
+	scheduleBody := func(ownerID int64, extra string) string {
+		return fmt.Sprintf(`{"title": "Standup", "owner_id": %d, "start_time": "2024-03-01T10:00:00Z", "end_time": "2024-03-01T10:15:00Z", "allow_conflicts": true, `, ownerID) + extra + `}`
+	}
+
+	var expandedID, linkedID int64
+
+	// --- Test Cases ---
+	t.Run("Should reject inviting a group the user is not a member of", func(t *testing.T) {
+		body := scheduleBody(daveID, fmt.Sprintf(`"participant_group_ids": [%d]`, groupID))
+		if code, _, resp := send("POST", "/api/schedules", daveToken, body); code != http.StatusForbidden {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", code, http.StatusForbidden, resp)
+		}
+	})
+
+	t.Run("Should add the current members when a group is invited", func(t *testing.T) {
+		code, schedule, body := send("POST", "/api/schedules", aliceToken, scheduleBody(aliceID, fmt.Sprintf(`"participant_group_ids": [%d]`, groupID)))
+		if code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusCreated, body)
+		}
+		if len(schedule.Participants) != 2 || schedule.ParticipantGroupIDs != nil {
+			t.Errorf("Expected alice and bob as participants without a linked group: %s", body)
+		}
+		expandedID = schedule.ID
+	})
+
+	t.Run("Should keep participants in sync with a linked group", func(t *testing.T) {
+		body := scheduleBody(aliceID, fmt.Sprintf(`"participant_ids": [%d], "participant_group_ids": [%d], "link_groups": true`, daveID, groupID))
+		code, schedule, resp := send("POST", "/api/schedules", aliceToken, body)
+		if code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusCreated, resp)
+		}
+		if len(schedule.ParticipantGroupIDs) != 1 || schedule.ParticipantGroupIDs[0] != groupID || len(schedule.Participants) != 3 {
+			t.Errorf("Expected the group to be linked with alice, bob and dave as participants: %s", resp)
+		}
+		linkedID = schedule.ID
+
+		addGroupMember(t, server, aliceToken, groupID, carolID, model.RoleMember)
+		if !participantIDs(linkedID)[carolID] {
+			t.Errorf("Expected a new member to join the linked schedule")
+		}
+		if participantIDs(expandedID)[carolID] {
+			t.Errorf("Expected a new member not to join a schedule the group was invited to without linking")
+		}
+
+		// A member who is also invited individually stays after leaving the group.
+		addGroupMember(t, server, aliceToken, groupID, daveID, model.RoleMember)
+		for _, userID := range []int64{bobID, daveID} {
+			if code, _, resp := send("DELETE", fmt.Sprintf("/api/groups/%d/members/%d", groupID, userID), aliceToken, ""); code != http.StatusNoContent {
+				t.Fatalf("Failed to remove user %d from the group: %s", userID, resp)
+			}
+		}
+		ids := participantIDs(linkedID)
+		if ids[bobID] || !ids[daveID] || !ids[carolID] {
+			t.Errorf("Expected bob to leave the linked schedule and dave to stay: %v", ids)
+		}
+		if !participantIDs(expandedID)[bobID] {
+			t.Errorf("Expected a former member to stay on a schedule the group was invited to without linking")
+		}
+	})
+
+	t.Run("Should let members of a linked group respond", func(t *testing.T) {
+		carolToken := loginUser(t, server, "carol@example.com", "password123")
+		code, _, body := send("POST", fmt.Sprintf("/api/schedules/%d/rsvp", linkedID), carolToken, `{"status": "accepted"}`)
+		if code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+	})
+
+	t.Run("Should keep group members when individual participants are updated", func(t *testing.T) {
+		code, _, body := send("PUT", fmt.Sprintf("/api/schedules/%d", linkedID), aliceToken, `{"participant_ids": [], "allow_conflicts": true}`)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		ids := participantIDs(linkedID)
+		if ids[daveID] || !ids[carolID] {
+			t.Errorf("Expected only the individual participant dave to be removed: %v", ids)
+		}
+	})
+
+	t.Run("Should unlink groups on update", func(t *testing.T) {
+		code, schedule, body := send("PUT", fmt.Sprintf("/api/schedules/%d", linkedID), aliceToken, `{"participant_group_ids": [], "link_groups": true, "allow_conflicts": true}`)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		if schedule.ParticipantGroupIDs != nil || participantIDs(linkedID)[carolID] {
+			t.Errorf("Expected the group to be unlinked and its members removed: %s", body)
+		}
+		if code, _, body := send("PUT", fmt.Sprintf("/api/schedules/%d", linkedID), daveToken, fmt.Sprintf(`{"participant_group_ids": [%d]}`, groupID)); code != http.StatusForbidden {
+			t.Errorf("Expected a non-member to be unable to invite the group, got %d: %s", code, body)
+		}
+	})
+
+	t.Run("Should unlink a deleted group", func(t *testing.T) {
+		if code, _, body := send("PUT", fmt.Sprintf("/api/schedules/%d", linkedID), aliceToken, fmt.Sprintf(`{"participant_group_ids": [%d], "link_groups": true, "allow_conflicts": true}`, groupID)); code != http.StatusOK {
+			t.Fatalf("Failed to link the group again: %s", body)
+		}
+		if code, _, body := send("DELETE", fmt.Sprintf("/api/groups/%d", groupID), aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Failed to delete the group: %s", body)
+		}
+		_, schedule, body := send("GET", fmt.Sprintf("/api/schedules/%d", linkedID), aliceToken, "")
+		if schedule.ParticipantGroupIDs != nil || len(schedule.Participants) != 0 {
+			t.Errorf("Expected the deleted group to be unlinked with its members removed: %s", body)
+		}
+	})
+}
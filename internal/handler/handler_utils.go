@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // writeJSON はGoの構造体をJSONレスポンスとして書き込みます。
@@ -24,4 +25,26 @@ func errorJSON(w http.ResponseWriter, status int, message string) {
 		Error string `json:"error"`
 	}
 	writeJSON(w, status, errorResponse{Error: message})
-}
\ No newline at end of file
+}
+
+// parseTimeParam はRFC 3339形式のクエリパラメータを解析します。指定がない場合はゼロ値を返します。
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	t, err := parseOptionalTimeParam(r, name)
+	if err != nil || t == nil {
+		return time.Time{}, err
+	}
+	return *t, nil
+}
+
+// parseOptionalTimeParam はRFC 3339形式のクエリパラメータを解析します。指定がない場合はnilを返します。
+func parseOptionalTimeParam(r *http.Request, name string) (*time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: must be RFC 3339", name)
+	}
+	return &t, nil
+}
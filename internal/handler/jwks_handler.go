@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"schedule-app/internal/jwtkeys"
+)
+
+// JWKSHandler はアクセストークンの検証に使う公開鍵を JWKS として公開します。
+// 他のサービスはこの公開鍵でトークンを検証できます。
+type JWKSHandler struct {
+	keys *jwtkeys.KeySet
+}
+
+// NewJWKSHandler は JWKSHandler の新しいインスタンスを生成します。
+func NewJWKSHandler(keys *jwtkeys.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKS は署名鍵と検証用の鍵の公開鍵を返します。HS256 で署名している場合、鍵の一覧は空です。
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	// 鍵のローテーション後に新しい鍵が取得されるよう、キャッシュの期間を短くする
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"schedule-app/internal/jwtkeys"
+	"schedule-app/internal/model"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWKS(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	createUser(t, server, "alice", "alice@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+
+	authorized := func(token string) bool {
+		req, _ := http.NewRequest("GET", "/api/groups", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return server.executeRequest(req).Code == http.StatusOK
+	}
+	// claimsFor copies the claims of a valid token so that forged tokens refer to a live session.
+	claimsFor := func(token string) *model.Claims {
+		claims := &model.Claims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+			t.Fatalf("Failed to parse token: %v", err)
+		}
+		return claims
+	}
+
+	// --- Test Cases ---
+	t.Run("Should publish the public verification keys", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Cache-Control"); got != "public, max-age=300" {
+			t.Errorf("Expected a cacheable response, got Cache-Control %q", got)
+		}
+
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+			t.Fatalf("Failed to decode JWKS: %v", err)
+		}
+		if len(set.Keys) != 2 {
+			t.Fatalf("Expected the signing key and the previous key, got %d keys", len(set.Keys))
+		}
+		signing, previous := set.Keys[0], set.Keys[1]
+		if signing["kid"] != testSigningKey.ID || signing["alg"] != "EdDSA" || signing["kty"] != "OKP" || signing["crv"] != "Ed25519" || signing["x"] == "" {
+			t.Errorf("Unexpected signing key: %v", signing)
+		}
+		if previous["kid"] != testPreviousKey.ID || previous["alg"] != "RS256" || previous["kty"] != "RSA" || previous["n"] == "" || previous["e"] != "AQAB" {
+			t.Errorf("Unexpected previous key: %v", previous)
+		}
+		for _, key := range set.Keys {
+			if key["use"] != "sig" {
+				t.Errorf("Expected use \"sig\", got %q", key["use"])
+			}
+			if _, ok := key["d"]; ok {
+				t.Errorf("Private key material must not be published: %v", key)
+			}
+		}
+	})
+
+	t.Run("Should sign access tokens with the current key", func(t *testing.T) {
+		token, _, err := jwt.NewParser().ParseUnverified(aliceToken, &model.Claims{})
+		if err != nil {
+			t.Fatalf("Failed to parse token: %v", err)
+		}
+		if token.Header["alg"] != "EdDSA" || token.Header["kid"] != testSigningKey.ID {
+			t.Errorf("Expected alg EdDSA and kid %q, got %v", testSigningKey.ID, token.Header)
+		}
+		if !authorized(aliceToken) {
+			t.Error("Expected the access token to be accepted")
+		}
+	})
+
+	t.Run("Should accept tokens signed with a previous key", func(t *testing.T) {
+		previous, err := jwtkeys.NewKeySet(testPreviousKey)
+		if err != nil {
+			t.Fatalf("Failed to create key set: %v", err)
+		}
+		token, err := previous.Sign(claimsFor(aliceToken))
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		if !authorized(token) {
+			t.Error("Expected a token signed with the previous key to be accepted")
+		}
+	})
+
+	t.Run("Should reject tokens signed with an unknown key", func(t *testing.T) {
+		_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claimsFor(aliceToken))
+		token.Header["kid"] = testSigningKey.ID
+		forged, _ := token.SignedString(otherKey)
+		if authorized(forged) {
+			t.Error("Expected a token signed with an unknown key to be rejected")
+		}
+	})
+
+	t.Run("Should reject HS256 tokens", func(t *testing.T) {
+		// A shared-secret token without kid, as issued before asymmetric keys were configured
+		legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor(aliceToken)).SignedString([]byte("test_secret_key_for_unit_tests"))
+		if authorized(legacy) {
+			t.Error("Expected an HS256 token to be rejected")
+		}
+
+		// Algorithm confusion: an HMAC signature keyed with the published public key
+		var set jwtkeys.JWKS
+		req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		json.NewDecoder(server.executeRequest(req).Body).Decode(&set)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor(aliceToken))
+		token.Header["kid"] = testSigningKey.ID
+		confused, _ := token.SignedString([]byte(set.Keys[0].X))
+		if authorized(confused) {
+			t.Error("Expected a token whose alg does not match the key to be rejected")
+		}
+	})
+
+	t.Run("Should reject expired tokens signed with a known key", func(t *testing.T) {
+		claims := claimsFor(aliceToken)
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		token, err := testKeySet.Sign(claims)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		if authorized(token) {
+			t.Error("Expected an expired token to be rejected")
+		}
+	})
+}
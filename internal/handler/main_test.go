@@ -1,56 +1,254 @@
 package handler
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"database/sql"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"schedule-app/internal/accountmail"
+	"schedule-app/internal/clock"
 	"schedule-app/internal/db"
+	"schedule-app/internal/events"
+	"schedule-app/internal/invite"
+	"schedule-app/internal/jwtkeys"
+	"schedule-app/internal/mail"
 	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/oidc"
+	"schedule-app/internal/reminder"
 	"schedule-app/internal/repository"
+	"schedule-app/internal/webhook"
 	"testing"
+	"time"
 )
 
 // testServer holds dependencies for a test server.
 type testServer struct {
 	router http.Handler
 	db     *sql.DB
+	outbox *mail.Outbox // emails sent by the server
+	// clock is the time seen by the reminder, webhook and invitation workers.
+	// Advance it and call reminders.RunOnce, webhooks.RunOnce, invitations.RunOnce or accountMail.RunOnce
+	// to send due reminders, webhooks, invitations or account emails.
+	clock       *clock.Fake
+	reminders   *reminder.Worker
+	webhooks    *webhook.Worker
+	invitations *invite.Worker
+	accountMail *accountmail.Worker
+}
+
+// testEventHeartbeat is the heartbeat interval of the event stream of the test server.
+const testEventHeartbeat = 200 * time.Millisecond
+
+// testBootstrapToken is the admin bootstrap token configured for the test server.
+const testBootstrapToken = "test_bootstrap_token"
+
+// Access token keys for the test server, generated once in TestMain.
+// testSigningKey signs new tokens; testPreviousKey is a rotated-out key that is still accepted for verification.
+var (
+	testSigningKey  *jwtkeys.Key
+	testPreviousKey *jwtkeys.Key
+	testKeySet      *jwtkeys.KeySet
+)
+
+// testLoginThrottlePolicy is the brute-force protection policy of the test server.
+var testLoginThrottlePolicy = model.LoginThrottlePolicy{
+	Window:             15 * time.Minute,
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	LockoutBase:        time.Minute,
+	LockoutMax:         4 * time.Minute,
+	MaxAccountResets:   3,
+	MaxIPResets:        5,
 }
 
 // newTestServer creates a new server for testing, with a fresh in-memory SQLite DB.
 func newTestServer() *testServer {
+	return newTestServerWithOIDC(nil)
+}
+
+// newTestServerWithOIDC creates a test server that signs users in through the given OpenID Connect provider.
+func newTestServerWithOIDC(oidcProvider *oidc.Provider) *testServer {
 	// Use in-memory SQLite database for testing.
 	// Pass ":memory:" to InitDB, which will construct the correct DSN.
 	conn, err := db.InitDB(":memory:")
 	if err != nil {
 		log.Fatalf("Failed to initialize in-memory database: %v", err)
 	}
+	// Every connection to ":memory:" opens a separate, empty database. Keep a single connection
+	// so that concurrent requests (such as open event streams) see the same data.
+	conn.SetMaxOpenConns(1)
+	return newTestServerWithDB(conn, oidcProvider)
+}
+
+// newFileTestServer creates a test server backed by a database file in a temporary directory.
+// Unlike the in-memory database, it uses a connection pool as in production, so requests and workers
+// running at the same time write through separate connections.
+func newFileTestServer(t *testing.T) *testServer {
+	t.Helper()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "schedule.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database file: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return newTestServerWithDB(conn, nil)
+}
+
+// newTestServerWithDB creates a test server on an initialized database.
+func newTestServerWithDB(conn *sql.DB, oidcProvider *oidc.Provider) *testServer {
 
 	// Create repositories and handlers
-	jwtSecretForTest := "test_secret_key_for_unit_tests"
 	userRepo := repository.NewUserRepository(conn)
-	userHandler := NewUserHandler(userRepo, jwtSecretForTest)
+	sessionRepo := repository.NewSessionRepository(conn)
+	oidcRepo := repository.NewOIDCRepository(conn)
+	outbox := mail.NewOutbox("Schedule App <no-reply@example.com>", "")
+	loginThrottleRepo := repository.NewLoginThrottleRepository(conn, testLoginThrottlePolicy)
+	outboxRepo := repository.NewOutboxRepository(conn)
+	accountHandler := NewAccountHandler(userRepo, repository.NewAccountTokenRepository(conn), outbox, outboxRepo, loginThrottleRepo, "http://localhost:8080")
+	mfaRepo := repository.NewMFARepository(conn)
+	userHandler := NewUserHandler(userRepo, sessionRepo, oidcRepo, oidcProvider, testKeySet, accountHandler, loginThrottleRepo, mfaRepo)
+	mfaHandler := NewMFAHandler(userRepo, mfaRepo, loginThrottleRepo)
 	scheduleRepo := repository.NewScheduleRepository(conn)
-	scheduleHandler := NewScheduleHandler(scheduleRepo)
-	authMiddleware := middleware.NewAuthMiddleware(jwtSecretForTest)
+	shareRepo := repository.NewShareRepository(conn)
+	groupRepo := repository.NewGroupRepository(conn)
+	eventHub := events.NewHub(100)
+	webhookRepo := repository.NewWebhookRepository(conn)
+	invitationRepo := repository.NewInvitationRepository(conn)
+	invitations := invite.NewSender(invitationRepo, userRepo, "http://localhost:8080")
+	scheduleHandler := NewScheduleHandler(scheduleRepo, shareRepo, groupRepo, eventHub, invitations)
+	eventHandler := NewEventHandler(eventHub, shareRepo, testEventHeartbeat)
+	shareHandler := NewShareHandler(shareRepo, userRepo, groupRepo)
+	groupHandler := NewGroupHandler(groupRepo, userRepo)
+	adminHandler := NewAdminHandler(userRepo, loginThrottleRepo, testBootstrapToken)
+	feedTokenRepo := repository.NewFeedTokenRepository(conn)
+	calendarFeedHandler := NewCalendarFeedHandler(scheduleRepo, userRepo, feedTokenRepo, shareRepo)
+	calendarImportHandler := NewCalendarImportHandler(scheduleRepo, userRepo)
+	caldavHandler := NewCalDAVHandler(scheduleRepo, userRepo, shareRepo)
+	freeBusyHandler := NewFreeBusyHandler(scheduleRepo, userRepo, shareRepo)
+	jwksHandler := NewJWKSHandler(testKeySet)
+	personalTokenRepo := repository.NewPersonalTokenRepository(conn)
+	personalTokenHandler := NewPersonalTokenHandler(personalTokenRepo)
+	reminderRepo := repository.NewReminderRepository(conn)
+	reminderHandler := NewReminderHandler(reminderRepo, scheduleRepo)
+	notificationHandler := NewNotificationHandler(repository.NewNotificationRepository(conn))
+	webhookHandler := NewWebhookHandler(webhookRepo, model.WebhookScopeUser)
+	adminWebhookHandler := NewWebhookHandler(webhookRepo, model.WebhookScopeAll)
+	fakeClock := clock.NewFake(time.Now().Truncate(time.Minute))
+	authMiddleware := middleware.NewAuthMiddleware(testKeySet, sessionRepo.CheckActive, personalTokenRepo.Authenticate)
+	caldavAuth := middleware.BasicAuthentication(CalDAVRealm, userHandler.CheckCredentials, personalTokenRepo.Authenticate)
+	requireAdmin := middleware.RequireRole(model.UserRoleAdmin)
 
 	// Set up router
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /api/users/register", userHandler.Register)
 	mux.HandleFunc("POST /api/users/login", userHandler.Login)
+	mux.HandleFunc("POST /api/users/login/mfa", userHandler.LoginMFA)
+	mux.Handle("GET /api/users/tokens", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.ListTokens))))
+	mux.Handle("POST /api/users/tokens", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.CreateToken))))
+	mux.Handle("DELETE /api/users/tokens/{tokenID}", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(personalTokenHandler.RevokeToken))))
+	mux.Handle("GET /api/users/mfa", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.GetStatus))))
+	mux.Handle("POST /api/users/mfa/totp", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.StartTOTPEnrollment))))
+	mux.Handle("POST /api/users/mfa/totp/confirm", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.ConfirmTOTPEnrollment))))
+	mux.Handle("POST /api/users/mfa/disable", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.Disable))))
+	mux.Handle("POST /api/users/mfa/recovery-codes", authMiddleware.JwtAuthentication(middleware.RequireSession(http.HandlerFunc(mfaHandler.RegenerateRecoveryCodes))))
+	mux.HandleFunc("POST /api/users/refresh", userHandler.Refresh)
+	mux.Handle("POST /api/users/logout", authMiddleware.JwtAuthentication(http.HandlerFunc(userHandler.Logout)))
+	mux.Handle("POST /api/users/verify-email/send", authMiddleware.JwtAuthentication(http.HandlerFunc(accountHandler.RequestEmailVerification)))
+	mux.HandleFunc("POST /api/users/verify-email", accountHandler.VerifyEmail)
+	mux.HandleFunc("POST /api/users/forgot-password", accountHandler.RequestPasswordReset)
+	mux.HandleFunc("POST /api/users/reset-password", accountHandler.ResetPassword)
+	mux.HandleFunc("GET /api/auth/oidc/login", userHandler.OIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/callback", userHandler.OIDCCallback)
+	mux.HandleFunc("GET /.well-known/jwks.json", jwksHandler.GetJWKS)
 	mux.Handle("POST /api/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.CreateSchedule)))
-	mux.HandleFunc("GET /api/users/{ownerID}/schedules", scheduleHandler.GetSchedulesByOwner)
-	mux.HandleFunc("GET /api/schedules/{scheduleID}", scheduleHandler.GetScheduleByID)
+	mux.Handle("GET /api/users/{ownerID}/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetSchedulesByOwner)))
+	mux.Handle("GET /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetScheduleByID)))
 	mux.Handle("PUT /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.UpdateSchedule)))
 	mux.Handle("DELETE /api/schedules/{scheduleID}", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.DeleteSchedule)))
+	mux.Handle("POST /api/schedules/{scheduleID}/rsvp", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.RespondToSchedule)))
+	mux.Handle("GET /api/events/stream", authMiddleware.JwtAuthentication(http.HandlerFunc(eventHandler.Stream)))
+	mux.Handle("GET /api/users/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.GetSettings)))
+	mux.Handle("PUT /api/users/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.UpdateSettings)))
+	mux.Handle("GET /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.GetScheduleReminders)))
+	mux.Handle("PUT /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.UpdateScheduleReminders)))
+	mux.Handle("DELETE /api/schedules/{scheduleID}/reminders", authMiddleware.JwtAuthentication(http.HandlerFunc(reminderHandler.DeleteScheduleReminders)))
+	mux.Handle("GET /api/notifications", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.ListNotifications)))
+	mux.Handle("POST /api/notifications/{notificationID}/read", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.MarkRead)))
+	mux.Handle("POST /api/notifications/read-all", authMiddleware.JwtAuthentication(http.HandlerFunc(notificationHandler.MarkAllRead)))
+	mux.Handle("GET /api/webhooks", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.ListWebhooks)))
+	mux.Handle("POST /api/webhooks", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.CreateWebhook)))
+	mux.Handle("DELETE /api/webhooks/{webhookID}", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.DeleteWebhook)))
+	mux.Handle("GET /api/webhooks/{webhookID}/deliveries", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.ListDeliveries)))
+	mux.Handle("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", authMiddleware.JwtAuthentication(http.HandlerFunc(webhookHandler.Redeliver)))
+	mux.Handle("POST /api/users/feed-token", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarFeedHandler.CreateFeedToken)))
+	mux.Handle("DELETE /api/users/feed-token", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarFeedHandler.RevokeFeedToken)))
+	mux.HandleFunc("GET /api/users/{ownerID}/calendar.ics", calendarFeedHandler.GetCalendarFeed)
+	mux.Handle("POST /api/users/{ownerID}/schedules/import", authMiddleware.JwtAuthentication(http.HandlerFunc(calendarImportHandler.ImportSchedules)))
+	mux.Handle("GET /api/users/{ownerID}/shares", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.ListShares)))
+	mux.Handle("POST /api/users/{ownerID}/shares", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.GrantShare)))
+	mux.Handle("DELETE /api/users/{ownerID}/shares/{shareID}", authMiddleware.JwtAuthentication(http.HandlerFunc(shareHandler.RevokeShare)))
+	mux.Handle("POST /api/groups", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.CreateGroup)))
+	mux.Handle("GET /api/groups", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.ListGroups)))
+	mux.Handle("GET /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.GetGroup)))
+	mux.Handle("PUT /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.UpdateGroup)))
+	mux.Handle("DELETE /api/groups/{groupID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.DeleteGroup)))
+	mux.Handle("POST /api/groups/{groupID}/members", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.AddMember)))
+	mux.Handle("DELETE /api/groups/{groupID}/members/{userID}", authMiddleware.JwtAuthentication(http.HandlerFunc(groupHandler.RemoveMember)))
+	mux.Handle("GET /api/groups/{groupID}/schedules", authMiddleware.JwtAuthentication(http.HandlerFunc(scheduleHandler.GetSchedulesByGroup)))
+	mux.Handle("POST /api/freebusy", authMiddleware.JwtAuthentication(http.HandlerFunc(freeBusyHandler.GetFreeBusy)))
+	mux.Handle("POST /api/schedules/suggest", authMiddleware.JwtAuthentication(http.HandlerFunc(freeBusyHandler.SuggestSlots)))
+	mux.Handle("/.well-known/caldav", http.RedirectHandler("/caldav/", http.StatusMovedPermanently))
+	mux.HandleFunc("OPTIONS /caldav/", caldavHandler.Options)
+	mux.Handle("PROPFIND /caldav/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindRoot)))
+	mux.Handle("PROPFIND /caldav/principals/{userID}/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindPrincipal)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindHome)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/default/{$}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindCalendar)))
+	mux.Handle("REPORT /caldav/calendars/{userID}/default/{$}", caldavAuth(http.HandlerFunc(caldavHandler.Report)))
+	mux.Handle("PROPFIND /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.PropfindObject)))
+	mux.Handle("GET /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.GetObject)))
+	mux.Handle("PUT /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.PutObject)))
+	mux.Handle("DELETE /caldav/calendars/{userID}/default/{name}", caldavAuth(http.HandlerFunc(caldavHandler.DeleteObject)))
+	mux.Handle("GET /api/admin/users", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(userHandler.GetAllUsers))))
+	mux.Handle("GET /api/admin/login-audit", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminHandler.GetLoginAudit))))
+	mux.Handle("GET /api/admin/users/{ownerID}/schedules", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(scheduleHandler.GetSchedulesByOwnerAsAdmin))))
+	mux.Handle("PUT /api/admin/users/{userID}/role", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminHandler.UpdateUserRole))))
+	mux.Handle("GET /api/admin/webhooks", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.ListWebhooks))))
+	mux.Handle("POST /api/admin/webhooks", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.CreateWebhook))))
+	mux.Handle("DELETE /api/admin/webhooks/{webhookID}", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.DeleteWebhook))))
+	mux.Handle("GET /api/admin/webhooks/{webhookID}/deliveries", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.ListDeliveries))))
+	mux.Handle("POST /api/admin/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", authMiddleware.JwtAuthentication(requireAdmin(http.HandlerFunc(adminWebhookHandler.Redeliver))))
+	mux.Handle("POST /api/bootstrap/admin", authMiddleware.JwtAuthentication(http.HandlerFunc(adminHandler.BootstrapAdmin)))
 
+	// Webhooks are sent to httptest receivers on the loopback address, which webhook.NewClient refuses,
+	// so the test workers send them with http.DefaultClient.
 	return &testServer{
 		router: mux,
 		db:     conn,
+		outbox: outbox,
+
+		clock:       fakeClock,
+		reminders:   newTestReminderWorker(conn, outbox, fakeClock),
+		webhooks:    webhook.NewWorker(webhookRepo, http.DefaultClient, fakeClock, time.Minute),
+		invitations: invite.NewWorker(invitationRepo, outbox, fakeClock, time.Minute),
+		accountMail: accountmail.NewWorker(outboxRepo, outbox, fakeClock, time.Minute),
 	}
 }
 
+// newTestReminderWorker creates a reminder worker for the test database that reads the time from clk.
+// Creating a second worker for the same database simulates a restart of the server.
+func newTestReminderWorker(conn *sql.DB, outbox *mail.Outbox, clk clock.Clock) *reminder.Worker {
+	return reminder.NewWorker(repository.NewReminderRepository(conn), map[model.ReminderChannel]reminder.Channel{
+		model.ReminderEmail:   reminder.NewEmailChannel(outbox, "http://localhost:8080"),
+		model.ReminderWebhook: reminder.NewWebhookChannel(http.DefaultClient),
+		model.ReminderInApp:   reminder.NewInAppChannel(repository.NewNotificationRepository(conn)),
+	}, clk, time.Minute)
+}
+
 // executeRequest performs a request against the test server's router.
 func (ts *testServer) executeRequest(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
@@ -60,7 +258,31 @@ func (ts *testServer) executeRequest(req *http.Request) *httptest.ResponseRecord
 
 // TestMain provides a place for package-level setup/teardown, if needed.
 func TestMain(m *testing.M) {
+	if err := generateTestKeys(); err != nil {
+		log.Fatalf("Failed to generate test keys: %v", err)
+	}
+
 	// Run all tests
 	code := m.Run()
 	os.Exit(code)
-}
\ No newline at end of file
+}
+
+// generateTestKeys creates an Ed25519 signing key and an RSA key standing in for a previous signing key.
+func generateTestKeys() error {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if testSigningKey, err = jwtkeys.NewKey(edKey); err != nil {
+		return err
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	if testPreviousKey, err = jwtkeys.NewKey(rsaKey); err != nil {
+		return err
+	}
+	testKeySet, err = jwtkeys.NewKeySet(testSigningKey, testPreviousKey)
+	return err
+}
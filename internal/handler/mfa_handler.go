@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"schedule-app/internal/totp"
+)
+
+// totpIssuer は認証アプリに表示するサービス名です。
+const totpIssuer = "Schedule App"
+
+// MFAHandler はログイン中のユーザーの二要素認証 (TOTP) の登録・無効化と、リカバリーコードの再発行を処理します。
+// ログイン時のコードの確認は UserHandler.LoginMFA で行います。
+type MFAHandler struct {
+	userRepo *repository.UserRepository
+	mfaRepo  *repository.MFARepository
+	throttle *repository.LoginThrottleRepository
+}
+
+// NewMFAHandler は MFAHandler の新しいインスタンスを生成します。
+// throttle はコードの総当たりを防ぐため、コードの間違いをログインの失敗として数えるのに使用します。
+func NewMFAHandler(userRepo *repository.UserRepository, mfaRepo *repository.MFARepository, throttle *repository.LoginThrottleRepository) *MFAHandler {
+	return &MFAHandler{userRepo: userRepo, mfaRepo: mfaRepo, throttle: throttle}
+}
+
+// GetStatus はログイン中のユーザーの二要素認証の設定を返します。
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status, err := h.mfaRepo.Status(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get MFA settings of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to get two-factor authentication settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// StartTOTPEnrollment は認証アプリの登録を開始し、秘密鍵と otpauth URI を返します。
+// ConfirmTOTPEnrollment でコードを確認するまで、二要素認証は有効になりません。
+func (h *MFAHandler) StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	user, err := h.userRepo.FindUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	secret, err := h.mfaRepo.StartEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+			errorJSON(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		} else {
+			log.Printf("ERROR: Failed to start MFA enrollment for user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to start enrollment")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, &model.TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTPEnrollment は認証アプリのコードを確認して二要素認証を有効にし、リカバリーコードを返します。
+// リカバリーコードはこの応答でのみ確認できます。
+func (h *MFAHandler) ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	codes, err := h.mfaRepo.ConfirmEnrollment(userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInvalidMFACode):
+			errorJSON(w, http.StatusBadRequest, "Invalid code")
+		case errors.Is(err, repository.ErrMFANotEnabled):
+			errorJSON(w, http.StatusConflict, "No enrollment in progress")
+		case errors.Is(err, repository.ErrMFAAlreadyEnabled):
+			errorJSON(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		default:
+			log.Printf("ERROR: Failed to confirm MFA enrollment for user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, &model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable は TOTP のコードまたはリカバリーコードを確認して、二要素認証を無効にします。
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, "Failed to disable two-factor authentication", func(userID int64, code string) error {
+		if err := h.mfaRepo.Disable(userID, code); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes は TOTP のコードまたはリカバリーコードを確認して、リカバリーコードを発行し直します。
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, "Failed to regenerate recovery codes", func(userID int64, code string) error {
+		codes, err := h.mfaRepo.RegenerateRecoveryCodes(userID, code)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, &model.RecoveryCodesResponse{RecoveryCodes: codes})
+		return nil
+	})
+}
+
+// withCode はリクエストボディのコードを確認する操作 fn を実行し、エラーを応答に変換します。
+// 盗まれたセッションでコードを総当たりされないよう、コードの間違いはログインの失敗として数えます。
+func (h *MFAHandler) withCode(w http.ResponseWriter, r *http.Request, failure string, fn func(userID int64, code string) error) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user, err := h.userRepo.FindUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, failure)
+		return
+	}
+	clientIP := middleware.ClientIP(r)
+	if writeThrottled(w, h.throttle.Check(user.Email, clientIP)) {
+		return
+	}
+
+	err = fn(userID, req.Code)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrInvalidMFACode):
+		if recordErr := h.throttle.RecordFailure(user.Email, clientIP, &user.ID); recordErr != nil {
+			log.Printf("ERROR: Failed to record login failure: %v", recordErr)
+		}
+		errorJSON(w, http.StatusBadRequest, "Invalid code")
+	case errors.Is(err, repository.ErrMFANotEnabled):
+		errorJSON(w, http.StatusConflict, "Two-factor authentication is not enabled")
+	default:
+		log.Printf("ERROR: %s for user %d: %v", failure, userID, err)
+		errorJSON(w, http.StatusInternalServerError, failure)
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"schedule-app/internal/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTOTP enrolls an authenticator app for the user of the token and returns one of the recovery codes.
+func enableTOTP(t *testing.T, server *testServer, token string) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/api/users/mfa/totp", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := server.executeRequest(req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to enroll TOTP: %s", rr.Body.String())
+	}
+	var enrollment model.TOTPEnrollmentResponse
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Failed to compute TOTP code: %v", err)
+	}
+
+	req, _ = http.NewRequest("POST", "/api/users/mfa/totp/confirm", bytes.NewBufferString(fmt.Sprintf(`{"code": "%s"}`, code)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = server.executeRequest(req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to confirm TOTP: %s", rr.Body.String())
+	}
+	var resp model.RecoveryCodesResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if len(resp.RecoveryCodes) == 0 {
+		t.Fatalf("Expected recovery codes")
+	}
+	return resp.RecoveryCodes[0]
+}
+
+func TestMFA(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	// code returns the TOTP code of the given time step offset from now.
+	code := func(t *testing.T, secret string, offset int64) string {
+		t.Helper()
+		c, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		if err != nil {
+			t.Fatalf("Failed to compute TOTP code: %v", err)
+		}
+		return c
+	}
+	// allowCodeReuse forgets the last used TOTP step, so the current code can be used again in the next step of a test.
+	allowCodeReuse := func(t *testing.T) {
+		if _, err := server.db.Exec("UPDATE user_mfa SET last_used_step = 0"); err != nil {
+			t.Fatalf("Failed to reset last used step: %v", err)
+		}
+	}
+	// startLogin logs in with the password and returns the MFA challenge.
+	startLogin := func(t *testing.T) model.MFAChallengeResponse {
+		t.Helper()
+		code, body := send("POST", "/api/users/login", "", `{"email": "alice@example.com", "password": "password123"}`)
+		if code != http.StatusOK {
+			t.Fatalf("Failed to login: %s", body)
+		}
+		var challenge model.MFAChallengeResponse
+		json.Unmarshal([]byte(body), &challenge)
+		if !challenge.MFARequired || challenge.MFAToken == "" || strings.Contains(body, `"token"`) {
+			t.Fatalf("Expected an MFA challenge instead of tokens, got %s", body)
+		}
+		return challenge
+	}
+	completeLogin := func(mfaToken, code string) (int, model.TokenResponse) {
+		status, body := send("POST", "/api/users/login/mfa", "", fmt.Sprintf(`{"mfa_token": "%s", "code": "%s"}`, mfaToken, code))
+		var tokens model.TokenResponse
+		json.Unmarshal([]byte(body), &tokens)
+		return status, tokens
+	}
+
+	var secret string
+	var recoveryCodes []string
+
+	// --- Test Cases ---
+	t.Run("Should enroll an authenticator app", func(t *testing.T) {
+		status, body := send("POST", "/api/users/mfa/totp", aliceToken, "")
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+		}
+		var enrollment model.TOTPEnrollmentResponse
+		json.Unmarshal([]byte(body), &enrollment)
+		secret = enrollment.Secret
+		if secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/Schedule%20App:alice@example.com?") || !strings.Contains(enrollment.URI, "secret="+secret) {
+			t.Fatalf("Unexpected enrollment: %+v", enrollment)
+		}
+
+		// Not enabled until a code is confirmed
+		loginUser(t, server, "alice@example.com", "password123")
+		if status, _ := send("POST", "/api/users/mfa/totp/confirm", aliceToken, `{"code": "not-a-code"}`); status != http.StatusBadRequest {
+			t.Errorf("Expected a wrong code to be rejected with %d, got %d", http.StatusBadRequest, status)
+		}
+		status, body = send("POST", "/api/users/mfa/totp/confirm", aliceToken, fmt.Sprintf(`{"code": "%s"}`, code(t, secret, 0)))
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+		}
+		var resp model.RecoveryCodesResponse
+		json.Unmarshal([]byte(body), &resp)
+		recoveryCodes = resp.RecoveryCodes
+		if len(recoveryCodes) != 10 {
+			t.Fatalf("Expected 10 recovery codes, got %v", recoveryCodes)
+		}
+
+		if status, _ := send("POST", "/api/users/mfa/totp", aliceToken, ""); status != http.StatusConflict {
+			t.Errorf("Expected re-enrollment to be rejected with %d, got %d", http.StatusConflict, status)
+		}
+		var mfa model.MFAStatus
+		_, body = send("GET", "/api/users/mfa", aliceToken, "")
+		json.Unmarshal([]byte(body), &mfa)
+		if !mfa.Enabled || mfa.RecoveryCodesRemaining != 10 {
+			t.Errorf("Unexpected MFA status: %s", body)
+		}
+	})
+
+	t.Run("Should require a code to complete a password login", func(t *testing.T) {
+		challenge := startLogin(t)
+		if status, _ := completeLogin(challenge.MFAToken, "not-a-code"); status != http.StatusUnauthorized {
+			t.Errorf("Expected a wrong code to be rejected with %d, got %d", http.StatusUnauthorized, status)
+		}
+		// The code used for the enrollment cannot be replayed; the next one is accepted within the allowed clock skew
+		if status, _ := completeLogin(challenge.MFAToken, code(t, secret, 0)); status != http.StatusUnauthorized {
+			t.Errorf("Expected a used code to be rejected with %d, got %d", http.StatusUnauthorized, status)
+		}
+		status, tokens := completeLogin(challenge.MFAToken, code(t, secret, 1))
+		if status != http.StatusOK || tokens.Token == "" || tokens.RefreshToken == "" {
+			t.Fatalf("Expected tokens, got %d %+v", status, tokens)
+		}
+		if code, _ := send("GET", "/api/groups", tokens.Token, ""); code != http.StatusOK {
+			t.Errorf("Expected the access token to be accepted, got %d", code)
+		}
+		if status, _ := completeLogin(challenge.MFAToken, code(t, secret, 1)); status != http.StatusUnauthorized {
+			t.Errorf("Expected a completed challenge to be rejected, got %d", status)
+		}
+	})
+
+	t.Run("Should accept each recovery code once", func(t *testing.T) {
+		challenge := startLogin(t)
+		if status, _ := completeLogin(challenge.MFAToken, strings.ToUpper(recoveryCodes[0])); status != http.StatusOK {
+			t.Fatalf("Expected a recovery code to be accepted, got %d", status)
+		}
+		challenge = startLogin(t)
+		if status, _ := completeLogin(challenge.MFAToken, recoveryCodes[0]); status != http.StatusUnauthorized {
+			t.Errorf("Expected a used recovery code to be rejected, got %d", status)
+		}
+		var mfa model.MFAStatus
+		_, body := send("GET", "/api/users/mfa", aliceToken, "")
+		json.Unmarshal([]byte(body), &mfa)
+		if mfa.RecoveryCodesRemaining != 9 {
+			t.Errorf("Expected 9 remaining recovery codes, got %d", mfa.RecoveryCodesRemaining)
+		}
+	})
+
+	t.Run("Should reject password-only Basic authentication", func(t *testing.T) {
+		req, _ := http.NewRequest("PROPFIND", "/caldav/", nil)
+		req.SetBasicAuth("alice@example.com", "password123")
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("Should accept a personal access token for Basic authentication", func(t *testing.T) {
+		status, body := send("POST", "/api/users/tokens", aliceToken, `{"name": "calendar app", "scopes": ["read"]}`)
+		if status != http.StatusCreated {
+			t.Fatalf("Failed to create personal access token: %s", body)
+		}
+		var pat model.CreatePersonalAccessTokenResponse
+		json.Unmarshal([]byte(body), &pat)
+
+		davRequest := func(method, path, password string) int {
+			req, _ := http.NewRequest(method, path, strings.NewReader(""))
+			req.Header.Set("Depth", "0")
+			req.SetBasicAuth("alice@example.com", password)
+			return server.executeRequest(req).Code
+		}
+		if status := davRequest("PROPFIND", "/caldav/", pat.Token); status != http.StatusMultiStatus {
+			t.Errorf("Expected status %d, got %d", http.StatusMultiStatus, status)
+		}
+		objectPath := fmt.Sprintf("/caldav/calendars/%d/default/event.ics", aliceID)
+		if status := davRequest("DELETE", objectPath, pat.Token); status != http.StatusForbidden {
+			t.Errorf("Expected the read scope to forbid DELETE, got %d", status)
+		}
+		if status := davRequest("PROPFIND", "/caldav/", "pat_unknown"); status != http.StatusUnauthorized {
+			t.Errorf("Expected an unknown token to be rejected, got %d", status)
+		}
+	})
+
+	t.Run("Should count wrong codes as failed logins", func(t *testing.T) {
+		// Start from a clean account failure count
+		completeLogin(startLogin(t).MFAToken, recoveryCodes[1])
+
+		challenge := startLogin(t)
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountFailures; i++ {
+			if status, _ := completeLogin(challenge.MFAToken, "not-a-code"); status != http.StatusUnauthorized {
+				t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, status)
+			}
+		}
+		req, _ := http.NewRequest("POST", "/api/users/login/mfa", bytes.NewBufferString(fmt.Sprintf(`{"mfa_token": "%s", "code": "%s"}`, challenge.MFAToken, recoveryCodes[2])))
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected 429 with Retry-After, got %d", rr.Code)
+		}
+		if _, err := server.db.Exec("UPDATE login_lockouts SET locked_until = ?", time.Now().Add(-time.Second).UTC()); err != nil {
+			t.Fatalf("Failed to expire lockouts: %v", err)
+		}
+	})
+
+	t.Run("Should limit attempts per challenge", func(t *testing.T) {
+		challenge := startLogin(t)
+		for i := 0; i < 5; i++ {
+			completeLogin(challenge.MFAToken, "not-a-code")
+			// Keep the account below its lockout limit
+			if _, err := server.db.Exec("DELETE FROM login_failures"); err != nil {
+				t.Fatalf("Failed to reset login failures: %v", err)
+			}
+		}
+		allowCodeReuse(t)
+		if status, _ := completeLogin(challenge.MFAToken, code(t, secret, 0)); status != http.StatusUnauthorized {
+			t.Errorf("Expected the challenge to be invalidated after too many attempts, got %d", status)
+		}
+	})
+
+	t.Run("Should regenerate recovery codes", func(t *testing.T) {
+		if status, _ := send("POST", "/api/users/mfa/recovery-codes", aliceToken, `{"code": "not-a-code"}`); status != http.StatusBadRequest {
+			t.Errorf("Expected a wrong code to be rejected with %d, got %d", http.StatusBadRequest, status)
+		}
+		allowCodeReuse(t)
+		status, body := send("POST", "/api/users/mfa/recovery-codes", aliceToken, fmt.Sprintf(`{"code": "%s"}`, code(t, secret, 0)))
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+		}
+		var resp model.RecoveryCodesResponse
+		json.Unmarshal([]byte(body), &resp)
+		if len(resp.RecoveryCodes) != 10 {
+			t.Fatalf("Expected 10 recovery codes, got %v", resp.RecoveryCodes)
+		}
+		challenge := startLogin(t)
+		if status, _ := completeLogin(challenge.MFAToken, recoveryCodes[3]); status != http.StatusUnauthorized {
+			t.Errorf("Expected old recovery codes to be invalidated, got %d", status)
+		}
+		recoveryCodes = resp.RecoveryCodes
+	})
+
+	t.Run("Should disable two-factor authentication", func(t *testing.T) {
+		if status, _ := send("POST", "/api/users/mfa/disable", aliceToken, `{}`); status != http.StatusBadRequest {
+			t.Errorf("Expected a missing code to be rejected with %d, got %d", http.StatusBadRequest, status)
+		}
+		if status, body := send("POST", "/api/users/mfa/disable", aliceToken, fmt.Sprintf(`{"code": "%s"}`, recoveryCodes[0])); status != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, status, body)
+		}
+		loginUser(t, server, "alice@example.com", "password123")
+		if status, _ := send("POST", "/api/users/mfa/disable", aliceToken, `{"code": "123456"}`); status != http.StatusConflict {
+			t.Errorf("Expected %d when not enabled, got %d", http.StatusConflict, status)
+		}
+		if status, _ := send("POST", "/api/users/mfa/totp/confirm", aliceToken, `{"code": "123456"}`); status != http.StatusConflict {
+			t.Errorf("Expected %d without an enrollment in progress, got %d", http.StatusConflict, status)
+		}
+	})
+}
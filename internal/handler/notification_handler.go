@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+)
+
+// defaultNotificationLimit と maxNotificationLimit は通知の一覧の1ページあたりの件数です。
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// NotificationHandler はアプリ内通知の取得と既読の管理を処理します。
+type NotificationHandler struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+// NewNotificationHandler は NotificationHandler の新しいインスタンスを生成します。
+func NewNotificationHandler(notificationRepo *repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{notificationRepo: notificationRepo}
+}
+
+// ListNotifications はログイン中のユーザーの通知を新しい順に返します。
+// クエリパラメータ unread=true で未読の通知のみに絞り込み、cursor と limit でページを指定します。
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	q, err := parseNotificationQuery(r)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, next, err := h.notificationRepo.FindByUser(userID, q)
+	if err != nil {
+		log.Printf("ERROR: Failed to get notifications of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+	unread, err := h.notificationRepo.CountUnread(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to count unread notifications of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+
+	resp := &model.NotificationListResponse{Notifications: notifications, UnreadCount: unread}
+	if next > 0 {
+		resp.NextCursor = strconv.FormatInt(next, 10)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// MarkRead はログイン中のユーザーの通知を既読にします。
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	notificationID, err := strconv.ParseInt(r.PathValue("notificationID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	if err := h.notificationRepo.MarkRead(userID, notificationID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Notification not found")
+		} else {
+			log.Printf("ERROR: Failed to mark notification %d as read: %v", notificationID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to mark notification as read")
+		}
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// MarkAllRead はログイン中のユーザーの未読の通知をすべて既読にし、既読にした件数を返します。
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	n, err := h.notificationRepo.MarkAllRead(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to mark notifications of user %d as read: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to mark notifications as read")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"marked": n})
+}
+
+// parseNotificationQuery は通知の一覧のクエリパラメータ (unread, cursor, limit) を解析します。
+func parseNotificationQuery(r *http.Request) (*model.NotificationQuery, error) {
+	q := &model.NotificationQuery{Limit: defaultNotificationLimit}
+	if unread := r.URL.Query().Get("unread"); unread != "" {
+		v, err := strconv.ParseBool(unread)
+		if err != nil {
+			return nil, fmt.Errorf("unread must be true or false")
+		}
+		q.UnreadOnly = v
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		q.BeforeID = id
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxNotificationLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxNotificationLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	carolToken := loginUser(t, server, "carol@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	list := func(t *testing.T, token, query string) model.NotificationListResponse {
+		t.Helper()
+		code, body := send("GET", "/api/notifications"+query, token, "")
+		if code != http.StatusOK {
+			t.Fatalf("Failed to list notifications: %d %s", code, body)
+		}
+		var resp model.NotificationListResponse
+		json.Unmarshal([]byte(body), &resp)
+		return resp
+	}
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	var scheduleID int64
+
+	// --- Test Cases ---
+	t.Run("Should notify the owner and participants of a new schedule", func(t *testing.T) {
+		scheduleID = createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Planning", "start_time": "%s", "end_time": "%s", "owner_id": %d, "participant_ids": [%d, %d]}`,
+			start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), aliceID, bobID, carolID))
+
+		resp := list(t, bobToken, "")
+		if len(resp.Notifications) != 1 || resp.UnreadCount != 1 {
+			t.Fatalf("Expected 1 unread notification, got %+v", resp)
+		}
+		n := resp.Notifications[0]
+		if n.Type != model.NotificationScheduleCreated || n.ScheduleID == nil || *n.ScheduleID != scheduleID ||
+			n.ActorID == nil || *n.ActorID != aliceID || n.ReadAt != nil || !strings.Contains(n.Body, `alice invited you to "Planning"`) {
+			t.Errorf("Unexpected notification: %+v", n)
+		}
+		if resp := list(t, aliceToken, ""); len(resp.Notifications) != 0 {
+			t.Errorf("Expected no notifications for the creator, got %+v", resp.Notifications)
+		}
+
+		// A schedule added to bob's calendar by alice
+		shareCalendar(t, server, bobToken, bobID, aliceID, model.PermissionWrite)
+		later := start.Add(2 * time.Hour)
+		createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "1:1", "start_time": "%s", "end_time": "%s", "owner_id": %d}`,
+			later.Format(time.RFC3339), later.Add(time.Hour).Format(time.RFC3339), bobID))
+		if resp := list(t, bobToken, ""); len(resp.Notifications) != 2 || !strings.Contains(resp.Notifications[0].Body, `alice added "1:1"`) {
+			t.Errorf("Expected bob to be notified about his calendar, got %+v", resp.Notifications)
+		}
+	})
+
+	t.Run("Should notify the owner of responses", func(t *testing.T) {
+		send("POST", fmt.Sprintf("/api/schedules/%d/rsvp", scheduleID), bobToken, `{"status": "accepted", "comment": "See you"}`)
+		resp := list(t, aliceToken, "")
+		if len(resp.Notifications) != 1 {
+			t.Fatalf("Expected 1 notification, got %+v", resp.Notifications)
+		}
+		if n := resp.Notifications[0]; n.Type != model.NotificationRSVP || n.Title != "bob accepted: Planning" || !strings.Contains(n.Body, "Comment: See you") {
+			t.Errorf("Unexpected notification: %+v", n)
+		}
+	})
+
+	t.Run("Should notify about changes including removed participants", func(t *testing.T) {
+		code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", scheduleID), aliceToken, fmt.Sprintf(`{"title": "Planning v2", "participant_ids": [%d]}`, bobID))
+		if code != http.StatusOK {
+			t.Fatalf("Failed to update schedule: %s", body)
+		}
+		for name, token := range map[string]string{"bob": bobToken, "carol": carolToken} {
+			n := list(t, token, "").Notifications[0]
+			if n.Type != model.NotificationScheduleUpdated || !strings.Contains(n.Body, `alice updated "Planning v2"`) {
+				t.Errorf("Expected %s to be notified about the update, got %+v", name, n)
+			}
+		}
+
+		if code, _ := send("DELETE", fmt.Sprintf("/api/schedules/%d", scheduleID), aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Failed to delete schedule: %d", code)
+		}
+		if n := list(t, bobToken, "").Notifications[0]; n.Type != model.NotificationScheduleDeleted || n.Title != "Schedule deleted: Planning v2" {
+			t.Errorf("Expected bob to be notified about the deletion, got %+v", n)
+		}
+		// carol was removed from the participants before the deletion
+		if n := list(t, carolToken, "").Notifications[0]; n.Type == model.NotificationScheduleDeleted {
+			t.Errorf("Expected carol not to be notified about the deletion, got %+v", n)
+		}
+	})
+
+	t.Run("Should page through notifications", func(t *testing.T) {
+		// bob: created, created (1:1), updated, deleted
+		first := list(t, bobToken, "?limit=3")
+		if len(first.Notifications) != 3 || first.NextCursor == "" || first.UnreadCount != 4 {
+			t.Fatalf("Unexpected first page: %+v", first)
+		}
+		second := list(t, bobToken, "?limit=3&cursor="+first.NextCursor)
+		if len(second.Notifications) != 1 || second.NextCursor != "" || second.Notifications[0].ID >= first.Notifications[2].ID {
+			t.Errorf("Unexpected second page: %+v", second)
+		}
+
+		for _, query := range []string{"?limit=0", "?limit=101", "?unread=maybe", "?cursor=abc"} {
+			if code, _ := send("GET", "/api/notifications"+query, bobToken, ""); code != http.StatusBadRequest {
+				t.Errorf("%s: expected %d, got %d", query, http.StatusBadRequest, code)
+			}
+		}
+	})
+
+	t.Run("Should mark notifications as read", func(t *testing.T) {
+		latest := list(t, bobToken, "").Notifications[0]
+		path := fmt.Sprintf("/api/notifications/%d/read", latest.ID)
+		if code, _ := send("POST", path, aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected other users' notifications to be %d, got %d", http.StatusNotFound, code)
+		}
+		if code, _ := send("POST", path, bobToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+		unread := list(t, bobToken, "?unread=true")
+		if len(unread.Notifications) != 3 || unread.UnreadCount != 3 {
+			t.Errorf("Expected 3 unread notifications, got %+v", unread)
+		}
+		for _, n := range unread.Notifications {
+			if n.ID == latest.ID {
+				t.Errorf("Expected the read notification to be filtered out")
+			}
+		}
+
+		code, body := send("POST", "/api/notifications/read-all", bobToken, "")
+		if code != http.StatusOK || !strings.Contains(body, `"marked":3`) {
+			t.Errorf("Expected 3 notifications to be marked, got %d %s", code, body)
+		}
+		if resp := list(t, bobToken, "?unread=true"); len(resp.Notifications) != 0 || resp.UnreadCount != 0 {
+			t.Errorf("Expected no unread notifications, got %+v", resp)
+		}
+		if resp := list(t, bobToken, ""); len(resp.Notifications) != 4 || resp.Notifications[0].ReadAt == nil {
+			t.Errorf("Expected read notifications to be kept, got %+v", resp)
+		}
+	})
+
+	t.Run("Should notify about changes through CalDAV", func(t *testing.T) {
+		objectPath := fmt.Sprintf("/caldav/calendars/%d/default/review-1@client.example.ics", aliceID)
+		dav := func(method, summary string) int {
+			body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Native Client//EN\r\nBEGIN:VEVENT\r\n" +
+				"UID:review-1@client.example\r\nDTSTAMP:20251101T000000Z\r\n" +
+				"DTSTART:" + start.UTC().Format("20060102T150405Z") + "\r\nDTEND:" + start.Add(time.Hour).UTC().Format("20060102T150405Z") + "\r\n" +
+				"SUMMARY:" + summary + "\r\nATTENDEE:mailto:bob@example.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+			if method == "DELETE" {
+				body = ""
+			}
+			req, _ := http.NewRequest(method, objectPath, strings.NewReader(body))
+			req.Header.Set("Content-Type", "text/calendar")
+			req.SetBasicAuth("alice@example.com", "password123")
+			return server.executeRequest(req).Code
+		}
+
+		aliceUnread := list(t, aliceToken, "").UnreadCount
+		steps := []struct {
+			method, summary string
+			status          int
+			kind, body      string
+		}{
+			{"PUT", "Review", http.StatusCreated, model.NotificationScheduleCreated, `alice invited you to "Review"`},
+			{"PUT", "Review v2", http.StatusNoContent, model.NotificationScheduleUpdated, `alice updated "Review v2"`},
+			{"DELETE", "", http.StatusNoContent, model.NotificationScheduleDeleted, `alice deleted "Review v2"`},
+		}
+		for _, step := range steps {
+			if code := dav(step.method, step.summary); code != step.status {
+				t.Fatalf("%s %q: expected status %d, got %d", step.method, step.summary, step.status, code)
+			}
+			if n := list(t, bobToken, "").Notifications[0]; n.Type != step.kind || !strings.Contains(n.Body, step.body) {
+				t.Errorf("%s %q: expected bob to be notified with %q, got %+v", step.method, step.summary, step.body, n)
+			}
+		}
+		if resp := list(t, aliceToken, ""); resp.UnreadCount != aliceUnread {
+			t.Errorf("Expected no notifications for alice's own CalDAV changes, got %+v", resp.Notifications)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPersonalTokenNameLength はトークンの名前の最大の長さです。
+const maxPersonalTokenNameLength = 100
+
+// PersonalTokenHandler はパーソナルアクセストークンの一覧・発行・取り消しを処理します。
+// トークンでトークンを発行できないよう、ルーティングで RequireSession を適用します。
+type PersonalTokenHandler struct {
+	tokenRepo *repository.PersonalTokenRepository
+}
+
+// NewPersonalTokenHandler は PersonalTokenHandler の新しいインスタンスを生成します。
+func NewPersonalTokenHandler(tokenRepo *repository.PersonalTokenRepository) *PersonalTokenHandler {
+	return &PersonalTokenHandler{tokenRepo: tokenRepo}
+}
+
+// ListTokens はログイン中のユーザーのトークンを返します。トークン自体は含みません。
+func (h *PersonalTokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tokens, err := h.tokenRepo.FindByUser(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get personal access tokens of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve tokens")
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// CreateToken は名前・スコープ・有効期限を指定してトークンを発行します。トークンはこの応答でのみ確認できます。
+// admin のスコープは管理者のみが指定できます。
+func (h *PersonalTokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req model.CreatePersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// 入力値のバリデーション
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxPersonalTokenNameLength {
+		errorJSON(w, http.StatusBadRequest, fmt.Sprintf("name is required and must be at most %d characters long", maxPersonalTokenNameLength))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		errorJSON(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	seen := make(map[model.TokenScope]bool)
+	var scopes []model.TokenScope
+	for _, scope := range req.Scopes {
+		if !scope.Valid() {
+			errorJSON(w, http.StatusBadRequest, fmt.Sprintf("Invalid scope %q: must be read, write or admin", scope))
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if seen[model.TokenScopeAdmin] && middleware.GetRoleFromContext(r.Context()) != model.UserRoleAdmin {
+		errorJSON(w, http.StatusForbidden, "Only admins can create tokens with the admin scope")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errorJSON(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	pat, token, err := h.tokenRepo.Create(userID, req.Name, scopes, req.ExpiresAt)
+	if err != nil {
+		log.Printf("ERROR: Failed to create personal access token for user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+	writeJSON(w, http.StatusCreated, &model.CreatePersonalAccessTokenResponse{PersonalAccessToken: pat, Token: token})
+}
+
+// RevokeToken はログイン中のユーザーのトークンを取り消します。
+func (h *PersonalTokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	tokenID, err := strconv.ParseInt(r.PathValue("tokenID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	if err := h.tokenRepo.Delete(userID, tokenID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Token not found")
+		} else {
+			log.Printf("ERROR: Failed to revoke personal access token %d: %v", tokenID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to revoke token")
+		}
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
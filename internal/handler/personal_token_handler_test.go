@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:12345"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	create := func(t *testing.T, sessionToken, body string) model.CreatePersonalAccessTokenResponse {
+		t.Helper()
+		code, resp := send("POST", "/api/users/tokens", sessionToken, body)
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to create token: %d %s", code, resp)
+		}
+		var created model.CreatePersonalAccessTokenResponse
+		json.Unmarshal([]byte(resp), &created)
+		return created
+	}
+
+	var readWrite, readOnly model.CreatePersonalAccessTokenResponse
+
+	// --- Test Cases ---
+	t.Run("Should create a token that authenticates API requests", func(t *testing.T) {
+		readWrite = create(t, aliceToken, `{"name": "deploy script", "scopes": ["read", "write", "read"]}`)
+		if !strings.HasPrefix(readWrite.Token, "pat_") || !strings.HasPrefix(readWrite.Token, readWrite.Prefix) || readWrite.ExpiresAt != nil {
+			t.Fatalf("Unexpected token: %+v", readWrite)
+		}
+		if len(readWrite.Scopes) != 2 {
+			t.Errorf("Expected duplicate scopes to be removed, got %v", readWrite.Scopes)
+		}
+
+		if code, body := send("GET", "/api/groups", readWrite.Token, ""); code != http.StatusOK {
+			t.Errorf("Expected the token to be accepted, got %d: %s", code, body)
+		}
+		if code, body := send("POST", "/api/groups", readWrite.Token, `{"name": "Team"}`); code != http.StatusCreated {
+			t.Errorf("Expected the write scope to allow creating a group, got %d: %s", code, body)
+		}
+	})
+
+	t.Run("Should enforce scopes", func(t *testing.T) {
+		readOnly = create(t, aliceToken, `{"name": "dashboard", "scopes": ["read"], "expires_at": "2999-01-01T00:00:00Z"}`)
+		if readOnly.ExpiresAt == nil {
+			t.Errorf("Expected an expiry, got %+v", readOnly)
+		}
+		if code, _ := send("GET", "/api/groups", readOnly.Token, ""); code != http.StatusOK {
+			t.Errorf("Expected the read scope to allow GET, got %d", code)
+		}
+		if code, _ := send("POST", "/api/groups", readOnly.Token, `{"name": "Team"}`); code != http.StatusForbidden {
+			t.Errorf("Expected the read scope to forbid POST, got %d", code)
+		}
+		if code, _ := send("GET", "/api/admin/users", readWrite.Token, ""); code != http.StatusForbidden {
+			t.Errorf("Expected admin endpoints to be forbidden without the admin scope, got %d", code)
+		}
+	})
+
+	t.Run("Should not manage tokens or sessions with a token", func(t *testing.T) {
+		tests := []struct {
+			method, path, body string
+		}{
+			{"GET", "/api/users/tokens", ""},
+			{"POST", "/api/users/tokens", `{"name": "escalate", "scopes": ["read"]}`},
+			{"DELETE", fmt.Sprintf("/api/users/tokens/%d", readOnly.ID), ""},
+			{"POST", "/api/users/mfa/totp", ""},
+		}
+		for _, tt := range tests {
+			if code, _ := send(tt.method, tt.path, readWrite.Token, tt.body); code != http.StatusForbidden {
+				t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, http.StatusForbidden, code)
+			}
+		}
+		if code, _ := send("POST", "/api/users/logout", readWrite.Token, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected logout with a token to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("Should list tokens with their last use", func(t *testing.T) {
+		code, body := send("GET", "/api/users/tokens", aliceToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+		}
+		if strings.Contains(body, readWrite.Token) || strings.Contains(body, `"token"`) {
+			t.Errorf("Expected the list not to contain tokens: %s", body)
+		}
+		var tokens []model.PersonalAccessToken
+		json.Unmarshal([]byte(body), &tokens)
+		if len(tokens) != 2 || tokens[0].Name != "dashboard" || tokens[1].Name != "deploy script" {
+			t.Fatalf("Unexpected tokens: %s", body)
+		}
+		if tokens[1].LastUsedAt == nil || tokens[1].LastUsedIP != "192.0.2.1" {
+			t.Errorf("Expected the last use to be recorded: %+v", tokens[1])
+		}
+
+		if code, body := send("GET", "/api/users/tokens", bobToken, ""); code != http.StatusOK || body != "[]\n" {
+			t.Errorf("Expected other users not to see the tokens, got %d %s", code, body)
+		}
+	})
+
+	t.Run("Should validate new tokens", func(t *testing.T) {
+		tests := []struct {
+			name, body string
+			want       int
+		}{
+			{"missing name", `{"scopes": ["read"]}`, http.StatusBadRequest},
+			{"missing scopes", `{"name": "script"}`, http.StatusBadRequest},
+			{"unknown scope", `{"name": "script", "scopes": ["delete"]}`, http.StatusBadRequest},
+			{"past expiry", `{"name": "script", "scopes": ["read"], "expires_at": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+			{"admin scope as user", `{"name": "script", "scopes": ["read", "admin"]}`, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			if code, body := send("POST", "/api/users/tokens", aliceToken, tt.body); code != tt.want {
+				t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, code, body)
+			}
+		}
+	})
+
+	t.Run("Should reject expired and revoked tokens", func(t *testing.T) {
+		if _, err := server.db.Exec("UPDATE personal_access_tokens SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC(), readOnly.ID); err != nil {
+			t.Fatalf("Failed to expire token: %v", err)
+		}
+		if code, _ := send("GET", "/api/groups", readOnly.Token, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected an expired token to be rejected, got %d", code)
+		}
+
+		path := fmt.Sprintf("/api/users/tokens/%d", readWrite.ID)
+		if code, _ := send("DELETE", path, bobToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected other users not to revoke the token, got %d", code)
+		}
+		if code, _ := send("DELETE", path, aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+		if code, _ := send("GET", "/api/groups", readWrite.Token, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected a revoked token to be rejected, got %d", code)
+		}
+		if code, _ := send("GET", "/api/groups", "pat_unknown", ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected an unknown token to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("Should grant admin access only while the owner is an admin", func(t *testing.T) {
+		send("POST", "/api/bootstrap/admin", aliceToken, fmt.Sprintf(`{"token": "%s"}`, testBootstrapToken))
+		aliceAdminToken := loginUser(t, server, "alice@example.com", "password123")
+		if code, body := send("PUT", fmt.Sprintf("/api/admin/users/%d/role", bobID), aliceAdminToken, `{"role": "admin"}`); code != http.StatusOK {
+			t.Fatalf("Failed to promote bob: %s", body)
+		}
+		bobAdminToken := loginUser(t, server, "bob@example.com", "password123")
+
+		admin := create(t, bobAdminToken, `{"name": "admin script", "scopes": ["read", "admin"]}`)
+		if code, _ := send("GET", "/api/admin/users", admin.Token, ""); code != http.StatusOK {
+			t.Errorf("Expected the admin scope to allow admin endpoints, got %d", code)
+		}
+		if code, body := send("PUT", fmt.Sprintf("/api/admin/users/%d/role", bobID), aliceAdminToken, `{"role": "user"}`); code != http.StatusOK {
+			t.Fatalf("Failed to demote bob: %s", body)
+		}
+		if code, _ := send("GET", "/api/admin/users", admin.Token, ""); code != http.StatusForbidden {
+			t.Errorf("Expected the admin scope to stop working after a demotion, got %d", code)
+		}
+	})
+}
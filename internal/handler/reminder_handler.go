@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+)
+
+// maxWebhookURLLength は webhook URL の最大の長さです。
+const maxWebhookURLLength = 2048
+
+// ReminderHandler はリマインダーの設定 (既定のリマインダーとスケジュールごとのリマインダー) を処理します。
+// リマインダーの送信は reminder.Worker が行います。
+type ReminderHandler struct {
+	reminderRepo *repository.ReminderRepository
+	scheduleRepo *repository.ScheduleRepository
+}
+
+// NewReminderHandler は ReminderHandler の新しいインスタンスを生成します。
+func NewReminderHandler(reminderRepo *repository.ReminderRepository, scheduleRepo *repository.ScheduleRepository) *ReminderHandler {
+	return &ReminderHandler{reminderRepo: reminderRepo, scheduleRepo: scheduleRepo}
+}
+
+// GetSettings はログイン中のユーザーのリマインダーの設定を返します。
+func (h *ReminderHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := h.reminderRepo.Settings(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get reminder settings of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve reminder settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// UpdateSettings はログイン中のユーザーの既定のリマインダーと webhook URL を更新します。
+func (h *ReminderHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req model.ReminderSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// 入力値のバリデーション
+	reminders, err := normalizeReminders(req.DefaultReminders)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.DefaultReminders = reminders
+	req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+	if req.WebhookURL != "" && !validWebhookURL(req.WebhookURL) {
+		errorJSON(w, http.StatusBadRequest, "webhook_url must be an absolute http or https URL")
+		return
+	}
+	if usesWebhook(reminders) && req.WebhookURL == "" {
+		errorJSON(w, http.StatusBadRequest, "webhook reminders require a webhook_url")
+		return
+	}
+
+	if err := h.reminderRepo.SaveSettings(userID, &req); err != nil {
+		log.Printf("ERROR: Failed to save reminder settings of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to save reminder settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, &req)
+}
+
+// GetScheduleReminders はログイン中のユーザーがスケジュールで受け取るリマインダーを返します。
+// スケジュールのリマインダーを設定していない場合は既定のリマインダーを返します。
+func (h *ReminderHandler) GetScheduleReminders(w http.ResponseWriter, r *http.Request) {
+	userID, scheduleID, ok := h.recipientOf(w, r)
+	if !ok {
+		return
+	}
+
+	reminders, err := h.reminderRepo.ScheduleReminders(scheduleID, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get reminders of schedule %d: %v", scheduleID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve reminders")
+		return
+	}
+	writeJSON(w, http.StatusOK, reminders)
+}
+
+// UpdateScheduleReminders はログイン中のユーザーのスケジュールのリマインダーを設定します。
+// 空のリストを設定すると、既定のリマインダーがあってもそのスケジュールのリマインダーは送信しません。
+func (h *ReminderHandler) UpdateScheduleReminders(w http.ResponseWriter, r *http.Request) {
+	userID, scheduleID, ok := h.recipientOf(w, r)
+	if !ok {
+		return
+	}
+	var req model.ScheduleReminders
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// 入力値のバリデーション
+	reminders, err := normalizeReminders(req.Reminders)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if usesWebhook(reminders) {
+		settings, err := h.reminderRepo.Settings(userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get reminder settings of user %d: %v", userID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to save reminders")
+			return
+		}
+		if settings.WebhookURL == "" {
+			errorJSON(w, http.StatusBadRequest, "webhook reminders require a webhook_url in the reminder settings")
+			return
+		}
+	}
+
+	if err := h.reminderRepo.SaveScheduleReminders(scheduleID, userID, reminders); err != nil {
+		log.Printf("ERROR: Failed to save reminders of schedule %d: %v", scheduleID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to save reminders")
+		return
+	}
+	writeJSON(w, http.StatusOK, &model.ScheduleReminders{Reminders: reminders, Custom: true})
+}
+
+// DeleteScheduleReminders はログイン中のユーザーのスケジュールのリマインダーを削除し、既定のリマインダーに戻します。
+func (h *ReminderHandler) DeleteScheduleReminders(w http.ResponseWriter, r *http.Request) {
+	userID, scheduleID, ok := h.recipientOf(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.reminderRepo.DeleteScheduleReminders(scheduleID, userID); err != nil {
+		log.Printf("ERROR: Failed to delete reminders of schedule %d: %v", scheduleID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to delete reminders")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// recipientOf はログイン中のユーザーとパスのスケジュールIDを返します。
+// リマインダーを受け取るのはスケジュールの所有者と参加者のみのため、それ以外のユーザーには 404 を返します。
+func (h *ReminderHandler) recipientOf(w http.ResponseWriter, r *http.Request) (userID, scheduleID int64, ok bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	scheduleID, err = strconv.ParseInt(r.PathValue("scheduleID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid schedule ID")
+		return 0, 0, false
+	}
+
+	schedule, err := h.scheduleRepo.FindByID(scheduleID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Schedule not found")
+		} else {
+			log.Printf("ERROR: Failed to get schedule %d: %v", scheduleID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve schedule")
+		}
+		return 0, 0, false
+	}
+	if !schedule.OwnedByUser(userID) && !schedule.HasParticipant(userID) {
+		errorJSON(w, http.StatusNotFound, "Schedule not found")
+		return 0, 0, false
+	}
+	return userID, scheduleID, true
+}
+
+// normalizeReminders はリマインダーを検証し、重複を除いて返します。
+func normalizeReminders(reminders []model.Reminder) ([]model.Reminder, error) {
+	seen := make(map[model.Reminder]bool)
+	normalized := []model.Reminder{}
+	for _, reminder := range reminders {
+		if err := reminder.Validate(); err != nil {
+			return nil, err
+		}
+		if !seen[reminder] {
+			seen[reminder] = true
+			normalized = append(normalized, reminder)
+		}
+	}
+	if len(normalized) > model.MaxReminders {
+		return nil, fmt.Errorf("at most %d reminders can be set", model.MaxReminders)
+	}
+	return normalized, nil
+}
+
+// usesWebhook はリマインダーに webhook チャネルのものが含まれるかどうかを返します。
+func usesWebhook(reminders []model.Reminder) bool {
+	for _, reminder := range reminders {
+		if reminder.Channel == model.ReminderWebhook {
+			return true
+		}
+	}
+	return false
+}
+
+// validWebhookURL は webhook URL がホストを含む http または https の URL かどうかを返します。
+func validWebhookURL(s string) bool {
+	if len(s) > maxWebhookURLLength {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
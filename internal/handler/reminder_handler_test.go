@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"schedule-app/internal/clock"
+	"schedule-app/internal/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReminders(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	createUser(t, server, "dave", "dave@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	carolToken := loginUser(t, server, "carol@example.com", "password123")
+	daveToken := loginUser(t, server, "dave@example.com", "password123")
+
+	// The webhook receiver records the reminders posted to it
+	var mu sync.Mutex
+	var webhooks []map[string]any
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		webhooks = append(webhooks, payload)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	// runReminders advances the worker's clock to at and sends the due reminders.
+	runReminders := func(t *testing.T, at time.Time) int {
+		t.Helper()
+		server.clock.Set(at)
+		sent, err := server.reminders.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to send reminders: %v", err)
+		}
+		return sent
+	}
+	// notifications returns the in-app reminders of the user, newest first.
+	notifications := func(token string) []*model.Notification {
+		_, body := send("GET", "/api/notifications", token, "")
+		var resp model.NotificationListResponse
+		json.Unmarshal([]byte(body), &resp)
+		var reminders []*model.Notification
+		for _, n := range resp.Notifications {
+			if n.Type == model.NotificationReminder {
+				reminders = append(reminders, n)
+			}
+		}
+		return reminders
+	}
+
+	now := server.clock.Now()
+	start := now.Add(2 * time.Hour)
+	var scheduleID int64
+
+	// --- Test Cases ---
+	t.Run("Should validate reminder settings", func(t *testing.T) {
+		tests := []struct {
+			name, body string
+		}{
+			{"unknown channel", `{"default_reminders": [{"minutes_before": 10, "channel": "sms"}]}`},
+			{"negative offset", `{"default_reminders": [{"minutes_before": -1, "channel": "email"}]}`},
+			{"offset over a week", `{"default_reminders": [{"minutes_before": 10081, "channel": "email"}]}`},
+			{"webhook without URL", `{"default_reminders": [{"minutes_before": 10, "channel": "webhook"}]}`},
+			{"invalid URL", `{"default_reminders": [], "webhook_url": "ftp://example.com/hook"}`},
+			{"too many reminders", `{"default_reminders": [{"minutes_before": 1, "channel": "email"}, {"minutes_before": 2, "channel": "email"},
+				{"minutes_before": 3, "channel": "email"}, {"minutes_before": 4, "channel": "email"}, {"minutes_before": 5, "channel": "email"},
+				{"minutes_before": 6, "channel": "email"}]}`},
+		}
+		for _, tt := range tests {
+			if code, body := send("PUT", "/api/users/reminders", aliceToken, tt.body); code != http.StatusBadRequest {
+				t.Errorf("%s: expected %d, got %d: %s", tt.name, http.StatusBadRequest, code, body)
+			}
+		}
+	})
+
+	t.Run("Should save default reminders", func(t *testing.T) {
+		code, body := send("PUT", "/api/users/reminders", aliceToken,
+			`{"default_reminders": [{"minutes_before": 10, "channel": "email"}, {"minutes_before": 60, "channel": "in_app"}, {"minutes_before": 10, "channel": "email"}]}`)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, code, body)
+		}
+		var settings model.ReminderSettings
+		_, body = send("GET", "/api/users/reminders", aliceToken, "")
+		json.Unmarshal([]byte(body), &settings)
+		if len(settings.DefaultReminders) != 2 || settings.DefaultReminders[1] != (model.Reminder{MinutesBefore: 60, Channel: model.ReminderInApp}) {
+			t.Errorf("Expected duplicate reminders to be removed, got %s", body)
+		}
+
+		if code, body := send("PUT", "/api/users/reminders", bobToken, fmt.Sprintf(`{"default_reminders": [{"minutes_before": 60, "channel": "in_app"}], "webhook_url": "%s"}`, hook.URL)); code != http.StatusOK {
+			t.Fatalf("Failed to save bob's settings: %s", body)
+		}
+		if code, body := send("PUT", "/api/users/reminders", carolToken, `{"default_reminders": [{"minutes_before": 60, "channel": "in_app"}]}`); code != http.StatusOK {
+			t.Fatalf("Failed to save carol's settings: %s", body)
+		}
+		if code, body := send("GET", "/api/users/reminders", daveToken, ""); code != http.StatusOK || !strings.Contains(body, `"default_reminders":[]`) {
+			t.Errorf("Expected no default reminders, got %d %s", code, body)
+		}
+	})
+
+	t.Run("Should set reminders per schedule", func(t *testing.T) {
+		scheduleID = createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Planning", "start_time": "%s", "end_time": "%s", "owner_id": %d, "participant_ids": [%d, %d]}`,
+			start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), aliceID, bobID, carolID))
+		send("POST", fmt.Sprintf("/api/schedules/%d/rsvp", scheduleID), carolToken, `{"status": "declined"}`)
+		path := fmt.Sprintf("/api/schedules/%d/reminders", scheduleID)
+
+		var reminders model.ScheduleReminders
+		_, body := send("GET", path, bobToken, "")
+		json.Unmarshal([]byte(body), &reminders)
+		if reminders.Custom || len(reminders.Reminders) != 1 || reminders.Reminders[0].Channel != model.ReminderInApp {
+			t.Errorf("Expected the default reminders, got %s", body)
+		}
+		code, body := send("PUT", path, bobToken, `{"reminders": [{"minutes_before": 30, "channel": "webhook"}]}`)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, code, body)
+		}
+		_, body = send("GET", path, bobToken, "")
+		json.Unmarshal([]byte(body), &reminders)
+		if !reminders.Custom || len(reminders.Reminders) != 1 || reminders.Reminders[0].MinutesBefore != 30 {
+			t.Errorf("Expected the schedule reminders, got %s", body)
+		}
+
+		if code, _ := send("PUT", path, aliceToken, `{"reminders": [{"minutes_before": 5, "channel": "webhook"}]}`); code != http.StatusBadRequest {
+			t.Errorf("Expected webhook reminders without a webhook URL to be rejected, got %d", code)
+		}
+		if code, _ := send("GET", path, daveToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected users who are not invited to get %d, got %d", http.StatusNotFound, code)
+		}
+		if code, _ := send("GET", "/api/schedules/9999/reminders", aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected %d for a missing schedule, got %d", http.StatusNotFound, code)
+		}
+	})
+
+	t.Run("Should send each reminder once when it is due", func(t *testing.T) {
+		if sent := runReminders(t, now); sent != 0 {
+			t.Fatalf("Expected no reminders yet, got %d", sent)
+		}
+
+		// 60 minutes before: alice's in-app reminder. Bob uses his schedule reminder and carol declined.
+		if sent := runReminders(t, start.Add(-60*time.Minute)); sent != 1 {
+			t.Fatalf("Expected 1 reminder, got %d", sent)
+		}
+		list := notifications(aliceToken)
+		if len(list) != 1 || list[0].Type != model.NotificationReminder || list[0].Title != "Reminder: Planning" ||
+			list[0].ScheduleID == nil || *list[0].ScheduleID != scheduleID || !strings.Contains(list[0].Body, "starts in 1 hour") {
+			t.Fatalf("Unexpected notifications: %+v", list)
+		}
+		if len(notifications(bobToken)) != 0 || len(notifications(carolToken)) != 0 {
+			t.Errorf("Expected no notifications for bob and carol")
+		}
+		if sent := runReminders(t, start.Add(-59*time.Minute)); sent != 0 {
+			t.Errorf("Expected the reminder not to be sent again, got %d", sent)
+		}
+
+		// 30 minutes before: bob's webhook reminder
+		if sent := runReminders(t, start.Add(-30*time.Minute)); sent != 1 {
+			t.Fatalf("Expected 1 reminder, got %d", sent)
+		}
+		mu.Lock()
+		if len(webhooks) != 1 || webhooks[0]["type"] != "schedule.reminder" || webhooks[0]["schedule_id"] != float64(scheduleID) || webhooks[0]["minutes_before"] != float64(30) {
+			t.Errorf("Unexpected webhooks: %v", webhooks)
+		}
+		mu.Unlock()
+
+		// 10 minutes before: alice's email reminder
+		if sent := runReminders(t, start.Add(-10*time.Minute)); sent != 1 {
+			t.Fatalf("Expected 1 reminder, got %d", sent)
+		}
+		messages := server.outbox.Messages()
+		last := messages[len(messages)-1]
+		if last.To != "alice@example.com" || last.Subject != "Reminder: Planning" || !strings.Contains(last.Body, "starts in 10 minutes") {
+			t.Errorf("Unexpected email: %+v", last)
+		}
+	})
+
+	t.Run("Should not send reminders again after a restart", func(t *testing.T) {
+		emails := len(server.outbox.Messages())
+		restarted := newTestReminderWorker(server.db, server.outbox, clock.NewFake(start.Add(-time.Minute)))
+		if sent, err := restarted.RunOnce(context.Background()); err != nil || sent != 0 {
+			t.Errorf("Expected no reminders after a restart, got %d (%v)", sent, err)
+		}
+		if len(server.outbox.Messages()) != emails || len(notifications(aliceToken)) != 1 {
+			t.Errorf("Expected no new emails or notifications")
+		}
+	})
+
+	t.Run("Should send missed reminders until the schedule starts", func(t *testing.T) {
+		later := start.Add(3 * time.Hour)
+		createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Review", "start_time": "%s", "end_time": "%s", "owner_id": %d}`,
+			later.Format(time.RFC3339), later.Add(time.Hour).Format(time.RFC3339), aliceID))
+		missed := later.Add(6 * time.Hour)
+		createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Retro", "start_time": "%s", "end_time": "%s", "owner_id": %d}`,
+			missed.Format(time.RFC3339), missed.Add(time.Hour).Format(time.RFC3339), aliceID))
+
+		// The worker was down while both reminders of "Review" became due
+		if sent := runReminders(t, later.Add(-5*time.Minute)); sent != 2 {
+			t.Fatalf("Expected both reminders to be sent late, got %d", sent)
+		}
+		if list := notifications(aliceToken); len(list) != 2 || !strings.Contains(list[0].Body, "starts in 5 minutes") {
+			t.Errorf("Unexpected notifications: %+v", list)
+		}
+
+		// The worker was down until "Retro" had started
+		if sent := runReminders(t, missed.Add(10*time.Minute)); sent != 0 {
+			t.Errorf("Expected no reminders after the start, got %d", sent)
+		}
+	})
+
+	t.Run("Should remind every occurrence of a recurring schedule", func(t *testing.T) {
+		series := server.clock.Now().Add(2 * time.Hour)
+		createSchedule(t, server, bobToken, fmt.Sprintf(`{"title": "Standup", "start_time": "%s", "end_time": "%s", "owner_id": %d, "recurrence_rule": "FREQ=DAILY;COUNT=3"}`,
+			series.Format(time.RFC3339), series.Add(15*time.Minute).Format(time.RFC3339), bobID))
+
+		for day := 0; day < 3; day++ {
+			occurrence := series.AddDate(0, 0, day)
+			if sent := runReminders(t, occurrence.Add(-60*time.Minute)); sent != 1 {
+				t.Errorf("Day %d: expected 1 reminder, got %d", day, sent)
+			}
+		}
+		if list := notifications(bobToken); len(list) != 3 {
+			t.Errorf("Expected 3 notifications, got %d", len(list))
+		}
+	})
+
+	t.Run("Should restore the default reminders", func(t *testing.T) {
+		path := fmt.Sprintf("/api/schedules/%d/reminders", scheduleID)
+		if code, _ := send("DELETE", path, bobToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+		var reminders model.ScheduleReminders
+		_, body := send("GET", path, bobToken, "")
+		json.Unmarshal([]byte(body), &reminders)
+		if reminders.Custom || len(reminders.Reminders) != 1 || reminders.Reminders[0].MinutesBefore != 60 {
+			t.Errorf("Expected the default reminders, got %s", body)
+		}
+	})
+}
+
+func TestRemindersWithConcurrentWrites(t *testing.T) {
+	// --- Test Setup ---
+	// Requests and the worker write through separate connections to the same database file
+	server := newFileTestServer(t)
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	req, _ := http.NewRequest("PUT", "/api/users/reminders", strings.NewReader(`{"default_reminders": [{"minutes_before": 60, "channel": "in_app"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	if rr := server.executeRequest(req); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to save reminder settings: %s", rr.Body.String())
+	}
+	// Run the worker ahead of the wall clock so that every reminder is due as soon as its schedule is created
+	server.clock.Set(time.Now().Add(time.Hour))
+	start := server.clock.Now().Add(time.Hour)
+
+	// --- Test Cases ---
+	t.Run("Should send reminders while schedules are being created", func(t *testing.T) {
+		const writers, schedulesPerWriter = 4, 10
+		var wg sync.WaitGroup
+		errs := make(chan string, writers*schedulesPerWriter)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < schedulesPerWriter; i++ {
+					body := fmt.Sprintf(`{"title": "Meeting %d-%d", "start_time": "%s", "end_time": "%s", "owner_id": %d, "allow_conflicts": true}`,
+						w, i, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), aliceID)
+					req, _ := http.NewRequest("POST", "/api/schedules", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					req.Header.Set("Authorization", "Bearer "+aliceToken)
+					if rr := server.executeRequest(req); rr.Code != http.StatusCreated {
+						errs <- fmt.Sprintf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+					}
+				}
+			}(w)
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		sent := 0
+		for running := true; running; {
+			select {
+			case <-done:
+				running = false
+			default:
+			}
+			n, err := server.reminders.RunOnce(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to send reminders during concurrent writes: %v", err)
+			}
+			sent += n
+		}
+		close(errs)
+		for err := range errs {
+			t.Errorf("Failed to create a schedule: %s", err)
+		}
+
+		if sent != writers*schedulesPerWriter {
+			t.Errorf("Expected %d reminders to be sent, got %d", writers*schedulesPerWriter, sent)
+		}
+	})
+}
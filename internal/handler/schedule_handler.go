@@ -2,23 +2,56 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"schedule-app/internal/events"
+	"schedule-app/internal/invite"
 	"schedule-app/internal/middleware"
 	"schedule-app/internal/model"
+	"schedule-app/internal/recurrence"
 	"schedule-app/internal/repository"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // ScheduleHandler はスケジュール関連のHTTPリクエストを処理します。
+// スケジュールの作成・更新・削除は hub に発行して購読中のクライアントに配信します
+// (webhook の配信キューへの追加はリポジトリが変更と同じトランザクションで行います)。
+// あわせて参加者に招待メール (iMIP) を送信します。
 type ScheduleHandler struct {
 	scheduleRepo *repository.ScheduleRepository
+	shareRepo    *repository.ShareRepository
+	groupRepo    *repository.GroupRepository
+	hub          *events.Hub
+	invitations  *invite.Sender
 }
 
 // NewScheduleHandler は ScheduleHandler の新しいインスタンスを生成します。
-func NewScheduleHandler(scheduleRepo *repository.ScheduleRepository) *ScheduleHandler {
-	return &ScheduleHandler{scheduleRepo: scheduleRepo}
+func NewScheduleHandler(scheduleRepo *repository.ScheduleRepository, shareRepo *repository.ShareRepository, groupRepo *repository.GroupRepository, hub *events.Hub, invitations *invite.Sender) *ScheduleHandler {
+	return &ScheduleHandler{scheduleRepo: scheduleRepo, shareRepo: shareRepo, groupRepo: groupRepo, hub: hub, invitations: invitations}
+}
+
+// queueInvitations は参加者への招待メールを送信キューに追加した結果 err を記録します。
+// 変更は保存済みのため、追加に失敗してもリクエストは失敗にしません。メールは invite.Worker がバックグラウンドで送信します。
+func queueInvitations(scheduleID int64, err error) {
+	if err != nil {
+		log.Printf("ERROR: Failed to queue invitations for schedule %d: %v", scheduleID, err)
+	}
+}
+
+// findTruncatedSeries は以降の発生の変更・削除で打ち切った元の系列を取得します。
+// 取得できない場合は元の系列の参加者に招待を送信しないため、エラーを記録して nil を返します。
+func (h *ScheduleHandler) findTruncatedSeries(scheduleID int64) *model.Schedule {
+	series, err := h.scheduleRepo.FindByID(scheduleID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get truncated series %d: %v", scheduleID, err)
+		return nil
+	}
+	return series
 }
 
 // CreateSchedule は新しいスケジュールを作成するためのハンドラです。
@@ -45,43 +78,163 @@ func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request)
 		errorJSON(w, http.StatusBadRequest, "OwnerID is required")
 		return
 	}
+	if req.OwnerType != "" && req.OwnerType != model.OwnerUser && req.OwnerType != model.OwnerGroup {
+		errorJSON(w, http.StatusBadRequest, "owner_type must be user or group")
+		return
+	}
+	if req.RecurrenceRule != "" {
+		rule, err := normalizeRecurrenceRule(req.RecurrenceRule)
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, "Invalid recurrence rule: "+err.Error())
+			return
+		}
+		req.RecurrenceRule = rule
+	}
 
-	schedule, err := h.scheduleRepo.Create(&req, creatorID)
+	schedule, event, err := h.scheduleRepo.Create(&req, creatorID)
 	if err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		log.Printf("ERROR: Failed to create schedule: %v", err)
-		errorJSON(w, http.StatusInternalServerError, "Failed to create schedule")
+		if errors.Is(err, repository.ErrNotGroupMember) {
+			errorJSON(w, http.StatusForbidden, "Forbidden: You can only invite groups you are a member of")
+		} else if strings.Contains(err.Error(), "not authorized") {
+			errorJSON(w, http.StatusForbidden, "Forbidden: You do not have write access to this calendar")
+		} else {
+			errorJSON(w, http.StatusInternalServerError, "Failed to create schedule")
+		}
 		return
 	}
 
+	h.hub.Publish(event)
+	queueInvitations(schedule.ID, h.invitations.Created(schedule))
 	writeJSON(w, http.StatusCreated, schedule.ToScheduleResponse())
 }
 
 // GetSchedulesByOwner は特定のユーザーが所有するスケジュール一覧を取得します。
+// 所有者のカレンダーへの read 権限が必要です。
 func (h *ScheduleHandler) GetSchedulesByOwner(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
 	ownerIDStr := r.PathValue("ownerID")
 	ownerID, err := strconv.ParseInt(ownerIDStr, 10, 64)
 	if err != nil {
 		errorJSON(w, http.StatusBadRequest, "Invalid owner ID")
 		return
 	}
+	if !requireCalendarPermission(w, h.shareRepo, model.OwnerUser, ownerID, userID, model.PermissionRead) {
+		return
+	}
 
-	schedules, err := h.scheduleRepo.FindByOwnerID(ownerID)
+	h.listSchedulesByOwner(w, r, ownerID)
+}
+
+// GetSchedulesByOwnerAsAdmin は共有の権限によらず、特定のユーザーが所有するスケジュール一覧を取得します。
+// 管理者パネルでの閲覧に使用します。admin ロールのチェックはミドルウェア (RequireRole) で行います。
+// 管理者にも他のユーザーのカレンダーを変更する権限はないため、作成・更新・削除には共有の権限が必要です。
+func (h *ScheduleHandler) GetSchedulesByOwnerAsAdmin(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := strconv.ParseInt(r.PathValue("ownerID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid owner ID")
+		return
+	}
+
+	h.listSchedulesByOwner(w, r, ownerID)
+}
+
+// listSchedulesByOwner はクエリパラメータに従ってユーザー ownerID のスケジュール一覧を返します。権限のチェックは行いません。
+func (h *ScheduleHandler) listSchedulesByOwner(w http.ResponseWriter, r *http.Request, ownerID int64) {
+	query, err := parseScheduleQuery(r)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedules, next, err := h.scheduleRepo.FindByOwnerID(ownerID, query)
 	if err != nil {
 		log.Printf("ERROR: Failed to get schedules for owner %d: %v", ownerID, err)
 		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve schedules")
 		return
 	}
 
-	var resp []*model.ScheduleResponse
+	writeScheduleList(w, schedules, next)
+}
+
+// GetSchedulesByGroup はグループのカレンダーと、メンバーのカレンダーのスケジュールを1つの一覧として取得します。
+// グループのメンバーのみが取得でき、メンバーのカレンダーはログイン中のユーザーが read 権限を持つもののみを含めます。
+func (h *ScheduleHandler) GetSchedulesByGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	groupID, err := strconv.ParseInt(r.PathValue("groupID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	group, ok := findGroupForMember(w, h.groupRepo, groupID, userID)
+	if !ok {
+		return
+	}
+
+	query, err := parseScheduleQuery(r)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var memberIDs []int64
+	for _, m := range group.Members {
+		permission, err := h.shareRepo.Permission(model.OwnerUser, m.ID, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get permission of user %d on calendar %d: %v", userID, m.ID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve schedules")
+			return
+		}
+		if permission.Allows(model.PermissionRead) {
+			memberIDs = append(memberIDs, m.ID)
+		}
+	}
+
+	schedules, next, err := h.scheduleRepo.FindByGroupID(groupID, memberIDs, query)
+	if err != nil {
+		log.Printf("ERROR: Failed to get schedules for group %d: %v", groupID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve schedules")
+		return
+	}
+
+	writeScheduleList(w, schedules, next)
+}
+
+// writeScheduleList はスケジュールの一覧を次ページのカーソルとともに返します。
+func writeScheduleList(w http.ResponseWriter, schedules []*model.Schedule, next *model.ScheduleCursor) {
+	resp := model.ScheduleListResponse{Schedules: make([]*model.ScheduleResponse, 0, len(schedules))}
 	for _, s := range schedules {
-		resp = append(resp, s.ToScheduleResponse())
+		resp.Schedules = append(resp.Schedules, s.ToScheduleResponse())
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
 	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
 // GetScheduleByID はIDで特定のスケジュールを取得します。
+// 所有者のカレンダーへの read 権限を持つユーザーと、スケジュールの参加者が取得できます。
 func (h *ScheduleHandler) GetScheduleByID(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
 	scheduleIDStr := r.PathValue("scheduleID")
 	scheduleID, err := strconv.ParseInt(scheduleIDStr, 10, 64)
 	if err != nil {
@@ -99,6 +252,9 @@ func (h *ScheduleHandler) GetScheduleByID(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	if !schedule.HasParticipant(userID) && !requireCalendarPermission(w, h.shareRepo, schedule.OwnerType, schedule.OwnerID, userID, model.PermissionRead) {
+		return
+	}
 
 	writeJSON(w, http.StatusOK, schedule.ToScheduleResponse())
 }
@@ -124,23 +280,120 @@ func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request)
 		errorJSON(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if err := validateScope(req.Scope, req.OccurrenceStart); err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.RecurrenceRule != nil && *req.RecurrenceRule != "" {
+		rule, err := normalizeRecurrenceRule(*req.RecurrenceRule)
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, "Invalid recurrence rule: "+err.Error())
+			return
+		}
+		req.RecurrenceRule = &rule
+	}
+
+	// 変更前の参加者にも招待の更新を送信するため、更新前のスケジュールを取得
+	previous, ok := h.findScheduleToChange(w, scheduleID, "Failed to update schedule")
+	if !ok {
+		return
+	}
 
-	updatedSchedule, err := h.scheduleRepo.Update(scheduleID, &req, userID)
+	updatedSchedule, event, err := h.scheduleRepo.Update(scheduleID, &req, userID)
 	if err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		log.Printf("ERROR: Failed to update schedule %d: %v", scheduleID, err)
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, repository.ErrNotRecurring) || errors.Is(err, repository.ErrInvalidOccurrence) {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, repository.ErrNotGroupMember) {
+			errorJSON(w, http.StatusForbidden, "Forbidden: You can only invite groups you are a member of")
+		} else if strings.Contains(err.Error(), "not found") {
 			errorJSON(w, http.StatusNotFound, "Schedule not found")
 		} else if strings.Contains(err.Error(), "not authorized") {
-			errorJSON(w, http.StatusForbidden, "Forbidden: You are not authorized to update this schedule")
+			errorJSON(w, http.StatusForbidden, "Forbidden: You do not have write access to this calendar")
 		} else {
 			errorJSON(w, http.StatusInternalServerError, "Failed to update schedule")
 		}
 		return
 	}
 
+	h.hub.Publish(event)
+
+	// 以降の発生で分割した場合は、新しい系列とあわせて打ち切った元の系列の招待も更新
+	var series *model.Schedule
+	if updatedSchedule.ID != previous.ID && updatedSchedule.RecurrenceID == nil {
+		series = h.findTruncatedSeries(previous.ID)
+	}
+	queueInvitations(scheduleID, h.invitations.Updated(previous, updatedSchedule, series))
 	writeJSON(w, http.StatusOK, updatedSchedule.ToScheduleResponse())
 }
 
+// maxRSVPCommentLength は出欠の回答に添えるコメントの最大文字数です。
+const maxRSVPCommentLength = 1000
+
+// RespondToSchedule は招待された参加者の出欠の回答 (accepted / declined / tentative) を記録します。
+// 参加者であるかのチェックはリポジトリ層で行います。
+func (h *ScheduleHandler) RespondToSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	scheduleIDStr := r.PathValue("scheduleID")
+	scheduleID, err := strconv.ParseInt(scheduleIDStr, 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid schedule ID")
+		return
+	}
+
+	var req model.RSVPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !model.ValidRSVPStatus(req.Status) {
+		errorJSON(w, http.StatusBadRequest, "status must be one of accepted, declined, tentative")
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(req.Comment) > maxRSVPCommentLength {
+		errorJSON(w, http.StatusBadRequest, fmt.Sprintf("comment must be at most %d characters", maxRSVPCommentLength))
+		return
+	}
+
+	schedule, err := h.scheduleRepo.Respond(scheduleID, &req, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to record response to schedule %d: %v", scheduleID, err)
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Schedule not found")
+		} else if strings.Contains(err.Error(), "not authorized") {
+			errorJSON(w, http.StatusForbidden, "Forbidden: Only participants can respond to this schedule")
+		} else {
+			errorJSON(w, http.StatusInternalServerError, "Failed to record response")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schedule.ToScheduleResponse())
+}
+
+// writeConflict は err がスケジュールの重複を表す場合に、重複しているスケジュールの一覧を 409 で返します。
+// タイトルなどの内容は他のユーザーのスケジュールを含み得るため、ID・ユーザー・日時のみを返します。
+func writeConflict(w http.ResponseWriter, err error) bool {
+	var conflictErr *repository.ConflictError
+	if !errors.As(err, &conflictErr) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, model.ScheduleConflictResponse{
+		Error:     "Schedule conflicts with existing schedules; set allow_conflicts to save anyway",
+		Conflicts: conflictErr.Conflicts,
+	})
+	return true
+}
+
 // DeleteSchedule はスケジュールを削除します。
 // 権限チェックはリポジトリ層で行います。
 func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
@@ -157,18 +410,125 @@ func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.scheduleRepo.Delete(scheduleID, userID)
+	// 繰り返しスケジュールの削除範囲はクエリパラメータで指定します。
+	req := model.DeleteScheduleRequest{Scope: model.RecurrenceScope(r.URL.Query().Get("scope"))}
+	if req.OccurrenceStart, err = parseOptionalTimeParam(r, "occurrence_start"); err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateScope(req.Scope, req.OccurrenceStart); err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 削除後は招待を取り消す参加者を判定できないため、削除前のスケジュールを取得
+	current, ok := h.findScheduleToChange(w, scheduleID, "Failed to delete schedule")
+	if !ok {
+		return
+	}
+
+	event, err := h.scheduleRepo.Delete(scheduleID, &req, userID)
 	if err != nil {
 		log.Printf("ERROR: Failed to delete schedule %d: %v", scheduleID, err)
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, repository.ErrNotRecurring) || errors.Is(err, repository.ErrInvalidOccurrence) {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "not found") {
 			errorJSON(w, http.StatusNotFound, "Schedule not found")
 		} else if strings.Contains(err.Error(), "not authorized") {
-			errorJSON(w, http.StatusForbidden, "Forbidden: You are not authorized to delete this schedule")
+			errorJSON(w, http.StatusForbidden, "Forbidden: You do not have write access to this calendar")
 		} else {
 			errorJSON(w, http.StatusInternalServerError, "Failed to delete schedule")
 		}
 		return
 	}
 
+	h.hub.Publish(event)
+
+	// 単一の発生の削除はその発生のみを取り消し、以降の発生の削除は打ち切った系列の招待を更新
+	var occurrence *time.Time
+	var series *model.Schedule
+	switch {
+	case req.Scope == model.ScopeThis:
+		occurrence = req.OccurrenceStart
+	case req.Scope == model.ScopeFollowing && !req.OccurrenceStart.Equal(current.StartTime):
+		series = h.findTruncatedSeries(scheduleID)
+	}
+	queueInvitations(scheduleID, h.invitations.Deleted(current, occurrence, series))
 	writeJSON(w, http.StatusNoContent, nil)
-}
\ No newline at end of file
+}
+
+// findScheduleToChange は更新・削除の対象のスケジュールを取得します。
+// 取得できない場合はエラーレスポンスを書き込み、false を返します。権限のチェックは行いません。
+func (h *ScheduleHandler) findScheduleToChange(w http.ResponseWriter, scheduleID int64, failure string) (*model.Schedule, bool) {
+	schedule, err := h.scheduleRepo.FindByID(scheduleID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get schedule %d: %v", scheduleID, err)
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Schedule not found")
+		} else {
+			errorJSON(w, http.StatusInternalServerError, failure)
+		}
+		return nil, false
+	}
+	return schedule, true
+}
+
+// defaultScheduleLimit と maxScheduleLimit はスケジュール一覧の1ページあたりの件数です。
+const (
+	defaultScheduleLimit = 100
+	maxScheduleLimit     = 500
+)
+
+// parseScheduleQuery はスケジュール一覧のクエリパラメータ (from, to, cursor, limit) を解析します。
+// from/to は [from, to) と重なるスケジュールを選択し、繰り返しスケジュールはこの範囲内の発生に展開されます。
+func parseScheduleQuery(r *http.Request) (*model.ScheduleQuery, error) {
+	var q model.ScheduleQuery
+	var err error
+	if q.From, err = parseTimeParam(r, "from"); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseTimeParam(r, "to"); err != nil {
+		return nil, err
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if q.Cursor, err = model.DecodeScheduleCursor(cursor); err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+	q.Limit = defaultScheduleLimit
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxScheduleLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxScheduleLimit)
+		}
+		q.Limit = n
+	}
+	return &q, nil
+}
+
+// normalizeRecurrenceRule は RRULE を検証し、正規化した文字列を返します。
+func normalizeRecurrenceRule(s string) (string, error) {
+	rule, err := recurrence.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+// validateScope は繰り返しスケジュールの更新・削除範囲の指定を検証します。
+func validateScope(scope model.RecurrenceScope, occurrenceStart *time.Time) error {
+	switch scope {
+	case "", model.ScopeAll:
+		return nil
+	case model.ScopeThis, model.ScopeFollowing:
+		if occurrenceStart == nil {
+			return fmt.Errorf("occurrence_start is required when scope is %q", scope)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid scope %q", scope)
+	}
+}
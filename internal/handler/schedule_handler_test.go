@@ -2,11 +2,18 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"schedule-app/internal/invite"
+	"schedule-app/internal/mail"
 	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Helper function to create a user and return their ID
@@ -39,6 +46,21 @@ func loginUser(t *testing.T, server *testServer, email, password string) string
 	return resp["token"]
 }
 
+// Helper function to create a schedule from a JSON request body and return its ID
+func createSchedule(t *testing.T, server *testServer, token, requestBody string) int64 {
+	req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := server.executeRequest(req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create schedule: %s", rr.Body.String())
+	}
+	var schedule model.ScheduleResponse
+	json.NewDecoder(rr.Body).Decode(&schedule)
+	return schedule.ID
+}
+
 func TestScheduleHandlers(t *testing.T) {
 	// --- Test Setup ---
 	server := newTestServer()
@@ -52,10 +74,14 @@ func TestScheduleHandlers(t *testing.T) {
 	tokenA := loginUser(t, server, "usera@example.com", "password123")
 	tokenB := loginUser(t, server, "userb@example.com", "password456")
 
+	// UserB lets UserA edit their calendar
+	shareCalendar(t, server, tokenB, userB_ID, userA_ID, model.PermissionWrite)
+
 	var scheduleID int64
 
 	// Create a third user to act as a participant
 	userC_ID := createUser(t, server, "userc", "userc@example.com", "password789")
+	tokenC := loginUser(t, server, "userc@example.com", "password789")
 
 	// --- Test Cases ---
 	t.Run("Should create a new schedule with participants", func(t *testing.T) {
@@ -124,11 +150,11 @@ func TestScheduleHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("Should forbid calendar owner (not creator) from updating", func(t *testing.T) {
+	t.Run("Should forbid a user without write access from updating", func(t *testing.T) {
 		requestBody := `{"title": "Forbidden Update"}`
 		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", scheduleID), bytes.NewBufferString(requestBody))
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+tokenB)
+		req.Header.Set("Authorization", "Bearer "+tokenC)
 
 		rr := server.executeRequest(req)
 		if status := rr.Code; status != http.StatusForbidden {
@@ -136,10 +162,22 @@ func TestScheduleHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("Should forbid calendar owner (not creator) from deleting", func(t *testing.T) {
-		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d", scheduleID), nil)
+	t.Run("Should allow calendar owner (not creator) to update", func(t *testing.T) {
+		requestBody := `{"location": "Room 2"}`
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", scheduleID), bytes.NewBufferString(requestBody))
+		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+tokenB)
 
+		rr := server.executeRequest(req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+	})
+
+	t.Run("Should forbid a user without write access from deleting", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d", scheduleID), nil)
+		req.Header.Set("Authorization", "Bearer "+tokenC)
+
 		rr := server.executeRequest(req)
 		if status := rr.Code; status != http.StatusForbidden {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
@@ -155,4 +193,751 @@ func TestScheduleHandlers(t *testing.T) {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestRecurringSchedules(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	ownerID := createUser(t, server, "owner", "owner@example.com", "password123")
+	token := loginUser(t, server, "owner@example.com", "password123")
+
+	// getOccurrences fetches the owner's schedules within the given window.
+	getOccurrences := func(t *testing.T, from, to string) []*model.ScheduleResponse {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?from=%s&to=%s", ownerID, from, to), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var resp model.ScheduleListResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Could not decode response: %v", err)
+		}
+		return resp.Schedules
+	}
+
+	var seriesID int64
+
+	t.Run("Should create a weekly recurring schedule", func(t *testing.T) {
+		requestBody := fmt.Sprintf(
+			`{"title": "Standup", "owner_id": %d, "start_time": "2025-11-03T09:00:00Z", "end_time": "2025-11-03T09:15:00Z", "recurrence_rule": "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6", "exdates": ["2025-11-05T09:00:00Z"]}`,
+			ownerID,
+		)
+		req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+		}
+		var schedule model.ScheduleResponse
+		json.NewDecoder(rr.Body).Decode(&schedule)
+		if schedule.RecurrenceRule != "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6" {
+			t.Errorf("Expected recurrence rule to be stored, got %q", schedule.RecurrenceRule)
+		}
+		seriesID = schedule.ID
+	})
+
+	t.Run("Should reject an invalid recurrence rule", func(t *testing.T) {
+		requestBody := fmt.Sprintf(
+			`{"title": "Broken", "owner_id": %d, "start_time": "2025-11-03T09:00:00Z", "end_time": "2025-11-03T09:15:00Z", "recurrence_rule": "FREQ=HOURLY"}`,
+			ownerID,
+		)
+		req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Should expand occurrences inside the requested window", func(t *testing.T) {
+		// COUNT=6 yields Nov 3, 5, 10, 12, 17, 19; Nov 5 is excluded by EXDATE.
+		schedules := getOccurrences(t, "2025-11-01T00:00:00Z", "2025-11-15T00:00:00Z")
+		if len(schedules) != 3 {
+			t.Fatalf("Expected 3 occurrences, got %d", len(schedules))
+		}
+		expected := []string{"2025-11-03T09:00:00Z", "2025-11-10T09:00:00Z", "2025-11-12T09:00:00Z"}
+		for i, s := range schedules {
+			if s.ID != seriesID {
+				t.Errorf("Expected occurrence to reference series %d, got %d", seriesID, s.ID)
+			}
+			if s.RecurrenceID == nil || s.RecurrenceID.UTC().Format(time.RFC3339) != expected[i] {
+				t.Errorf("Expected occurrence %d to start at %s, got %v", i, expected[i], s.RecurrenceID)
+			}
+		}
+	})
+
+	t.Run("Should update a single occurrence only", func(t *testing.T) {
+		requestBody := `{"title": "Standup (moved)", "start_time": "2025-11-10T10:00:00Z", "end_time": "2025-11-10T10:15:00Z", "scope": "this", "occurrence_start": "2025-11-10T09:00:00Z"}`
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", seriesID), bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var override model.ScheduleResponse
+		json.NewDecoder(rr.Body).Decode(&override)
+		if override.SeriesID == nil || *override.SeriesID != seriesID {
+			t.Errorf("Expected override to reference series %d, got %v", seriesID, override.SeriesID)
+		}
+
+		schedules := getOccurrences(t, "2025-11-10T00:00:00Z", "2025-11-11T00:00:00Z")
+		if len(schedules) != 1 || schedules[0].Title != "Standup (moved)" {
+			t.Fatalf("Expected only the moved occurrence on Nov 10, got %+v", schedules)
+		}
+
+		// The occurrence is now a schedule of its own and is no longer part of the series
+		req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", seriesID), bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = server.executeRequest(req)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), fmt.Sprintf("use schedule %d", override.ID)) {
+			t.Errorf("Expected a second edit of the occurrence to point at override %d with %d, got %d: %s", override.ID, http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Should reject an occurrence that is not part of the series", func(t *testing.T) {
+		requestBody := `{"title": "Nope", "scope": "this", "occurrence_start": "2025-11-11T09:00:00Z"}`
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", seriesID), bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Should update this and following occurrences", func(t *testing.T) {
+		requestBody := `{"location": "Room B", "scope": "following", "occurrence_start": "2025-11-17T09:00:00Z"}`
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", seriesID), bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+
+		schedules := getOccurrences(t, "2025-11-01T00:00:00Z", "2025-12-31T00:00:00Z")
+		if len(schedules) != 5 {
+			t.Fatalf("Expected 5 occurrences in total after the split, got %d", len(schedules))
+		}
+		for _, s := range schedules {
+			following := !s.StartTime.Before(time.Date(2025, 11, 17, 0, 0, 0, 0, time.UTC))
+			if following != (s.Location == "Room B") {
+				t.Errorf("Unexpected location %q for occurrence at %s", s.Location, s.StartTime)
+			}
+		}
+	})
+
+	t.Run("Should delete a single occurrence", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d?scope=this&occurrence_start=2025-11-12T09:00:00Z", seriesID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+		}
+		if schedules := getOccurrences(t, "2025-11-12T00:00:00Z", "2025-11-13T00:00:00Z"); len(schedules) != 0 {
+			t.Errorf("Expected the Nov 12 occurrence to be deleted, got %d schedules", len(schedules))
+		}
+
+		req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d?scope=this&occurrence_start=2025-11-12T09:00:00Z", seriesID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected deleting a deleted occurrence again to return %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+		req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/schedules/%d", seriesID), bytes.NewBufferString(`{"title": "Back", "scope": "this", "occurrence_start": "2025-11-12T09:00:00Z"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected editing a deleted occurrence to return %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Should delete all occurrences of the series", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d", seriesID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+		// The split-off series created by the "following" update remains.
+		schedules := getOccurrences(t, "2025-11-01T00:00:00Z", "2025-12-31T00:00:00Z")
+		if len(schedules) != 2 {
+			t.Errorf("Expected only the 2 occurrences of the split series to remain, got %d", len(schedules))
+		}
+	})
+
+	t.Run("Should expand and edit occurrences years after the start of an open-ended series", func(t *testing.T) {
+		requestBody := fmt.Sprintf(
+			`{"title": "Journal", "owner_id": %d, "start_time": "2025-11-03T07:00:00Z", "end_time": "2025-11-03T07:30:00Z", "recurrence_rule": "FREQ=DAILY"}`,
+			ownerID,
+		)
+		req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+		}
+		var schedule model.ScheduleResponse
+		json.NewDecoder(rr.Body).Decode(&schedule)
+
+		// More than recurrence.MaxOccurrences occurrences precede this window.
+		if schedules := getOccurrences(t, "2031-06-01T00:00:00Z", "2031-06-04T00:00:00Z"); len(schedules) != 3 {
+			t.Fatalf("Expected 3 occurrences, got %d", len(schedules))
+		}
+
+		req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d?scope=this&occurrence_start=2031-06-02T07:00:00Z", schedule.ID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = server.executeRequest(req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body.String())
+		}
+		if schedules := getOccurrences(t, "2031-06-01T00:00:00Z", "2031-06-04T00:00:00Z"); len(schedules) != 2 {
+			t.Errorf("Expected the Jun 2 occurrence to be deleted, got %d schedules", len(schedules))
+		}
+	})
+}
+
+func TestScheduleTimeRangeAndPagination(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	ownerID := createUser(t, server, "pager", "pager@example.com", "password123")
+	token := loginUser(t, server, "pager@example.com", "password123")
+
+	// Five one-hour events on consecutive days, one of them given with a +09:00 offset,
+	// plus a daily series covering the same days.
+	starts := []string{"2025-11-01T10:00:00Z", "2025-11-02T19:00:00+09:00", "2025-11-03T10:00:00Z", "2025-11-04T10:00:00Z", "2025-11-05T10:00:00Z"}
+	for i, start := range starts {
+		startTime, _ := time.Parse(time.RFC3339, start)
+		requestBody := fmt.Sprintf(`{"title": "Event %d", "owner_id": %d, "start_time": "%s", "end_time": "%s"}`,
+			i, ownerID, start, startTime.Add(time.Hour).Format(time.RFC3339))
+		req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create schedule: %s", rr.Body.String())
+		}
+	}
+	requestBody := fmt.Sprintf(`{"title": "Daily", "owner_id": %d, "start_time": "2025-11-01T08:00:00Z", "end_time": "2025-11-01T08:30:00Z", "recurrence_rule": "FREQ=DAILY"}`, ownerID)
+	req, _ := http.NewRequest("POST", "/api/schedules", bytes.NewBufferString(requestBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if rr := server.executeRequest(req); rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create recurring schedule: %s", rr.Body.String())
+	}
+
+	list := func(t *testing.T, query string) model.ScheduleListResponse {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?%s", ownerID, query), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var resp model.ScheduleListResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Could not decode response: %v", err)
+		}
+		return resp
+	}
+
+	// --- Test Cases ---
+	t.Run("Should return only schedules overlapping the window", func(t *testing.T) {
+		// 2025-11-02T19:00+09:00 is 10:00Z and overlaps; the daily occurrences fall outside the window.
+		resp := list(t, "from=2025-11-02T09:00:00Z&to=2025-11-03T08:00:00Z")
+		if len(resp.Schedules) != 1 || resp.Schedules[0].Title != "Event 1" {
+			t.Fatalf("Expected only Event 1, got %+v", resp.Schedules)
+		}
+		if resp.NextCursor != "" {
+			t.Errorf("Expected no next cursor, got %q", resp.NextCursor)
+		}
+	})
+
+	t.Run("Should include schedules that only partially overlap the window", func(t *testing.T) {
+		resp := list(t, "from=2025-11-03T10:30:00Z&to=2025-11-03T12:00:00Z")
+		if len(resp.Schedules) != 1 || resp.Schedules[0].Title != "Event 2" {
+			t.Fatalf("Expected only Event 2, got %+v", resp.Schedules)
+		}
+	})
+
+	t.Run("Should paginate through all schedules with a cursor", func(t *testing.T) {
+		var titles []string
+		query := "from=2025-11-01T00:00:00Z&to=2025-11-06T00:00:00Z&limit=3"
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("Too many pages")
+			}
+			resp := list(t, query)
+			for _, s := range resp.Schedules {
+				titles = append(titles, s.Title)
+			}
+			if resp.NextCursor == "" {
+				break
+			}
+			query = "from=2025-11-01T00:00:00Z&to=2025-11-06T00:00:00Z&limit=3&cursor=" + resp.NextCursor
+		}
+		expected := []string{"Daily", "Event 0", "Daily", "Event 1", "Daily", "Event 2", "Daily", "Event 3", "Daily", "Event 4"}
+		if fmt.Sprint(titles) != fmt.Sprint(expected) {
+			t.Errorf("Expected %v, got %v", expected, titles)
+		}
+	})
+
+	t.Run("Should page past the first 1000 occurrences of an unbounded series", func(t *testing.T) {
+		// Without "to", only the daily series matches after Nov 6
+		query := "from=2025-11-06T00:00:00Z&limit=500"
+		var last time.Time
+		seen := 0
+		for pages := 0; pages < 3; pages++ {
+			resp := list(t, query)
+			if len(resp.Schedules) != 500 || resp.NextCursor == "" {
+				t.Fatalf("Page %d: expected 500 occurrences and a next cursor, got %d and %q", pages+1, len(resp.Schedules), resp.NextCursor)
+			}
+			for _, s := range resp.Schedules {
+				if !s.StartTime.After(last) {
+					t.Fatalf("Expected occurrences in ascending order, got %s after %s", s.StartTime, last)
+				}
+				last = s.StartTime
+				seen++
+			}
+			query = "from=2025-11-06T00:00:00Z&limit=500&cursor=" + resp.NextCursor
+		}
+		if expected := time.Date(2025, 11, 6, 8, 0, 0, 0, time.UTC).AddDate(0, 0, seen-1); !last.Equal(expected) {
+			t.Errorf("Expected occurrence %d to start at %s, got %s", seen, expected, last)
+		}
+	})
+
+	t.Run("Should reject invalid query parameters", func(t *testing.T) {
+		for _, query := range []string{"from=yesterday", "from=2025-11-02T00:00:00Z&to=2025-11-01T00:00:00Z", "cursor=@@@", "limit=0"} {
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/api/users/%d/schedules?%s", ownerID, query), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if rr := server.executeRequest(req); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v", query, rr.Code, http.StatusBadRequest)
+			}
+		}
+	})
+}
+
+func TestScheduleConflicts(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	token := loginUser(t, server, "alice@example.com", "password123")
+	shareCalendar(t, server, loginUser(t, server, "bob@example.com", "password123"), bobID, aliceID, model.PermissionWrite)
+	shareCalendar(t, server, loginUser(t, server, "carol@example.com", "password123"), carolID, aliceID, model.PermissionWrite)
+
+	// alice: 10:00-11:00 with bob, carol: daily 09:00-09:30
+	reviewID := createSchedule(t, server, token, fmt.Sprintf(`{"title": "Secret review", "owner_id": %d, "participant_ids": [%d],
+		"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z"}`, aliceID, bobID))
+	dailyID := createSchedule(t, server, token, fmt.Sprintf(`{"title": "Carol daily", "owner_id": %d,
+		"start_time": "2025-11-01T09:00:00Z", "end_time": "2025-11-01T09:30:00Z", "recurrence_rule": "FREQ=DAILY"}`, carolID))
+
+	send := func(method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	decodeConflicts := func(t *testing.T, body string) []*model.ScheduleConflict {
+		var resp model.ScheduleConflictResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("Failed to decode conflict response: %v", err)
+		}
+		return resp.Conflicts
+	}
+
+	// --- Test Cases ---
+	t.Run("Should reject a schedule overlapping a participant's schedule", func(t *testing.T) {
+		code, body := send("POST", "/api/schedules", fmt.Sprintf(`{"title": "Bob focus", "owner_id": %d,
+			"start_time": "2025-11-03T10:30:00Z", "end_time": "2025-11-03T11:30:00Z"}`, bobID))
+		if code != http.StatusConflict {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusConflict, body)
+		}
+		if strings.Contains(body, "Secret") {
+			t.Errorf("conflict response leaked the title of the existing schedule: %s", body)
+		}
+		conflicts := decodeConflicts(t, body)
+		if len(conflicts) != 1 || conflicts[0].ScheduleID != reviewID || fmt.Sprint(conflicts[0].UserIDs) != fmt.Sprint([]int64{bobID}) {
+			t.Errorf("unexpected conflicts: %s", body)
+		}
+	})
+
+	t.Run("Should report the overlapping occurrence of a recurring schedule", func(t *testing.T) {
+		code, body := send("POST", "/api/schedules", fmt.Sprintf(`{"title": "Sync", "owner_id": %d, "participant_ids": [%d],
+			"start_time": "2025-11-05T09:15:00Z", "end_time": "2025-11-05T09:45:00Z"}`, aliceID, carolID))
+		if code != http.StatusConflict {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusConflict, body)
+		}
+		conflicts := decodeConflicts(t, body)
+		want := time.Date(2025, 11, 5, 9, 0, 0, 0, time.UTC)
+		if len(conflicts) != 1 || conflicts[0].ScheduleID != dailyID || !conflicts[0].StartTime.Equal(want) ||
+			fmt.Sprint(conflicts[0].UserIDs) != fmt.Sprint([]int64{carolID}) {
+			t.Errorf("unexpected conflicts: %s", body)
+		}
+	})
+
+	t.Run("Should reject a recurring schedule overlapping a later occurrence", func(t *testing.T) {
+		code, body := send("POST", "/api/schedules", fmt.Sprintf(`{"title": "Weekly", "owner_id": %d,
+			"start_time": "2025-10-20T09:00:00Z", "end_time": "2025-10-20T10:00:00Z", "recurrence_rule": "FREQ=WEEKLY"}`, carolID))
+		if code != http.StatusConflict {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusConflict, body)
+		}
+		conflicts := decodeConflicts(t, body)
+		if len(conflicts) != 1 || conflicts[0].ScheduleID != dailyID || !conflicts[0].StartTime.Equal(time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected conflicts: %s", body)
+		}
+	})
+
+	var adjacentID int64
+	t.Run("Should accept back-to-back schedules", func(t *testing.T) {
+		adjacentID = createSchedule(t, server, token, fmt.Sprintf(`{"title": "Follow-up", "owner_id": %d,
+			"start_time": "2025-11-03T11:00:00Z", "end_time": "2025-11-03T12:00:00Z"}`, bobID))
+	})
+
+	t.Run("Should create a conflicting schedule when allow_conflicts is set", func(t *testing.T) {
+		createSchedule(t, server, token, fmt.Sprintf(`{"title": "Bob focus", "owner_id": %d, "allow_conflicts": true,
+			"start_time": "2025-11-03T10:30:00Z", "end_time": "2025-11-03T11:30:00Z"}`, bobID))
+	})
+
+	t.Run("Should not check conflicts when only the title changes", func(t *testing.T) {
+		code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", reviewID), `{"title": "Renamed review"}`)
+		if code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+	})
+
+	t.Run("Should reject an update that moves the schedule onto another one", func(t *testing.T) {
+		code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", adjacentID),
+			`{"start_time": "2025-11-03T10:45:00Z", "end_time": "2025-11-03T11:45:00Z"}`)
+		if code != http.StatusConflict {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusConflict, body)
+		}
+		if conflicts := decodeConflicts(t, body); len(conflicts) != 2 || conflicts[0].ScheduleID != reviewID {
+			t.Errorf("unexpected conflicts: %s", body)
+		}
+
+		code, body = send("PUT", fmt.Sprintf("/api/schedules/%d", adjacentID),
+			`{"start_time": "2025-11-03T10:45:00Z", "end_time": "2025-11-03T11:45:00Z", "allow_conflicts": true}`)
+		if code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+	})
+}
+
+func TestScheduleRSVP(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+
+	scheduleID := createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Weekly sync", "owner_id": %d, "participant_ids": [%d],
+		"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z", "recurrence_rule": "FREQ=WEEKLY;COUNT=4"}`, aliceID, bobID))
+
+	send := func(method, path, token, body string) (int, *model.ScheduleResponse, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		var schedule model.ScheduleResponse
+		json.Unmarshal(rr.Body.Bytes(), &schedule)
+		return rr.Code, &schedule, rr.Body.String()
+	}
+	rsvpPath := fmt.Sprintf("/api/schedules/%d/rsvp", scheduleID)
+	participant := func(s *model.ScheduleResponse, userID int64) *model.ParticipantResponse {
+		for _, p := range s.Participants {
+			if p.ID == userID {
+				return p
+			}
+		}
+		return nil
+	}
+
+	// --- Test Cases ---
+	t.Run("Should start as needs-action", func(t *testing.T) {
+		_, schedule, _ := send("GET", fmt.Sprintf("/api/schedules/%d", scheduleID), bobToken, "")
+		if p := participant(schedule, bobID); p == nil || p.Status != model.RSVPNeedsAction || p.RespondedAt != nil {
+			t.Errorf("unexpected participant: %+v", p)
+		}
+	})
+
+	t.Run("Should reject invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			path  string
+			token string
+			body  string
+			want  int
+		}{
+			{"no token", rsvpPath, "", `{"status": "accepted"}`, http.StatusUnauthorized},
+			{"invalid status", rsvpPath, bobToken, `{"status": "maybe"}`, http.StatusBadRequest},
+			{"needs-action", rsvpPath, bobToken, `{"status": "needs-action"}`, http.StatusBadRequest},
+			{"comment too long", rsvpPath, bobToken, `{"status": "accepted", "comment": "` + strings.Repeat("a", 1001) + `"}`, http.StatusBadRequest},
+			{"not a participant", rsvpPath, aliceToken, `{"status": "accepted"}`, http.StatusForbidden},
+			{"unknown schedule", "/api/schedules/999/rsvp", bobToken, `{"status": "accepted"}`, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			if code, _, body := send("POST", tt.path, tt.token, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.name, code, tt.want, body)
+			}
+		}
+	})
+
+	t.Run("Should record the participant's response", func(t *testing.T) {
+		code, schedule, body := send("POST", rsvpPath, bobToken, `{"status": "tentative", "comment": "  May be late  "}`)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		p := participant(schedule, bobID)
+		if p == nil || p.Status != model.RSVPTentative || p.Comment != "May be late" || p.RespondedAt == nil {
+			t.Errorf("unexpected participant: %s", body)
+		}
+	})
+
+	t.Run("Should keep responses when participants are updated", func(t *testing.T) {
+		code, schedule, body := send("PUT", fmt.Sprintf("/api/schedules/%d", scheduleID), aliceToken,
+			fmt.Sprintf(`{"participant_ids": [%d, %d]}`, bobID, carolID))
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		if p := participant(schedule, bobID); p == nil || p.Status != model.RSVPTentative {
+			t.Errorf("expected bob's response to be kept: %s", body)
+		}
+		if p := participant(schedule, carolID); p == nil || p.Status != model.RSVPNeedsAction {
+			t.Errorf("expected carol to be needs-action: %s", body)
+		}
+	})
+
+	t.Run("Should carry responses over to an overridden occurrence", func(t *testing.T) {
+		code, schedule, body := send("PUT", fmt.Sprintf("/api/schedules/%d", scheduleID), aliceToken,
+			`{"title": "Moved sync", "scope": "this", "occurrence_start": "2025-11-10T10:00:00Z"}`)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		if p := participant(schedule, bobID); p == nil || p.Status != model.RSVPTentative || p.Comment != "May be late" {
+			t.Errorf("expected bob's response to be carried over: %s", body)
+		}
+	})
+}
+
+// failingMailer is a mail.Sender that cannot reach the mail server.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg *mail.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestScheduleInvitations(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+	// Run the worker ahead of the wall clock so that newly queued invitations are due immediately.
+	server.clock.Set(time.Now().Add(time.Hour))
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+
+	send := func(method, path, body string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		if rr := server.executeRequest(req); rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Fatalf("%s %s returned status %d: %s", method, path, rr.Code, rr.Body.String())
+		}
+	}
+	// invitations sends the queued invitations and returns the invitations sent since the last call by recipient,
+	// with their calendars unfolded
+	seen := len(server.outbox.Messages())
+	invitations := func() map[string]*mail.Message {
+		t.Helper()
+		if _, err := server.invitations.RunOnce(context.Background()); err != nil {
+			t.Fatalf("Failed to send invitations: %v", err)
+		}
+		messages := server.outbox.Messages()
+		byRecipient := make(map[string]*mail.Message)
+		for _, m := range messages[seen:] {
+			if m.Calendar == nil {
+				continue
+			}
+			m.Calendar = &mail.CalendarPart{Method: m.Calendar.Method, Data: strings.ReplaceAll(m.Calendar.Data, "\r\n ", "")}
+			byRecipient[m.To] = &m
+		}
+		seen = len(messages)
+		return byRecipient
+	}
+	expectInvitation := func(t *testing.T, m *mail.Message, method, subject string, lines ...string) {
+		t.Helper()
+		if m == nil {
+			t.Fatalf("Expected a %s invitation", method)
+		}
+		if m.Calendar.Method != method || m.Subject != subject || !strings.Contains(m.Calendar.Data, "METHOD:"+method+"\r\n") {
+			t.Errorf("Unexpected invitation: %s %s\n%s", m.Calendar.Method, m.Subject, m.Calendar.Data)
+		}
+		for _, line := range lines {
+			if !strings.Contains(m.Calendar.Data, "\r\n"+line+"\r\n") {
+				t.Errorf("Expected %q in the invitation:\n%s", line, m.Calendar.Data)
+			}
+		}
+	}
+
+	scheduleID := createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Weekly sync", "owner_id": %d, "participant_ids": [%d, %d],
+		"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z", "recurrence_rule": "FREQ=WEEKLY;COUNT=4"}`, aliceID, bobID, carolID))
+	path := fmt.Sprintf("/api/schedules/%d", scheduleID)
+	uid := "UID:" + model.ScheduleUID(scheduleID)
+	organizer := "ORGANIZER;CN=alice:mailto:alice@example.com"
+
+	// --- Test Cases ---
+	t.Run("Should invite participants", func(t *testing.T) {
+		sent := invitations()
+		if len(sent) != 2 || sent["alice@example.com"] != nil {
+			t.Fatalf("Expected invitations to bob and carol only, got %d", len(sent))
+		}
+		expectInvitation(t, sent["bob@example.com"], "REQUEST", "Invitation: Weekly sync", uid, organizer, "STATUS:CONFIRMED",
+			"DTSTART:20251103T100000Z", "RRULE:FREQ=WEEKLY;COUNT=4",
+			"ATTENDEE;CN=bob;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com",
+			"ATTENDEE;CN=carol;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:carol@example.com")
+		if m := sent["carol@example.com"]; m == nil || !strings.Contains(m.Body, `alice invited you to "Weekly sync"`) {
+			t.Errorf("Unexpected body: %+v", m)
+		}
+	})
+
+	t.Run("Should update invitations and cancel removed participants", func(t *testing.T) {
+		send("PUT", path, fmt.Sprintf(`{"title": "Weekly sync v2", "participant_ids": [%d]}`, bobID))
+		sent := invitations()
+		if len(sent) != 2 {
+			t.Fatalf("Expected 2 invitations, got %d", len(sent))
+		}
+		expectInvitation(t, sent["bob@example.com"], "REQUEST", "Updated invitation: Weekly sync v2", uid, "SEQUENCE:1", "SUMMARY:Weekly sync v2")
+		expectInvitation(t, sent["carol@example.com"], "CANCEL", "Canceled: Weekly sync v2", uid, "SEQUENCE:1", "STATUS:CANCELLED",
+			"ATTENDEE;CN=carol:mailto:carol@example.com")
+		if strings.Contains(sent["carol@example.com"].Calendar.Data, "mailto:bob@example.com") {
+			t.Errorf("Expected the cancellation to list carol only")
+		}
+	})
+
+	t.Run("Should update a single occurrence", func(t *testing.T) {
+		send("PUT", path, `{"scope": "this", "occurrence_start": "2025-11-10T10:00:00Z", "location": "Room 2"}`)
+		sent := invitations()
+		if len(sent) != 1 {
+			t.Fatalf("Expected 1 invitation, got %d", len(sent))
+		}
+		expectInvitation(t, sent["bob@example.com"], "REQUEST", "Updated invitation: Weekly sync v2", uid,
+			"RECURRENCE-ID:20251110T100000Z", "SEQUENCE:2", "LOCATION:Room 2")
+	})
+
+	t.Run("Should cancel a single occurrence", func(t *testing.T) {
+		send("DELETE", path+"?scope=this&occurrence_start=2025-11-17T10:00:00Z", "")
+		m := invitations()["bob@example.com"]
+		expectInvitation(t, m, "CANCEL", "Canceled: Weekly sync v2", uid, "RECURRENCE-ID:20251117T100000Z", "DTSTART:20251117T100000Z", "SEQUENCE:3")
+		if m != nil && strings.Contains(m.Calendar.Data, "RRULE:") {
+			t.Errorf("Expected the cancellation of an occurrence not to have a rule:\n%s", m.Calendar.Data)
+		}
+	})
+
+	t.Run("Should cancel the series", func(t *testing.T) {
+		send("DELETE", path, "")
+		m := invitations()["bob@example.com"]
+		expectInvitation(t, m, "CANCEL", "Canceled: Weekly sync v2", uid, "SEQUENCE:4", "RRULE:FREQ=WEEKLY;COUNT=4")
+		if m != nil && strings.Contains(m.Calendar.Data, "RECURRENCE-ID") {
+			t.Errorf("Expected the cancellation of the whole series:\n%s", m.Calendar.Data)
+		}
+	})
+
+	t.Run("Should send recurring invitations in the offset of the series", func(t *testing.T) {
+		// Monday 08:00 in +09:00 is Sunday in UTC, so BYDAY=MO only matches in the offset of the series
+		tokyoID := createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Tokyo sync", "owner_id": %d, "participant_ids": [%d],
+			"start_time": "2025-11-03T08:00:00+09:00", "end_time": "2025-11-03T09:00:00+09:00",
+			"recurrence_rule": "FREQ=WEEKLY;BYDAY=MO;COUNT=3", "allow_conflicts": true}`, aliceID, bobID))
+		tokyoPath := fmt.Sprintf("/api/schedules/%d", tokyoID)
+		tokyoUID := "UID:" + model.ScheduleUID(tokyoID)
+		timezone := []string{"BEGIN:VTIMEZONE", "TZID:UTC+0900", "TZOFFSETTO:+0900"}
+
+		expectInvitation(t, invitations()["bob@example.com"], "REQUEST", "Invitation: Tokyo sync", append(timezone, tokyoUID,
+			"DTSTART;TZID=UTC+0900:20251103T080000", "DTEND;TZID=UTC+0900:20251103T090000", "RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=3")...)
+
+		send("PUT", tokyoPath, `{"scope": "this", "occurrence_start": "2025-11-10T08:00:00+09:00", "location": "Room 3"}`)
+		expectInvitation(t, invitations()["bob@example.com"], "REQUEST", "Updated invitation: Tokyo sync", append(timezone, tokyoUID,
+			"RECURRENCE-ID;TZID=UTC+0900:20251110T080000", "DTSTART;TZID=UTC+0900:20251110T080000")...)
+
+		send("DELETE", tokyoPath+"?scope=this&occurrence_start=2025-11-17T08:00:00%2B09:00", "")
+		expectInvitation(t, invitations()["bob@example.com"], "CANCEL", "Canceled: Tokyo sync", append(timezone, tokyoUID,
+			"RECURRENCE-ID;TZID=UTC+0900:20251117T080000")...)
+
+		send("DELETE", tokyoPath, "")
+		m := invitations()["bob@example.com"]
+		expectInvitation(t, m, "CANCEL", "Canceled: Tokyo sync", append(timezone, tokyoUID,
+			"DTSTART;TZID=UTC+0900:20251103T080000", "EXDATE;TZID=UTC+0900:20251110T080000,20251117T080000")...)
+		if m != nil && strings.Contains(m.Calendar.Data, "DTSTART:20251102T230000Z") {
+			t.Errorf("Expected no UTC start in the cancellation:\n%s", m.Calendar.Data)
+		}
+	})
+
+	// A worker on the same queue whose mail server is down
+	failing := invite.NewWorker(repository.NewInvitationRepository(server.db), failingMailer{}, server.clock, time.Minute)
+	queued := func(t *testing.T, scheduleID int64) (status string, attempts int, lastError string) {
+		t.Helper()
+		err := server.db.QueryRow("SELECT status, attempts, last_error FROM invitation_emails WHERE schedule_id = ? AND recipient = 'bob@example.com'",
+			scheduleID).Scan(&status, &attempts, &lastError)
+		if err != nil {
+			t.Fatalf("Failed to get queued invitation: %v", err)
+		}
+		return status, attempts, lastError
+	}
+	newSchedule := func(title string) int64 {
+		return createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": %q, "owner_id": %d, "participant_ids": [%d],
+			"start_time": "2025-12-01T10:00:00Z", "end_time": "2025-12-01T11:00:00Z", "allow_conflicts": true}`, title, aliceID, bobID))
+	}
+
+	t.Run("Should retry failed invitations with backoff", func(t *testing.T) {
+		retroID := newSchedule("Retro")
+		if sent, err := failing.RunOnce(context.Background()); sent != 0 || err != nil {
+			t.Fatalf("Expected the invitation to fail, got %d sent: %v", sent, err)
+		}
+		if status, attempts, lastError := queued(t, retroID); status != string(model.InvitationPending) || attempts != 1 || lastError != "connection refused" {
+			t.Fatalf("Unexpected invitation after a failure: %s %d %q", status, attempts, lastError)
+		}
+
+		server.clock.Advance(invite.Backoff(1) - time.Second)
+		if sent := invitations(); len(sent) != 0 {
+			t.Errorf("Expected no retry before the backoff, got %d", len(sent))
+		}
+		server.clock.Advance(time.Second)
+		expectInvitation(t, invitations()["bob@example.com"], "REQUEST", "Invitation: Retro")
+		if status, attempts, _ := queued(t, retroID); status != string(model.InvitationSent) || attempts != 2 {
+			t.Errorf("Expected the invitation to be sent on the second attempt, got %s %d", status, attempts)
+		}
+	})
+
+	t.Run("Should give up after the maximum attempts", func(t *testing.T) {
+		reviewID := newSchedule("Review")
+		for i := 0; i < model.MaxInvitationAttempts+1; i++ {
+			if _, err := failing.RunOnce(context.Background()); err != nil {
+				t.Fatalf("Failed to run the worker: %v", err)
+			}
+			server.clock.Advance(3 * time.Hour)
+		}
+		if status, attempts, _ := queued(t, reviewID); status != string(model.InvitationFailed) || attempts != model.MaxInvitationAttempts {
+			t.Errorf("Expected the invitation to fail after %d attempts, got %s %d", model.MaxInvitationAttempts, status, attempts)
+		}
+		if sent := invitations(); len(sent) != 0 {
+			t.Errorf("Expected failed invitations not to be sent again, got %d", len(sent))
+		}
+	})
+}
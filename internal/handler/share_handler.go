@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+)
+
+// ShareHandler はカレンダーの共有設定 (アクセス権) の一覧・付与・取り消しを処理します。
+// 共有設定の変更には、カレンダーへの manage 権限が必要です。
+type ShareHandler struct {
+	shareRepo *repository.ShareRepository
+	userRepo  *repository.UserRepository
+	groupRepo *repository.GroupRepository
+}
+
+// NewShareHandler は ShareHandler の新しいインスタンスを生成します。
+func NewShareHandler(shareRepo *repository.ShareRepository, userRepo *repository.UserRepository, groupRepo *repository.GroupRepository) *ShareHandler {
+	return &ShareHandler{shareRepo: shareRepo, userRepo: userRepo, groupRepo: groupRepo}
+}
+
+// ListShares は所有者のカレンダーの共有設定の一覧を返します。
+func (h *ShareHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.authorizeManage(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := h.shareRepo.FindByOwnerID(ownerID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get shares for owner %d: %v", ownerID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve shares")
+		return
+	}
+
+	resp := make([]*model.ShareResponse, len(shares))
+	for i, s := range shares {
+		resp[i] = s.ToShareResponse()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GrantShare は所有者のカレンダーへのアクセス権をユーザーまたはグループに付与します。
+// 既に共有されている場合は権限を置き換えて 200 を、新しく共有した場合は 201 を返します。
+func (h *ShareHandler) GrantShare(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.authorizeManage(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !req.Permission.Valid() {
+		errorJSON(w, http.StatusBadRequest, "permission must be one of free-busy, read, write, manage")
+		return
+	}
+	if (req.UserID == 0) == (req.GroupID == 0) {
+		errorJSON(w, http.StatusBadRequest, "Exactly one of user_id and group_id is required")
+		return
+	}
+	if req.UserID == ownerID {
+		errorJSON(w, http.StatusBadRequest, "Cannot share a calendar with its owner")
+		return
+	}
+
+	granteeType, granteeID, notFound := model.GranteeUser, req.UserID, "User not found"
+	var err error
+	if req.GroupID != 0 {
+		granteeType, granteeID, notFound = model.GranteeGroup, req.GroupID, "Group not found"
+		_, err = h.groupRepo.FindByID(req.GroupID)
+	} else {
+		_, err = h.userRepo.FindUserByID(req.UserID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, notFound)
+		} else {
+			log.Printf("ERROR: Failed to get %s %d: %v", granteeType, granteeID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to share calendar")
+		}
+		return
+	}
+
+	share, created, err := h.shareRepo.Grant(ownerID, granteeType, granteeID, req.Permission)
+	if err != nil {
+		log.Printf("ERROR: Failed to share calendar %d with %s %d: %v", ownerID, granteeType, granteeID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to share calendar")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, share.ToShareResponse())
+}
+
+// RevokeShare は所有者のカレンダーの共有設定を取り消します。
+func (h *ShareHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.authorizeManage(w, r)
+	if !ok {
+		return
+	}
+
+	shareID, err := strconv.ParseInt(r.PathValue("shareID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid share ID")
+		return
+	}
+
+	if err := h.shareRepo.Revoke(ownerID, shareID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Share not found")
+		} else {
+			log.Printf("ERROR: Failed to revoke share %d: %v", shareID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to revoke share")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// authorizeManage はパスの {ownerID} を取得し、ログイン中のユーザーがそのカレンダーへの manage 権限を持つかを確認します。
+// 失敗した場合は応答を書き込み false を返します。
+func (h *ShareHandler) authorizeManage(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return 0, false
+	}
+	ownerID, err := strconv.ParseInt(r.PathValue("ownerID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid owner ID")
+		return 0, false
+	}
+	if !requireCalendarPermission(w, h.shareRepo, model.OwnerUser, ownerID, userID, model.PermissionManage) {
+		return 0, false
+	}
+	return ownerID, true
+}
+
+// requireCalendarPermission はユーザー userID がカレンダー (ownerType と ownerID で示すユーザーまたはグループのカレンダー) に
+// required 以上の権限を持つかを確認します。持たない場合は 403 を書き込み false を返します。
+func requireCalendarPermission(w http.ResponseWriter, shareRepo *repository.ShareRepository, ownerType string, ownerID, userID int64, required model.SharePermission) bool {
+	permission, err := shareRepo.Permission(ownerType, ownerID, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get permission of user %d on calendar %d: %v", userID, ownerID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to check calendar permission")
+		return false
+	}
+	if !permission.Allows(required) {
+		errorJSON(w, http.StatusForbidden, "Forbidden: You do not have "+string(required)+" access to this calendar")
+		return false
+	}
+	return true
+}
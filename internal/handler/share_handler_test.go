@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"schedule-app/internal/model"
+	"testing"
+)
+
+// Helper function to share ownerID's calendar with userID and return the share ID
+func shareCalendar(t *testing.T, server *testServer, token string, ownerID, userID int64, permission model.SharePermission) int64 {
+	requestBody := fmt.Sprintf(`{"user_id": %d, "permission": "%s"}`, userID, permission)
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/users/%d/shares", ownerID), bytes.NewBufferString(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := server.executeRequest(req)
+	if rr.Code != http.StatusCreated && rr.Code != http.StatusOK {
+		t.Fatalf("Failed to share calendar %d with user %d: %s", ownerID, userID, rr.Body.String())
+	}
+	var share model.ShareResponse
+	json.NewDecoder(rr.Body).Decode(&share)
+	return share.ID
+}
+
+func TestShareHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	carolID := createUser(t, server, "carol", "carol@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	carolToken := loginUser(t, server, "carol@example.com", "password123")
+
+	scheduleID := createSchedule(t, server, aliceToken, fmt.Sprintf(`{"title": "Private", "owner_id": %d,
+		"start_time": "2025-11-03T10:00:00Z", "end_time": "2025-11-03T11:00:00Z"}`, aliceID))
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	listPath := fmt.Sprintf("/api/users/%d/schedules?from=2025-11-01T00:00:00Z&to=2025-12-01T00:00:00Z", aliceID)
+	schedulePath := fmt.Sprintf("/api/schedules/%d", scheduleID)
+	freeBusyBody := fmt.Sprintf(`{"user_ids": [%d], "from": "2025-11-03T00:00:00Z", "to": "2025-11-04T00:00:00Z"}`, aliceID)
+	createBody := fmt.Sprintf(`{"title": "By bob", "owner_id": %d, "start_time": "2025-11-04T10:00:00Z", "end_time": "2025-11-04T11:00:00Z"}`, aliceID)
+	sharesPath := fmt.Sprintf("/api/users/%d/shares", aliceID)
+
+	// expect checks the status code of each request made by bob.
+	expect := func(t *testing.T, tests map[string]struct {
+		method, path, body string
+		want               int
+	}) {
+		t.Helper()
+		for name, tt := range tests {
+			if code, body := send(tt.method, tt.path, bobToken, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", name, code, tt.want, body)
+			}
+		}
+	}
+
+	// --- Test Cases ---
+	t.Run("Should require authentication to read a calendar", func(t *testing.T) {
+		for _, path := range []string{listPath, schedulePath} {
+			if code, _ := send("GET", path, "", ""); code != http.StatusUnauthorized {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v", path, code, http.StatusUnauthorized)
+			}
+		}
+	})
+
+	t.Run("Should deny access to a calendar that is not shared", func(t *testing.T) {
+		expect(t, map[string]struct {
+			method, path, body string
+			want               int
+		}{
+			"list":      {"GET", listPath, "", http.StatusForbidden},
+			"get":       {"GET", schedulePath, "", http.StatusForbidden},
+			"free/busy": {"POST", "/api/freebusy", freeBusyBody, http.StatusForbidden},
+			"create":    {"POST", "/api/schedules", createBody, http.StatusForbidden},
+			"update":    {"PUT", schedulePath, `{"title": "Hacked"}`, http.StatusForbidden},
+			"delete":    {"DELETE", schedulePath, "", http.StatusForbidden},
+			"shares":    {"GET", sharesPath, "", http.StatusForbidden},
+		})
+	})
+
+	var shareID int64
+	t.Run("Should validate share requests", func(t *testing.T) {
+		tests := []struct {
+			body string
+			want int
+		}{
+			{fmt.Sprintf(`{"user_id": %d, "permission": "admin"}`, bobID), http.StatusBadRequest},
+			{`{"permission": "read"}`, http.StatusBadRequest},
+			{fmt.Sprintf(`{"user_id": %d, "permission": "read"}`, aliceID), http.StatusBadRequest},
+			{`{"user_id": 999, "permission": "read"}`, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			if code, body := send("POST", sharesPath, aliceToken, tt.body); code != tt.want {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", tt.body, code, tt.want, body)
+			}
+		}
+	})
+
+	t.Run("Should allow only free/busy lookups with a free-busy share", func(t *testing.T) {
+		shareID = shareCalendar(t, server, aliceToken, aliceID, bobID, model.PermissionFreeBusy)
+		expect(t, map[string]struct {
+			method, path, body string
+			want               int
+		}{
+			"free/busy": {"POST", "/api/freebusy", freeBusyBody, http.StatusOK},
+			"list":      {"GET", listPath, "", http.StatusForbidden},
+		})
+	})
+
+	t.Run("Should allow reading but not writing with a read share", func(t *testing.T) {
+		code, body := send("POST", sharesPath, aliceToken, fmt.Sprintf(`{"user_id": %d, "permission": "read"}`, bobID))
+		if code != http.StatusOK {
+			t.Fatalf("Expected changing the permission to return 200, got %d: %s", code, body)
+		}
+		var share model.ShareResponse
+		json.Unmarshal([]byte(body), &share)
+		if share.ID != shareID || share.Permission != model.PermissionRead {
+			t.Errorf("Expected share %d to be updated to read, got %s", shareID, body)
+		}
+
+		expect(t, map[string]struct {
+			method, path, body string
+			want               int
+		}{
+			"list":   {"GET", listPath, "", http.StatusOK},
+			"get":    {"GET", schedulePath, "", http.StatusOK},
+			"create": {"POST", "/api/schedules", createBody, http.StatusForbidden},
+			"update": {"PUT", schedulePath, `{"title": "Edited"}`, http.StatusForbidden},
+			"shares": {"GET", sharesPath, "", http.StatusForbidden},
+		})
+	})
+
+	t.Run("Should allow editing any schedule with a write share", func(t *testing.T) {
+		shareCalendar(t, server, aliceToken, aliceID, bobID, model.PermissionWrite)
+		expect(t, map[string]struct {
+			method, path, body string
+			want               int
+		}{
+			"create": {"POST", "/api/schedules", createBody, http.StatusCreated},
+			"update": {"PUT", schedulePath, `{"title": "Edited"}`, http.StatusOK},
+			"shares": {"POST", sharesPath, fmt.Sprintf(`{"user_id": %d, "permission": "read"}`, carolID), http.StatusForbidden},
+		})
+	})
+
+	t.Run("Should let a manager share the calendar", func(t *testing.T) {
+		shareCalendar(t, server, aliceToken, aliceID, bobID, model.PermissionManage)
+		shareCalendar(t, server, bobToken, aliceID, carolID, model.PermissionRead)
+
+		code, body := send("GET", sharesPath, bobToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusOK, body)
+		}
+		var shares []*model.ShareResponse
+		json.Unmarshal([]byte(body), &shares)
+		if len(shares) != 2 || shares[0].UserID != bobID || shares[0].Permission != model.PermissionManage ||
+			shares[1].UserID != carolID || shares[1].Permission != model.PermissionRead {
+			t.Errorf("Unexpected shares: %s", body)
+		}
+		if code, _ := send("GET", listPath, carolToken, ""); code != http.StatusOK {
+			t.Errorf("Expected carol to read the calendar, got %d", code)
+		}
+	})
+
+	t.Run("Should revoke a share", func(t *testing.T) {
+		if code, body := send("DELETE", fmt.Sprintf("%s/%d", sharesPath, shareID), aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusNoContent, body)
+		}
+		if code, _ := send("DELETE", fmt.Sprintf("%s/%d", sharesPath, shareID), aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a revoked share, got %d", code)
+		}
+		if code, _ := send("GET", listPath, bobToken, ""); code != http.StatusForbidden {
+			t.Errorf("Expected bob to lose access, got %d", code)
+		}
+	})
+}
@@ -6,8 +6,12 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"schedule-app/internal/jwtkeys"
+	"schedule-app/internal/middleware"
 	"schedule-app/internal/model"
+	"schedule-app/internal/oidc"
 	"schedule-app/internal/repository"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,17 +19,45 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// accessTokenTTL はアクセストークン (JWT) の有効期間です。期限が切れたらリフレッシュトークンで再発行します。
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL はリフレッシュトークンの有効期間です。リフレッシュするたびに新しいトークンが発行されます。
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// minPasswordLength はパスワードの最小の長さです。
+	minPasswordLength = 8
+	// mfaChallengeTTL は二要素認証のチャレンジの有効期間です。パスワードの確認後、この時間内にコードを送信します。
+	mfaChallengeTTL = 5 * time.Minute
+)
+
+// errMFARequired は二要素認証を有効にしたユーザーが、パスワードだけで認証しようとした場合のエラーです。
+var errMFARequired = errors.New("two-factor authentication is required")
+
 // UserHandler はユーザー関連のHTTPリクエストを処理します。
 type UserHandler struct {
-	userRepo  *repository.UserRepository
-	jwtSecret []byte
+	userRepo    *repository.UserRepository
+	sessionRepo *repository.SessionRepository
+	oidcRepo    *repository.OIDCRepository
+	oidc        *oidc.Provider // nil の場合、OpenID Connect ログインは無効
+	keys        *jwtkeys.KeySet
+	accounts    *AccountHandler
+	throttle    *repository.LoginThrottleRepository
+	mfaRepo     *repository.MFARepository
 }
 
 // NewUserHandler は UserHandler の新しいインスタンスを生成します。
-func NewUserHandler(userRepo *repository.UserRepository, jwtSecret string) *UserHandler {
+// oidcProvider が nil の場合、OpenID Connect ログインのエンドポイントは 404 を返します。
+// accounts はユーザー登録時の確認メールの送信に、throttle はパスワードの総当たり攻撃の対策に、mfaRepo は二要素認証に使用します。
+func NewUserHandler(userRepo *repository.UserRepository, sessionRepo *repository.SessionRepository, oidcRepo *repository.OIDCRepository, oidcProvider *oidc.Provider, keys *jwtkeys.KeySet, accounts *AccountHandler, throttle *repository.LoginThrottleRepository, mfaRepo *repository.MFARepository) *UserHandler {
 	return &UserHandler{
-		userRepo:  userRepo,
-		jwtSecret: []byte(jwtSecret),
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		oidcRepo:    oidcRepo,
+		oidc:        oidcProvider,
+		keys:        keys,
+		accounts:    accounts,
+		throttle:    throttle,
+		mfaRepo:     mfaRepo,
 	}
 }
 
@@ -48,11 +80,15 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		errorJSON(w, http.StatusBadRequest, "Username must be at least 3 characters long")
 		return
 	}
+	if model.HasControlCharacter(req.Username) {
+		errorJSON(w, http.StatusBadRequest, "Username must not contain control characters")
+		return
+	}
 	if !emailRegex.MatchString(req.Email) {
 		errorJSON(w, http.StatusBadRequest, "Invalid email format")
 		return
 	}
-	if len(req.Password) < 8 {
+	if len(req.Password) < minPasswordLength {
 		errorJSON(w, http.StatusBadRequest, "Password must be at least 8 characters long")
 		return
 	}
@@ -68,10 +104,18 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 確認メールを送信。送信に失敗しても登録は完了し、後から再送信できる
+	if err := h.accounts.SendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("ERROR: Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	writeJSON(w, http.StatusCreated, user.ToUserResponse())
 }
 
 // Login はユーザーログインのためのハンドラです。
+// 新しいセッションを作成し、アクセストークンとリフレッシュトークンを返します。
+// 二要素認証を有効にしたユーザーには、トークンの代わりにチャレンジを返します。LoginMFA でコードを送信するとログインが完了します。
+// 失敗が続いたアカウントまたはクライアントIPからの試行には、Retry-After ヘッダーとともに 429 を返します。
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req model.LoginUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -79,43 +123,399 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userRepo.FindUserByEmail(req.Email)
+	clientIP := middleware.ClientIP(r)
+	user, err := h.authenticate(req.Email, req.Password, clientIP)
+	if writeThrottled(w, err) {
+		return
+	}
 	if err != nil {
 		errorJSON(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	// パスワードを比較
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	h.completeLogin(w, user, clientIP)
+}
+
+// completeLogin はパスワードまたは OpenID Connect で認証したユーザーのセッションを作成し、トークンを返します。
+// 二要素認証を有効にしたユーザーには、トークンの代わりにチャレンジを返します。
+func (h *UserHandler) completeLogin(w http.ResponseWriter, user *model.User, clientIP string) {
+	mfaEnabled, err := h.mfaRepo.Enabled(user.ID)
 	if err != nil {
-		errorJSON(w, http.StatusUnauthorized, "Invalid email or password")
+		log.Printf("ERROR: Failed to get MFA settings of user %d: %v", user.ID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+	if mfaEnabled {
+		token, expiresAt, err := h.mfaRepo.CreateChallenge(user.ID, mfaChallengeTTL)
+		if err != nil {
+			log.Printf("ERROR: Failed to create MFA challenge for user %d: %v", user.ID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to create token")
+			return
+		}
+		writeJSON(w, http.StatusOK, &model.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    token,
+			ExpiresAt:   expiresAt.Truncate(time.Second),
+		})
+		return
+	}
+
+	h.recordLoginSuccess(user, clientIP)
+	session, refreshToken, err := h.sessionRepo.Create(user.ID, refreshTokenTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to create session for user %d: %v", user.ID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+// LoginMFA は Login で返したチャレンジと TOTP のコードまたはリカバリーコードで、ログインを完了します。
+// コードの間違いはログインの失敗として数え、チャレンジごとの回数も制限します。
+func (h *UserHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req model.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := h.mfaRepo.ChallengeUser(req.MFAToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidMFAChallenge) {
+			errorJSON(w, http.StatusUnauthorized, "Invalid or expired MFA token. Please log in again.")
+		} else {
+			log.Printf("ERROR: Failed to get MFA challenge: %v", err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to log in")
+		}
+		return
+	}
+	user, err := h.userRepo.FindUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get user %d for MFA login: %v", userID, err)
+		errorJSON(w, http.StatusUnauthorized, "Invalid or expired MFA token. Please log in again.")
+		return
+	}
+	clientIP := middleware.ClientIP(r)
+	if writeThrottled(w, h.throttle.Check(user.Email, clientIP)) {
 		return
 	}
 
-	// トークンの有効期限を設定 (例: 24時間)
-	expirationTime := time.Now().Add(24 * time.Hour)
+	if _, err := h.mfaRepo.CompleteChallenge(req.MFAToken, req.Code); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInvalidMFACode):
+			if recordErr := h.throttle.RecordFailure(user.Email, clientIP, &user.ID); recordErr != nil {
+				log.Printf("ERROR: Failed to record login failure: %v", recordErr)
+			}
+			errorJSON(w, http.StatusUnauthorized, "Invalid code")
+		case errors.Is(err, repository.ErrInvalidMFAChallenge), errors.Is(err, repository.ErrMFANotEnabled):
+			errorJSON(w, http.StatusUnauthorized, "Invalid or expired MFA token. Please log in again.")
+		default:
+			log.Printf("ERROR: Failed to complete MFA challenge for user %d: %v", user.ID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to log in")
+		}
+		return
+	}
+
+	h.recordLoginSuccess(user, clientIP)
+	session, refreshToken, err := h.sessionRepo.Create(user.ID, refreshTokenTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to create session for user %d: %v", user.ID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+const (
+	// oidcStateCookie は認可リクエストの state をブラウザに結び付ける Cookie の名前です (ログイン CSRF 対策)。
+	oidcStateCookie = "oidc_state"
+	// oidcLoginTimeout は認可リクエストからコールバックまでの制限時間です。
+	oidcLoginTimeout = 10 * time.Minute
+)
+
+// OIDCLogin は外部IDプロバイダーによるログインを開始します。
+// state・nonce・PKCE のコード検証子を生成して保存し、IDプロバイダーの認可エンドポイントにリダイレクトします。
+func (h *UserHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		errorJSON(w, http.StatusNotFound, "OpenID Connect login is not configured")
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate OIDC state: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate OIDC nonce: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate PKCE verifier: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	if err := h.oidcRepo.SaveLoginState(state, &model.OIDCLoginState{Nonce: nonce, CodeVerifier: verifier}); err != nil {
+		log.Printf("ERROR: Failed to save OIDC login state: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.oidc.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+}
 
-	// JWTのクレームを設定
+// OIDCCallback はIDプロバイダーからのリダイレクトを処理します。
+// 認可コードを ID トークンに交換して検証し、対応するユーザーでログインします。
+// 初めてのログインでは、確認済みのメールアドレスで既存のユーザーに紐付けるか、新しいユーザーを作成します。
+// 既存のユーザーはメールアドレスを確認済みの場合のみ紐付けます。
+// 二要素認証を有効にしたユーザーには、パスワードでのログインと同じくトークンの代わりにチャレンジを返します。
+func (h *UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		errorJSON(w, http.StatusNotFound, "OpenID Connect login is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	// state の Cookie は成否にかかわらず削除する
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc/", MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode})
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		errorJSON(w, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+	loginState, err := h.oidcRepo.TakeLoginState(state, oidcLoginTimeout)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidLoginState) {
+			errorJSON(w, http.StatusBadRequest, "Invalid login state")
+		} else {
+			log.Printf("ERROR: Failed to get OIDC login state: %v", err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to log in")
+		}
+		return
+	}
+	if errCode := query.Get("error"); errCode != "" {
+		errorJSON(w, http.StatusUnauthorized, "Login was not completed: "+errCode)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		errorJSON(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	rawIDToken, err := h.oidc.Exchange(r.Context(), code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("ERROR: Failed to exchange OIDC authorization code: %v", err)
+		errorJSON(w, http.StatusUnauthorized, "Failed to authenticate with the identity provider")
+		return
+	}
+	idToken, err := h.oidc.VerifyIDToken(r.Context(), rawIDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("ERROR: Failed to verify OIDC ID token: %v", err)
+		errorJSON(w, http.StatusUnauthorized, "Failed to authenticate with the identity provider")
+		return
+	}
+
+	username := idToken.PreferredUsername
+	if username == "" {
+		username = idToken.Name
+	}
+	user, created, err := h.oidcRepo.FindOrProvisionUser(&model.ExternalIdentity{
+		Issuer:        h.oidc.Issuer(),
+		Subject:       idToken.Subject,
+		Email:         strings.TrimSpace(idToken.Email),
+		EmailVerified: idToken.EmailVerified,
+		Username:      username,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailNotVerified) {
+			errorJSON(w, http.StatusForbidden, "A verified email address is required to sign in for the first time")
+		} else if errors.Is(err, repository.ErrLinkedAccountNotVerified) {
+			errorJSON(w, http.StatusConflict, "An account with this email address already exists. Verify its email address or reset its password, then sign in again")
+		} else {
+			log.Printf("ERROR: Failed to provision user for OIDC subject %q: %v", idToken.Subject, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to log in")
+		}
+		return
+	}
+	if created {
+		log.Printf("INFO: Provisioned user %d for OIDC subject %q", user.ID, idToken.Subject)
+	}
+
+	h.completeLogin(w, user, middleware.ClientIP(r))
+}
+
+// Refresh はリフレッシュトークンを新しいアクセストークンとリフレッシュトークンに交換します。
+// 使ったリフレッシュトークンは無効になります。ロールの変更もこの時点で反映されます。
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req model.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.RefreshToken == "" {
+		errorJSON(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	session, refreshToken, err := h.sessionRepo.Refresh(req.RefreshToken, refreshTokenTTL)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			log.Println("WARNING: Reuse of a rotated refresh token detected; the session has been revoked")
+			errorJSON(w, http.StatusUnauthorized, "Invalid refresh token")
+		} else if errors.Is(err, repository.ErrInvalidRefreshToken) || errors.Is(err, repository.ErrSessionRevoked) {
+			errorJSON(w, http.StatusUnauthorized, "Invalid refresh token")
+		} else {
+			log.Printf("ERROR: Failed to refresh token: %v", err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to refresh token")
+		}
+		return
+	}
+
+	user, err := h.userRepo.FindUserByID(session.UserID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get user %d for refresh: %v", session.UserID, err)
+		errorJSON(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+// Logout は現在のセッションを無効にします。
+// そのセッションのアクセストークンとリフレッシュトークンは、以降使えなくなります。
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := middleware.GetSessionIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return
+	}
+
+	if err := h.sessionRepo.Revoke(sessionID); err != nil {
+		log.Printf("ERROR: Failed to revoke session: %v", err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// writeTokens はセッションのアクセストークンを発行し、リフレッシュトークンとともに書き込みます。
+func (h *UserHandler) writeTokens(w http.ResponseWriter, user *model.User, session *model.Session, refreshToken string) {
+	// トークンの有効期限を設定
+	expirationTime := time.Now().Add(accessTokenTTL)
+
+	// JWTのクレームを設定。jti にセッションIDを設定し、ログアウト後のトークンを拒否できるようにする
 	claims := &model.Claims{
 		UserID: user.ID,
+		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	// 新しいトークンを生成し、設定した秘密鍵で署名
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(h.jwtSecret)
+	// 新しいトークンを生成し、現在の署名鍵で署名
+	tokenString, err := h.keys.Sign(claims)
 	if err != nil {
 		errorJSON(w, http.StatusInternalServerError, "Failed to create token")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"token": tokenString})
+	writeJSON(w, http.StatusOK, &model.TokenResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expirationTime.UTC().Truncate(time.Second),
+	})
+}
+
+// CheckCredentials はメールアドレスとパスワードを検証し、ユーザーIDを返します。
+// Basic 認証 (CalDAV) で使用します。二要素認証を有効にしたユーザーは、パスワードだけでは認証できません
+// (パスワードの代わりにパーソナルアクセストークンを使用します)。
+// 成功は、それまでに失敗やロックがあった場合だけ監査ログに記録します。
+func (h *UserHandler) CheckCredentials(email, password, clientIP string) (int64, error) {
+	user, err := h.authenticate(email, password, clientIP)
+	if err != nil {
+		return 0, err
+	}
+	mfaEnabled, err := h.mfaRepo.Enabled(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if mfaEnabled {
+		return 0, errMFARequired
+	}
+	// クライアントはリクエストごとに認証するため、成功は失敗やロックをリセットする場合だけ記録する
+	if err := h.throttle.RecordSuccessAfterFailures(user.Email, clientIP, user.ID); err != nil {
+		log.Printf("ERROR: Failed to record login success for user %d: %v", user.ID, err)
+	}
+	return user.ID, nil
+}
+
+// authenticate はメールアドレスとパスワードを検証し、ユーザーを返します。失敗は記録しますが、成功は記録しません。
+// 二要素認証のコードの確認を待つ間に失敗回数がリセットされないよう、呼び出し側がログインの完了時に recordLoginSuccess を呼び出します。
+// アカウントまたはクライアントIPがロックされている場合は、パスワードを検証せずに *model.LoginThrottledError を返します。
+func (h *UserHandler) authenticate(email, password, clientIP string) (*model.User, error) {
+	if err := h.throttle.Check(email, clientIP); err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepo.FindUserByEmail(email)
+	if err == nil {
+		// パスワードを比較
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	}
+	if err != nil {
+		// 存在しないメールアドレスへの試行も数え、ロックの有無からアカウントの存在を推測されないようにする
+		var userID *int64
+		if user != nil {
+			userID = &user.ID
+		}
+		if recordErr := h.throttle.RecordFailure(email, clientIP, userID); recordErr != nil {
+			log.Printf("ERROR: Failed to record login failure: %v", recordErr)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// recordLoginSuccess はログインの成功を記録し、アカウントの失敗回数をリセットします。記録の失敗はログに残すだけです。
+func (h *UserHandler) recordLoginSuccess(user *model.User, clientIP string) {
+	if err := h.throttle.RecordSuccess(user.Email, clientIP, user.ID); err != nil {
+		log.Printf("ERROR: Failed to record login success for user %d: %v", user.ID, err)
+	}
+}
+
+// writeThrottled は err が *model.LoginThrottledError の場合に Retry-After ヘッダーとともに 429 を書き込み、true を返します。
+func writeThrottled(w http.ResponseWriter, err error) bool {
+	var throttled *model.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(throttled.RetryAfterSeconds()))
+	errorJSON(w, http.StatusTooManyRequests, "Too many failed login attempts. Please try again later.")
+	return true
 }
 
-// GetAllUsers はすべてのユーザーのリストを取得します。
-// 本番環境では、このエンドポイントは管理者のみがアクセスできるように制限する必要があります。
+// GetAllUsers はすべてのユーザーのリストをロールとともに取得します。
+// 管理者のみがアクセスできるよう、ルーティングで RequireRole を適用します。
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := h.userRepo.FindAll()
 	if err != nil {
@@ -124,9 +524,9 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var resp []*model.UserResponse
+	var resp []*model.AdminUserResponse
 	for _, u := range users {
-		resp = append(resp, u.ToUserResponse())
+		resp = append(resp, u.ToAdminUserResponse())
 	}
 
 	writeJSON(w, http.StatusOK, resp)
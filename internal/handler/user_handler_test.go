@@ -2,10 +2,28 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"schedule-app/internal/middleware"
 	"schedule-app/internal/model"
+	"schedule-app/internal/oidc"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestUserHandlers(t *testing.T) {
@@ -84,4 +102,671 @@ func TestUserHandlers(t *testing.T) {
 			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
 		}
 	})
+
+	t.Run("Should fail to register a username with control characters", func(t *testing.T) {
+		requestBody := `{"username": "x\r\nATTENDEE:mailto:evil@example.com", "email": "evil@example.com", "password": "password123"}`
+		req, _ := http.NewRequest("POST", "/api/users/register", bytes.NewBufferString(requestBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := server.executeRequest(req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestSessionHandlers(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	createUser(t, server, "alice", "alice@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	login := func() model.TokenResponse {
+		code, body := send("POST", "/api/users/login", "", `{"email": "alice@example.com", "password": "password123"}`)
+		if code != http.StatusOK {
+			t.Fatalf("Failed to login: %s", body)
+		}
+		var tokens model.TokenResponse
+		json.Unmarshal([]byte(body), &tokens)
+		return tokens
+	}
+	refresh := func(refreshToken string) (int, model.TokenResponse) {
+		code, body := send("POST", "/api/users/refresh", "", fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken))
+		var tokens model.TokenResponse
+		json.Unmarshal([]byte(body), &tokens)
+		return code, tokens
+	}
+	authorized := func(token string) bool {
+		code, _ := send("GET", "/api/groups", token, "")
+		return code == http.StatusOK
+	}
+
+	// --- Test Cases ---
+	t.Run("Should issue an access token and a refresh token on login", func(t *testing.T) {
+		tokens := login()
+		if tokens.Token == "" || tokens.RefreshToken == "" || tokens.ExpiresAt.IsZero() {
+			t.Errorf("Expected both tokens and an expiry: %+v", tokens)
+		}
+		if !authorized(tokens.Token) {
+			t.Errorf("Expected the access token to be accepted")
+		}
+	})
+
+	t.Run("Should rotate the refresh token", func(t *testing.T) {
+		tokens := login()
+		code, rotated := refresh(tokens.RefreshToken)
+		if code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", code, http.StatusOK)
+		}
+		if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+			t.Errorf("Expected a new refresh token")
+		}
+		if !authorized(rotated.Token) {
+			t.Errorf("Expected the new access token to be accepted")
+		}
+		if code, next := refresh(rotated.RefreshToken); code != http.StatusOK || !authorized(next.Token) {
+			t.Errorf("Expected the rotated refresh token to be usable, got %d", code)
+		}
+	})
+
+	t.Run("Should revoke the session when a used refresh token is reused", func(t *testing.T) {
+		tokens := login()
+		_, rotated := refresh(tokens.RefreshToken)
+		if code, _ := refresh(tokens.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a reused refresh token, got %d", code)
+		}
+		if code, _ := refresh(rotated.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("Expected the latest refresh token to be revoked too, got %d", code)
+		}
+		if authorized(rotated.Token) {
+			t.Errorf("Expected access tokens of the revoked session to be rejected")
+		}
+	})
+
+	t.Run("Should reject invalid refresh requests", func(t *testing.T) {
+		if code, _ := send("POST", "/api/users/refresh", "", `{}`); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 without a refresh token, got %d", code)
+		}
+		if code, _ := refresh("unknown"); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for an unknown refresh token, got %d", code)
+		}
+	})
+
+	t.Run("Should log out only the current session", func(t *testing.T) {
+		tokens := login()
+		other := login()
+		if code, _ := send("POST", "/api/users/logout", "", ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 without a token, got %d", code)
+		}
+		if code, body := send("POST", "/api/users/logout", tokens.Token, ""); code != http.StatusNoContent {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", code, http.StatusNoContent, body)
+		}
+		if authorized(tokens.Token) {
+			t.Errorf("Expected the access token to be rejected after logout")
+		}
+		if code, _ := refresh(tokens.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("Expected the refresh token to be rejected after logout, got %d", code)
+		}
+		if !authorized(other.Token) {
+			t.Errorf("Expected other sessions to stay logged in")
+		}
+	})
+}
+
+const (
+	stubClientID     = "test-client"
+	stubClientSecret = "test-secret"
+	stubRedirectURL  = "http://localhost:8080/api/auth/oidc/callback"
+)
+
+// stubIdP is a minimal OpenID Connect provider supporting the authorization code flow with PKCE.
+type stubIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]stubAuthorization
+}
+
+// stubAuthorization is an authorization code issued by the stub together with what it was issued for.
+type stubAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	idp := &stubIdP{key: key, codes: make(map[string]stubAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// authorize simulates the user signing in at the authorization endpoint and returns the code and state
+// the provider would redirect back with.
+func (idp *stubIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != stubClientID || q.Get("redirect_uri") != stubRedirectURL ||
+		q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Unexpected authorization request: %s", authURL)
+	}
+
+	code, _ = oidc.RandomString()
+	idp.mu.Lock()
+	idp.codes[code] = stubAuthorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (idp *stubIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != stubClientID || secret != stubClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+	r.ParseForm()
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != stubRedirectURL ||
+		oidc.S256Challenge(r.PostForm.Get("code_verifier")) != auth.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   stubClientID,
+		"nonce": auth.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range auth.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub-key"
+	idToken, _ := token.SignedString(idp.key)
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "stub-access-token", "token_type": "Bearer", "id_token": idToken})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	// --- Test Setup ---
+	idp := newStubIdP(t)
+	defer idp.server.Close()
+	provider, err := oidc.Discover(context.Background(), idp.server.Client(), oidc.Config{
+		IssuerURL:    idp.server.URL,
+		ClientID:     stubClientID,
+		ClientSecret: stubClientSecret,
+		RedirectURL:  stubRedirectURL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to discover the stub provider: %v", err)
+	}
+	server := newTestServerWithOIDC(provider)
+	defer server.db.Close()
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+
+	// start begins a login and returns the authorization URL and the state cookie.
+	start := func() (string, *http.Cookie) {
+		req, _ := http.NewRequest("GET", "/api/auth/oidc/login", nil)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusFound, rr.Body.String())
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Expected a state cookie, got %v", cookies)
+		}
+		return rr.Header().Get("Location"), cookies[0]
+	}
+	callback := func(query string, cookie *http.Cookie) (int, string) {
+		req, _ := http.NewRequest("GET", "/api/auth/oidc/callback?"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	// login signs in at the stub provider with the given claims and returns the user ID of the issued token.
+	login := func(claims jwt.MapClaims) (int, int64, string) {
+		authURL, cookie := start()
+		code, state := idp.authorize(t, authURL, claims)
+		status, body := callback(url.Values{"code": {code}, "state": {state}}.Encode(), cookie)
+		var tokens model.TokenResponse
+		json.Unmarshal([]byte(body), &tokens)
+		var tokenClaims model.Claims
+		jwt.NewParser().ParseUnverified(tokens.Token, &tokenClaims)
+		return status, tokenClaims.UserID, tokens.Token
+	}
+
+	// --- Test Cases ---
+	t.Run("Should return 404 when OIDC is not configured", func(t *testing.T) {
+		plain := newTestServer()
+		defer plain.db.Close()
+		req, _ := http.NewRequest("GET", "/api/auth/oidc/login", nil)
+		if rr := plain.executeRequest(req); rr.Code != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Should provision a new user with a verified email", func(t *testing.T) {
+		status, userID, token := login(jwt.MapClaims{"sub": "idp-1", "email": "newbie@example.com", "email_verified": true, "preferred_username": "newbie"})
+		if status != http.StatusOK || userID == 0 || userID == aliceID {
+			t.Fatalf("Expected a new user to be signed in, got %d (user %d)", status, userID)
+		}
+		groupID := createGroup(t, server, token, "Newbies")
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/groups/%d", groupID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var group model.GroupResponse
+		json.NewDecoder(server.executeRequest(req).Body).Decode(&group)
+		if len(group.Members) != 1 || group.Members[0].Username != "newbie" || group.Members[0].Email != "newbie@example.com" {
+			t.Errorf("Unexpected provisioned user: %+v", group.Members)
+		}
+		req, _ = http.NewRequest("POST", "/api/users/verify-email/send", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusConflict {
+			t.Errorf("Expected the email verified by the provider to be marked as verified, got %d", rr.Code)
+		}
+
+		if _, again, _ := login(jwt.MapClaims{"sub": "idp-1", "email": "newbie@example.com", "email_verified": true}); again != userID {
+			t.Errorf("Expected the same user on the next login, got %d want %d", again, userID)
+		}
+		req, _ = http.NewRequest("POST", "/api/users/login", bytes.NewBufferString(`{"email": "newbie@example.com", "password": ""}`))
+		if rr := server.executeRequest(req); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a provisioned user to have no password, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Should not link an existing user who has not verified the email", func(t *testing.T) {
+		if status, _, _ := login(jwt.MapClaims{"sub": "idp-2", "email": "alice@example.com", "email_verified": true}); status != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+		}
+		var linked int
+		server.db.QueryRow("SELECT count(*) FROM user_identities WHERE user_id = ?", aliceID).Scan(&linked)
+		if linked != 0 {
+			t.Errorf("Expected alice not to be linked, got %d identities", linked)
+		}
+	})
+
+	t.Run("Should link an existing user by verified email", func(t *testing.T) {
+		if _, err := server.db.Exec("UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = ?", aliceID); err != nil {
+			t.Fatalf("Failed to verify the email of alice: %v", err)
+		}
+		status, userID, _ := login(jwt.MapClaims{"sub": "idp-2", "email": "Alice@Example.com", "email_verified": true})
+		if status != http.StatusOK || userID != aliceID {
+			t.Errorf("Expected alice to be signed in, got %d (user %d)", status, userID)
+		}
+		// The link is kept even if the email changes at the provider.
+		status, userID, _ = login(jwt.MapClaims{"sub": "idp-2", "email": "alice@elsewhere.example", "email_verified": false})
+		if status != http.StatusOK || userID != aliceID {
+			t.Errorf("Expected the linked identity to sign in as alice, got %d (user %d)", status, userID)
+		}
+		loginUser(t, server, "alice@example.com", "password123")
+	})
+
+	t.Run("Should reject an unverified email for a new identity", func(t *testing.T) {
+		if status, _, _ := login(jwt.MapClaims{"sub": "idp-3", "email": "alice@example.com", "email_verified": false}); status != http.StatusForbidden {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+		}
+		if status, _, _ := login(jwt.MapClaims{"sub": "idp-3"}); status != http.StatusForbidden {
+			t.Errorf("Expected 403 without an email, got %d", status)
+		}
+	})
+
+	t.Run("Should choose a free username", func(t *testing.T) {
+		status, _, token := login(jwt.MapClaims{"sub": "idp-4", "email": "other.alice@example.com", "email_verified": true, "preferred_username": "alice"})
+		if status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		groupID := createGroup(t, server, token, "Others")
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/groups/%d", groupID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var group model.GroupResponse
+		json.NewDecoder(server.executeRequest(req).Body).Decode(&group)
+		if len(group.Members) != 1 || group.Members[0].Username != "alice2" {
+			t.Errorf("Expected the username alice2, got %+v", group.Members)
+		}
+	})
+
+	t.Run("Should not use a username with control characters", func(t *testing.T) {
+		status, _, token := login(jwt.MapClaims{"sub": "idp-6", "email": "crlf@example.com", "email_verified": true, "preferred_username": "x\r\nATTENDEE:mailto:evil@example.com"})
+		if status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		groupID := createGroup(t, server, token, "Control")
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/groups/%d", groupID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var group model.GroupResponse
+		json.NewDecoder(server.executeRequest(req).Body).Decode(&group)
+		if len(group.Members) != 1 || group.Members[0].Username != "crlf" {
+			t.Errorf("Expected the username crlf, got %+v", group.Members)
+		}
+	})
+
+	t.Run("Should require the second factor for users with two-factor authentication", func(t *testing.T) {
+		claims := jwt.MapClaims{"sub": "idp-5", "email": "mfa@example.com", "email_verified": true}
+		status, _, token := login(claims)
+		if status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		recoveryCode := enableTOTP(t, server, token)
+
+		authURL, cookie := start()
+		code, state := idp.authorize(t, authURL, claims)
+		status, body := callback(url.Values{"code": {code}, "state": {state}}.Encode(), cookie)
+		var challenge model.MFAChallengeResponse
+		json.Unmarshal([]byte(body), &challenge)
+		if status != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" || strings.Contains(body, `"token"`) {
+			t.Fatalf("Expected an MFA challenge instead of tokens, got %d: %s", status, body)
+		}
+
+		req, _ := http.NewRequest("POST", "/api/users/login/mfa", bytes.NewBufferString(fmt.Sprintf(`{"mfa_token": "%s", "code": "%s"}`, challenge.MFAToken, recoveryCode)))
+		if rr := server.executeRequest(req); rr.Code != http.StatusOK {
+			t.Errorf("Expected the login to complete with a recovery code, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Should reject invalid callbacks", func(t *testing.T) {
+		claims := jwt.MapClaims{"sub": "idp-1", "email": "newbie@example.com", "email_verified": true}
+
+		authURL, cookie := start()
+		code, state := idp.authorize(t, authURL, claims)
+		query := url.Values{"code": {code}, "state": {state}}.Encode()
+		if status, _ := callback(query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected 400 without the state cookie, got %d", status)
+		}
+		if status, _ := callback(url.Values{"code": {code}, "state": {"forged"}}.Encode(), &http.Cookie{Name: cookie.Name, Value: "forged"}); status != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown state, got %d", status)
+		}
+		if status, body := callback(query, cookie); status != http.StatusOK {
+			t.Errorf("Expected the login to succeed, got %d: %s", status, body)
+		}
+		if status, _ := callback(query, cookie); status != http.StatusBadRequest {
+			t.Errorf("Expected 400 when the state is reused, got %d", status)
+		}
+
+		authURL, cookie = start()
+		_, state = idp.authorize(t, authURL, claims)
+		if status, _ := callback(url.Values{"error": {"access_denied"}, "state": {state}}.Encode(), cookie); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 when the user denies the login, got %d", status)
+		}
+
+		authURL, cookie = start()
+		code, state = idp.authorize(t, authURL, jwt.MapClaims{"sub": "idp-1", "nonce": "replayed"})
+		if status, _ := callback(url.Values{"code": {code}, "state": {state}}.Encode(), cookie); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a nonce mismatch, got %d", status)
+		}
+
+		authURL, cookie = start()
+		code, state = idp.authorize(t, authURL, jwt.MapClaims{"sub": "idp-1", "aud": "another-client"})
+		if status, _ := callback(url.Values{"code": {code}, "state": {state}}.Encode(), cookie); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for an ID token issued to another client, got %d", status)
+		}
+
+		authURL, cookie = start()
+		_, state = idp.authorize(t, authURL, claims)
+		if status, _ := callback(url.Values{"code": {"unknown"}, "state": {state}}.Encode(), cookie); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 when the code exchange fails, got %d", status)
+		}
+	})
+}
+
+func TestLoginThrottle(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+
+	createUser(t, server, "alice", "alice@example.com", "password123")
+	createUser(t, server, "bob", "bob@example.com", "password123")
+
+	// login attempts a password login from the given client IP and returns the status and the Retry-After header.
+	login := func(router http.Handler, ip, email, password string, headers map[string]string) (int, string) {
+		req, _ := http.NewRequest("POST", "/api/users/login", bytes.NewBufferString(fmt.Sprintf(`{"email": "%s", "password": "%s"}`, email, password)))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":12345"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code, rr.Header().Get("Retry-After")
+	}
+	// expireLockouts ends all lockouts as if their duration had passed.
+	expireLockouts := func(t *testing.T) {
+		if _, err := server.db.Exec("UPDATE login_lockouts SET locked_until = ?", time.Now().Add(-time.Second).UTC()); err != nil {
+			t.Fatalf("Failed to expire lockouts: %v", err)
+		}
+	}
+
+	// --- Test Cases ---
+	t.Run("Should lock an account after repeated failures", func(t *testing.T) {
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountFailures; i++ {
+			if code, _ := login(server.router, "192.0.2.1", "alice@example.com", "wrong-password", nil); code != http.StatusUnauthorized {
+				t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, code)
+			}
+		}
+		// The account is locked even with the right password and from another IP
+		code, retryAfter := login(server.router, "192.0.2.2", "Alice@Example.com", "password123", nil)
+		if code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, code)
+		}
+		if seconds, _ := strconv.Atoi(retryAfter); seconds < 59 || seconds > 60 {
+			t.Errorf("Expected Retry-After of about 60 seconds, got %q", retryAfter)
+		}
+		if code, _ := login(server.router, "192.0.2.1", "bob@example.com", "password123", nil); code != http.StatusOK {
+			t.Errorf("Expected other accounts to be unaffected, got %d", code)
+		}
+
+		// The lockout is stored in the database and survives a restart
+		restarted := repository.NewLoginThrottleRepository(server.db, testLoginThrottlePolicy)
+		var throttled *model.LoginThrottledError
+		if err := restarted.Check("alice@example.com", ""); !errors.As(err, &throttled) {
+			t.Errorf("Expected the lockout to be persisted, got %v", err)
+		}
+	})
+
+	t.Run("Should double the lockout for consecutive lockouts", func(t *testing.T) {
+		expireLockouts(t)
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountFailures; i++ {
+			login(server.router, "192.0.2.3", "alice@example.com", "wrong-password", nil)
+		}
+		code, retryAfter := login(server.router, "192.0.2.3", "alice@example.com", "password123", nil)
+		if seconds, _ := strconv.Atoi(retryAfter); code != http.StatusTooManyRequests || seconds < 119 || seconds > 120 {
+			t.Errorf("Expected 429 with Retry-After of about 120 seconds, got %d %q", code, retryAfter)
+		}
+
+		// A successful login resets the backoff
+		expireLockouts(t)
+		if code, _ := login(server.router, "192.0.2.3", "alice@example.com", "password123", nil); code != http.StatusOK {
+			t.Fatalf("Expected login to succeed after the lockout, got %d", code)
+		}
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountFailures; i++ {
+			login(server.router, "192.0.2.4", "alice@example.com", "wrong-password", nil)
+		}
+		if _, retryAfter := login(server.router, "192.0.2.4", "alice@example.com", "password123", nil); retryAfter != "60" {
+			t.Errorf("Expected the backoff to restart at 60 seconds, got %q", retryAfter)
+		}
+		expireLockouts(t)
+	})
+
+	t.Run("Should lock a client IP that tries many accounts", func(t *testing.T) {
+		for i := 0; i < testLoginThrottlePolicy.MaxIPFailures; i++ {
+			login(server.router, "198.51.100.7", fmt.Sprintf("user%d@example.com", i), "wrong-password", nil)
+		}
+		if code, retryAfter := login(server.router, "198.51.100.7", "bob@example.com", "password123", nil); code != http.StatusTooManyRequests || retryAfter == "" {
+			t.Errorf("Expected 429 with Retry-After for the locked IP, got %d %q", code, retryAfter)
+		}
+		if code, _ := login(server.router, "198.51.100.8", "bob@example.com", "password123", nil); code != http.StatusOK {
+			t.Errorf("Expected other IPs to be unaffected, got %d", code)
+		}
+	})
+
+	t.Run("Should use the forwarded client IP behind a trusted proxy", func(t *testing.T) {
+		proxied := middleware.TrustProxyHeaders(server.router)
+		for i := 0; i < testLoginThrottlePolicy.MaxIPFailures; i++ {
+			forwarded := map[string]string{"X-Forwarded-For": fmt.Sprintf("10.0.0.%d, 203.0.113.9", i)}
+			login(proxied, "192.0.2.100", fmt.Sprintf("proxied%d@example.com", i), "wrong-password", forwarded)
+		}
+		if code, _ := login(proxied, "192.0.2.100", "bob@example.com", "password123", map[string]string{"X-Forwarded-For": "203.0.113.9"}); code != http.StatusTooManyRequests {
+			t.Errorf("Expected the forwarded IP to be locked, got %d", code)
+		}
+		if code, _ := login(proxied, "192.0.2.100", "bob@example.com", "password123", map[string]string{"X-Forwarded-For": "203.0.113.10"}); code != http.StatusOK {
+			t.Errorf("Expected other clients behind the proxy to be unaffected, got %d", code)
+		}
+	})
+
+	t.Run("Should throttle Basic authentication", func(t *testing.T) {
+		createUser(t, server, "carol", "carol@example.com", "password123")
+		propfind := func(password string) (int, string) {
+			req, _ := http.NewRequest("PROPFIND", "/caldav/", nil)
+			req.SetBasicAuth("carol@example.com", password)
+			rr := server.executeRequest(req)
+			return rr.Code, rr.Header().Get("Retry-After")
+		}
+		for i := 0; i < testLoginThrottlePolicy.MaxAccountFailures; i++ {
+			if code, _ := propfind("wrong-password"); code != http.StatusUnauthorized {
+				t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, code)
+			}
+		}
+		if code, retryAfter := propfind("password123"); code != http.StatusTooManyRequests || retryAfter == "" {
+			t.Errorf("Expected 429 with Retry-After, got %d %q", code, retryAfter)
+		}
+	})
+
+	t.Run("Should audit Basic authentication only when it resets failures", func(t *testing.T) {
+		expireLockouts(t)
+		successes := func() int {
+			var n int
+			server.db.QueryRow("SELECT COUNT(*) FROM login_audit_log WHERE event = ? AND email = ?", model.LoginAuditSuccess, "carol@example.com").Scan(&n)
+			return n
+		}
+		propfind := func(password string) int {
+			req, _ := http.NewRequest("PROPFIND", "/caldav/", bytes.NewBufferString(""))
+			req.SetBasicAuth("carol@example.com", password)
+			return server.executeRequest(req).Code
+		}
+
+		before := successes()
+		for i := 0; i < 3; i++ {
+			if code := propfind("password123"); code != http.StatusMultiStatus {
+				t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusMultiStatus, code)
+			}
+		}
+		if n := successes() - before; n != 1 {
+			t.Errorf("Expected one success to reset the lockout, got %d", n)
+		}
+
+		propfind("wrong-password")
+		propfind("password123")
+		propfind("password123")
+		if n := successes() - before; n != 2 {
+			t.Errorf("Expected one more success after a failure, got %d", n)
+		}
+	})
+
+	t.Run("Should prune old audit entries on successful logins", func(t *testing.T) {
+		if _, err := server.db.Exec("INSERT INTO login_audit_log (event, email, ip, created_at) VALUES (?, 'old@example.com', '', '2000-01-01 00:00:00')", model.LoginAuditSuccess); err != nil {
+			t.Fatalf("Failed to insert an old audit entry: %v", err)
+		}
+		loginUser(t, server, "bob@example.com", "password123")
+		var old int
+		server.db.QueryRow("SELECT COUNT(*) FROM login_audit_log WHERE email = 'old@example.com'").Scan(&old)
+		if old != 0 {
+			t.Errorf("Expected old audit entries to be pruned, got %d", old)
+		}
+	})
+
+	t.Run("Should record login attempts in the audit log", func(t *testing.T) {
+		createUser(t, server, "admin", "admin@example.com", "password123")
+		token := loginUser(t, server, "admin@example.com", "password123")
+		req, _ := http.NewRequest("POST", "/api/bootstrap/admin", bytes.NewBufferString(fmt.Sprintf(`{"token": "%s"}`, testBootstrapToken)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusOK {
+			t.Fatalf("Failed to bootstrap admin: %s", rr.Body.String())
+		}
+		adminToken := loginUser(t, server, "admin@example.com", "password123")
+
+		req, _ = http.NewRequest("GET", "/api/admin/login-audit?limit=1000", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := server.executeRequest(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var entries []model.LoginAuditEntry
+		json.NewDecoder(rr.Body).Decode(&entries)
+		events := map[model.LoginAuditEvent]int{}
+		for _, e := range entries {
+			events[e.Event]++
+			if e.Event == model.LoginAuditLockout && e.Detail == "" {
+				t.Errorf("Expected lockout entries to describe the lockout: %+v", e)
+			}
+		}
+		for _, event := range []model.LoginAuditEvent{model.LoginAuditSuccess, model.LoginAuditFailure, model.LoginAuditLockout, model.LoginAuditBlocked} {
+			if events[event] == 0 {
+				t.Errorf("Expected %q entries in the audit log, got %v", event, events)
+			}
+		}
+		if len(entries) > 0 && (entries[0].Event != model.LoginAuditSuccess || entries[0].Email != "admin@example.com") {
+			t.Errorf("Expected the newest entry first, got %+v", entries[0])
+		}
+
+		req, _ = http.NewRequest("GET", "/api/admin/login-audit?limit=0", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if rr := server.executeRequest(req); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected an invalid limit to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		req, _ = http.NewRequest("GET", "/api/admin/login-audit", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if rr := server.executeRequest(req); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected non-admins to get %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
 }
\ No newline at end of file
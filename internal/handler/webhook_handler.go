@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"schedule-app/internal/middleware"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"strings"
+)
+
+// defaultWebhookDeliveryLimit と maxWebhookDeliveryLimit は配信の一覧の件数です。
+const (
+	defaultWebhookDeliveryLimit = 20
+	maxWebhookDeliveryLimit     = 100
+)
+
+// WebhookHandler は webhook の購読の登録・一覧・削除と、配信の一覧・再送信を処理します。
+// scope が user の場合はログイン中のユーザーが登録した購読のみを扱い、all の場合はすべての管理者の購読を扱います
+// (all のルーティングには RequireRole で admin ロールを必須にします)。
+type WebhookHandler struct {
+	webhookRepo *repository.WebhookRepository
+	scope       model.WebhookScope
+}
+
+// NewWebhookHandler は scope の購読を扱う WebhookHandler の新しいインスタンスを生成します。
+func NewWebhookHandler(webhookRepo *repository.WebhookRepository, scope model.WebhookScope) *WebhookHandler {
+	return &WebhookHandler{webhookRepo: webhookRepo, scope: scope}
+}
+
+// ListWebhooks は購読の一覧を返します。署名の鍵は含みません。
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subs, err := h.webhookRepo.FindByScope(h.scope, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get webhooks of user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// CreateWebhook は URL と受信するイベントの種類を指定して購読を登録します。署名の鍵はこの応答でのみ確認できます。
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req model.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// 入力値のバリデーション
+	req.URL = strings.TrimSpace(req.URL)
+	if !validWebhookURL(req.URL) {
+		errorJSON(w, http.StatusBadRequest, fmt.Sprintf("url must be an http or https URL of at most %d characters", maxWebhookURLLength))
+		return
+	}
+	seen := make(map[model.ScheduleEventType]bool)
+	eventTypes := []model.ScheduleEventType{}
+	for _, t := range req.EventTypes {
+		if !t.Valid() {
+			errorJSON(w, http.StatusBadRequest, fmt.Sprintf("Invalid event type %q: must be schedule.created, schedule.updated or schedule.deleted", t))
+			return
+		}
+		if !seen[t] {
+			seen[t] = true
+			eventTypes = append(eventTypes, t)
+		}
+	}
+
+	sub := &model.WebhookSubscription{UserID: userID, Scope: h.scope, URL: req.URL, EventTypes: eventTypes}
+	if err := h.webhookRepo.Create(sub); err != nil {
+		log.Printf("ERROR: Failed to create webhook for user %d: %v", userID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	writeJSON(w, http.StatusCreated, &model.CreateWebhookResponse{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// DeleteWebhook は購読と、その配信・送信ログを削除します。
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookRepo.Delete(sub.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			log.Printf("ERROR: Failed to delete webhook %d: %v", sub.ID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to delete webhook")
+		}
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// ListDeliveries は購読の配信を新しい順に、送信ログとともに返します。クエリパラメータ limit で件数を指定します。
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultWebhookDeliveryLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxWebhookDeliveryLimit {
+			errorJSON(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhookRepo.Deliveries(sub.ID, limit)
+	if err != nil {
+		log.Printf("ERROR: Failed to get deliveries of webhook %d: %v", sub.ID, err)
+		errorJSON(w, http.StatusInternalServerError, "Failed to retrieve deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// Redeliver は送信済みまたは失敗した配信を、すぐに再送信するようキューに戻します。
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findWebhook(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(r.PathValue("deliveryID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	if err := h.webhookRepo.Redeliver(sub.ID, deliveryID); err != nil {
+		if errors.Is(err, repository.ErrDeliveryPending) {
+			errorJSON(w, http.StatusConflict, "Delivery is still pending")
+		} else if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Delivery not found")
+		} else {
+			log.Printf("ERROR: Failed to redeliver webhook delivery %d: %v", deliveryID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to redeliver")
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, nil)
+}
+
+// findWebhook はパスの webhookID の購読を取得します。
+// 購読がハンドラの scope でない場合と、scope が user で他のユーザーの購読の場合は 404 を返します。
+func (h *WebhookHandler) findWebhook(w http.ResponseWriter, r *http.Request) (*model.WebhookSubscription, bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		errorJSON(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+	webhookID, err := strconv.ParseInt(r.PathValue("webhookID"), 10, 64)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "Invalid webhook ID")
+		return nil, false
+	}
+
+	sub, err := h.webhookRepo.FindByID(webhookID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			errorJSON(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			log.Printf("ERROR: Failed to get webhook %d: %v", webhookID, err)
+			errorJSON(w, http.StatusInternalServerError, "Failed to retrieve webhook")
+		}
+		return nil, false
+	}
+	if sub.Scope != h.scope || (h.scope == model.WebhookScopeUser && sub.UserID != userID) {
+		errorJSON(w, http.StatusNotFound, "Webhook not found")
+		return nil, false
+	}
+	return sub, true
+}
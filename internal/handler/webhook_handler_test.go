@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"schedule-app/internal/model"
+	"schedule-app/internal/webhook"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the webhook requests it receives and answers them with a configurable status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*receivedWebhook
+}
+
+// receivedWebhook is a webhook request recorded by webhookReceiver.
+type receivedWebhook struct {
+	header  http.Header
+	body    []byte
+	payload model.WebhookPayload
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	received := &receivedWebhook{header: r.Header, body: body}
+	json.Unmarshal(body, &received.payload)
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.requests = append(wr.requests, received)
+	w.WriteHeader(wr.status)
+}
+
+// respond sets the status of the following responses.
+func (wr *webhookReceiver) respond(status int) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.status = status
+}
+
+// received returns the requests received since the last call.
+func (wr *webhookReceiver) received() []*receivedWebhook {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	requests := wr.requests
+	wr.requests = nil
+	return requests
+}
+
+func TestWebhooks(t *testing.T) {
+	// --- Test Setup ---
+	server := newTestServer()
+	defer server.db.Close()
+	receiver := &webhookReceiver{status: http.StatusOK}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+	// Run the workers ahead of the wall clock so that newly queued deliveries are due immediately.
+	server.clock.Set(time.Now().Add(time.Hour))
+
+	aliceID := createUser(t, server, "alice", "alice@example.com", "password123")
+	bobID := createUser(t, server, "bob", "bob@example.com", "password123")
+	createUser(t, server, "admin", "admin@example.com", "password123")
+	aliceToken := loginUser(t, server, "alice@example.com", "password123")
+	bobToken := loginUser(t, server, "bob@example.com", "password123")
+	adminToken := loginUser(t, server, "admin@example.com", "password123")
+
+	send := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := server.executeRequest(req)
+		return rr.Code, rr.Body.String()
+	}
+	if code, body := send("POST", "/api/bootstrap/admin", adminToken, fmt.Sprintf(`{"token": "%s"}`, testBootstrapToken)); code != http.StatusOK {
+		t.Fatalf("Failed to bootstrap admin: %s", body)
+	}
+	adminToken = loginUser(t, server, "admin@example.com", "password123")
+
+	runWebhooks := func(t *testing.T, advance time.Duration) int {
+		t.Helper()
+		server.clock.Advance(advance)
+		sent, err := server.webhooks.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to send webhooks: %v", err)
+		}
+		return sent
+	}
+	deliveries := func(t *testing.T, path, token string) []*model.WebhookDelivery {
+		t.Helper()
+		code, body := send("GET", path+"/deliveries", token, "")
+		if code != http.StatusOK {
+			t.Fatalf("Failed to list deliveries: %d %s", code, body)
+		}
+		var list []*model.WebhookDelivery
+		json.Unmarshal([]byte(body), &list)
+		return list
+	}
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	scheduleBody := func(title string, ownerID int64) string {
+		return fmt.Sprintf(`{"title": %q, "start_time": "%s", "end_time": "%s", "owner_id": %d, "allow_conflicts": true}`,
+			title, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), ownerID)
+	}
+
+	var aliceSecret, alicePath, adminPath string
+	var aliceScheduleID int64
+
+	// --- Test Cases ---
+	t.Run("Should register webhooks", func(t *testing.T) {
+		for _, body := range []string{
+			`{"url": "ftp://example.com/hook"}`,
+			`{"url": "not a url"}`,
+			fmt.Sprintf(`{"url": %q, "event_types": ["schedule.moved"]}`, receiverServer.URL),
+		} {
+			if code, _ := send("POST", "/api/webhooks", aliceToken, body); code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, code)
+			}
+		}
+
+		code, body := send("POST", "/api/webhooks", aliceToken, fmt.Sprintf(`{"url": %q, "event_types": ["schedule.created", "schedule.deleted", "schedule.created"]}`, receiverServer.URL))
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to create webhook: %d %s", code, body)
+		}
+		var created model.CreateWebhookResponse
+		json.Unmarshal([]byte(body), &created)
+		if !strings.HasPrefix(created.Secret, "whsec_") || created.Scope != model.WebhookScopeUser || len(created.EventTypes) != 2 {
+			t.Fatalf("Unexpected webhook: %s", body)
+		}
+		aliceSecret, alicePath = created.Secret, fmt.Sprintf("/api/webhooks/%d", created.ID)
+
+		code, body = send("GET", "/api/webhooks", aliceToken, "")
+		if code != http.StatusOK || !strings.Contains(body, receiverServer.URL) || strings.Contains(body, aliceSecret) {
+			t.Errorf("Expected the webhook to be listed without its secret, got %d %s", code, body)
+		}
+		if _, body := send("GET", "/api/webhooks", bobToken, ""); strings.TrimSpace(body) != "[]" {
+			t.Errorf("Expected bob to have no webhooks, got %s", body)
+		}
+		if code, _ := send("GET", alicePath+"/deliveries", bobToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected other users' webhooks to be %d, got %d", http.StatusNotFound, code)
+		}
+
+		// Admin webhooks receive every change and are separate from user webhooks.
+		if code, _ := send("POST", "/api/admin/webhooks", aliceToken, fmt.Sprintf(`{"url": %q}`, receiverServer.URL)); code != http.StatusForbidden {
+			t.Errorf("Expected non-admins to get %d, got %d", http.StatusForbidden, code)
+		}
+		code, body = send("POST", "/api/admin/webhooks", adminToken, fmt.Sprintf(`{"url": %q}`, receiverServer.URL))
+		if code != http.StatusCreated {
+			t.Fatalf("Failed to create admin webhook: %d %s", code, body)
+		}
+		json.Unmarshal([]byte(body), &created)
+		if created.Scope != model.WebhookScopeAll {
+			t.Errorf("Expected an admin webhook, got %s", body)
+		}
+		adminPath = fmt.Sprintf("/api/admin/webhooks/%d", created.ID)
+		if code, _ := send("GET", strings.TrimPrefix(adminPath, "/api/admin")+"/deliveries", adminToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected admin webhooks to be hidden from the user endpoints, got %d", code)
+		}
+	})
+
+	t.Run("Should deliver signed changes of visible calendars", func(t *testing.T) {
+		createSchedule(t, server, bobToken, scheduleBody("Bob's schedule", bobID))
+		aliceScheduleID = createSchedule(t, server, aliceToken, scheduleBody("Planning", aliceID))
+		if code, body := send("PUT", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, `{"title": "Planning v2"}`); code != http.StatusOK {
+			t.Fatalf("Failed to update schedule: %s", body)
+		}
+
+		// alice: her schedule's creation (updates are filtered out); admin: all three changes
+		if sent := runWebhooks(t, 0); sent != 4 {
+			t.Fatalf("Expected 4 webhooks to be sent, got %d", sent)
+		}
+		requests := receiver.received()
+		signedForAlice := 0
+		for _, req := range requests {
+			timestamp, _ := strconv.ParseInt(req.header.Get(webhook.HeaderTimestamp), 10, 64)
+			if req.header.Get(webhook.HeaderSignature) == webhook.Sign(aliceSecret, timestamp, req.body) {
+				signedForAlice++
+				if req.payload.Type != model.EventScheduleCreated || req.payload.Data.ScheduleID != aliceScheduleID ||
+					req.header.Get(webhook.HeaderEvent) != string(model.EventScheduleCreated) || req.payload.ID == "" {
+					t.Errorf("Unexpected webhook for alice: %s", req.body)
+				}
+			}
+		}
+		if len(requests) != 4 || signedForAlice != 1 {
+			t.Errorf("Expected 4 requests with 1 signed for alice, got %d with %d", len(requests), signedForAlice)
+		}
+		if runWebhooks(t, time.Hour) != 0 || len(receiver.received()) != 0 {
+			t.Errorf("Expected sent webhooks not to be sent again")
+		}
+
+		list := deliveries(t, alicePath, aliceToken)
+		if len(list) != 1 || list[0].Status != model.WebhookSucceeded || list[0].Attempts != 1 || list[0].NextAttemptAt != nil ||
+			len(list[0].AttemptLog) != 1 || *list[0].AttemptLog[0].StatusCode != http.StatusOK {
+			t.Errorf("Unexpected deliveries: %+v", list)
+		}
+	})
+
+	t.Run("Should not save changes whose deliveries cannot be queued", func(t *testing.T) {
+		if _, err := server.db.Exec(`CREATE TRIGGER fail_webhook_deliveries BEFORE INSERT ON webhook_deliveries
+			BEGIN SELECT RAISE(ABORT, 'queue unavailable'); END`); err != nil {
+			t.Fatalf("Failed to create trigger: %v", err)
+		}
+		code, _ := send("PUT", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, `{"title": "Planning v3"}`)
+		if _, err := server.db.Exec("DROP TRIGGER fail_webhook_deliveries"); err != nil {
+			t.Fatalf("Failed to drop trigger: %v", err)
+		}
+		if code != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, code)
+		}
+		if _, body := send("GET", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, ""); !strings.Contains(body, "Planning v2") {
+			t.Errorf("Expected the update to be rolled back, got %s", body)
+		}
+	})
+
+	t.Run("Should retry failed deliveries with backoff", func(t *testing.T) {
+		receiver.respond(http.StatusInternalServerError)
+		if code, _ := send("DELETE", fmt.Sprintf("/api/schedules/%d", aliceScheduleID), aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Failed to delete schedule: %d", code)
+		}
+
+		if sent := runWebhooks(t, 0); sent != 0 || len(receiver.received()) != 2 {
+			t.Fatalf("Expected 2 failed attempts, got %d sent", sent)
+		}
+		d := deliveries(t, alicePath, aliceToken)[0]
+		if d.Status != model.WebhookPending || d.Attempts != 1 || d.AttemptLog[0].Error == "" ||
+			d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(server.clock.Now().Add(webhook.Backoff(1))) {
+			t.Fatalf("Unexpected delivery after a failure: %+v", d)
+		}
+		if runWebhooks(t, webhook.Backoff(1)-time.Second); len(receiver.received()) != 0 {
+			t.Errorf("Expected no retry before the backoff")
+		}
+		if runWebhooks(t, time.Second); len(receiver.received()) != 2 {
+			t.Errorf("Expected a retry after the backoff")
+		}
+
+		receiver.respond(http.StatusOK)
+		if sent := runWebhooks(t, webhook.Backoff(2)); sent != 2 || len(receiver.received()) != 2 {
+			t.Errorf("Expected the retries to succeed, got %d", sent)
+		}
+		d = deliveries(t, alicePath, aliceToken)[0]
+		if d.Status != model.WebhookSucceeded || d.EventType != model.EventScheduleDeleted || d.Attempts != 3 || len(d.AttemptLog) != 3 {
+			t.Errorf("Unexpected delivery after the retries: %+v", d)
+		}
+	})
+
+	t.Run("Should give up after the maximum attempts", func(t *testing.T) {
+		receiver.respond(http.StatusBadGateway)
+		createSchedule(t, server, aliceToken, scheduleBody("Retro", aliceID))
+		for i := 0; i < model.MaxWebhookAttempts+1; i++ {
+			runWebhooks(t, time.Hour)
+		}
+		if got := len(receiver.received()); got != 2*model.MaxWebhookAttempts {
+			t.Errorf("Expected %d attempts, got %d", 2*model.MaxWebhookAttempts, got)
+		}
+		d := deliveries(t, alicePath, aliceToken)[0]
+		if d.Status != model.WebhookFailed || d.Attempts != model.MaxWebhookAttempts || d.NextAttemptAt != nil {
+			t.Errorf("Expected the delivery to fail, got %+v", d)
+		}
+	})
+
+	t.Run("Should redeliver manually", func(t *testing.T) {
+		receiver.respond(http.StatusOK)
+		d := deliveries(t, adminPath, adminToken)[0]
+		redeliver := fmt.Sprintf("%s/deliveries/%d/redeliver", adminPath, d.ID)
+		if code, _ := send("POST", fmt.Sprintf("%s/deliveries/%d/redeliver", alicePath, d.ID), aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected deliveries of other webhooks to be %d, got %d", http.StatusNotFound, code)
+		}
+		if code, body := send("POST", redeliver, adminToken, ""); code != http.StatusAccepted {
+			t.Fatalf("Failed to redeliver: %d %s", code, body)
+		}
+		if code, _ := send("POST", redeliver, adminToken, ""); code != http.StatusConflict {
+			t.Errorf("Expected pending deliveries to be %d, got %d", http.StatusConflict, code)
+		}
+
+		if sent := runWebhooks(t, 0); sent != 1 {
+			t.Fatalf("Expected the redelivery to be sent, got %d", sent)
+		}
+		if req := receiver.received()[0]; req.header.Get(webhook.HeaderID) != strconv.FormatInt(d.ID, 10) {
+			t.Errorf("Expected the same delivery ID, got %s", req.header.Get(webhook.HeaderID))
+		}
+		d = deliveries(t, adminPath, adminToken)[0]
+		if d.Status != model.WebhookSucceeded || d.Attempts != 1 || len(d.AttemptLog) != model.MaxWebhookAttempts+1 {
+			t.Errorf("Unexpected delivery after the redelivery: %+v", d)
+		}
+	})
+
+	t.Run("Should delete webhooks", func(t *testing.T) {
+		if code, _ := send("DELETE", alicePath, bobToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected other users' webhooks to be %d, got %d", http.StatusNotFound, code)
+		}
+		if code, _ := send("DELETE", alicePath, aliceToken, ""); code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+		if code, _ := send("GET", alicePath+"/deliveries", aliceToken, ""); code != http.StatusNotFound {
+			t.Errorf("Expected the webhook to be deleted, got %d", code)
+		}
+		createSchedule(t, server, aliceToken, scheduleBody("After", aliceID))
+		if sent := runWebhooks(t, 0); sent != 1 {
+			t.Errorf("Expected only the admin webhook to be sent, got %d", sent)
+		}
+	})
+}
+
+func TestWebhookClient(t *testing.T) {
+	// --- Test Setup ---
+	receiver := &webhookReceiver{status: http.StatusOK}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+	client := webhook.NewClient(5 * time.Second)
+
+	// --- Test Cases ---
+	t.Run("Should refuse internal addresses", func(t *testing.T) {
+		_, port, _ := strings.Cut(strings.TrimPrefix(receiverServer.URL, "http://"), ":")
+		urls := []string{
+			receiverServer.URL,
+			"http://localhost:" + port + "/hook",
+			"http://[::1]:" + port + "/hook",
+			"http://10.0.0.1/hook",
+			"http://192.168.1.1/hook",
+			"http://169.254.169.254/latest/meta-data/",
+			"http://[fe80::1]/hook",
+			"http://[fd00::1]/hook",
+			"http://100.64.0.1/hook",
+			"http://0.0.0.0:" + port + "/hook",
+			"http://[::ffff:127.0.0.1]:" + port + "/hook",
+		}
+		for _, u := range urls {
+			resp, err := client.Post(u, "application/json", strings.NewReader("{}"))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, webhook.ErrForbiddenAddress) {
+				t.Errorf("%s: expected ErrForbiddenAddress, got %v", u, err)
+			}
+		}
+		if requests := receiver.received(); len(requests) != 0 {
+			t.Errorf("Expected no requests to reach the loopback receiver, got %d", len(requests))
+		}
+	})
+
+	t.Run("Should not follow redirects", func(t *testing.T) {
+		if client.CheckRedirect == nil || client.CheckRedirect(nil, nil) != http.ErrUseLastResponse {
+			t.Error("Expected the client to return redirect responses instead of following them")
+		}
+	})
+}
@@ -0,0 +1,387 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // TZID で指定されたタイムゾーンを解決するため
+)
+
+// Property は解析済みのコンテンツ行 (name;params:value) を表します。
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Decode は iCalendar 形式のデータを解析し、VEVENT を含むカレンダーを返します。
+// VEVENT 以外のコンポーネント (VTODO など) と VEVENT 内の VALARM は無視します。
+// VTIMEZONE は、IANA のタイムゾーン名でない TZID を固定オフセットのタイムゾーンとして解決するためにのみ使用します。
+// 個々の VEVENT の解析エラーは EventError として errs に含まれ、解析は続行されます。
+func Decode(r io.Reader) (cal *Calendar, errs []*EventError, err error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cal = &Calendar{}
+	var stack []string
+	var props []*Property
+	// VTIMEZONE は VEVENT の後に置かれることもあるため、VEVENT はすべて読み終えてから解析する
+	var events [][]*Property
+	zones := map[string]*time.Location{}
+	var tzid string
+	var offsets map[int]bool
+	var tzInvalid bool
+	for _, line := range lines {
+		prop, err := parseContentLine(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			name := strings.ToUpper(prop.Value)
+			stack = append(stack, name)
+			switch {
+			case name == "VEVENT" && len(stack) == 2:
+				props = nil
+			case name == "VTIMEZONE" && len(stack) == 2:
+				tzid, offsets, tzInvalid = "", map[int]bool{}, false
+			}
+			continue
+		case "END":
+			name := strings.ToUpper(prop.Value)
+			if len(stack) == 0 || stack[len(stack)-1] != name {
+				return nil, nil, fmt.Errorf("unexpected END:%s", prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+			switch {
+			case name == "VEVENT" && len(stack) == 1:
+				events = append(events, props)
+			case name == "VTIMEZONE" && len(stack) == 1:
+				// 夏時間のあるタイムゾーンは規則を解釈しないため、オフセットが1つのものだけを使用する
+				if tzid != "" && !tzInvalid && len(offsets) == 1 {
+					for offset := range offsets {
+						zones[tzid] = time.FixedZone(tzid, offset)
+					}
+				}
+			}
+			continue
+		}
+
+		switch {
+		case len(stack) == 1 && stack[0] == "VCALENDAR":
+			switch prop.Name {
+			case "METHOD":
+				cal.Method = strings.ToUpper(prop.Value)
+			case "X-WR-CALNAME":
+				cal.Name = unescapeText(prop.Value)
+			}
+		case len(stack) == 2 && stack[1] == "VEVENT":
+			props = append(props, prop)
+		case len(stack) == 2 && stack[1] == "VTIMEZONE" && prop.Name == "TZID":
+			tzid = prop.Value
+		case len(stack) == 3 && stack[1] == "VTIMEZONE" && prop.Name == "TZOFFSETTO":
+			offset, err := parseUTCOffset(prop.Value)
+			if err != nil {
+				// 解釈できないタイムゾーンは定義されていないものとして扱う
+				tzInvalid = true
+				continue
+			}
+			offsets[offset] = true
+		}
+	}
+	if len(stack) != 0 {
+		return nil, nil, fmt.Errorf("unterminated component %s", stack[len(stack)-1])
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, nil, fmt.Errorf("not an iCalendar object")
+	}
+	for index, props := range events {
+		ev, err := parseEvent(props, zones)
+		if err != nil {
+			errs = append(errs, &EventError{Index: index, UID: findValue(props, "UID"), Summary: unescapeText(findValue(props, "SUMMARY")), Err: err})
+			continue
+		}
+		cal.Events = append(cal.Events, ev)
+	}
+	return cal, errs, nil
+}
+
+// EventError は個々の VEVENT の解析エラーを表します。
+type EventError struct {
+	// Index はカレンダー内での VEVENT の出現順 (0始まり) です。
+	Index   int
+	UID     string
+	Summary string
+	Err     error
+}
+
+func (e *EventError) Error() string {
+	return fmt.Sprintf("event %d (%s): %v", e.Index, e.UID, e.Err)
+}
+
+// unfoldLines は折り返された行を結合し、空行を除いた行のリストを返します。
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// parseContentLine は "NAME;PARAM=VALUE:value" 形式の行を解析します。
+// 引用符で囲まれたパラメータ値に含まれる ":" や ";" を正しく扱います。
+func parseContentLine(line string) (*Property, error) {
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return nil, fmt.Errorf("invalid content line %q", line)
+	}
+
+	prop := &Property{Params: map[string]string{}, Value: line[colon+1:]}
+	head := splitQuoted(line[:colon], ';')
+	prop.Name = strings.ToUpper(head[0])
+	for _, p := range head[1:] {
+		key, value, _ := strings.Cut(p, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// splitQuoted は二重引用符の外側にある sep で文字列を分割します。
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range s {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == sep && !inQuotes {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func findValue(props []*Property, name string) string {
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// parseEvent は VEVENT のプロパティから Event を組み立てます。zones は VTIMEZONE で定義された TZID です。
+func parseEvent(props []*Property, zones map[string]*time.Location) (*Event, error) {
+	ev := &Event{}
+	var duration *time.Duration
+	var startIsDate bool
+	for _, p := range props {
+		var err error
+		switch p.Name {
+		case "UID":
+			ev.UID = p.Value
+		case "DTSTAMP":
+			ev.DTStamp, _, err = parseDateTime(p, zones)
+		case "DTSTART":
+			ev.Start, startIsDate, err = parseDateTime(p, zones)
+		case "DTEND":
+			ev.End, _, err = parseDateTime(p, zones)
+		case "DURATION":
+			var d time.Duration
+			d, err = parseDuration(p.Value)
+			duration = &d
+		case "RECURRENCE-ID":
+			var t time.Time
+			t, _, err = parseDateTime(p, zones)
+			ev.RecurrenceID = &t
+		case "SUMMARY":
+			ev.Summary = unescapeText(p.Value)
+		case "DESCRIPTION":
+			ev.Description = unescapeText(p.Value)
+		case "LOCATION":
+			ev.Location = unescapeText(p.Value)
+		case "STATUS":
+			ev.Status = strings.ToUpper(p.Value)
+		case "SEQUENCE":
+			ev.Sequence, err = strconv.Atoi(p.Value)
+		case "RRULE":
+			ev.RRule = p.Value
+		case "EXDATE":
+			for _, v := range strings.Split(p.Value, ",") {
+				var t time.Time
+				t, _, err = parseDateTime(&Property{Name: p.Name, Params: p.Params, Value: v}, zones)
+				if err != nil {
+					break
+				}
+				ev.ExDates = append(ev.ExDates, t)
+			}
+		case "ORGANIZER":
+			ev.Organizer = parseAttendee(p)
+		case "ATTENDEE":
+			ev.Attendees = append(ev.Attendees, parseAttendee(p))
+		case "CREATED":
+			ev.Created, _, err = parseDateTime(p, zones)
+		case "LAST-MODIFIED":
+			ev.LastModified, _, err = parseDateTime(p, zones)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", p.Name, err)
+		}
+	}
+
+	if ev.UID == "" {
+		return nil, fmt.Errorf("UID is required")
+	}
+	if ev.Start.IsZero() {
+		return nil, fmt.Errorf("DTSTART is required")
+	}
+	if ev.End.IsZero() {
+		switch {
+		case duration != nil:
+			ev.End = ev.Start.Add(*duration)
+		case startIsDate:
+			// 終日の予定で DTEND がない場合は1日間 (RFC 5545 3.6.1)
+			ev.End = ev.Start.AddDate(0, 0, 1)
+		default:
+			ev.End = ev.Start
+		}
+	}
+	if ev.End.Before(ev.Start) {
+		return nil, fmt.Errorf("DTEND is before DTSTART")
+	}
+	return ev, nil
+}
+
+// parseAttendee は "mailto:" で始まる CAL-ADDRESS を解析します。
+func parseAttendee(p *Property) *Attendee {
+	email := p.Value
+	if len(email) >= 7 && strings.EqualFold(email[:7], "mailto:") {
+		email = email[7:]
+	}
+	return &Attendee{
+		Email:    strings.TrimSpace(email),
+		Name:     p.Params["CN"],
+		PartStat: strings.ToUpper(p.Params["PARTSTAT"]),
+		RSVP:     strings.EqualFold(p.Params["RSVP"], "TRUE"),
+	}
+}
+
+// parseDateTime は DATE-TIME または DATE 型の値を解析します。
+// TZID パラメータがあればそのタイムゾーン (IANA の名前でなければ zones で定義されたもの)、
+// フローティング時刻は UTC として扱います。
+// 2番目の戻り値は値が DATE 型 (終日) であるかを表します。
+func parseDateTime(p *Property, zones map[string]*time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(p.Value)
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		} else if l, ok := zones[tzid]; ok {
+			loc = l
+		}
+	}
+
+	if strings.EqualFold(p.Params["VALUE"], "DATE") || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// utcOffsetPattern は UTC-OFFSET 型の値 (RFC 5545 3.3.14) に一致します。
+var utcOffsetPattern = regexp.MustCompile(`^([+-])(\d{2})(\d{2})(\d{2})?$`)
+
+// parseUTCOffset は "+0900" のような UTC-OFFSET の値を秒数に変換します。
+func parseUTCOffset(value string) (int, error) {
+	m := utcOffsetPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+	hours, _ := strconv.Atoi(m[2])
+	minutes, _ := strconv.Atoi(m[3])
+	seconds, _ := strconv.Atoi(m[4])
+	offset := hours*3600 + minutes*60 + seconds
+	if m[1] == "-" {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// durationPattern は ISO 8601 形式の期間 (RFC 5545 3.3.6) に一致します。
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration は "PT1H30M" や "P1D" のような DURATION の値を解析します。
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// unescapeText は TEXT 型の値のエスケープを解除します。
+func unescapeText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,271 @@
+// Package ical は RFC 5545 (iCalendar) の VCALENDAR/VEVENT の生成を提供します。
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ProdID はこのアプリケーションが生成するカレンダーの PRODID です。
+const ProdID = "-//schedule-app//Schedule Sharing Web Service//JA"
+
+// dateTimeLayout は UTC の DATE-TIME 形式、localDateTimeLayout は TZID とともに出力する DATE-TIME 形式です。
+const (
+	dateTimeLayout      = "20060102T150405Z"
+	localDateTimeLayout = "20060102T150405"
+)
+
+// maxLineOctets は折り返し前の1行の最大オクテット数です (RFC 5545 3.1)。
+const maxLineOctets = 75
+
+// Calendar は VCALENDAR コンポーネントを表します。
+type Calendar struct {
+	// Method は iTIP のメソッド (REQUEST, CANCEL など) です。空の場合は出力しません。
+	Method string
+	// Name はカレンダーの表示名 (X-WR-CALNAME) です。
+	Name   string
+	Events []*Event
+}
+
+// Event は VEVENT コンポーネントを表します。
+type Event struct {
+	UID          string
+	DTStamp      time.Time
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	Organizer    *Attendee
+	Attendees    []*Attendee
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID *time.Time
+	Sequence     int
+	Status       string
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Attendee は ATTENDEE / ORGANIZER プロパティの値を表します。
+type Attendee struct {
+	Email string
+	Name  string
+	// PartStat は参加状況 (NEEDS-ACTION, ACCEPTED, DECLINED, TENTATIVE) です。空の場合は出力しません。
+	PartStat string
+	RSVP     bool
+}
+
+// Encode はカレンダーを iCalendar 形式で w に書き込みます。
+func (c *Calendar) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		e.line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		e.line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	defined := map[int]bool{}
+	for _, ev := range c.Events {
+		if offset, ok := ev.zoneOffset(); ok && !defined[offset] {
+			defined[offset] = true
+			e.timezone(offset)
+		}
+	}
+	for _, ev := range c.Events {
+		ev.encode(e)
+	}
+	e.line("END", "VCALENDAR")
+	return e.err
+}
+
+// String はカレンダーを iCalendar 形式の文字列に変換します。
+func (c *Calendar) String() string {
+	var sb strings.Builder
+	c.Encode(&sb)
+	return sb.String()
+}
+
+// zoneOffset は VEVENT の日時を TZID とともに出力する場合に、そのタイムゾーンの UTC からのオフセット (秒) を返します。
+// RRULE の BYDAY や BYMONTHDAY は DTSTART のタイムゾーンで展開されるため (RFC 5545 3.3.10)、
+// 繰り返しの VEVENT と単一発生の変更は UTC に変換せず、サーバーが展開に使用する開始日時のオフセットで出力します。
+// スケジュールの日時はオフセットとして保存されるため、タイムゾーンは固定オフセットの VTIMEZONE として定義します。
+func (ev *Event) zoneOffset() (int, bool) {
+	if ev.RRule == "" && ev.RecurrenceID == nil {
+		return 0, false
+	}
+	_, offset := ev.Start.Zone()
+	return offset, offset != 0
+}
+
+func (ev *Event) encode(e *encoder) {
+	var loc *time.Location
+	if offset, ok := ev.zoneOffset(); ok {
+		loc = time.FixedZone(zoneID(offset), offset)
+	}
+	e.line("BEGIN", "VEVENT")
+	e.line("UID", escapeText(ev.UID))
+	e.line("DTSTAMP", formatDateTime(ev.DTStamp))
+	e.dateTime("DTSTART", loc, ev.Start)
+	e.dateTime("DTEND", loc, ev.End)
+	if ev.RecurrenceID != nil {
+		e.dateTime("RECURRENCE-ID", loc, *ev.RecurrenceID)
+	}
+	if ev.RRule != "" {
+		e.line("RRULE", ev.RRule)
+	}
+	if len(ev.ExDates) > 0 {
+		e.dateTime("EXDATE", loc, ev.ExDates...)
+	}
+	e.line("SUMMARY", escapeText(ev.Summary))
+	if ev.Description != "" {
+		e.line("DESCRIPTION", escapeText(ev.Description))
+	}
+	if ev.Location != "" {
+		e.line("LOCATION", escapeText(ev.Location))
+	}
+	if ev.Status != "" {
+		e.line("STATUS", ev.Status)
+	}
+	if ev.Sequence > 0 {
+		e.line("SEQUENCE", fmt.Sprint(ev.Sequence))
+	}
+	if ev.Organizer != nil {
+		e.line("ORGANIZER"+ev.Organizer.params(), "mailto:"+ev.Organizer.Email)
+	}
+	for _, a := range ev.Attendees {
+		e.line("ATTENDEE"+a.params(), "mailto:"+a.Email)
+	}
+	if !ev.Created.IsZero() {
+		e.line("CREATED", formatDateTime(ev.Created))
+	}
+	if !ev.LastModified.IsZero() {
+		e.line("LAST-MODIFIED", formatDateTime(ev.LastModified))
+	}
+	e.line("END", "VEVENT")
+}
+
+func (a *Attendee) params() string {
+	var sb strings.Builder
+	if a.Name != "" {
+		sb.WriteString(";CN=" + quoteParam(a.Name))
+	}
+	if a.PartStat != "" {
+		sb.WriteString(";PARTSTAT=" + a.PartStat)
+	}
+	if a.RSVP {
+		sb.WriteString(";RSVP=TRUE")
+	}
+	return sb.String()
+}
+
+// encoder は行の折り返しと CRLF 改行を行いながら書き込みます。最初のエラーを保持します。
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, foldLine(name+":"+value))
+}
+
+// dateTime は DATE-TIME 型のプロパティを書き込みます。loc が nil の場合は UTC、それ以外は TZID とともに loc の時刻で出力します。
+func (e *encoder) dateTime(name string, loc *time.Location, times ...time.Time) {
+	values := make([]string, len(times))
+	for i, t := range times {
+		if loc == nil {
+			values[i] = formatDateTime(t)
+		} else {
+			values[i] = t.In(loc).Format(localDateTimeLayout)
+		}
+	}
+	if loc != nil {
+		name += ";TZID=" + loc.String()
+	}
+	e.line(name, strings.Join(values, ","))
+}
+
+// timezone は UTC からのオフセットが offset (秒) の固定オフセットのタイムゾーンを VTIMEZONE として書き込みます。
+func (e *encoder) timezone(offset int) {
+	e.line("BEGIN", "VTIMEZONE")
+	e.line("TZID", zoneID(offset))
+	e.line("BEGIN", "STANDARD")
+	e.line("DTSTART", "19700101T000000")
+	e.line("TZOFFSETFROM", formatUTCOffset(offset))
+	e.line("TZOFFSETTO", formatUTCOffset(offset))
+	e.line("TZNAME", zoneID(offset))
+	e.line("END", "STANDARD")
+	e.line("END", "VTIMEZONE")
+}
+
+// zoneID は固定オフセットのタイムゾーンの TZID ("UTC+0900" など) を返します。
+// パラメータ値の引用が不要になるよう ":" を含めません。
+func zoneID(offset int) string {
+	return "UTC" + formatUTCOffset(offset)
+}
+
+// formatUTCOffset は UTC からのオフセット (秒) を UTC-OFFSET 型 ("+0900" など) に変換します (RFC 5545 3.3.14)。
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
+
+// foldLine は1行を75オクテットごとに折り返し、CRLF を付加します。UTF-8 の文字の途中では折り返しません。
+func foldLine(s string) string {
+	var sb strings.Builder
+	lineLen := 0
+	for _, r := range s {
+		n := len(string(r))
+		if lineLen+n > maxLineOctets {
+			sb.WriteString("\r\n ")
+			lineLen = 1
+		}
+		sb.WriteRune(r)
+		lineLen += n
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+// escapeText は TEXT 型の値をエスケープします (RFC 5545 3.3.11)。
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// quoteParam はパラメータ値に区切り文字が含まれる場合に二重引用符で囲みます。
+// パラメータ値はエスケープできないため、制御文字は削除し、二重引用符は単一引用符に置き換えます。
+func quoteParam(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.ReplaceAll(s, `"`, "'")
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
@@ -0,0 +1,140 @@
+package ical
+
+import (
+	"schedule-app/internal/model"
+	"schedule-app/internal/recurrence"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tokyo := time.FixedZone("", 9*60*60)
+	dtstamp := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	seriesID := int64(1)
+	series := &model.Schedule{
+		ID:             seriesID,
+		UID:            "weekly@example.com",
+		Title:          "Monday standup",
+		StartTime:      time.Date(2025, 11, 3, 8, 0, 0, 0, tokyo), // Monday, Sunday 23:00 in UTC
+		EndTime:        time.Date(2025, 11, 3, 8, 30, 0, 0, tokyo),
+		RecurrenceRule: "FREQ=WEEKLY;BYDAY=MO;COUNT=4",
+		ExDates:        []time.Time{time.Date(2025, 11, 10, 8, 0, 0, 0, tokyo)},
+	}
+	recurrenceID := time.Date(2025, 11, 17, 8, 0, 0, 0, tokyo)
+	override := &model.Schedule{
+		ID:           2,
+		UID:          series.UID,
+		Title:        "Monday standup (moved)",
+		StartTime:    time.Date(2025, 11, 17, 10, 0, 0, 0, tokyo),
+		EndTime:      time.Date(2025, 11, 17, 10, 30, 0, 0, tokyo),
+		SeriesID:     &seriesID,
+		RecurrenceID: &recurrenceID,
+	}
+	single := &model.Schedule{
+		ID:        3,
+		UID:       "single@example.com",
+		Title:     "Lunch",
+		StartTime: time.Date(2025, 11, 4, 12, 0, 0, 0, tokyo),
+		EndTime:   time.Date(2025, 11, 4, 13, 0, 0, 0, tokyo),
+	}
+
+	cal := &Calendar{Events: EventsFromSchedules([]*model.Schedule{series, override, single}, dtstamp)}
+	text := cal.String()
+
+	t.Run("Should export recurring events in the offset of the series", func(t *testing.T) {
+		for _, expected := range []string{
+			"BEGIN:VTIMEZONE\r\nTZID:UTC+0900\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0900\r\nTZOFFSETTO:+0900\r\n",
+			"DTSTART;TZID=UTC+0900:20251103T080000\r\n",
+			"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=4\r\n",
+			"EXDATE;TZID=UTC+0900:20251110T080000\r\n",
+			"RECURRENCE-ID;TZID=UTC+0900:20251117T080000\r\n",
+			"DTSTART;TZID=UTC+0900:20251117T100000\r\n",
+			"DTSTART:20251104T030000Z\r\n",
+		} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("Expected %q in\n%s", expected, text)
+			}
+		}
+		if n := strings.Count(text, "BEGIN:VTIMEZONE"); n != 1 {
+			t.Errorf("Expected one VTIMEZONE, got %d", n)
+		}
+	})
+
+	t.Run("Should expand the decoded series on the same days as the server", func(t *testing.T) {
+		decoded, errs, err := Decode(strings.NewReader(text))
+		if err != nil || len(errs) > 0 {
+			t.Fatalf("Failed to decode: %v %v", err, errs)
+		}
+		if len(decoded.Events) != 3 {
+			t.Fatalf("Expected 3 events, got %d", len(decoded.Events))
+		}
+		ev := decoded.Events[0]
+		if !ev.Start.Equal(series.StartTime) || !ev.End.Equal(series.EndTime) {
+			t.Errorf("Expected %s - %s, got %s - %s", series.StartTime, series.EndTime, ev.Start, ev.End)
+		}
+		if _, offset := ev.Start.Zone(); offset != 9*60*60 {
+			t.Errorf("Expected DTSTART in +09:00, got offset %d", offset)
+		}
+
+		rule, err := recurrence.Parse(series.RecurrenceRule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := rule.Between(series.StartTime, time.Hour, time.Time{}, time.Time{}, series.ExDates)
+		decodedRule, err := recurrence.Parse(ev.RRule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := decodedRule.Between(ev.Start, time.Hour, time.Time{}, time.Time{}, ev.ExDates)
+		if len(got) != 3 || len(got) != len(expected) {
+			t.Fatalf("Expected 3 occurrences, got %v (server: %v)", got, expected)
+		}
+		for i := range got {
+			if !got[i].Equal(expected[i]) || got[i].Weekday() != time.Monday {
+				t.Errorf("Expected occurrence %d on Monday %s, got %s", i, expected[i], got[i])
+			}
+		}
+
+		moved := decoded.Events[1]
+		if moved.RecurrenceID == nil || !moved.RecurrenceID.Equal(recurrenceID) {
+			t.Errorf("Expected RECURRENCE-ID %s, got %v", recurrenceID, moved.RecurrenceID)
+		}
+		if !decoded.Events[2].Start.Equal(single.StartTime) {
+			t.Errorf("Expected %s, got %s", single.StartTime, decoded.Events[2].Start)
+		}
+	})
+}
+
+func TestDecodeTimezone(t *testing.T) {
+	t.Run("Should resolve a custom TZID with a fixed offset from its VTIMEZONE", func(t *testing.T) {
+		data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+			"BEGIN:VEVENT\r\nUID:a\r\nDTSTART;TZID=Tokyo Standard Time:20251105T100000\r\nDTEND;TZID=Tokyo Standard Time:20251105T110000\r\nEND:VEVENT\r\n" +
+			"BEGIN:VTIMEZONE\r\nTZID:Tokyo Standard Time\r\nBEGIN:STANDARD\r\nDTSTART:16010101T000000\r\nTZOFFSETFROM:+0900\r\nTZOFFSETTO:+0900\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+			"END:VCALENDAR\r\n"
+		cal, errs, err := Decode(strings.NewReader(data))
+		if err != nil || len(errs) > 0 || len(cal.Events) != 1 {
+			t.Fatalf("Failed to decode: %v %v", err, errs)
+		}
+		if expected := time.Date(2025, 11, 5, 1, 0, 0, 0, time.UTC); !cal.Events[0].Start.Equal(expected) {
+			t.Errorf("Expected %s, got %s", expected, cal.Events[0].Start)
+		}
+	})
+
+	t.Run("Should treat a TZID with daylight saving time and no IANA name as UTC", func(t *testing.T) {
+		data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+			"BEGIN:VTIMEZONE\r\nTZID:Custom Time\r\n" +
+			"BEGIN:STANDARD\r\nDTSTART:19701025T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nEND:STANDARD\r\n" +
+			"BEGIN:DAYLIGHT\r\nDTSTART:19700329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nEND:DAYLIGHT\r\n" +
+			"END:VTIMEZONE\r\n" +
+			"BEGIN:VEVENT\r\nUID:a\r\nDTSTART;TZID=Custom Time:20251105T100000\r\nEND:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"
+		cal, errs, err := Decode(strings.NewReader(data))
+		if err != nil || len(errs) > 0 || len(cal.Events) != 1 {
+			t.Fatalf("Failed to decode: %v %v", err, errs)
+		}
+		if expected := time.Date(2025, 11, 5, 10, 0, 0, 0, time.UTC); !cal.Events[0].Start.Equal(expected) {
+			t.Errorf("Expected %s, got %s", expected, cal.Events[0].Start)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package ical
+
+import (
+	"schedule-app/internal/model"
+	"strings"
+	"time"
+)
+
+// EventFromSchedule はスケジュールを VEVENT に変換します。
+// 単一発生の変更は系列の UID と RECURRENCE-ID を持つ VEVENT として出力されます。
+func EventFromSchedule(s *model.Schedule, dtstamp time.Time) *Event {
+	uid := s.UID
+	if uid == "" {
+		uid = model.ScheduleUID(s.ID)
+	}
+
+	ev := &Event{
+		UID:          uid,
+		DTStamp:      dtstamp,
+		Start:        s.StartTime,
+		End:          s.EndTime,
+		Summary:      s.Title,
+		Description:  s.Description,
+		Location:     s.Location,
+		RRule:        s.RecurrenceRule,
+		ExDates:      s.ExDates,
+		RecurrenceID: s.RecurrenceID,
+		Sequence:     s.Sequence,
+		Created:      s.CreatedAt,
+		LastModified: s.UpdatedAt,
+	}
+	for _, p := range s.Participants {
+		ev.Attendees = append(ev.Attendees, &Attendee{Email: p.Email, Name: p.Username, PartStat: strings.ToUpper(p.Status)})
+	}
+	return ev
+}
+
+// EventsFromSchedules は複数のスケジュールを VEVENT に変換します。
+// 単一発生の変更は RECURRENCE-ID で系列の発生を置き換えるため、系列の EXDATE からその発生を除きます。
+func EventsFromSchedules(schedules []*model.Schedule, dtstamp time.Time) []*Event {
+	overridden := make(map[int64]map[int64]bool)
+	for _, s := range schedules {
+		if s.SeriesID != nil && s.RecurrenceID != nil {
+			if overridden[*s.SeriesID] == nil {
+				overridden[*s.SeriesID] = make(map[int64]bool)
+			}
+			overridden[*s.SeriesID][s.RecurrenceID.Unix()] = true
+		}
+	}
+
+	events := make([]*Event, 0, len(schedules))
+	for _, s := range schedules {
+		ev := EventFromSchedule(s, dtstamp)
+		if len(overridden[s.ID]) > 0 {
+			ev.ExDates = nil
+			for _, ex := range s.ExDates {
+				if !overridden[s.ID][ex.Unix()] {
+					ev.ExDates = append(ev.ExDates, ex)
+				}
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
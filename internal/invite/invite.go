@@ -0,0 +1,190 @@
+// Package invite はスケジュールの参加者に招待メール (iMIP, RFC 6047) を送信します。
+// メールには iTIP (RFC 5546) の REQUEST または CANCEL を text/calendar のパートとして含めるため、
+// Outlook や Gmail などのメールクライアントは承諾・辞退のボタンを表示し、カレンダーに予定を追加します。
+// iTIP に更新用のメソッドはないため、スケジュールの変更は SEQUENCE を増やした REQUEST として送信します。
+//
+// Sender は招待メールを生成して送信キュー (invitation_emails) に追加し、Worker がバックグラウンドで送信します。
+// メールサーバーに接続できない場合も、スケジュールの変更のリクエストを待たせず、後で再送信します。
+package invite
+
+import (
+	"errors"
+	"fmt"
+	"schedule-app/internal/ical"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strings"
+	"time"
+)
+
+// iTIP のメソッド
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+// timeLayout は招待の本文に記載する日時の形式です (UTC)。
+const timeLayout = "2006-01-02 15:04 MST"
+
+// Sender は招待メールを生成し、送信キューに追加します。送信は Worker が行います。
+// 主催者 (ORGANIZER) はユーザーのカレンダーでは所有者、グループのカレンダーではスケジュールの作成者です。
+// 参加者がメールクライアントで回答すると、その返信 (REPLY) は主催者のメールアドレスに届きます。
+type Sender struct {
+	repo     *repository.InvitationRepository
+	userRepo *repository.UserRepository
+	baseURL  string
+}
+
+// NewSender は Sender の新しいインスタンスを生成します。baseURL は本文に記載するアプリのURLです。
+func NewSender(repo *repository.InvitationRepository, userRepo *repository.UserRepository, baseURL string) *Sender {
+	return &Sender{repo: repo, userRepo: userRepo, baseURL: baseURL}
+}
+
+// Created は作成したスケジュールの招待を参加者に送信します。
+func (s *Sender) Created(schedule *model.Schedule) error {
+	return s.send(MethodRequest, schedule, schedule.Participants)
+}
+
+// Updated は更新後のスケジュール updated の招待を参加者に送信し、更新で外れた参加者には取り消しを送信します。
+// 繰り返しスケジュールを以降の発生で分割した場合、updated は新しい系列です。
+// このとき series に打ち切った元の系列を指定すると、元の系列の参加者にも更新した招待を送信します。
+func (s *Sender) Updated(previous, updated, series *model.Schedule) error {
+	var errs []error
+	if series != nil {
+		errs = append(errs, s.send(MethodRequest, series, series.Participants))
+	}
+	errs = append(errs, s.send(MethodRequest, updated, updated.Participants))
+	// 新しい系列は元の系列と UID が異なり、外れた参加者のカレンダーにはないため取り消しは不要
+	if updated.UID == previous.UID {
+		errs = append(errs, s.send(MethodCancel, updated, removedParticipants(previous, updated)))
+	}
+	return errors.Join(errs...)
+}
+
+// Deleted は削除したスケジュール deleted の取り消しを参加者に送信します。
+// occurrence を指定した場合は、その発生のみの取り消しを送信します。
+// 以降の発生を削除して系列を打ち切った場合は、取り消しの代わりに打ち切った系列 series の招待を送信します。
+func (s *Sender) Deleted(deleted *model.Schedule, occurrence *time.Time, series *model.Schedule) error {
+	if series != nil {
+		return s.send(MethodRequest, series, series.Participants)
+	}
+
+	canceled := *deleted
+	canceled.Sequence++ // 削除したスケジュールは保存されていないため、ここで SEQUENCE を増やす
+	if occurrence != nil {
+		canceled.StartTime = *occurrence
+		canceled.EndTime = occurrence.Add(deleted.EndTime.Sub(deleted.StartTime))
+		canceled.RecurrenceRule = ""
+		canceled.ExDates = nil
+		canceled.RecurrenceID = occurrence
+	}
+	return s.send(MethodCancel, &canceled, deleted.Participants)
+}
+
+// removedParticipants は previous の参加者のうち updated の参加者でないユーザーを返します。
+func removedParticipants(previous, updated *model.Schedule) []*model.Participant {
+	current := make(map[int64]bool)
+	for _, p := range updated.Participants {
+		current[p.ID] = true
+	}
+	var removed []*model.Participant
+	for _, p := range previous.Participants {
+		if !current[p.ID] {
+			removed = append(removed, p)
+		}
+	}
+	return removed
+}
+
+// send は recipients のそれぞれへの method の招待メールを生成し、送信キューに追加します。主催者には送信しません。
+func (s *Sender) send(method string, schedule *model.Schedule, recipients []*model.Participant) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	organizerID := schedule.OwnerID
+	if schedule.OwnerType == model.OwnerGroup {
+		organizerID = schedule.CreatorID
+	}
+	organizer, err := s.userRepo.FindUserByID(organizerID)
+	if err != nil {
+		return fmt.Errorf("failed to get organizer of schedule %d: %w", schedule.ID, err)
+	}
+
+	var emails []*model.InvitationEmail
+	for _, p := range recipients {
+		if p.ID == organizer.ID || p.Email == "" {
+			continue
+		}
+		emails = append(emails, &model.InvitationEmail{
+			ScheduleID: schedule.ID,
+			Recipient:  p.Email,
+			Subject:    subject(method, schedule),
+			Body:       s.body(method, schedule, organizer),
+			Method:     method,
+			Calendar:   calendar(method, schedule, organizer, p).String(),
+		})
+	}
+	if err := s.repo.Enqueue(emails); err != nil {
+		return fmt.Errorf("failed to queue %s of schedule %d: %w", method, schedule.ID, err)
+	}
+	return nil
+}
+
+// calendar は recipient に送る iTIP のオブジェクトを生成します。
+// REQUEST にはすべての参加者を、CANCEL には取り消す参加者 recipient のみを ATTENDEE として含めます。
+func calendar(method string, schedule *model.Schedule, organizer *model.User, recipient *model.Participant) *ical.Calendar {
+	ev := ical.EventFromSchedule(schedule, time.Now())
+	ev.Organizer = &ical.Attendee{Email: organizer.Email, Name: organizer.Username}
+	if method == MethodCancel {
+		ev.Status = "CANCELLED"
+		ev.Attendees = []*ical.Attendee{{Email: recipient.Email, Name: recipient.Username}}
+	} else {
+		ev.Status = "CONFIRMED"
+		for _, a := range ev.Attendees {
+			a.RSVP = true
+		}
+	}
+	return &ical.Calendar{Method: method, Events: []*ical.Event{ev}}
+}
+
+// subject は招待メールの件名を返します。
+func subject(method string, schedule *model.Schedule) string {
+	title := oneLine(schedule.Title)
+	switch {
+	case method == MethodCancel:
+		return "Canceled: " + title
+	case schedule.Sequence > 0:
+		return "Updated invitation: " + title
+	default:
+		return "Invitation: " + title
+	}
+}
+
+// body は招待メールのプレーンテキストの本文を返します。iCalendar を表示できないメールクライアント向けです。
+func (s *Sender) body(method string, schedule *model.Schedule, organizer *model.User) string {
+	var sb strings.Builder
+	switch {
+	case method == MethodCancel:
+		fmt.Fprintf(&sb, "%s canceled %q.\n\n", organizer.Username, schedule.Title)
+	case schedule.Sequence > 0:
+		fmt.Fprintf(&sb, "%s updated %q.\n\n", organizer.Username, schedule.Title)
+	default:
+		fmt.Fprintf(&sb, "%s invited you to %q.\n\n", organizer.Username, schedule.Title)
+	}
+	fmt.Fprintf(&sb, "Start: %s\nEnd: %s\n", schedule.StartTime.UTC().Format(timeLayout), schedule.EndTime.UTC().Format(timeLayout))
+	if schedule.RecurrenceRule != "" {
+		fmt.Fprintf(&sb, "Repeats: %s\n", schedule.RecurrenceRule)
+	}
+	if schedule.Location != "" {
+		fmt.Fprintf(&sb, "Location: %s\n", schedule.Location)
+	}
+	if method == MethodRequest {
+		fmt.Fprintf(&sb, "\nRespond in your calendar app or open your calendar: %s/\n", s.baseURL)
+	}
+	return sb.String()
+}
+
+// oneLine は件名に使うため、改行を含む空白の連続を1つの空白にまとめます。
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,118 @@
+package invite
+
+import (
+	"context"
+	"log"
+	"schedule-app/internal/clock"
+	"schedule-app/internal/mail"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"time"
+)
+
+const (
+	// batchSize は1回の RunOnce で送信する招待メールの最大件数です。
+	batchSize = 50
+	// sendTimeout はメール1通の送信にかける時間の上限です。
+	sendTimeout = 30 * time.Second
+	// lease は送信中の招待メールを確保する期間です。sendTimeout より長くします。
+	lease = 2 * time.Minute
+	// backoffBase と backoffMax は再送信までの待ち時間の初期値と上限です。
+	backoffBase = time.Minute
+	backoffMax  = 2 * time.Hour
+	// emailRetention は送信済み・失敗した招待メールを保持する期間です。
+	emailRetention = 7 * 24 * time.Hour
+)
+
+// Backoff は attempts 回目の送信に失敗した後、再送信するまでの待ち時間を返します (1分から倍々、最大2時間)。
+func Backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, backoffMax)
+}
+
+// Worker は一定間隔で送信キューの招待メールを mail.Sender で送信します。
+// 送信の前にメールを確保するため、複数のワーカーがあっても同時に同じメールを送信しません。
+// 現在時刻は clock.Clock から取得するため、テストでは clock.Fake で時刻を進めて RunOnce を呼び出します。
+type Worker struct {
+	repo     *repository.InvitationRepository
+	mailer   mail.Sender
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewWorker は Worker の新しいインスタンスを生成します。
+func NewWorker(repo *repository.InvitationRepository, mailer mail.Sender, clk clock.Clock, interval time.Duration) *Worker {
+	return &Worker{repo: repo, mailer: mailer, clock: clk, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("ERROR: Failed to send invitation emails: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce は送信予定の日時を過ぎた招待メールを送信し、送信に成功した件数を返します。
+// 失敗したメールは MaxInvitationAttempts 回に達するまで Backoff の後に再送信します。
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := w.clock.Now()
+	due, err := w.repo.DueEmails(now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range due {
+		claimed, err := w.repo.Claim(e, now.Add(lease))
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		sendErr := w.send(ctx, e)
+		var retryAt *time.Time
+		if sendErr == nil {
+			sent++
+		} else {
+			log.Printf("WARNING: Failed to send %s of schedule %d to %s: %v", e.Method, e.ScheduleID, e.Recipient, sendErr)
+			if e.Attempts+1 < model.MaxInvitationAttempts {
+				t := w.clock.Now().Add(Backoff(e.Attempts + 1))
+				retryAt = &t
+			}
+		}
+		if err := w.repo.RecordAttempt(e, sendErr, retryAt); err != nil {
+			return sent, err
+		}
+	}
+
+	if err := w.repo.PruneEmails(now.Add(-emailRetention)); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+// send は招待メールを1回送信します。
+func (w *Worker) send(ctx context.Context, e *model.InvitationEmail) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return w.mailer.Send(ctx, &mail.Message{
+		To:       e.Recipient,
+		Subject:  e.Subject,
+		Body:     e.Body,
+		Calendar: &mail.CalendarPart{Method: e.Method, Data: e.Calendar},
+	})
+}
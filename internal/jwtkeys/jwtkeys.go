@@ -0,0 +1,255 @@
+// Package jwtkeys はアクセストークン (JWT) の署名鍵と検証鍵を管理します。
+// RS256 (RSA) と EdDSA (Ed25519) の鍵には RFC 7638 の JWK サムプリントを kid として付け、公開鍵を JWKS (RFC 7517) として公開します。
+// 鍵のローテーションのため、署名に使う鍵のほかに、以前の鍵を検証専用として複数登録できます。
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 対応する署名アルゴリズム
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmHS256 = "HS256"
+)
+
+// Key は JWT の署名または検証に使う鍵です。
+type Key struct {
+	// ID は JWT ヘッダーの kid です。HS256 の鍵は公開しないため空です。
+	ID        string
+	Algorithm string
+	signKey   any // 署名用の秘密鍵。検証専用の鍵では nil
+	verifyKey any
+}
+
+// NewHMACKey は共有シークレットによる HS256 の鍵を生成します。
+// 非対称鍵が設定されていない場合の互換用で、JWKS には含まれません。
+func NewHMACKey(secret []byte) *Key {
+	return &Key{Algorithm: AlgorithmHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewKey は RSA または Ed25519 の秘密鍵・公開鍵から Key を生成します。公開鍵の場合は検証専用になります。
+func NewKey(key any) (*Key, error) {
+	var k Key
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k = Key{Algorithm: AlgorithmRS256, signKey: key, verifyKey: &key.PublicKey}
+	case *rsa.PublicKey:
+		k = Key{Algorithm: AlgorithmRS256, verifyKey: key}
+	case ed25519.PrivateKey:
+		k = Key{Algorithm: AlgorithmEdDSA, signKey: key, verifyKey: key.Public()}
+	case ed25519.PublicKey:
+		k = Key{Algorithm: AlgorithmEdDSA, verifyKey: key}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if rsaKey, ok := k.verifyKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key must be at least 2048 bits, got %d", rsaKey.N.BitLen())
+	}
+	k.ID = thumbprint(k.jwk())
+	return &k, nil
+}
+
+// ParsePEM は PEM 形式の鍵を読み込みます。
+// 秘密鍵 (PKCS #8、RSA の場合は PKCS #1 も可) と公開鍵 (PKIX) に対応します。
+func ParsePEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", block.Type, err)
+	}
+	return NewKey(key)
+}
+
+// LoadFile は PEM ファイルから鍵を読み込みます。
+func LoadFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := ParsePEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// method は鍵のアルゴリズムに対応する署名方式を返します。
+func (k *Key) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// JWK は JWKS で公開する公開鍵です。
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS は JSON Web Key Set です。
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk は鍵の公開部分を JWK に変換します (kid・use・alg を除く)。
+func (k *Key) jwk() JWK {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+	default:
+		return JWK{}
+	}
+}
+
+// thumbprint は JWK サムプリント (RFC 7638) を計算します。必須のメンバーのみを辞書順に並べた JSON の SHA-256 です。
+func thumbprint(jwk JWK) string {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeySet は署名に使う鍵と、検証に使う鍵の集合です。
+type KeySet struct {
+	signing *Key
+	verify  map[string]*Key // kid -> 鍵。署名に使う鍵も含む
+	order   []*Key          // JWKS の順序。署名に使う鍵が先頭
+}
+
+// NewKeySet は signing で署名し、signing と verificationKeys で検証する KeySet を生成します。
+// verificationKeys にはローテーション前の鍵を指定します。秘密鍵を指定しても公開鍵のみを使用します。
+func NewKeySet(signing *Key, verificationKeys ...*Key) (*KeySet, error) {
+	if signing == nil || signing.signKey == nil {
+		return nil, errors.New("signing key must be a private key")
+	}
+	ks := &KeySet{signing: signing, verify: map[string]*Key{signing.ID: signing}, order: []*Key{signing}}
+	for _, k := range verificationKeys {
+		if k.Algorithm == AlgorithmHS256 {
+			return nil, errors.New("HS256 keys cannot be used as additional verification keys")
+		}
+		if _, ok := ks.verify[k.ID]; ok {
+			continue
+		}
+		public := &Key{ID: k.ID, Algorithm: k.Algorithm, verifyKey: k.verifyKey}
+		ks.verify[k.ID] = public
+		ks.order = append(ks.order, public)
+	}
+	return ks, nil
+}
+
+// SigningKeyID は署名に使う鍵の kid を返します。
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signing.ID
+}
+
+// Sign はクレームに署名した JWT を返します。非対称鍵の場合はヘッダーに kid を設定します。
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method(), claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse は JWT の署名と有効期限を検証し、claims に読み込みます。
+// ヘッダーの kid で検証鍵を選び、alg が鍵のアルゴリズムと一致することを確認します (アルゴリズムの取り違えを防ぐため)。
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("algorithm %s does not match key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods(ks.algorithms()), jwt.WithExpirationRequired())
+}
+
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, k := range ks.order {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	return algs
+}
+
+// JWKS は検証に使う公開鍵の一覧を返します。HS256 の鍵は含みません。署名に使う鍵が先頭です。
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.order {
+		if k.Algorithm == AlgorithmHS256 {
+			continue
+		}
+		jwk := k.jwk()
+		jwk.Kid, jwk.Use, jwk.Alg = k.ID, "sig", k.Algorithm
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,272 @@
+// Package mail はメールの送信を扱います。
+// 送信方法は Sender インターフェースで差し替えられます。本番環境では SMTPSender を、開発環境とテストでは送信したメールを保存する Outbox を使用します。
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message は送信するメールです。本文はプレーンテキスト (UTF-8) です。
+// Calendar を指定した場合は、本文と iCalendar のパートからなる multipart/alternative のメール (iMIP, RFC 6047) になります。
+type Message struct {
+	To       string
+	Subject  string
+	Body     string
+	Calendar *CalendarPart
+}
+
+// CalendarPart は iMIP のメールに含める iCalendar のオブジェクトです。
+type CalendarPart struct {
+	// Method は iTIP のメソッド (REQUEST, CANCEL など) です。Data の METHOD と一致させてください。
+	Method string
+	// Data は iCalendar 形式のテキストです。
+	Data string
+}
+
+// Sender はメールを送信します。
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// encode は msg を送信元 from のメール (RFC 5322) に変換し、宛先のアドレスとともに返します。
+func (msg *Message) encode(from string, date time.Time) (to string, data []byte, err error) {
+	fromAddr, err := netmail.ParseAddress(from)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	toAddr, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid recipient address %q: %w", msg.To, err)
+	}
+	// ヘッダーインジェクションを防ぐため、件名の改行を拒否する
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return "", nil, errors.New("subject must not contain line breaks")
+	}
+	if msg.Calendar != nil && !validMethod(msg.Calendar.Method) {
+		return "", nil, fmt.Errorf("invalid calendar method %q", msg.Calendar.Method)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", fromAddr.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", toAddr.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if msg.Calendar == nil {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeText(&buf, msg.Body); err != nil {
+			return "", nil, err
+		}
+		return toAddr.Address, buf.Bytes(), nil
+	}
+
+	// 本文を表示できないクライアント向けにプレーンテキストを先に、優先する iCalendar を後に置く
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode body: %w", err)
+	}
+	if err := writeText(part, msg.Body); err != nil {
+		return "", nil, err
+	}
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/calendar; charset=UTF-8; method=" + msg.Calendar.Method},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode calendar: %w", err)
+	}
+	if err := writeBase64(part, []byte(msg.Calendar.Data)); err != nil {
+		return "", nil, fmt.Errorf("failed to encode calendar: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return toAddr.Address, buf.Bytes(), nil
+}
+
+// writeText は本文を CRLF 改行の quoted-printable で w に書き込みます。
+func writeText(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+	return nil
+}
+
+// writeBase64 は data を76文字ごとに改行した base64 で w に書き込みます (RFC 2045 6.8)。
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(len(encoded), 76)
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// validMethod は iTIP のメソッドが Content-Type のパラメータに書き込める英大文字のみからなるかを返します。
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, r := range method {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// SMTPConfig は SMTP サーバーの設定です。
+type SMTPConfig struct {
+	Addr     string // host:port (例: smtp.example.com:587)
+	Username string // 空の場合は認証しません
+	Password string
+	From     string // 送信元 (例: Schedule App <no-reply@example.com>)
+}
+
+// SMTPSender は SMTP サーバーを経由してメールを送信します。
+// サーバーが対応している場合は STARTTLS で暗号化します。認証 (PLAIN) は暗号化された接続か localhost でのみ行います。
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPSender は SMTPSender の新しいインスタンスを生成します。
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	return &SMTPSender{config: config}
+}
+
+// Send はメールを送信します。ctx の期限は接続全体に適用されます。
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	from, err := netmail.ParseAddress(s.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", s.config.From, err)
+	}
+	to, data, err := msg.encode(s.config.From, time.Now())
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %w", s.config.Addr, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if s.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// Outbox はメールを送信せずに保存する Sender です。開発環境とテストで使用します。
+// 送信したメールはメモリに保持し、dir が空でなければ dir に .eml ファイルとしても書き出します。
+type Outbox struct {
+	from string
+	dir  string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox は Outbox の新しいインスタンスを生成します。from は書き出すファイルの送信元です。
+func NewOutbox(from, dir string) *Outbox {
+	return &Outbox{from: from, dir: dir}
+}
+
+// Send はメールを保存します。
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	_, data, err := msg.encode(o.from, now)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, *msg)
+	if o.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	name := now.UTC().Format("20060102T150405.000000000") + ".eml"
+	if err := os.WriteFile(filepath.Join(o.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+	return nil
+}
+
+// Messages は保存したメールを送信順に返します。
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
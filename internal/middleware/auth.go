@@ -4,28 +4,45 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"schedule-app/internal/jwtkeys"
 	"schedule-app/internal/model"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
+// SessionChecker はセッション (アクセストークンの jti) が有効であることを確認する関数です。
+// ログアウトなどで無効にされたセッションの場合はエラーを返します。
+type SessionChecker func(sessionID string) error
+
+// PersonalTokenVerifier はパーソナルアクセストークンを検証し、その内容を返す関数です。
+// clientIP はトークンの最終使用の記録に使用します。無効・期限切れのトークンの場合はエラーを返します。
+type PersonalTokenVerifier func(token, clientIP string) (*model.PersonalAccessToken, error)
+
 // AuthMiddleware holds dependencies for authentication middleware.
 type AuthMiddleware struct {
-	jwtSecret []byte
+	keys         *jwtkeys.KeySet
+	checkSession SessionChecker
+	verifyToken  PersonalTokenVerifier
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware.
-func NewAuthMiddleware(jwtSecret string) *AuthMiddleware {
-	return &AuthMiddleware{jwtSecret: []byte(jwtSecret)}
+func NewAuthMiddleware(keys *jwtkeys.KeySet, checkSession SessionChecker, verifyToken PersonalTokenVerifier) *AuthMiddleware {
+	return &AuthMiddleware{keys: keys, checkSession: checkSession, verifyToken: verifyToken}
 }
 
 // userContextKey is a private type to prevent collisions with other context keys.
 type userContextKey string
 
-const userIDKey userContextKey = "userID"
+const (
+	userIDKey    userContextKey = "userID"
+	roleKey      userContextKey = "role"
+	sessionIDKey userContextKey = "sessionID"
+	expiresAtKey userContextKey = "expiresAt"
+	recheckKey   userContextKey = "recheck"
+)
 
 // JwtAuthentication is a middleware to protect routes.
+// It accepts access tokens (JWT) issued on login and personal access tokens ("pat_..."), both as Bearer tokens.
 func (amw *AuthMiddleware) JwtAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// "Authorization" ヘッダーからトークンを取得
@@ -43,24 +60,95 @@ func (amw *AuthMiddleware) JwtAuthentication(next http.Handler) http.Handler {
 		}
 		tokenString := bearerToken[1]
 
-		// トークンをパース・検証
+		if strings.HasPrefix(tokenString, model.PersonalAccessTokenPrefix) {
+			amw.personalTokenAuthentication(w, r, next, tokenString)
+			return
+		}
+
+		// トークンをパース・検証 (ヘッダーの kid で検証鍵を選択)
 		claims := &model.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return amw.jwtSecret, nil
-		})
+		token, err := amw.keys.Parse(tokenString, claims)
 
-		if err != nil || !token.Valid {
+		if err != nil || !token.Valid || claims.ID == "" {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		// コンテキストにユーザーIDを格納
+		// ログアウト済みのセッションのトークンを拒否
+		if err := amw.checkSession(claims.ID); err != nil {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		// コンテキストにユーザーID・ロール・セッションIDと、長く続くリクエストのための有効期限と再確認の方法を格納
 		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, roleKey, claims.Role)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.ID)
+		if claims.ExpiresAt != nil {
+			ctx = context.WithValue(ctx, expiresAtKey, claims.ExpiresAt.Time)
+		}
+		ctx = context.WithValue(ctx, recheckKey, func() error { return amw.checkSession(claims.ID) })
 		// 次のハンドラにコンテキストを渡す
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// personalTokenAuthentication はパーソナルアクセストークンで認証し、スコープを確認して次のハンドラを呼び出します。
+// 読み取り (GET, HEAD, OPTIONS) には read、それ以外のメソッドには write のスコープが必要です (requiredScope)。
+// admin のスコープを持ち、持ち主が現在も管理者である場合にのみ、管理者のロールを格納します。
+// セッションIDは格納しないため、RequireSession で保護したルートには使用できません。
+func (amw *AuthMiddleware) personalTokenAuthentication(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	pat, err := amw.verifyToken(token, ClientIP(r))
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	scope := requiredScope(r.Method)
+	if !pat.HasScope(scope) {
+		http.Error(w, "Insufficient token scope: "+string(scope)+" is required", http.StatusForbidden)
+		return
+	}
+
+	role := model.UserRoleUser
+	if pat.HasScope(model.TokenScopeAdmin) && pat.UserRole == model.UserRoleAdmin {
+		role = model.UserRoleAdmin
+	}
+	ctx := context.WithValue(r.Context(), userIDKey, pat.UserID)
+	ctx = context.WithValue(ctx, roleKey, role)
+	if pat.ExpiresAt != nil {
+		ctx = context.WithValue(ctx, expiresAtKey, *pat.ExpiresAt)
+	}
+	clientIP := ClientIP(r)
+	ctx = context.WithValue(ctx, recheckKey, func() error {
+		_, err := amw.verifyToken(token, clientIP)
+		return err
+	})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requiredScope はパーソナルアクセストークンでメソッド method のリクエストをするために必要なスコープを返します。
+// 読み取りのメソッドには read、それ以外には write が必要です。CalDAV の PROPFIND と REPORT は読み取りとして扱います。
+func requiredScope(method string) model.TokenScope {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return model.TokenScopeRead
+	}
+	return model.TokenScopeWrite
+}
+
+// RequireSession は、ログインのセッション (JWT) 以外の方法で認証されたリクエストに 403 を返すミドルウェアです。
+// パーソナルアクセストークンでトークン自体や二要素認証の設定を変更できないようにします。JwtAuthentication の内側で使用します。
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetSessionIDFromContext(r.Context()); err != nil {
+			http.Error(w, "This endpoint requires a login session", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // GetUserIDFromContext はコンテキストからユーザーIDを取得します。
 func GetUserIDFromContext(ctx context.Context) (int64, error) {
 	userID, ok := ctx.Value(userIDKey).(int64)
@@ -68,4 +156,59 @@ func GetUserIDFromContext(ctx context.Context) (int64, error) {
 		return 0, fmt.Errorf("user ID not found in context")
 	}
 	return userID, nil
+}
+
+// GetSessionIDFromContext はコンテキストからセッションID (アクセストークンの jti) を取得します。
+// Basic 認証など、セッションを使わない認証の場合はエラーを返します。
+func GetSessionIDFromContext(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(sessionIDKey).(string)
+	if !ok {
+		return "", fmt.Errorf("session ID not found in context")
+	}
+	return sessionID, nil
+}
+
+// GetExpiryFromContext はリクエストを認証したトークン (アクセストークンの exp またはパーソナルアクセストークンの有効期限) の
+// 有効期限を取得します。有効期限のないトークンの場合は false を返します。
+func GetExpiryFromContext(ctx context.Context) (time.Time, bool) {
+	expiresAt, ok := ctx.Value(expiresAtKey).(time.Time)
+	return expiresAt, ok
+}
+
+// RecheckCredentials はリクエストを認証したトークンが現在も有効かを確認します。
+// ログアウトしたセッションや取り消されたパーソナルアクセストークンの場合はエラーを返します。
+// Server-Sent Events のように長く続くリクエストで、認証の後に無効になったトークンで配信を続けないために使用します。
+func RecheckCredentials(ctx context.Context) error {
+	recheck, ok := ctx.Value(recheckKey).(func() error)
+	if !ok {
+		return fmt.Errorf("credentials not found in context")
+	}
+	return recheck()
+}
+
+// GetRoleFromContext はコンテキストからユーザーのロールを取得します。
+// ロールを含まないトークンの場合は一般ユーザー (model.UserRoleUser) として扱います。
+func GetRoleFromContext(ctx context.Context) model.UserRole {
+	role, _ := ctx.Value(roleKey).(model.UserRole)
+	if role == "" {
+		return model.UserRoleUser
+	}
+	return role
+}
+
+// RequireRole は、トークンのロールが roles のいずれかでない場合に 403 を返すミドルウェアです。
+// JwtAuthentication の内側で使用します。
+func RequireRole(roles ...model.UserRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := GetRoleFromContext(r.Context())
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Insufficient role", http.StatusForbidden)
+		})
+	}
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"schedule-app/internal/model"
+	"strconv"
+	"strings"
+)
+
+// CredentialVerifier はメールアドレスとパスワードを検証し、ユーザーIDを返す関数です。
+// clientIP は総当たり攻撃の対策で、試行の回数をクライアントごとに数えるために使用します。
+// 試行が制限されている場合は *model.LoginThrottledError を返します。
+type CredentialVerifier func(email, password, clientIP string) (int64, error)
+
+// BasicAuthentication は HTTP Basic 認証 (RFC 7617) でルートを保護するミドルウェアです。
+// Authorization ヘッダーに JWT を設定できない CalDAV クライアントのために使用します。
+// パスワードの代わりにパーソナルアクセストークン ("pat_...") も受け付けます。この場合、ユーザー名は検証せず、
+// トークンの持ち主として認証します。二要素認証を有効にしたユーザーはパスワードでは認証できないため、トークンを使用します。
+// 認証に成功すると、JwtAuthentication と同様にコンテキストにユーザーIDを格納します。
+func BasicAuthentication(realm string, verify CredentialVerifier, verifyToken PersonalTokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			email, password, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+				http.Error(w, "Authorization required", http.StatusUnauthorized)
+				return
+			}
+
+			if strings.HasPrefix(password, model.PersonalAccessTokenPrefix) {
+				pat, err := verifyToken(password, ClientIP(r))
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+					http.Error(w, "Invalid token", http.StatusUnauthorized)
+					return
+				}
+				if scope := requiredScope(r.Method); !pat.HasScope(scope) {
+					http.Error(w, "Insufficient token scope: "+string(scope)+" is required", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey, pat.UserID)))
+				return
+			}
+
+			userID, err := verify(email, password, ClientIP(r))
+			var throttled *model.LoginThrottledError
+			if errors.As(err, &throttled) {
+				w.Header().Set("Retry-After", strconv.Itoa(throttled.RetryAfterSeconds()))
+				http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+				http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+				return
+			}
+
+			// コンテキストにユーザーIDを格納
+			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
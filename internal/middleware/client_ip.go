@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const clientIPKey userContextKey = "clientIP"
+
+// ClientIP はリクエストの送信元のIPアドレスを返します。
+// TrustProxyHeaders を適用している場合はプロキシが設定したアドレス、それ以外の場合は接続元のアドレスです。
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// TrustProxyHeaders は、リバースプロキシが X-Forwarded-For ヘッダーの末尾に追加したアドレスを送信元として扱うミドルウェアです。
+// クライアントがヘッダーを偽装できるため、リバースプロキシを経由する場合にのみ使用します。
+func TrustProxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			// 末尾のアドレスのみがプロキシ自身によって追加されたもの
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(last) != nil {
+				ip = last
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,9 +1,218 @@
 package model
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 // Claims represents the JWT claims used in the application.
+// The registered "jti" claim (ID) holds the session the access token belongs to.
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID int64    `json:"user_id"`
+	Role   UserRole `json:"role,omitempty"`
 	jwt.RegisteredClaims
+}
+
+// Session is a login session. Access tokens carry its ID as their "jti" claim,
+// so revoking the session invalidates every access token issued for it.
+type Session struct {
+	ID        string
+	UserID    int64
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// RefreshTokenRequest is the request body for exchanging a refresh token for new tokens.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse is returned on login and refresh.
+type TokenResponse struct {
+	Token        string    `json:"token"` // short-lived access token (JWT)
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // expiry of the access token
+}
+
+// AccountTokenPurpose is what a single-use account token sent by email can be used for.
+type AccountTokenPurpose string
+
+const (
+	// TokenPurposeVerifyEmail confirms that the user owns their email address.
+	TokenPurposeVerifyEmail AccountTokenPurpose = "verify_email"
+	// TokenPurposeResetPassword allows setting a new password without knowing the current one.
+	TokenPurposeResetPassword AccountTokenPurpose = "reset_password"
+)
+
+// VerifyEmailRequest is the request body for confirming an email address with a token from the verification email.
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// PasswordResetRequest is the request body for requesting a password reset email.
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is the request body for setting a new password with a token from the password reset email.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// LoginThrottlePolicy configures brute-force protection for password logins.
+// Failed attempts are counted per account (email address) and per client IP within a sliding window.
+// Reaching a limit locks the account or IP temporarily; each consecutive lockout doubles the duration.
+// Password reset requests are limited within the same window, separately from failed logins.
+type LoginThrottlePolicy struct {
+	Window             time.Duration // sliding window for counting failed attempts
+	MaxAccountFailures int           // failures per account within Window before a lockout
+	MaxIPFailures      int           // failures per client IP within Window before a lockout
+	LockoutBase        time.Duration // duration of the first lockout
+	LockoutMax         time.Duration // upper bound for the lockout duration
+	MaxAccountResets   int           // password reset requests per email address within Window
+	MaxIPResets        int           // password reset requests per client IP within Window
+}
+
+// LockoutDuration returns the duration of the n-th consecutive lockout (n >= 1).
+func (p LoginThrottlePolicy) LockoutDuration(n int) time.Duration {
+	d := p.LockoutBase
+	for i := 1; i < n && d < p.LockoutMax; i++ {
+		d *= 2
+	}
+	return min(d, p.LockoutMax)
+}
+
+// LoginThrottledError is returned when login attempts are temporarily blocked for an account or client IP.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// RetryAfterSeconds returns the value for the Retry-After header, rounded up to whole seconds.
+func (e *LoginThrottledError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// LoginAuditEvent is the kind of a login audit log entry.
+type LoginAuditEvent string
+
+const (
+	LoginAuditSuccess LoginAuditEvent = "success" // successful password login
+	LoginAuditFailure LoginAuditEvent = "failure" // wrong email or password
+	LoginAuditLockout LoginAuditEvent = "lockout" // an account or client IP was locked
+	LoginAuditBlocked LoginAuditEvent = "blocked" // an attempt was rejected during a lockout
+)
+
+// LoginAuditEntry is an entry of the login audit log.
+type LoginAuditEntry struct {
+	ID        int64           `json:"id"`
+	Event     LoginAuditEvent `json:"event"`
+	Email     string          `json:"email"`
+	IP        string          `json:"ip"`
+	UserID    *int64          `json:"user_id,omitempty"`
+	Detail    string          `json:"detail,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// MFAChallengeResponse is returned by a password login when the user has two-factor authentication enabled.
+// The login is completed by sending MFAToken together with a TOTP or recovery code.
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"` // always true
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"` // expiry of the challenge
+}
+
+// MFALoginRequest is the request body for completing a login with a second factor.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP code or recovery code
+}
+
+// MFACodeRequest is the request body for confirming a TOTP enrollment or managing an enabled second factor.
+type MFACodeRequest struct {
+	Code string `json:"code"` // TOTP code or, where accepted, a recovery code
+}
+
+// TOTPEnrollmentResponse is returned when a user starts enrolling an authenticator app.
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`      // base32 secret for manual entry
+	URI    string `json:"otpauth_uri"` // otpauth:// URI, usually shown as a QR code
+}
+
+// RecoveryCodesResponse contains newly generated recovery codes. They are shown only once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAStatus describes the two-factor authentication settings of a user.
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so the server can tell them apart from JWTs.
+const PersonalAccessTokenPrefix = "pat_"
+
+// TokenScope is an operation a personal access token is allowed to perform.
+type TokenScope string
+
+const (
+	// TokenScopeRead allows read-only requests (GET, HEAD).
+	TokenScopeRead TokenScope = "read"
+	// TokenScopeWrite allows requests that change data (POST, PUT, DELETE).
+	TokenScopeWrite TokenScope = "write"
+	// TokenScopeAdmin allows the admin endpoints, as long as the owner still has the admin role.
+	TokenScopeAdmin TokenScope = "admin"
+)
+
+// Valid reports whether the scope is a known value.
+func (s TokenScope) Valid() bool {
+	return s == TokenScopeRead || s == TokenScopeWrite || s == TokenScopeAdmin
+}
+
+// PersonalAccessToken is a named, scoped token a user creates for scripts and integrations.
+// Only its hash is stored; the token itself is shown once when it is created.
+type PersonalAccessToken struct {
+	ID         int64        `json:"id"`
+	UserID     int64        `json:"-"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"` // first characters of the token, to tell tokens apart
+	Scopes     []TokenScope `json:"scopes"`
+	ExpiresAt  *time.Time   `json:"expires_at"` // nil if the token never expires
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	LastUsedIP string       `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UserRole   UserRole     `json:"-"` // current role of the owner, set when the token is used
+}
+
+// HasScope reports whether the token grants the scope.
+func (t *PersonalAccessToken) HasScope(scope TokenScope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalAccessTokenRequest is the request body for creating a personal access token.
+type CreatePersonalAccessTokenRequest struct {
+	Name      string       `json:"name"`
+	Scopes    []TokenScope `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at"` // omit or null for a token that never expires
+}
+
+// CreatePersonalAccessTokenResponse is returned when a personal access token is created.
+// It is the only response that contains the token itself.
+type CreatePersonalAccessTokenResponse struct {
+	*PersonalAccessToken
+	Token string `json:"token"`
 }
\ No newline at end of file
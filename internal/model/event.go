@@ -0,0 +1,73 @@
+package model
+
+import "time"
+
+// ScheduleEventType is the kind of a schedule change streamed to clients. It is sent as the SSE event name.
+type ScheduleEventType string
+
+const (
+	EventScheduleCreated ScheduleEventType = "schedule.created"
+	EventScheduleUpdated ScheduleEventType = "schedule.updated"
+	EventScheduleDeleted ScheduleEventType = "schedule.deleted"
+)
+
+// Valid reports whether t is a known event type.
+func (t ScheduleEventType) Valid() bool {
+	return t == EventScheduleCreated || t == EventScheduleUpdated || t == EventScheduleDeleted
+}
+
+// ScheduleEvent is a change to a schedule, streamed to the users who can see the schedule.
+type ScheduleEvent struct {
+	// ID identifies the event in the stream. It is assigned when the event is published.
+	ID         string            `json:"-"`
+	Type       ScheduleEventType `json:"type"`
+	ScheduleID int64             `json:"schedule_id"`
+	OwnerType  string            `json:"owner_type"`
+	OwnerID    int64             `json:"owner_id"`
+	ActorID    int64             `json:"actor_id"` // the user who made the change
+	// Schedule is the schedule after the change. It is nil for deletions.
+	// When an update splits a recurring schedule (scope this or following), it is the new schedule.
+	Schedule        *ScheduleResponse `json:"schedule,omitempty"`
+	Scope           RecurrenceScope   `json:"scope,omitempty"`
+	OccurrenceStart *time.Time        `json:"occurrence_start,omitempty"`
+	// AudienceIDs are the participants before and after the change. They receive the event
+	// in addition to the users who can read the owner's calendar.
+	AudienceIDs []int64 `json:"-"`
+}
+
+// NewScheduleEvent creates an event for a change of s by actorID.
+// previous is the schedule before the change, or nil for new schedules.
+func NewScheduleEvent(eventType ScheduleEventType, s, previous *Schedule, actorID int64) *ScheduleEvent {
+	e := &ScheduleEvent{Type: eventType, ActorID: actorID}
+	for _, schedule := range []*Schedule{previous, s} {
+		if schedule == nil {
+			continue
+		}
+		for _, p := range schedule.Participants {
+			e.AudienceIDs = append(e.AudienceIDs, p.ID)
+		}
+	}
+	target := s
+	if previous != nil {
+		target = previous
+	}
+	e.ScheduleID, e.OwnerType, e.OwnerID = target.ID, target.OwnerType, target.OwnerID
+	if eventType != EventScheduleDeleted {
+		e.Schedule = s.ToScheduleResponse()
+	}
+	return e
+}
+
+// VisibleTo reports whether userID receives the event without a share of the owner's calendar,
+// because they own the calendar or take part in the schedule.
+func (e *ScheduleEvent) VisibleTo(userID int64) bool {
+	if e.OwnerType == OwnerUser && e.OwnerID == userID {
+		return true
+	}
+	for _, id := range e.AudienceIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// FreeBusyRequest defines the request body for looking up the busy times of several users.
+type FreeBusyRequest struct {
+	UserIDs []int64   `json:"user_ids"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+}
+
+// BusyInterval is a period in which a user has at least one schedule.
+type BusyInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// UserFreeBusy lists the merged busy intervals of a single user.
+type UserFreeBusy struct {
+	UserID int64          `json:"user_id"`
+	Busy   []BusyInterval `json:"busy"`
+}
+
+// FreeBusyResponse is the response body of a free/busy lookup.
+// Users are returned in the order of the request.
+type FreeBusyResponse struct {
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+	Users []*UserFreeBusy `json:"users"`
+}
+
+// SuggestSlotsRequest defines the request body for finding meeting times.
+type SuggestSlotsRequest struct {
+	ParticipantIDs  []int64   `json:"participant_ids"`
+	DurationMinutes int       `json:"duration_minutes"`
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	// WorkingHours limits candidates to the given days and hours. When omitted, any time is a candidate.
+	WorkingHours *WorkingHours `json:"working_hours"`
+	// MinAttendees is the minimum number of participants that must be free. Defaults to all participants.
+	MinAttendees int `json:"min_attendees"`
+	// StepMinutes is the interval between candidate start times. Defaults to 30.
+	StepMinutes int `json:"step_minutes"`
+	// Limit is the maximum number of slots returned. Defaults to 10.
+	Limit int `json:"limit"`
+}
+
+// WorkingHours describes the days and local hours in which meetings may take place.
+type WorkingHours struct {
+	Start string `json:"start"` // "HH:MM"
+	End   string `json:"end"`   // "HH:MM" ("24:00" for midnight)
+	// Days lists the allowed weekdays as RFC 5545 codes (MO, TU, ...). Defaults to MO-FR.
+	Days []string `json:"days"`
+	// TimeZone is an IANA time zone name such as "Asia/Tokyo". Defaults to UTC.
+	TimeZone string `json:"time_zone"`
+}
+
+// SuggestedSlot is a candidate meeting time.
+type SuggestedSlot struct {
+	Start              time.Time `json:"start"`
+	End                time.Time `json:"end"`
+	AttendeeCount      int       `json:"attendee_count"`
+	AvailableUserIDs   []int64   `json:"available_user_ids"`
+	UnavailableUserIDs []int64   `json:"unavailable_user_ids"`
+}
+
+// SuggestSlotsResponse is the response body of a meeting-time search.
+// Slots are ranked by the number of available participants, then by start time.
+type SuggestSlotsResponse struct {
+	Slots []*SuggestedSlot `json:"slots"`
+}
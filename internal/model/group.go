@@ -0,0 +1,127 @@
+package model
+
+import "time"
+
+// GroupRole is the role of a member in a group.
+// Each role includes the ones below it: member < admin < owner.
+type GroupRole string
+
+const (
+	// RoleNone means the user is not a member of the group.
+	RoleNone GroupRole = ""
+	// RoleMember can read and edit the group calendar.
+	RoleMember GroupRole = "member"
+	// RoleAdmin can additionally rename the group and add or remove members and admins.
+	RoleAdmin GroupRole = "admin"
+	// RoleOwner can additionally manage owners and delete the group.
+	RoleOwner GroupRole = "owner"
+)
+
+var roleRanks = map[GroupRole]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// Valid reports whether r is a role that can be assigned.
+func (r GroupRole) Valid() bool {
+	return roleRanks[r] > 0
+}
+
+// AtLeast reports whether r includes the required role.
+func (r GroupRole) AtLeast(required GroupRole) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// CalendarPermission returns the permission the role grants on the group calendar.
+func (r GroupRole) CalendarPermission() SharePermission {
+	switch {
+	case r.AtLeast(RoleAdmin):
+		return PermissionManage
+	case r.AtLeast(RoleMember):
+		return PermissionWrite
+	default:
+		return PermissionNone
+	}
+}
+
+// Group represents a group of users sharing a group calendar.
+type Group struct {
+	ID          int64
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Members     []*GroupMember
+}
+
+// GroupMember is a user belonging to a group.
+type GroupMember struct {
+	User
+	Role     GroupRole
+	JoinedAt time.Time
+}
+
+// CreateGroupRequest defines the request body for creating a group. The creator becomes its owner.
+type CreateGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// UpdateGroupRequest defines the request body for updating a group.
+// Using pointers to distinguish between empty values and omitted fields.
+type UpdateGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// GroupMemberRequest defines the request body for adding a member or changing their role.
+type GroupMemberRequest struct {
+	UserID int64     `json:"user_id"`
+	Role   GroupRole `json:"role"`
+}
+
+// GroupMemberResponse is a group member returned from the API.
+type GroupMemberResponse struct {
+	UserResponse
+	Role     GroupRole `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ToGroupMemberResponse converts a GroupMember model to a GroupMemberResponse.
+func (m *GroupMember) ToGroupMemberResponse() *GroupMemberResponse {
+	return &GroupMemberResponse{
+		UserResponse: *m.ToUserResponse(),
+		Role:         m.Role,
+		JoinedAt:     m.JoinedAt,
+	}
+}
+
+// GroupResponse defines the structure of a group returned by the API.
+// Members is omitted when listing groups.
+type GroupResponse struct {
+	ID          int64                  `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	Members     []*GroupMemberResponse `json:"members,omitempty"`
+}
+
+// ToGroupResponse converts a Group model to a GroupResponse.
+func (g *Group) ToGroupResponse() *GroupResponse {
+	resp := &GroupResponse{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   g.CreatedAt,
+		UpdatedAt:   g.UpdatedAt,
+	}
+	if g.Members != nil {
+		resp.Members = make([]*GroupMemberResponse, len(g.Members))
+		for i, m := range g.Members {
+			resp.Members[i] = m.ToGroupMemberResponse()
+		}
+	}
+	return resp
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// InvitationEmailStatus is the state of a queued invitation email.
+type InvitationEmailStatus string
+
+const (
+	// InvitationPending emails are waiting for their first attempt or for a retry.
+	InvitationPending InvitationEmailStatus = "pending"
+	// InvitationSent emails were accepted by the mail server.
+	InvitationSent InvitationEmailStatus = "sent"
+	// InvitationFailed emails failed MaxInvitationAttempts times and are not retried.
+	InvitationFailed InvitationEmailStatus = "failed"
+)
+
+// MaxInvitationAttempts is the number of attempts to send an invitation email before it is marked as failed.
+const MaxInvitationAttempts = 8
+
+// InvitationEmail is an iMIP invitation (RFC 6047) queued for one recipient.
+type InvitationEmail struct {
+	ID            int64
+	ScheduleID    int64
+	Recipient     string // email address
+	Subject       string
+	Body          string // plain text part
+	Method        string // iTIP method of the calendar part (REQUEST or CANCEL)
+	Calendar      string // text/calendar part
+	Status        InvitationEmailStatus
+	Attempts      int
+	NextAttemptAt *time.Time
+	LastError     string // error of the last failed attempt
+	CreatedAt     time.Time
+}
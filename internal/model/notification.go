@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Notification types.
+const (
+	// NotificationReminder is a reminder of an upcoming schedule delivered through the ReminderInApp channel.
+	NotificationReminder = "reminder"
+	// NotificationScheduleCreated tells the owner and the participants that another user created a schedule.
+	NotificationScheduleCreated = "schedule_created"
+	// NotificationScheduleUpdated tells the owner and the participants that another user changed a schedule.
+	NotificationScheduleUpdated = "schedule_updated"
+	// NotificationScheduleDeleted tells the owner and the participants that another user deleted a schedule.
+	NotificationScheduleDeleted = "schedule_deleted"
+	// NotificationRSVP tells the owner of a schedule that a participant responded to the invitation.
+	NotificationRSVP = "rsvp"
+)
+
+// Notification is a message shown to a user in the application.
+type Notification struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Type       string     `json:"type"`
+	ScheduleID *int64     `json:"schedule_id,omitempty"`
+	ActorID    *int64     `json:"actor_id,omitempty"` // the user whose action caused the notification
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	ReadAt     *time.Time `json:"read_at"` // nil while unread
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NotificationQuery holds the filter and pagination options for listing notifications, newest first.
+type NotificationQuery struct {
+	UnreadOnly bool
+	// BeforeID starts the page after the notification with this ID. Zero starts from the newest.
+	BeforeID int64
+	Limit    int
+}
+
+// NotificationListResponse is the response envelope for paginated notification lists.
+type NotificationListResponse struct {
+	Notifications []*Notification `json:"notifications"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+	// UnreadCount is the number of unread notifications of the user, regardless of the page.
+	UnreadCount int `json:"unread_count"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// ExternalIdentity is a user account at an external OpenID Connect identity provider,
+// taken from a verified ID token.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Username is the preferred username for a user provisioned on first login.
+	Username string
+}
+
+// OIDCLoginState is what the server remembers between redirecting a user to the identity provider
+// and handling the callback.
+type OIDCLoginState struct {
+	Nonce        string
+	CodeVerifier string
+}
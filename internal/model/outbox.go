@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// MaxOutboxEmailAttempts is the number of attempts to send an outbox email before it is marked as failed.
+const MaxOutboxEmailAttempts = 8
+
+// OutboxEmail is a plain text email to a user's account, such as a password reset, queued for sending.
+// It uses the same statuses as invitation emails.
+type OutboxEmail struct {
+	ID            int64
+	Recipient     string // email address
+	Subject       string
+	Body          string // cleared once the email is sent or has failed
+	Status        InvitationEmailStatus
+	Attempts      int
+	NextAttemptAt *time.Time
+	// ExpiresAt is when the email becomes useless, e.g. when its link expires. It is not sent or retried after that.
+	ExpiresAt time.Time
+	LastError string // error of the last failed attempt
+	CreatedAt time.Time
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// Participant response statuses. They correspond to the iCalendar PARTSTAT values of the same name.
+const (
+	RSVPNeedsAction = "needs-action"
+	RSVPAccepted    = "accepted"
+	RSVPDeclined    = "declined"
+	RSVPTentative   = "tentative"
+)
+
+// ValidRSVPStatus reports whether status is a response a participant may give.
+// RSVPNeedsAction is the initial state and cannot be chosen.
+func ValidRSVPStatus(status string) bool {
+	switch status {
+	case RSVPAccepted, RSVPDeclined, RSVPTentative:
+		return true
+	}
+	return false
+}
+
+// Participant is a user invited to a schedule together with their response.
+type Participant struct {
+	User
+	Status      string
+	Comment     string
+	RespondedAt *time.Time // nil until the participant responds
+	// Direct is false when the user participates only as a member of a linked group.
+	Direct bool
+}
+
+// RSVPRequest is the request body for responding to a schedule invitation.
+type RSVPRequest struct {
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+}
+
+// ParticipantResponse is the participant representation returned from the API.
+type ParticipantResponse struct {
+	UserResponse
+	Status      string     `json:"status"`
+	Comment     string     `json:"comment,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// ToParticipantResponse converts a Participant model to a ParticipantResponse.
+func (p *Participant) ToParticipantResponse() *ParticipantResponse {
+	return &ParticipantResponse{
+		UserResponse: *p.ToUserResponse(),
+		Status:       p.Status,
+		Comment:      p.Comment,
+		RespondedAt:  p.RespondedAt,
+	}
+}
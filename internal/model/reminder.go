@@ -0,0 +1,77 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReminderChannel is the way a reminder is delivered to a user.
+type ReminderChannel string
+
+const (
+	// ReminderEmail sends the reminder to the user's email address.
+	ReminderEmail ReminderChannel = "email"
+	// ReminderWebhook posts the reminder as JSON to the webhook URL in the user's reminder settings.
+	ReminderWebhook ReminderChannel = "webhook"
+	// ReminderInApp adds the reminder to the user's notifications.
+	ReminderInApp ReminderChannel = "in_app"
+)
+
+// Valid reports whether the channel is a known delivery channel.
+func (c ReminderChannel) Valid() bool {
+	return c == ReminderEmail || c == ReminderWebhook || c == ReminderInApp
+}
+
+const (
+	// MaxReminderMinutesBefore is the earliest a reminder can fire before a schedule starts (one week).
+	MaxReminderMinutesBefore = 7 * 24 * 60
+	// MaxReminders is the maximum number of reminders per schedule or in the default reminders.
+	MaxReminders = 5
+)
+
+// Reminder fires MinutesBefore minutes before a schedule starts through Channel.
+type Reminder struct {
+	MinutesBefore int             `json:"minutes_before"`
+	Channel       ReminderChannel `json:"channel"`
+}
+
+// Validate checks the offset and the channel of the reminder.
+func (r Reminder) Validate() error {
+	if r.MinutesBefore < 0 || r.MinutesBefore > MaxReminderMinutesBefore {
+		return fmt.Errorf("minutes_before must be between 0 and %d", MaxReminderMinutesBefore)
+	}
+	if !r.Channel.Valid() {
+		return fmt.Errorf("invalid channel %q: must be email, webhook or in_app", r.Channel)
+	}
+	return nil
+}
+
+// Lead returns how long before the start of a schedule the reminder fires.
+func (r Reminder) Lead() time.Duration {
+	return time.Duration(r.MinutesBefore) * time.Minute
+}
+
+// ReminderSettings holds the reminders a user receives for schedules without their own reminders.
+type ReminderSettings struct {
+	// DefaultReminders apply to every schedule the user owns or participates in.
+	DefaultReminders []Reminder `json:"default_reminders"`
+	// WebhookURL receives reminders of the ReminderWebhook channel.
+	WebhookURL string `json:"webhook_url"`
+}
+
+// ScheduleReminders is the request and response body for the reminders of a schedule.
+type ScheduleReminders struct {
+	Reminders []Reminder `json:"reminders"`
+	// Custom is false when the schedule uses the user's default reminders.
+	Custom bool `json:"custom"`
+}
+
+// DueReminder is a reminder that should be delivered now for an occurrence of a schedule.
+type DueReminder struct {
+	Reminder
+	// User is the recipient: the owner or a participant of the schedule.
+	User       User
+	WebhookURL string
+	// Schedule is the occurrence the reminder is for. Recurring schedules are expanded.
+	Schedule *Schedule
+}
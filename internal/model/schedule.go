@@ -1,77 +1,306 @@
 package model
 
-import "time"
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleUID returns the iCalendar UID assigned to schedules created in this application.
+func ScheduleUID(scheduleID int64) string {
+	return fmt.Sprintf("schedule-%d@schedule-app", scheduleID)
+}
+
+// Owner types of a schedule: the calendar it belongs to is either a user's or a group's.
+const (
+	OwnerUser  = "user"
+	OwnerGroup = "group"
+)
 
 // Schedule represents a schedule event in the database.
 type Schedule struct {
 	ID           int64
+	UID          string // iCalendar UID. Overrides of a single occurrence share the UID of their series.
 	Title        string
 	StartTime    time.Time
 	EndTime      time.Time
 	Description  string
 	Location     string
-	OwnerID      int64
+	OwnerID      int64  // The ID of the user or group, depending on OwnerType.
+	OwnerType    string // OwnerUser or OwnerGroup.
 	CreatorID    int64
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
-	Participants []*User
+	Participants []*Participant
+	// LinkedGroupIDs lists the groups invited with a live link. Their current members are always participants.
+	LinkedGroupIDs []int64
+
+	// RecurrenceRule is an RFC 5545 RRULE value (e.g. "FREQ=WEEKLY;BYDAY=MO"). Empty for single events.
+	RecurrenceRule string
+	// ExDates lists occurrence start times excluded from the recurrence (EXDATE).
+	ExDates []time.Time
+	// SeriesID is the ID of the recurring schedule this row overrides or was split from.
+	SeriesID *int64
+	// RecurrenceID is the original start time of the occurrence (RECURRENCE-ID).
+	// It is set on expanded occurrences and on rows overriding a single occurrence.
+	RecurrenceID *time.Time
+	// Sequence is the iCalendar SEQUENCE. It is incremented by each change that updates the invitations of the participants.
+	Sequence int
+}
+
+// RecurrenceScope specifies which occurrences of a recurring schedule an update or delete applies to.
+type RecurrenceScope string
+
+const (
+	// ScopeThis applies the change to a single occurrence only.
+	ScopeThis RecurrenceScope = "this"
+	// ScopeFollowing applies the change to the given occurrence and all following ones.
+	ScopeFollowing RecurrenceScope = "following"
+	// ScopeAll applies the change to every occurrence of the series.
+	ScopeAll RecurrenceScope = "all"
+)
+
+// IsRecurring reports whether the schedule has a recurrence rule.
+func (s *Schedule) IsRecurring() bool {
+	return s.RecurrenceRule != ""
+}
+
+// OwnedByUser reports whether the schedule belongs to the personal calendar of the user.
+func (s *Schedule) OwnedByUser(userID int64) bool {
+	return s.OwnerType == OwnerUser && s.OwnerID == userID
+}
+
+// HasParticipant reports whether the user is a participant of the schedule.
+func (s *Schedule) HasParticipant(userID int64) bool {
+	for _, p := range s.Participants {
+		if p.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// BusyFor reports whether the schedule makes the user busy: it is on the user's personal calendar,
+// or the user is a participant who has not declined it.
+func (s *Schedule) BusyFor(userID int64) bool {
+	if s.OwnedByUser(userID) {
+		return true
+	}
+	for _, p := range s.Participants {
+		if p.ID == userID {
+			return p.Status != RSVPDeclined
+		}
+	}
+	return false
 }
 
 // CreateScheduleRequest defines the request body for creating a new schedule.
 type CreateScheduleRequest struct {
-	Title          string    `json:"title"`
-	StartTime      time.Time `json:"start_time"`
-	EndTime        time.Time `json:"end_time"`
-	Description    string    `json:"description"`
-	Location       string    `json:"location"`
-	OwnerID        int64     `json:"owner_id"` // The ID of the user whose calendar this event belongs to.
-	ParticipantIDs []int64   `json:"participant_ids"`
+	Title          string      `json:"title"`
+	StartTime      time.Time   `json:"start_time"`
+	EndTime        time.Time   `json:"end_time"`
+	Description    string      `json:"description"`
+	Location       string      `json:"location"`
+	OwnerID        int64       `json:"owner_id"`   // The ID of the user or group whose calendar this event belongs to.
+	OwnerType      string      `json:"owner_type"` // OwnerUser (default) or OwnerGroup.
+	ParticipantIDs []int64     `json:"participant_ids"`
+	RecurrenceRule string      `json:"recurrence_rule"`
+	ExDates        []time.Time `json:"exdates"`
+	// ParticipantGroupIDs invites every member of these groups. The requester must be a member of each group.
+	ParticipantGroupIDs []int64 `json:"participant_group_ids"`
+	// LinkGroups keeps ParticipantGroupIDs linked to the schedule, so that users who join a group later become
+	// participants and users who leave stop being participants. Otherwise the current members are added once.
+	LinkGroups bool `json:"link_groups"`
+	// AllowConflicts creates the schedule even if it overlaps schedules of the owner or participants.
+	AllowConflicts bool `json:"allow_conflicts"`
+
+	// UID and RecurrenceID are only set when importing from iCalendar.
+	UID          string     `json:"-"`
+	RecurrenceID *time.Time `json:"-"`
 }
 
 // UpdateScheduleRequest defines the request body for updating an existing schedule.
 // Using pointers to distinguish between empty values and omitted fields.
 type UpdateScheduleRequest struct {
-	Title          *string    `json:"title"`
-	StartTime      *time.Time `json:"start_time"`
-	EndTime        *time.Time `json:"end_time"`
-	Description    *string    `json:"description"`
-	Location       *string    `json:"location"`
-	ParticipantIDs *[]int64   `json:"participant_ids"`
+	Title          *string      `json:"title"`
+	StartTime      *time.Time   `json:"start_time"`
+	EndTime        *time.Time   `json:"end_time"`
+	Description    *string      `json:"description"`
+	Location       *string      `json:"location"`
+	ParticipantIDs *[]int64     `json:"participant_ids"`
+	RecurrenceRule *string      `json:"recurrence_rule"`
+	ExDates        *[]time.Time `json:"exdates"`
+	// ParticipantGroupIDs invites every member of these groups. With LinkGroups it replaces the linked groups;
+	// otherwise the current members are added to the participants (or to ParticipantIDs if it is set).
+	ParticipantGroupIDs *[]int64 `json:"participant_group_ids"`
+	LinkGroups          bool     `json:"link_groups"`
+	// AllowConflicts saves the change even if it makes the schedule overlap schedules of the owner or participants.
+	AllowConflicts bool `json:"allow_conflicts"`
+
+	// Scope selects the occurrences to update for recurring schedules. Defaults to ScopeAll.
+	Scope RecurrenceScope `json:"scope"`
+	// OccurrenceStart is the original start time of the target occurrence.
+	// Required when Scope is ScopeThis or ScopeFollowing.
+	OccurrenceStart *time.Time `json:"occurrence_start"`
+}
+
+// DeleteScheduleRequest holds the options for deleting a schedule.
+// For recurring schedules the options are taken from the "scope" and "occurrence_start" query parameters.
+type DeleteScheduleRequest struct {
+	Scope           RecurrenceScope
+	OccurrenceStart *time.Time
 }
 
 // ScheduleResponse defines the structure of a schedule event returned by the API.
 type ScheduleResponse struct {
-	ID           int64          `json:"id"`
-	Title        string         `json:"title"`
-	StartTime    time.Time      `json:"start_time"`
-	EndTime      time.Time      `json:"end_time"`
-	Description  string         `json:"description"`
-	Location     string         `json:"location"`
-	OwnerID      int64          `json:"owner_id"`
-	CreatorID    int64          `json:"creator_id"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	Participants []*UserResponse `json:"participants"`
+	ID           int64                  `json:"id"`
+	UID          string                 `json:"uid"`
+	Title        string                 `json:"title"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	Description  string                 `json:"description"`
+	Location     string                 `json:"location"`
+	OwnerID      int64                  `json:"owner_id"`
+	OwnerType    string                 `json:"owner_type"`
+	CreatorID    int64                  `json:"creator_id"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	Participants []*ParticipantResponse `json:"participants"`
+	// ParticipantGroupIDs lists the linked groups whose members are participants.
+	ParticipantGroupIDs []int64 `json:"participant_group_ids,omitempty"`
+
+	RecurrenceRule string      `json:"recurrence_rule,omitempty"`
+	ExDates        []time.Time `json:"exdates,omitempty"`
+	SeriesID       *int64      `json:"series_id,omitempty"`
+	RecurrenceID   *time.Time  `json:"recurrence_id,omitempty"`
 }
 
 // ToScheduleResponse converts a Schedule model to a ScheduleResponse.
 func (s *Schedule) ToScheduleResponse() *ScheduleResponse {
-	participants := make([]*UserResponse, len(s.Participants))
+	participants := make([]*ParticipantResponse, len(s.Participants))
 	for i, p := range s.Participants {
-		participants[i] = p.ToUserResponse()
+		participants[i] = p.ToParticipantResponse()
 	}
 
 	return &ScheduleResponse{
 		ID:           s.ID,
+		UID:          s.UID,
 		Title:        s.Title,
 		StartTime:    s.StartTime,
 		EndTime:      s.EndTime,
 		Description:  s.Description,
 		Location:     s.Location,
 		OwnerID:      s.OwnerID,
+		OwnerType:    s.OwnerType,
 		CreatorID:    s.CreatorID,
 		CreatedAt:    s.CreatedAt,
 		UpdatedAt:    s.UpdatedAt,
 		Participants: participants,
+
+		ParticipantGroupIDs: s.LinkedGroupIDs,
+
+		RecurrenceRule: s.RecurrenceRule,
+		ExDates:        s.ExDates,
+		SeriesID:       s.SeriesID,
+		RecurrenceID:   s.RecurrenceID,
 	}
-}
\ No newline at end of file
+}
+
+// ScheduleQuery holds the time window and pagination options for listing schedules.
+type ScheduleQuery struct {
+	// From and To select schedules overlapping [From, To). A zero value leaves that side unbounded.
+	From time.Time
+	To   time.Time
+	// Cursor is the position after which the page starts. Nil starts from the beginning.
+	Cursor *ScheduleCursor
+	// Limit is the maximum number of schedules to return. Zero means no limit.
+	Limit int
+	// KeepSeries returns recurring schedules as a single series row instead of expanding
+	// them into occurrences. A series is included when any of its occurrences overlaps the window.
+	KeepSeries bool
+}
+
+// ScheduleCursor identifies a position in a list of schedules ordered by start time and ID.
+type ScheduleCursor struct {
+	StartUnix int64
+	ID        int64
+}
+
+// CursorAfter returns the cursor pointing just after the given schedule.
+func CursorAfter(s *Schedule) *ScheduleCursor {
+	return &ScheduleCursor{StartUnix: s.StartTime.Unix(), ID: s.ID}
+}
+
+// Precedes reports whether the cursor position is before the given schedule.
+func (c *ScheduleCursor) Precedes(s *Schedule) bool {
+	start := s.StartTime.Unix()
+	return start > c.StartUnix || (start == c.StartUnix && s.ID > c.ID)
+}
+
+// Encode returns the opaque string representation of the cursor.
+func (c *ScheduleCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.StartUnix, c.ID)))
+}
+
+// DecodeScheduleCursor parses a cursor produced by Encode.
+func DecodeScheduleCursor(s string) (*ScheduleCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	startStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	return &ScheduleCursor{StartUnix: start, ID: id}, nil
+}
+
+// ScheduleListResponse is the response envelope for paginated schedule lists.
+type ScheduleListResponse struct {
+	Schedules  []*ScheduleResponse `json:"schedules"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// ImportEventResult reports the outcome of importing a single VEVENT.
+type ImportEventResult struct {
+	UID          string     `json:"uid"`
+	RecurrenceID *time.Time `json:"recurrence_id,omitempty"`
+	Title        string     `json:"title"`
+	ScheduleID   int64      `json:"schedule_id,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	// UnmatchedAttendees lists attendee addresses that do not belong to any user.
+	UnmatchedAttendees []string `json:"unmatched_attendees,omitempty"`
+}
+
+// ImportSchedulesResponse is the response body of an iCalendar import.
+type ImportSchedulesResponse struct {
+	Created []*ImportEventResult `json:"created"`
+	Skipped []*ImportEventResult `json:"skipped"`
+	Failed  []*ImportEventResult `json:"failed"`
+}
+
+// ScheduleConflict describes an existing schedule that overlaps a schedule being saved.
+type ScheduleConflict struct {
+	ScheduleID int64 `json:"schedule_id"`
+	// UserIDs lists the owner and participants who would be double-booked.
+	UserIDs []int64 `json:"user_ids"`
+	// StartTime and EndTime are those of the first overlapping occurrence of the existing schedule.
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// ScheduleConflictResponse is the 409 response body returned when a schedule conflicts with existing ones.
+type ScheduleConflictResponse struct {
+	Error     string              `json:"error"`
+	Conflicts []*ScheduleConflict `json:"conflicts"`
+}
@@ -0,0 +1,99 @@
+package model
+
+import "time"
+
+// SharePermission is the level of access granted on another user's (or a group's) calendar.
+// Each level includes the ones below it: free-busy < read < write < manage.
+type SharePermission string
+
+const (
+	// PermissionNone means the calendar is not shared.
+	PermissionNone SharePermission = ""
+	// PermissionFreeBusy allows looking up busy times only.
+	PermissionFreeBusy SharePermission = "free-busy"
+	// PermissionRead allows reading schedules.
+	PermissionRead SharePermission = "read"
+	// PermissionWrite allows creating, updating and deleting schedules.
+	PermissionWrite SharePermission = "write"
+	// PermissionManage additionally allows granting and revoking shares. Owners always have it.
+	PermissionManage SharePermission = "manage"
+)
+
+var permissionRanks = map[SharePermission]int{
+	PermissionFreeBusy: 1,
+	PermissionRead:     2,
+	PermissionWrite:    3,
+	PermissionManage:   4,
+}
+
+// Max returns the higher of p and other.
+func (p SharePermission) Max(other SharePermission) SharePermission {
+	if permissionRanks[other] > permissionRanks[p] {
+		return other
+	}
+	return p
+}
+
+// Valid reports whether p is a permission that can be granted.
+func (p SharePermission) Valid() bool {
+	return permissionRanks[p] > 0
+}
+
+// Allows reports whether p includes the required permission.
+func (p SharePermission) Allows(required SharePermission) bool {
+	return permissionRanks[p] >= permissionRanks[required]
+}
+
+// Grantee types of a calendar share.
+const (
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+)
+
+// CalendarShare grants a user, or every member of a group, access to the calendar of OwnerID.
+type CalendarShare struct {
+	ID          int64
+	OwnerID     int64
+	GranteeType string
+	GranteeID   int64
+	Permission  SharePermission
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ShareRequest is the request body for granting access to a calendar.
+// Exactly one of UserID and GroupID must be set.
+type ShareRequest struct {
+	UserID     int64           `json:"user_id"`
+	GroupID    int64           `json:"group_id"`
+	Permission SharePermission `json:"permission"`
+}
+
+// ShareResponse is the calendar share representation returned from the API.
+type ShareResponse struct {
+	ID         int64           `json:"id"`
+	OwnerID    int64           `json:"owner_id"`
+	UserID     int64           `json:"user_id,omitempty"`
+	GroupID    int64           `json:"group_id,omitempty"`
+	Permission SharePermission `json:"permission"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// ToShareResponse converts a CalendarShare model to a ShareResponse.
+func (s *CalendarShare) ToShareResponse() *ShareResponse {
+	resp := &ShareResponse{
+		ID:         s.ID,
+		OwnerID:    s.OwnerID,
+		Permission: s.Permission,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+	switch s.GranteeType {
+	case GranteeUser:
+		resp.UserID = s.GranteeID
+	case GranteeGroup:
+		resp.GroupID = s.GranteeID
+	}
+	return resp
+}
@@ -1,14 +1,41 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// UserRole はシステム全体でのユーザーのロールです。グループ内の役割 (GroupRole) とは別のものです。
+type UserRole string
+
+const (
+	// UserRoleUser は一般ユーザーです。
+	UserRoleUser UserRole = "user"
+	// UserRoleAdmin は管理者用エンドポイント (/api/admin/*) を利用できる管理者です。
+	UserRoleAdmin UserRole = "admin"
+)
+
+// Valid はロールが割り当て可能な値かどうかを返します。
+func (r UserRole) Valid() bool {
+	return r == UserRoleUser || r == UserRoleAdmin
+}
 
 // User はデータベースの users テーブルに対応する構造体です。
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // パスワードハッシュはJSONに含めない
-	CreatedAt    time.Time `json:"created_at"`
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"` // パスワードハッシュはJSONに含めない
+	Role            UserRole   `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // メールアドレスを確認した日時 (未確認の場合は nil)
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// HasControlCharacter は s が改行などの制御文字を含むかどうかを返します。
+// ユーザー名は iCalendar のフィードや招待メールにそのまま出力するため、制御文字を含むものは使用できません。
+func HasControlCharacter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
 }
 
 // RegisterUserRequest はユーザー登録APIのリクエストボディを表します。
@@ -24,20 +51,46 @@ type LoginUserRequest struct {
 	Password string `json:"password"`
 }
 
+// UpdateUserRoleRequest は管理者がユーザーのロールを変更するAPIのリクエストボディを表します。
+type UpdateUserRoleRequest struct {
+	Role UserRole `json:"role"`
+}
+
+// BootstrapAdminRequest は最初の管理者を作成するAPIのリクエストボディを表します。
+type BootstrapAdminRequest struct {
+	Token string `json:"token"`
+}
+
 // UserResponse はAPIから返すユーザー情報の構造体です。
 type UserResponse struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // ToUserResponse は User モデルを UserResponse に変換します。
 func (u *User) ToUserResponse() *UserResponse {
 	return &UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+// AdminUserResponse は管理者用APIから返すユーザー情報の構造体で、ロールを含みます。
+type AdminUserResponse struct {
+	UserResponse
+	Role UserRole `json:"role"`
+}
+
+// ToAdminUserResponse は User モデルを AdminUserResponse に変換します。
+func (u *User) ToAdminUserResponse() *AdminUserResponse {
+	return &AdminUserResponse{
+		UserResponse: *u.ToUserResponse(),
+		Role:         u.Role,
 	}
 }
\ No newline at end of file
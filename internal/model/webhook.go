@@ -0,0 +1,111 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookScope determines which schedule changes a webhook subscription receives.
+type WebhookScope string
+
+const (
+	// WebhookScopeUser receives changes to the calendars the user who registered the subscription can see.
+	WebhookScopeUser WebhookScope = "user"
+	// WebhookScopeAll receives every change. Only admins can manage these subscriptions.
+	WebhookScopeAll WebhookScope = "all"
+)
+
+// WebhookDeliveryStatus is the state of a webhook delivery.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookPending deliveries are waiting for their first attempt or for a retry.
+	WebhookPending WebhookDeliveryStatus = "pending"
+	// WebhookSucceeded deliveries were answered with a 2xx status.
+	WebhookSucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookFailed deliveries failed MaxWebhookAttempts times. They can be redelivered manually.
+	WebhookFailed WebhookDeliveryStatus = "failed"
+)
+
+// MaxWebhookAttempts is the number of attempts of a delivery before it is marked as failed.
+const MaxWebhookAttempts = 8
+
+// WebhookSubscription is a URL that receives schedule changes as signed HTTP POST requests.
+type WebhookSubscription struct {
+	ID     int64        `json:"id"`
+	UserID int64        `json:"user_id"` // the user who registered the subscription
+	Scope  WebhookScope `json:"scope"`
+	URL    string       `json:"url"`
+	// EventTypes filters the events to deliver. Empty delivers every type.
+	EventTypes []ScheduleEventType `json:"event_types"`
+	Secret     string              `json:"-"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+// Accepts reports whether the subscription receives events of the given type.
+func (s *WebhookSubscription) Accepts(eventType ScheduleEventType) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhookRequest is the request body for registering a webhook subscription.
+type CreateWebhookRequest struct {
+	URL        string              `json:"url"`
+	EventTypes []ScheduleEventType `json:"event_types"`
+}
+
+// CreateWebhookResponse is returned when a webhook subscription is registered.
+// It is the only response that contains the signing secret.
+type CreateWebhookResponse struct {
+	*WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the JSON body posted to webhook subscribers.
+type WebhookPayload struct {
+	// ID identifies the event. It is shared by the deliveries of the same event, but differs from the ID in the event stream.
+	ID        string            `json:"id"`
+	Type      ScheduleEventType `json:"type"`
+	CreatedAt time.Time         `json:"created_at"`
+	Data      *ScheduleEvent    `json:"data"`
+}
+
+// WebhookDelivery is an event queued for a webhook subscription, with its attempts.
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	SubscriptionID int64                 `json:"subscription_id"`
+	EventID        string                `json:"event_id"`
+	EventType      ScheduleEventType     `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"` // attempts since the delivery was queued or redelivered
+	// NextAttemptAt is when the delivery is attempted next. Nil once it succeeded or failed.
+	NextAttemptAt *time.Time        `json:"next_attempt_at"`
+	CreatedAt     time.Time         `json:"created_at"`
+	AttemptLog    []*WebhookAttempt `json:"attempt_log,omitempty"`
+
+	// Secret and URL are those of the subscription. They are set for deliveries to send.
+	Secret string `json:"-"`
+	URL    string `json:"-"`
+}
+
+// WebhookAttempt is the outcome of a single attempt to deliver a webhook.
+type WebhookAttempt struct {
+	// StatusCode is the HTTP status of the response. Nil if no response was received.
+	StatusCode  *int      `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// Succeeded reports whether the attempt was answered with a 2xx status.
+func (a *WebhookAttempt) Succeeded() bool {
+	return a.StatusCode != nil && *a.StatusCode >= 200 && *a.StatusCode <= 299
+}
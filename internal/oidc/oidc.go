@@ -0,0 +1,234 @@
+// Package oidc は OpenID Connect (Core 1.0) の認可コードフローによるログインを、リライングパーティー (クライアント) として実装します。
+// ディスカバリー、PKCE (RFC 7636)、トークンエンドポイントでのコードの交換、JWKS による ID トークンの検証に対応します。
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultScopes は認可リクエストで要求するスコープです。メールアドレスでユーザーを紐付けるため email を含みます。
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// Config はIDプロバイダーに登録したクライアントの設定です。
+type Config struct {
+	// IssuerURL はIDプロバイダーの issuer です。ディスカバリー文書は IssuerURL + "/.well-known/openid-configuration" から取得します。
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // 空の場合はパブリッククライアントとして PKCE のみで認証します
+	RedirectURL  string
+	Scopes       []string // 空の場合は DefaultScopes
+}
+
+// discoveryDocument はディスカバリー文書のうち、使用する項目です。
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider はディスカバリー文書で設定したIDプロバイダーです。
+type Provider struct {
+	config                Config
+	client                *http.Client
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	keys                  *keySet
+}
+
+// Discover はディスカバリー文書を取得して Provider を生成します。client が nil の場合は http.DefaultClient を使用します。
+func Discover(ctx context.Context, client *http.Client, config Config) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	wellKnown := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var doc discoveryDocument
+	if err := getJSON(ctx, client, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	// なりすましを防ぐため、ディスカバリー文書の issuer は設定と一致する必要がある (OpenID Connect Discovery 4.3)
+	if doc.Issuer != config.IssuerURL {
+		return nil, fmt.Errorf("issuer %q in discovery document does not match %q", doc.Issuer, config.IssuerURL)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document lacks a required endpoint")
+	}
+
+	return &Provider{
+		config:                config,
+		client:                client,
+		issuer:                doc.Issuer,
+		authorizationEndpoint: doc.AuthorizationEndpoint,
+		tokenEndpoint:         doc.TokenEndpoint,
+		keys:                  &keySet{client: client, uri: doc.JWKSURI},
+	}, nil
+}
+
+// Issuer はIDプロバイダーの issuer を返します。
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL はユーザーをリダイレクトする認可リクエストのURLを返します。
+// codeChallenge は PKCE の S256 チャレンジ (NewPKCE で生成) です。
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authorizationEndpoint + sep + v.Encode()
+}
+
+// tokenResponse はトークンエンドポイントの応答のうち、使用する項目です。
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange は認可コードをトークンエンドポイントで交換し、ID トークン (未検証) を返します。
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response does not contain an id_token")
+	}
+	return token.IDToken, nil
+}
+
+// IDToken は検証済みの ID トークンのクレームです。
+type IDToken struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// VerifyIDToken は ID トークンの署名・issuer・audience・有効期限・nonce を検証します (OpenID Connect Core 3.1.3.7)。
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	claims := &IDToken{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.find(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: missing sub claim")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// NewPKCE は PKCE のコード検証子と、その S256 チャレンジを生成します。
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, S256Challenge(verifier), nil
+}
+
+// S256Challenge はコード検証子の S256 チャレンジ (BASE64URL(SHA256(verifier))) を返します。
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString は state や nonce に使用する推測できないランダムな文字列を返します。
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// getJSON は URL から JSON を取得してデコードします。
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
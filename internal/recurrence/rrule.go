@@ -0,0 +1,491 @@
+// Package recurrence は RFC 5545 の RRULE (繰り返しルール) の解析と展開を提供します。
+//
+// サポートしているルールパートは FREQ (DAILY/WEEKLY/MONTHLY/YEARLY), INTERVAL,
+// BYDAY, BYMONTHDAY, COUNT, UNTIL です。週の開始曜日は月曜日 (WKST=MO) 固定です。
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency は繰り返しの頻度 (FREQ) を表します。
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// MaxOccurrences は1つのルールから展開する発生回数の上限です。
+// UNTIL も COUNT も持たない無期限のルールを安全に扱うために使用します。
+const MaxOccurrences = 1000
+
+// maxPeriods は候補が見つからない場合でもループを打ち切るための上限です。
+const maxPeriods = 100000
+
+// UNTIL で使用する書式です。untilLayout は UTC 日時、floatingLayout はタイムゾーンのないローカル日時、dateLayout は日付です。
+const (
+	untilLayout    = "20060102T150405Z"
+	floatingLayout = "20060102T150405"
+	dateLayout     = "20060102"
+)
+
+// WeekdayNum は BYDAY の1要素を表します。N が0以外の場合は月内の第N週 (負数は末尾から) を意味します。
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule は解析済みの RRULE です。
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+	// UntilFloating は UNTIL がタイムゾーンのないローカル日時であることを示します。
+	// この場合、Until の年月日・時刻を dtstart のタイムゾーンで解釈します。
+	UntilFloating bool
+	// UntilDate は UNTIL が日付のみであることを示します (UntilFloating も true です)。その日の終わりまでの発生を含みます。
+	UntilDate bool
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Parse は "FREQ=WEEKLY;BYDAY=MO,WE" のような RRULE 文字列を解析します。
+// 先頭の "RRULE:" プレフィックスは省略可能です。
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		value = strings.ToUpper(strings.TrimSpace(value))
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "FREQ":
+			switch f := Frequency(value); f {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = f
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			if err := rule.parseUntil(value); err != nil {
+				return nil, err
+			}
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("unsupported WKST %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL must not both be set")
+	}
+	for _, wd := range rule.ByDay {
+		if wd.N != 0 && rule.Freq != Monthly && rule.Freq != Yearly {
+			return nil, fmt.Errorf("BYDAY with ordinal is only allowed for MONTHLY or YEARLY")
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq == Weekly {
+		return nil, fmt.Errorf("BYMONTHDAY is not allowed for WEEKLY")
+	}
+	return rule, nil
+}
+
+// parseUntil は UNTIL の値を解析して Until, UntilFloating, UntilDate を設定します。
+// タイムゾーンのない日時と日付は、dtstart が分かるまで UTC の年月日・時刻として保持します。
+func (r *Rule) parseUntil(value string) error {
+	if t, err := time.Parse(untilLayout, value); err == nil {
+		r.Until = t
+		return nil
+	}
+	if t, err := time.Parse(floatingLayout, value); err == nil {
+		r.Until, r.UntilFloating = t, true
+		return nil
+	}
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		r.Until, r.UntilFloating, r.UntilDate = t, true, true
+		return nil
+	}
+	return fmt.Errorf("invalid UNTIL %q", value)
+}
+
+// until は dtstart のタイムゾーンで解釈した UNTIL を返します。この時刻以前に開始する発生を含みます。
+// 日付のみの UNTIL は、その日の終わりまでを含みます。
+func (r *Rule) until(loc *time.Location) time.Time {
+	if r.Until.IsZero() || !r.UntilFloating {
+		return r.Until
+	}
+	y, m, d := r.Until.Date()
+	if r.UntilDate {
+		return time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+	}
+	hh, mm, ss := r.Until.Clock()
+	return time.Date(y, m, d, hh, mm, ss, r.Until.Nanosecond(), loc)
+}
+
+func parseWeekdayNum(v string) (WeekdayNum, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", v)
+	}
+	day, ok := weekdayCodes[v[len(v)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", v)
+	}
+	wd := WeekdayNum{Day: day}
+	if prefix := v[:len(v)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", v)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+// String はルールを RRULE 文字列 ("RRULE:" プレフィックスなし) に変換します。
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = weekdayNames[wd.Day]
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	switch {
+	case r.Until.IsZero():
+	case r.UntilDate:
+		parts = append(parts, "UNTIL="+r.Until.Format(dateLayout))
+	case r.UntilFloating:
+		parts = append(parts, "UNTIL="+r.Until.Format(floatingLayout))
+	default:
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences は dtstart から始まる発生時刻を昇順で返します。
+// dtstart は常に最初の発生として扱います (RFC 5545 3.3.10)。
+// 展開は COUNT/UNTIL に達するか、開始時刻が before 以降になった時点で終了します (before がゼロ値の場合は無制限)。
+// 無期限のルールを安全に扱うため、最大 MaxOccurrences 件で打ち切ります。
+func (r *Rule) Occurrences(dtstart, before time.Time) []time.Time {
+	var result []time.Time
+	r.iterate(dtstart, time.Time{}, before, func(t time.Time) bool {
+		result = append(result, t)
+		return len(result) < MaxOccurrences
+	})
+	return result
+}
+
+// Between は [from, to) の時間窓と重なる発生の開始時刻を返します。
+// duration は1回の発生の長さで、exdates に含まれる開始時刻は除外されます。
+// from/to がゼロ値の場合、その方向は無制限として扱います。
+// COUNT のないルールは時間窓の直前の期間から展開するため、dtstart からどれだけ後の時間窓でも発生を返します。
+// 時間窓内の発生が MaxOccurrences 件に達した時点で打ち切ります。
+func (r *Rule) Between(dtstart time.Time, duration time.Duration, from, to time.Time, exdates []time.Time) []time.Time {
+	var result []time.Time
+	r.EachBetween(dtstart, duration, from, to, exdates, func(occ time.Time) bool {
+		result = append(result, occ)
+		return len(result) < MaxOccurrences
+	})
+	return result
+}
+
+// EachBetween は Between と同じ発生の開始時刻を昇順で yield に渡します。yield が false を返すと終了します。
+// 件数の上限はないため、時間窓の終了がない場合は yield で打ち切ってください。
+func (r *Rule) EachBetween(dtstart time.Time, duration time.Duration, from, to time.Time, exdates []time.Time, yield func(time.Time) bool) {
+	excluded := make(map[int64]bool, len(exdates))
+	for _, ex := range exdates {
+		excluded[ex.Unix()] = true
+	}
+
+	// from より前に開始して from 以降に終わる発生も時間窓と重なる
+	var skipBefore time.Time
+	if !from.IsZero() {
+		skipBefore = from.Add(-duration)
+	}
+	r.iterate(dtstart, skipBefore, to, func(occ time.Time) bool {
+		if excluded[occ.Unix()] || !Overlaps(occ, occ.Add(duration), from, to) {
+			return true
+		}
+		return yield(occ)
+	})
+}
+
+// Overlaps は [start, end) が時間窓 [from, to) と重なるかを判定します。
+// from/to がゼロ値の場合、その方向は無制限として扱います。長さ0の予定は開始時刻で判定します。
+func Overlaps(start, end, from, to time.Time) bool {
+	if !to.IsZero() && !start.Before(to) {
+		return false
+	}
+	if from.IsZero() {
+		return true
+	}
+	if end.Equal(start) {
+		return !start.Before(from)
+	}
+	return end.After(from)
+}
+
+// CountBefore は t より前に開始する発生の件数を返します (EXDATE は考慮しません)。
+func (r *Rule) CountBefore(dtstart, t time.Time) int {
+	n := 0
+	r.iterate(dtstart, time.Time{}, t, func(time.Time) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// iterate は dtstart から始まる発生時刻を昇順で yield に渡します。yield が false を返すと終了します。
+// 展開は COUNT/UNTIL に達するか、開始時刻が before 以降になった時点で終了します (before がゼロ値の場合は無制限)。
+// COUNT のないルールは、skipBefore より前の発生を展開せず、skipBefore を含む期間から展開を始めます。
+// COUNT のあるルールは件数を数えるため、常に dtstart から展開します。
+func (r *Rule) iterate(dtstart, skipBefore, before time.Time, yield func(time.Time) bool) {
+	until := r.until(dtstart.Location())
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if !until.IsZero() && t.After(until) {
+			return false
+		}
+		if !before.IsZero() && !t.Before(before) {
+			return false
+		}
+		emitted++
+		if !yield(t) {
+			return false
+		}
+		return r.Count == 0 || emitted < r.Count
+	}
+
+	first := 0
+	if r.Count == 0 && skipBefore.After(dtstart) {
+		first = r.periodAt(dtstart, skipBefore)
+	}
+	// 読み飛ばした期間より前の dtstart は skipBefore より前
+	if first == 0 && !emit(dtstart) {
+		return
+	}
+	for period := first; period < first+maxPeriods; period++ {
+		candidates := r.candidates(dtstart, period)
+		for _, c := range candidates {
+			if !c.After(dtstart) {
+				continue
+			}
+			if !emit(c) {
+				return
+			}
+		}
+		// 期間の開始がすでに打ち切り条件を超えている場合は終了
+		if len(candidates) == 0 {
+			if start := r.periodStart(dtstart, period); (!until.IsZero() && start.After(until)) || (!before.IsZero() && !start.Before(before)) {
+				return
+			}
+		}
+	}
+}
+
+// periodAt は t を含む期間 (開始が t 以前である最後の期間) の番号を返します。t は dtstart より後である必要があります。
+// 経過時間からおおよその番号を求め、期間の開始日時と比較して補正します。
+func (r *Rule) periodAt(dtstart, t time.Time) int {
+	local := t.In(dtstart.Location())
+	var n int
+	switch r.Freq {
+	case Daily:
+		n = int(t.Sub(dtstart).Hours() / 24)
+	case Weekly:
+		n = int(t.Sub(dtstart).Hours() / (24 * 7))
+	case Monthly:
+		n = (local.Year()-dtstart.Year())*12 + int(local.Month()-dtstart.Month())
+	default: // Yearly
+		n = local.Year() - dtstart.Year()
+	}
+	period := max(n/r.Interval, 0)
+	for period > 0 && r.periodStart(dtstart, period).After(t) {
+		period--
+	}
+	for !r.periodStart(dtstart, period+1).After(t) {
+		period++
+	}
+	return period
+}
+
+// periodStart は period 番目の期間の開始日時を返します。
+func (r *Rule) periodStart(dtstart time.Time, period int) time.Time {
+	n := period * r.Interval
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+	switch r.Freq {
+	case Daily:
+		return time.Date(y, m, d+n, hh, mm, ss, dtstart.Nanosecond(), loc)
+	case Weekly:
+		offset := (int(dtstart.Weekday()) + 6) % 7 // 月曜日からの日数
+		return time.Date(y, m, d-offset+7*n, hh, mm, ss, dtstart.Nanosecond(), loc)
+	case Monthly:
+		return time.Date(y, m+time.Month(n), 1, hh, mm, ss, dtstart.Nanosecond(), loc)
+	default: // Yearly
+		return time.Date(y+n, m, 1, hh, mm, ss, dtstart.Nanosecond(), loc)
+	}
+}
+
+// candidates は period 番目の期間に含まれる発生候補を昇順で返します。
+func (r *Rule) candidates(dtstart time.Time, period int) []time.Time {
+	start := r.periodStart(dtstart, period)
+	var days []time.Time
+
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{start}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			offset := (int(dtstart.Weekday()) + 6) % 7
+			days = []time.Time{start.AddDate(0, 0, offset)}
+		} else {
+			for i := 0; i < 7; i++ {
+				days = append(days, start.AddDate(0, 0, i))
+			}
+		}
+	case Monthly, Yearly:
+		// YEARLY は dtstart と同じ月を対象にします (BYMONTH は未サポート)
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			day := time.Date(start.Year(), start.Month(), dtstart.Day(), start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+			if day.Month() == start.Month() {
+				days = []time.Time{day}
+			}
+		} else {
+			for day := start; day.Month() == start.Month(); day = day.AddDate(0, 0, 1) {
+				days = append(days, day)
+			}
+		}
+	}
+
+	var result []time.Time
+	for _, day := range days {
+		if r.matchByDay(day) && r.matchByMonthDay(day) {
+			result = append(result, day)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result
+}
+
+func (r *Rule) matchByDay(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Day != day.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+		if wd.N > 0 && (day.Day()-1)/7+1 == wd.N {
+			return true
+		}
+		if wd.N < 0 && (daysInMonth(day)-day.Day())/7+1 == -wd.N {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchByMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	for _, md := range r.ByMonthDay {
+		if md > 0 && day.Day() == md {
+			return true
+		}
+		if md < 0 && day.Day() == daysInMonth(day)+md+1 {
+			return true
+		}
+	}
+	return false
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,234 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+// mustParse parses a rule or fails the test.
+func mustParse(t *testing.T, s string) *Rule {
+	t.Helper()
+	rule, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", s, err)
+	}
+	return rule
+}
+
+// equalTimes reports whether two lists contain the same instants in the same order.
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Should parse and format supported rules", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"RRULE:FREQ=DAILY", "FREQ=DAILY"},
+			{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE"},
+			{"freq=monthly;byday=-1fr", "FREQ=MONTHLY;BYDAY=-1FR"},
+			{"FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=5", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=5"},
+			{"FREQ=YEARLY;UNTIL=20301231T000000Z;WKST=MO", "FREQ=YEARLY;UNTIL=20301231T000000Z"},
+			{"FREQ=DAILY;UNTIL=20301231", "FREQ=DAILY;UNTIL=20301231"},
+			{"FREQ=DAILY;UNTIL=20301231T090000", "FREQ=DAILY;UNTIL=20301231T090000"},
+		}
+		for _, tt := range tests {
+			rule, err := Parse(tt.input)
+			if err != nil {
+				t.Errorf("Failed to parse %q: %v", tt.input, err)
+				continue
+			}
+			if got := rule.String(); got != tt.expected {
+				t.Errorf("Expected %q for %q, got %q", tt.expected, tt.input, got)
+			}
+		}
+	})
+
+	t.Run("Should reject invalid rules", func(t *testing.T) {
+		for _, input := range []string{
+			"",
+			"INTERVAL=2",
+			"FREQ=HOURLY",
+			"FREQ=DAILY;INTERVAL=0",
+			"FREQ=DAILY;COUNT=3;UNTIL=20300101T000000Z",
+			"FREQ=WEEKLY;BYDAY=1MO",
+			"FREQ=WEEKLY;BYMONTHDAY=1",
+			"FREQ=MONTHLY;BYMONTHDAY=32",
+			"FREQ=DAILY;WKST=SU",
+			"FREQ=DAILY;BYHOUR=9",
+		} {
+			if _, err := Parse(input); err == nil {
+				t.Errorf("Expected an error for %q", input)
+			}
+		}
+	})
+}
+
+func TestOccurrences(t *testing.T) {
+	dtstart := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC) // Monday
+
+	t.Run("Should expand rules from the start", func(t *testing.T) {
+		tests := []struct {
+			rule     string
+			dtstart  time.Time
+			expected []time.Time
+		}{
+			{"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", dtstart, []time.Time{
+				dtstart, dtstart.AddDate(0, 0, 2), dtstart.AddDate(0, 0, 7), dtstart.AddDate(0, 0, 9),
+			}},
+			{"FREQ=DAILY;INTERVAL=3;UNTIL=20250112T090000Z", dtstart, []time.Time{
+				dtstart, dtstart.AddDate(0, 0, 3), dtstart.AddDate(0, 0, 6),
+			}},
+			{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), []time.Time{
+				time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 28, 9, 0, 0, 0, time.UTC),
+			}},
+			{"FREQ=MONTHLY;COUNT=3", time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), []time.Time{
+				time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 31, 9, 0, 0, 0, time.UTC),
+			}},
+		}
+		for _, tt := range tests {
+			got := mustParse(t, tt.rule).Occurrences(tt.dtstart, time.Time{})
+			if !equalTimes(got, tt.expected) {
+				t.Errorf("Unexpected occurrences of %s: %v", tt.rule, got)
+			}
+		}
+	})
+
+	t.Run("Should include the whole day of a date-only UNTIL", func(t *testing.T) {
+		start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+		got := mustParse(t, "FREQ=DAILY;UNTIL=20250105").Occurrences(start, time.Time{})
+		expected := []time.Time{start, start.AddDate(0, 0, 1), start.AddDate(0, 0, 2), start.AddDate(0, 0, 3), start.AddDate(0, 0, 4)}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should read a floating UNTIL in the time zone of the start", func(t *testing.T) {
+		jst := time.FixedZone("JST", 9*60*60)
+		start := time.Date(2025, 1, 1, 9, 0, 0, 0, jst)
+		// Read as UTC, 2025-01-03T08:00 would be 17:00 JST and include the occurrence on Jan 3
+		got := mustParse(t, "FREQ=DAILY;UNTIL=20250103T080000").Occurrences(start, time.Time{})
+		expected := []time.Time{start, start.AddDate(0, 0, 1)}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should stop at MaxOccurrences for open-ended rules", func(t *testing.T) {
+		got := mustParse(t, "FREQ=DAILY").Occurrences(dtstart, time.Time{})
+		if len(got) != MaxOccurrences {
+			t.Errorf("Expected %d occurrences, got %d", MaxOccurrences, len(got))
+		}
+	})
+
+	t.Run("Should count occurrences beyond MaxOccurrences", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY")
+		if n := rule.CountBefore(dtstart, dtstart.AddDate(0, 0, 1500)); n != 1500 {
+			t.Errorf("Expected 1500 occurrences, got %d", n)
+		}
+	})
+}
+
+func TestBetween(t *testing.T) {
+	dtstart := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC) // Monday
+
+	t.Run("Should expand open-ended rules in windows far after the start", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=WEEKLY;BYDAY=MO,FR")
+		from := time.Date(2045, 3, 1, 0, 0, 0, 0, time.UTC) // Wednesday
+		got := rule.Between(dtstart, time.Hour, from, from.AddDate(0, 0, 7), nil)
+		expected := []time.Time{
+			time.Date(2045, 3, 3, 9, 0, 0, 0, time.UTC),
+			time.Date(2045, 3, 6, 9, 0, 0, 0, time.UTC),
+		}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should include occurrences that start before the window and end in it", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY")
+		from := time.Date(2030, 6, 1, 10, 0, 0, 0, time.UTC)
+		got := rule.Between(dtstart, 2*time.Hour, from, from.Add(time.Hour), nil)
+		expected := []time.Time{time.Date(2030, 6, 1, 9, 0, 0, 0, time.UTC)}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should apply COUNT from the start of the rule", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY;COUNT=10")
+		from := dtstart.AddDate(0, 0, 8)
+		got := rule.Between(dtstart, time.Hour, from, from.AddDate(0, 0, 7), nil)
+		expected := []time.Time{dtstart.AddDate(0, 0, 8), dtstart.AddDate(0, 0, 9)}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should exclude EXDATEs", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY;COUNT=3")
+		got := rule.Between(dtstart, time.Hour, time.Time{}, time.Time{}, []time.Time{dtstart.AddDate(0, 0, 1)})
+		expected := []time.Time{dtstart, dtstart.AddDate(0, 0, 2)}
+		if !equalTimes(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Should stop at MaxOccurrences inside the window", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY")
+		from := dtstart.AddDate(10, 0, 0)
+		got := rule.Between(dtstart, time.Hour, from, from.AddDate(0, 0, 2*MaxOccurrences), nil)
+		if len(got) != MaxOccurrences || !got[0].Equal(from) {
+			t.Errorf("Expected %d occurrences from %v, got %d", MaxOccurrences, from, len(got))
+		}
+	})
+
+	t.Run("Should keep the local time across daylight saving time changes", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Skipf("Time zone data is not available: %v", err)
+		}
+		rule := mustParse(t, "FREQ=WEEKLY")
+		start := time.Date(2025, 1, 6, 9, 0, 0, 0, loc)
+		from := time.Date(2040, 7, 1, 0, 0, 0, 0, loc)
+		got := rule.Between(start, time.Hour, from, from.AddDate(0, 0, 7), nil)
+		if len(got) != 1 || got[0].In(loc).Hour() != 9 || got[0].Weekday() != time.Monday {
+			t.Errorf("Expected one occurrence on Monday at 9:00, got %v", got)
+		}
+	})
+}
+
+func TestOverlaps(t *testing.T) {
+	from := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	tests := []struct {
+		name       string
+		start, end time.Time
+		expected   bool
+	}{
+		{"inside", from.Add(10 * time.Minute), from.Add(20 * time.Minute), true},
+		{"ending at the start of the window", from.Add(-time.Hour), from, false},
+		{"starting at the end of the window", to, to.Add(time.Hour), false},
+		{"zero length at the start of the window", from, from, true},
+		{"zero length before the window", from.Add(-time.Minute), from.Add(-time.Minute), false},
+	}
+	for _, tt := range tests {
+		if got := Overlaps(tt.start, tt.end, from, to); got != tt.expected {
+			t.Errorf("Expected %v for %s, got %v", tt.expected, tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"schedule-app/internal/mail"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strings"
+	"time"
+)
+
+// timeLayout はリマインダーの本文に記載する日時の形式です (UTC)。
+const timeLayout = "2006-01-02 15:04 MST"
+
+// EmailChannel はリマインダーをユーザーのメールアドレスに送信します。
+type EmailChannel struct {
+	mailer  mail.Sender
+	baseURL string
+}
+
+// NewEmailChannel は EmailChannel の新しいインスタンスを生成します。baseURL は本文に記載するアプリのURLです。
+func NewEmailChannel(mailer mail.Sender, baseURL string) *EmailChannel {
+	return &EmailChannel{mailer: mailer, baseURL: baseURL}
+}
+
+// Deliver はリマインダーのメールを送信します。
+func (c *EmailChannel) Deliver(ctx context.Context, d *model.DueReminder, now time.Time) error {
+	s := d.Schedule
+	body := fmt.Sprintf("Hello %s,\n\n%s\n\nStart: %s\nEnd: %s\n", d.User.Username, summary(d, now),
+		s.StartTime.UTC().Format(timeLayout), s.EndTime.UTC().Format(timeLayout))
+	if s.Location != "" {
+		body += fmt.Sprintf("Location: %s\n", s.Location)
+	}
+	body += fmt.Sprintf("\nOpen your calendar: %s/\n", c.baseURL)
+	return c.mailer.Send(ctx, &mail.Message{
+		To:      d.User.Email,
+		Subject: "Reminder: " + oneLine(s.Title),
+		Body:    body,
+	})
+}
+
+// WebhookChannel はリマインダーを JSON でユーザーの webhook URL に POST します。
+// 2xx 以外の応答は送信の失敗として扱います。
+type WebhookChannel struct {
+	client *http.Client
+}
+
+// NewWebhookChannel は WebhookChannel の新しいインスタンスを生成します。
+func NewWebhookChannel(client *http.Client) *WebhookChannel {
+	return &WebhookChannel{client: client}
+}
+
+// webhookPayload は webhook で送信するリマインダーです。
+type webhookPayload struct {
+	Type          string    `json:"type"`
+	ScheduleID    int64     `json:"schedule_id"`
+	Title         string    `json:"title"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Location      string    `json:"location,omitempty"`
+	MinutesBefore int       `json:"minutes_before"`
+	Text          string    `json:"text"`
+}
+
+// Deliver はリマインダーを webhook URL に POST します。
+func (c *WebhookChannel) Deliver(ctx context.Context, d *model.DueReminder, now time.Time) error {
+	if d.WebhookURL == "" {
+		return errors.New("no webhook URL is configured")
+	}
+	s := d.Schedule
+	payload, err := json.Marshal(&webhookPayload{
+		Type:          "schedule.reminder",
+		ScheduleID:    s.ID,
+		Title:         s.Title,
+		StartTime:     s.StartTime.UTC(),
+		EndTime:       s.EndTime.UTC(),
+		Location:      s.Location,
+		MinutesBefore: d.MinutesBefore,
+		Text:          summary(d, now),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// InAppChannel はリマインダーをユーザーのアプリ内通知に追加します。
+type InAppChannel struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+// NewInAppChannel は InAppChannel の新しいインスタンスを生成します。
+func NewInAppChannel(notificationRepo *repository.NotificationRepository) *InAppChannel {
+	return &InAppChannel{notificationRepo: notificationRepo}
+}
+
+// Deliver はリマインダーの通知を保存します。
+func (c *InAppChannel) Deliver(ctx context.Context, d *model.DueReminder, now time.Time) error {
+	scheduleID := d.Schedule.ID
+	return c.notificationRepo.Create(&model.Notification{
+		UserID:     d.User.ID,
+		Type:       model.NotificationReminder,
+		ScheduleID: &scheduleID,
+		Title:      "Reminder: " + oneLine(d.Schedule.Title),
+		Body:       summary(d, now),
+	})
+}
+
+// summary はリマインダーの内容を1文で返します (例: "Weekly sync" starts in 10 minutes (2024-05-01 10:00 UTC).)。
+func summary(d *model.DueReminder, now time.Time) string {
+	start := d.Schedule.StartTime
+	when := "has started"
+	if until := start.Sub(now); until > 0 {
+		when = "starts in " + formatDuration(until)
+	}
+	return fmt.Sprintf("%q %s (%s).", d.Schedule.Title, when, start.UTC().Format(timeLayout))
+}
+
+// formatDuration は開始までの時間を分単位 (切り上げ) で、割り切れる場合は時間・日単位で返します。
+func formatDuration(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	switch {
+	case minutes%(24*60) == 0:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	default:
+		return plural(minutes, "minute")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// oneLine は件名に使えるよう、改行などの空白をまとめて1行にします。
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,106 @@
+// Package reminder は予定のリマインダーを送信するバックグラウンドのワーカーを提供します。
+// 送信方法 (メール・webhook・アプリ内通知) は Channel インターフェースで差し替えられます。
+// 現在時刻は clock.Clock から取得するため、テストでは clock.Fake で時刻を進めて RunOnce を呼び出します。
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"schedule-app/internal/clock"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"time"
+)
+
+const (
+	// Grace は開始日時を過ぎたリマインダー (0分前のリマインダーなど) を送信する猶予です。
+	Grace = 5 * time.Minute
+	// deliveryTimeout は1件のリマインダーの送信の制限時間です。
+	deliveryTimeout = 10 * time.Second
+	// deliveryRetention は送信記録を保持する期間です (発生の開始日時から)。
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+// Channel はリマインダーを送信します。now はリマインダーを送信する時点の時刻です。
+type Channel interface {
+	Deliver(ctx context.Context, d *model.DueReminder, now time.Time) error
+}
+
+// Worker は一定間隔で送信予定の日時を過ぎたリマインダーを探し、チャネルごとに送信します。
+// 送信する前に送信記録を追加するため、再起動や複数のワーカーがあっても各リマインダーは1回だけ送信されます
+// (送信中にプロセスが終了した場合、そのリマインダーは再送信しません)。
+type Worker struct {
+	repo     *repository.ReminderRepository
+	channels map[model.ReminderChannel]Channel
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewWorker は Worker の新しいインスタンスを生成します。channels にないチャネルのリマインダーは失敗として記録します。
+func NewWorker(repo *repository.ReminderRepository, channels map[model.ReminderChannel]Channel, clk clock.Clock, interval time.Duration) *Worker {
+	return &Worker{repo: repo, channels: channels, clock: clk, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("ERROR: Failed to send reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce は現在時刻に送信するリマインダーを送信し、送信に成功した件数を返します。
+// 送信に失敗したリマインダーは記録して次のリマインダーに進みます。
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := w.clock.Now()
+	due, err := w.repo.FindDue(now, Grace)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range due {
+		claimed, err := w.repo.Claim(d)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		deliveryErr := w.deliver(ctx, d, now)
+		if deliveryErr != nil {
+			log.Printf("WARNING: Failed to send %s reminder of schedule %d to user %d: %v", d.Channel, d.Schedule.ID, d.User.ID, deliveryErr)
+		} else {
+			sent++
+		}
+		if err := w.repo.RecordDelivery(d, w.clock.Now(), deliveryErr); err != nil {
+			return sent, err
+		}
+	}
+
+	if err := w.repo.PruneDeliveries(now.Add(-deliveryRetention)); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+// deliver はリマインダーのチャネルで送信します。
+func (w *Worker) deliver(ctx context.Context, d *model.DueReminder, now time.Time) error {
+	channel, ok := w.channels[d.Channel]
+	if !ok {
+		return fmt.Errorf("channel %s is not configured", d.Channel)
+	}
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	return channel.Deliver(ctx, d, now)
+}
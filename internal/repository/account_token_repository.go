@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidAccountToken is returned when an account token is unknown, already used, expired
+// or was issued for another purpose.
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// AccountTokenRepository はメールで送信するアカウント用トークン (メールアドレスの確認・パスワードの再設定) のデータベース操作を扱います。
+// トークンは1回のみ使用でき、有効期限があります。
+type AccountTokenRepository struct {
+	db *sql.DB
+}
+
+// NewAccountTokenRepository は AccountTokenRepository の新しいインスタンスを生成します。
+func NewAccountTokenRepository(db *sql.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+// Create はユーザーの現在のメールアドレスに対して purpose のトークンを発行します。有効期間は ttl です。
+// 最後に送信したメールのリンクのみが有効になるよう、同じ目的の未使用のトークンは削除します。
+func (r *AccountTokenRepository) Create(user *model.User, purpose model.AccountTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 期限切れのトークンと、同じ目的の未使用のトークンを削除
+	if _, err := tx.Exec("DELETE FROM account_tokens WHERE unixepoch(expires_at) < unixepoch('now')"); err != nil {
+		return "", fmt.Errorf("failed to delete expired account tokens: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM account_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose); err != nil {
+		return "", fmt.Errorf("failed to delete previous account tokens: %w", err)
+	}
+	expiresAt := time.Now().Add(ttl).UTC()
+	_, err = tx.Exec("INSERT INTO account_tokens (token_hash, user_id, purpose, email, expires_at) VALUES (?, ?, ?, ?, ?)",
+		hashToken(token), user.ID, purpose, user.Email, expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert account token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return token, nil
+}
+
+// VerifyEmail はメールアドレスの確認トークンを使用し、ユーザーのメールアドレスを確認済みにします。
+// トークンの発行後にメールアドレスが変わっている場合は ErrInvalidAccountToken を返します。
+func (r *AccountTokenRepository) VerifyEmail(token string) (*model.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeAccountToken(tx, token, model.TokenPurposeVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := markEmailVerified(tx, userID, email)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, ErrInvalidAccountToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return NewUserRepository(r.db).FindUserByID(userID)
+}
+
+// ResetPassword はパスワード再設定トークンを使用し、ユーザーのパスワードを変更してユーザーIDを返します。
+// 漏洩したパスワードやトークンでログインしたままにならないよう、ユーザーのすべてのセッションと他の再設定トークンを無効にします。
+// 再設定のメールを受け取ったことでメールアドレスの所有も確認できるため、メールアドレスを確認済みにします。
+func (r *AccountTokenRepository) ResetPassword(token, password string) (int64, error) {
+	// トークンの検証前にハッシュ化し、トランザクションを短くする
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeAccountToken(tx, token, model.TokenPurposeResetPassword)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(hashedPassword), userID); err != nil {
+		return 0, fmt.Errorf("failed to update password of user %d: %w", userID, err)
+	}
+	if _, err := tx.Exec("DELETE FROM account_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, model.TokenPurposeResetPassword); err != nil {
+		return 0, fmt.Errorf("failed to delete other password reset tokens: %w", err)
+	}
+	if err := revokeUserSessions(tx, userID); err != nil {
+		return 0, err
+	}
+	if _, err := markEmailVerified(tx, userID, email); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// consumeAccountToken は purpose のトークンを使用済みにし、トークンのユーザーIDと発行時のメールアドレスを返します。
+func consumeAccountToken(q querier, token string, purpose model.AccountTokenPurpose) (userID int64, email string, err error) {
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = q.QueryRow("SELECT user_id, email, expires_at, used_at FROM account_tokens WHERE token_hash = ? AND purpose = ?", hashToken(token), purpose).
+		Scan(&userID, &email, &expiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", ErrInvalidAccountToken
+		}
+		return 0, "", fmt.Errorf("query for account token failed: %w", err)
+	}
+	if usedAt.Valid || !time.Now().Before(expiresAt) {
+		return 0, "", ErrInvalidAccountToken
+	}
+
+	// 同時に使用された場合に1回だけ成功するよう、未使用であることを条件に更新する
+	result, err := q.Exec("UPDATE account_tokens SET used_at = CURRENT_TIMESTAMP WHERE token_hash = ? AND used_at IS NULL", hashToken(token))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to mark account token as used: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return 0, "", ErrInvalidAccountToken
+	}
+	return userID, email, nil
+}
+
+// markEmailVerified はユーザーのメールアドレスが email のままであれば確認済みにし、確認済みかどうかを返します。
+func markEmailVerified(q querier, userID int64, email string) (bool, error) {
+	result, err := q.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = ? AND email = ?", userID, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark email of user %d as verified: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return n > 0, nil
+}
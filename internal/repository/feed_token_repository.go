@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// FeedTokenRepository はカレンダー購読用フィードトークンのデータベース操作を扱います。
+// JWT を送信できないカレンダークライアントのために、URL に含める秘密のトークンで認証します。
+type FeedTokenRepository struct {
+	db *sql.DB
+}
+
+// NewFeedTokenRepository は FeedTokenRepository の新しいインスタンスを生成します。
+func NewFeedTokenRepository(db *sql.DB) *FeedTokenRepository {
+	return &FeedTokenRepository{db: db}
+}
+
+// Rotate はユーザーの新しいフィードトークンを発行して返します。既存のトークンは無効になります。
+func (r *FeedTokenRepository) Rotate(userID int64) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	query := `
+		INSERT INTO calendar_feed_tokens (user_id, token_hash, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at;
+	`
+	if _, err := r.db.Exec(query, userID, hashToken(token)); err != nil {
+		return "", fmt.Errorf("failed to store feed token: %w", err)
+	}
+	return token, nil
+}
+
+// Revoke はユーザーのフィードトークンを無効にします。
+func (r *FeedTokenRepository) Revoke(userID int64) error {
+	result, err := r.db.Exec("DELETE FROM calendar_feed_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke feed token: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("feed token for user %d not found", userID)
+	}
+	return nil
+}
+
+// FindUserIDByToken はフィードトークンの持ち主のユーザーIDを返します。
+func (r *FeedTokenRepository) FindUserIDByToken(token string) (int64, error) {
+	var userID int64
+	err := r.db.QueryRow("SELECT user_id FROM calendar_feed_tokens WHERE token_hash = ?", hashToken(token)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("feed token not found")
+		}
+		return 0, fmt.Errorf("query for feed token failed: %w", err)
+	}
+	return userID, nil
+}
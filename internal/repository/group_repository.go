@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"strings"
+)
+
+// ErrLastOwner is returned when a change would leave a group without any owner.
+var ErrLastOwner = errors.New("a group must have at least one owner")
+
+// GroupRepository はグループとメンバーのデータベース操作を扱います。
+// 変更系の操作では、操作するユーザーのグループ内の役割 (role) をチェックします。
+type GroupRepository struct {
+	db *sql.DB
+}
+
+// NewGroupRepository は GroupRepository の新しいインスタンスを生成します。
+func NewGroupRepository(db *sql.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// groupColumns は groups テーブルから取得するカラムの一覧です。scanGroup と順序を合わせてください。
+const groupColumns = `g.id, g.name, g.description, g.created_at, g.updated_at`
+
+func scanGroup(row rowScanner) (*model.Group, error) {
+	var g model.Group
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Create は新しいグループを作成し、作成したユーザーを owner として追加します。
+func (r *GroupRepository) Create(req *model.CreateGroupRequest, creatorID int64) (*model.Group, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO groups (name, description) VALUES (?, ?)", req.Name, req.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert group: %w", err)
+	}
+	groupID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)", groupID, creatorID, model.RoleOwner); err != nil {
+		return nil, fmt.Errorf("failed to insert group owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return r.FindByID(groupID)
+}
+
+// FindByID はIDでグループを検索し、メンバー情報も取得します。
+func (r *GroupRepository) FindByID(id int64) (*model.Group, error) {
+	return findGroupByID(r.db, id)
+}
+
+func findGroupByID(q querier, id int64) (*model.Group, error) {
+	g, err := scanGroup(q.QueryRow("SELECT "+groupColumns+" FROM groups g WHERE g.id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("group with id %d not found", id)
+		}
+		return nil, fmt.Errorf("query for group by id failed: %w", err)
+	}
+
+	rows, err := q.Query(`
+		SELECT u.id, u.username, u.email, u.created_at, gm.role, gm.joined_at
+		FROM users u
+		JOIN group_members gm ON u.id = gm.user_id
+		WHERE gm.group_id = ?
+		ORDER BY gm.joined_at, u.id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query for group members failed: %w", err)
+	}
+	defer rows.Close()
+
+	g.Members = []*model.GroupMember{}
+	for rows.Next() {
+		var m model.GroupMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.Email, &m.CreatedAt, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group member row: %w", err)
+		}
+		g.Members = append(g.Members, &m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during group member rows iteration: %w", err)
+	}
+	return g, nil
+}
+
+// FindByUserID はユーザーが所属するグループの一覧を作成順に返します。メンバー情報は取得しません。
+func (r *GroupRepository) FindByUserID(userID int64) ([]*model.Group, error) {
+	rows, err := r.db.Query(`
+		SELECT `+groupColumns+` FROM groups g
+		JOIN group_members gm ON g.id = gm.group_id
+		WHERE gm.user_id = ?
+		ORDER BY g.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query for groups by user id failed: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []*model.Group{}
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group row: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during group rows iteration: %w", err)
+	}
+	return groups, nil
+}
+
+// Role はユーザーのグループ内の役割を返します。メンバーでない場合は RoleNone を返します。
+func (r *GroupRepository) Role(groupID, userID int64) (model.GroupRole, error) {
+	return groupRole(r.db, groupID, userID)
+}
+
+func groupRole(q querier, groupID, userID int64) (model.GroupRole, error) {
+	var role model.GroupRole
+	err := q.QueryRow("SELECT role FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.RoleNone, nil
+		}
+		return model.RoleNone, fmt.Errorf("query for group role failed: %w", err)
+	}
+	return role, nil
+}
+
+// requireRole はグループが存在し、ユーザー userID が required 以上の役割を持たない場合にエラーを返します。
+func requireRole(q querier, groupID, userID int64, required model.GroupRole, action string) (model.GroupRole, error) {
+	var exists int
+	if err := q.QueryRow("SELECT COUNT(*) FROM groups WHERE id = ?", groupID).Scan(&exists); err != nil {
+		return model.RoleNone, fmt.Errorf("query for group failed: %w", err)
+	}
+	if exists == 0 {
+		return model.RoleNone, fmt.Errorf("group with id %d not found", groupID)
+	}
+	role, err := groupRole(q, groupID, userID)
+	if err != nil {
+		return model.RoleNone, err
+	}
+	if !role.AtLeast(required) {
+		return role, fmt.Errorf("user %d is not authorized to %s group %d", userID, action, groupID)
+	}
+	return role, nil
+}
+
+// Update はグループの名前・説明を更新します。admin 以上の役割が必要です。
+func (r *GroupRepository) Update(id int64, req *model.UpdateGroupRequest, userID int64) (*model.Group, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := requireRole(tx, id, userID, model.RoleAdmin, "update"); err != nil {
+		return nil, err
+	}
+
+	setClauses := []string{"updated_at = CURRENT_TIMESTAMP"}
+	var args []interface{}
+	if req.Name != nil {
+		setClauses = append(setClauses, "name = ?")
+		args = append(args, *req.Name)
+	}
+	if req.Description != nil {
+		setClauses = append(setClauses, "description = ?")
+		args = append(args, *req.Description)
+	}
+	args = append(args, id)
+	if _, err := tx.Exec("UPDATE groups SET "+strings.Join(setClauses, ", ")+" WHERE id = ?", args...); err != nil {
+		return nil, fmt.Errorf("failed to update group %d: %w", id, err)
+	}
+
+	group, err := findGroupByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return group, nil
+}
+
+// Delete はグループを削除します。owner の役割が必要です。
+// グループのカレンダーのスケジュール、メンバー、グループへのカレンダーの共有、スケジュールへのリンクもあわせて削除します。
+func (r *GroupRepository) Delete(id int64, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := requireRole(tx, id, userID, model.RoleOwner, "delete"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id FROM schedules WHERE owner_type = ? AND owner_id = ?", model.OwnerGroup, id)
+	if err != nil {
+		return fmt.Errorf("query for group schedules failed: %w", err)
+	}
+	var scheduleIDs []int64
+	for rows.Next() {
+		var scheduleID int64
+		if err := rows.Scan(&scheduleID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan schedule id: %w", err)
+		}
+		scheduleIDs = append(scheduleIDs, scheduleID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error during schedule rows iteration: %w", err)
+	}
+	if err := deleteScheduleRows(tx, scheduleIDs...); err != nil {
+		return err
+	}
+
+	// グループのリンクを解除し、グループのメンバーとしてのみ参加していたユーザーを参加者から削除
+	linkedIDs, err := linkedScheduleIDs(tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM schedule_participant_groups WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("failed to unlink group %d from schedules: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete members of group %d: %w", id, err)
+	}
+	if err := syncLinkedParticipants(tx, linkedIDs...); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM calendar_shares WHERE grantee_type = ? AND grantee_id = ?", model.GranteeGroup, id); err != nil {
+		return fmt.Errorf("failed to delete shares of group %d: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM groups WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete group %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetMember はユーザーをグループに追加するか、既存のメンバーの役割を変更します。
+// admin 以上の役割が必要で、owner を追加・変更できるのは owner のみです。
+// 最後の owner の役割を変更しようとした場合は ErrLastOwner を返します。
+func (r *GroupRepository) SetMember(groupID int64, req *model.GroupMemberRequest, actorID int64) (group *model.Group, created bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actorRole, err := requireRole(tx, groupID, actorID, model.RoleAdmin, "manage members of")
+	if err != nil {
+		return nil, false, err
+	}
+	current, err := groupRole(tx, groupID, req.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	if (req.Role == model.RoleOwner || current == model.RoleOwner) && actorRole != model.RoleOwner {
+		return nil, false, fmt.Errorf("user %d is not authorized to manage owners of group %d", actorID, groupID)
+	}
+
+	switch current {
+	case model.RoleNone:
+		if _, err := tx.Exec("INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)", groupID, req.UserID, req.Role); err != nil {
+			return nil, false, fmt.Errorf("failed to insert group member: %w", err)
+		}
+		// グループをリンクしているスケジュールの参加者に追加
+		if err := syncGroupSchedules(tx, groupID); err != nil {
+			return nil, false, err
+		}
+		created = true
+	default:
+		if current == model.RoleOwner && req.Role != model.RoleOwner {
+			if err := requireAnotherOwner(tx, groupID, req.UserID); err != nil {
+				return nil, false, err
+			}
+		}
+		if _, err := tx.Exec("UPDATE group_members SET role = ? WHERE group_id = ? AND user_id = ?", req.Role, groupID, req.UserID); err != nil {
+			return nil, false, fmt.Errorf("failed to update group member: %w", err)
+		}
+	}
+
+	group, err = findGroupByID(tx, groupID)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return group, created, nil
+}
+
+// RemoveMember はユーザーをグループから外します。
+// メンバーは自分自身を外すことができます。他のメンバーを外すには admin 以上 (owner を外すには owner) の役割が必要です。
+// 最後の owner を外そうとした場合は ErrLastOwner を返します。
+func (r *GroupRepository) RemoveMember(groupID, userID, actorID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	required := model.RoleAdmin
+	if userID == actorID {
+		required = model.RoleMember
+	}
+	actorRole, err := requireRole(tx, groupID, actorID, required, "manage members of")
+	if err != nil {
+		return err
+	}
+	current, err := groupRole(tx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if current == model.RoleNone {
+		return fmt.Errorf("member %d of group %d not found", userID, groupID)
+	}
+	if current == model.RoleOwner {
+		if actorRole != model.RoleOwner {
+			return fmt.Errorf("user %d is not authorized to manage owners of group %d", actorID, groupID)
+		}
+		if err := requireAnotherOwner(tx, groupID, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return fmt.Errorf("failed to delete group member: %w", err)
+	}
+	// グループをリンクしているスケジュールの参加者から削除
+	if err := syncGroupSchedules(tx, groupID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// requireAnotherOwner はユーザー userID 以外に owner がいない場合に ErrLastOwner を返します。
+func requireAnotherOwner(q querier, groupID, userID int64) error {
+	var owners int
+	err := q.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND role = ? AND user_id != ?",
+		groupID, model.RoleOwner, userID).Scan(&owners)
+	if err != nil {
+		return fmt.Errorf("query for group owners failed: %w", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
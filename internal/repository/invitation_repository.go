@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+)
+
+// InvitationRepository は招待メール (iMIP) の送信キューのデータベース操作を扱います。
+type InvitationRepository struct {
+	db *sql.DB
+}
+
+// NewInvitationRepository は InvitationRepository の新しいインスタンスを生成します。
+func NewInvitationRepository(db *sql.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+// Enqueue は招待メールを単一トランザクションで送信キューに追加し、すぐに送信できるようにします。
+func (r *InvitationRepository) Enqueue(emails []*model.InvitationEmail) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, e := range emails {
+		result, err := tx.Exec(`
+			INSERT INTO invitation_emails (schedule_id, recipient, subject, body, method, calendar, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ScheduleID, e.Recipient, e.Subject, e.Body, e.Method, e.Calendar, model.InvitationPending, now, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to queue invitation email: %w", err)
+		}
+		if e.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		e.Status, e.NextAttemptAt, e.CreatedAt = model.InvitationPending, &now, now
+	}
+	return tx.Commit()
+}
+
+// invitationEmailColumns は scanInvitationEmail で読み取る列です。
+const invitationEmailColumns = "id, schedule_id, recipient, subject, body, method, calendar, status, attempts, next_attempt_at, last_error, created_at"
+
+// scanInvitationEmail は invitationEmailColumns の行を読み取ります。
+func scanInvitationEmail(row rowScanner) (*model.InvitationEmail, error) {
+	var e model.InvitationEmail
+	err := row.Scan(&e.ID, &e.ScheduleID, &e.Recipient, &e.Subject, &e.Body, &e.Method, &e.Calendar, &e.Status, &e.Attempts, &e.NextAttemptAt, &e.LastError, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// DueEmails は送信予定の日時が now 以前の送信待ちの招待メールを、古い順に最大 limit 件返します。
+func (r *InvitationRepository) DueEmails(now time.Time, limit int) ([]*model.InvitationEmail, error) {
+	rows, err := r.db.Query(`
+		SELECT `+invitationEmailColumns+` FROM invitation_emails
+		WHERE status = ? AND unixepoch(next_attempt_at) <= unixepoch(?)
+		ORDER BY next_attempt_at, id LIMIT ?`, model.InvitationPending, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query for due invitation emails failed: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []*model.InvitationEmail
+	for rows.Next() {
+		e, err := scanInvitationEmail(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation email row: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during invitation email rows iteration: %w", err)
+	}
+	return emails, nil
+}
+
+// Claim は送信する招待メールの送信予定の日時を leaseUntil に延ばして確保します。
+// 他のワーカーが先に確保した場合は false を返します。送信中にプロセスが終了した場合、メールは leaseUntil 以降に再送信されます。
+func (r *InvitationRepository) Claim(e *model.InvitationEmail, leaseUntil time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE invitation_emails SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND unixepoch(next_attempt_at) = unixepoch(?)`,
+		leaseUntil.UTC(), e.ID, model.InvitationPending, e.NextAttemptAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim invitation email: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RecordAttempt は送信の結果を記録します。sendErr が nil の場合は送信済みにします。
+// 失敗した場合は retryAt に再送信します。retryAt が nil の場合は failed にします。
+func (r *InvitationRepository) RecordAttempt(e *model.InvitationEmail, sendErr error, retryAt *time.Time) error {
+	status, next, lastError := model.InvitationFailed, (*time.Time)(nil), ""
+	if sendErr == nil {
+		status = model.InvitationSent
+	} else {
+		lastError = sendErr.Error()
+		if retryAt != nil {
+			utc := retryAt.UTC()
+			status, next = model.InvitationPending, &utc
+		}
+	}
+	if _, err := r.db.Exec("UPDATE invitation_emails SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_error = ?, updated_at = ? WHERE id = ?",
+		status, next, lastError, time.Now().UTC(), e.ID); err != nil {
+		return fmt.Errorf("failed to update invitation email: %w", err)
+	}
+	return nil
+}
+
+// PruneEmails は before より前に作成され、送信済みまたは失敗した招待メールを削除します。
+func (r *InvitationRepository) PruneEmails(before time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM invitation_emails WHERE status != ? AND unixepoch(created_at) < unixepoch(?)", model.InvitationPending, before.UTC()); err != nil {
+		return fmt.Errorf("failed to prune invitation emails: %w", err)
+	}
+	return nil
+}
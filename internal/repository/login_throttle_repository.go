@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"schedule-app/internal/model"
+	"strings"
+	"time"
+)
+
+// ログイン失敗を数える単位
+const (
+	throttleScopeAccount = "account"
+	throttleScopeIP      = "ip"
+)
+
+// パスワード再設定の要求を数える単位。ログインの失敗とは別に数えます。
+const (
+	throttleScopeResetAccount = "reset_account"
+	throttleScopeResetIP      = "reset_ip"
+)
+
+// loginAuditRetention は監査ログを保持する期間です。
+const loginAuditRetention = 90 * 24 * time.Hour
+
+// LoginThrottleRepository はパスワードによるログインの総当たり攻撃を防ぐため、失敗の記録と一時的なロックを扱います。
+// 失敗回数はアカウント (メールアドレス) とクライアントIPごとに数え、上限に達するとロックします。
+// 状態はデータベースに保存するため、サーバーを再起動しても引き継がれます。
+type LoginThrottleRepository struct {
+	db     *sql.DB
+	policy model.LoginThrottlePolicy
+}
+
+// NewLoginThrottleRepository は LoginThrottleRepository の新しいインスタンスを生成します。
+func NewLoginThrottleRepository(db *sql.DB, policy model.LoginThrottlePolicy) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db, policy: policy}
+}
+
+// accountKey はアカウントの失敗を数えるキーです。大文字・小文字の違いで制限を回避できないよう、小文字にします。
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check はアカウントまたはクライアントIPがロックされている場合に *model.LoginThrottledError を返します。
+// ロック中の試行は監査ログに記録します。ip が空の場合、IPのロックは確認しません。
+func (r *LoginThrottleRepository) Check(email, ip string) error {
+	now := time.Now()
+	rows, err := r.db.Query(`
+		SELECT locked_until FROM login_lockouts
+		WHERE (scope = ? AND identifier = ?) OR (scope = ? AND identifier = ? AND identifier != '')
+	`, throttleScopeAccount, accountKey(email), throttleScopeIP, ip)
+	if err != nil {
+		return fmt.Errorf("query for login lockouts failed: %w", err)
+	}
+	var lockedUntil time.Time
+	for rows.Next() {
+		var until time.Time
+		if err := rows.Scan(&until); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan login lockout row: %w", err)
+		}
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error during login lockout rows iteration: %w", err)
+	}
+
+	if !lockedUntil.After(now) {
+		return nil
+	}
+	if err := insertLoginAudit(r.db, model.LoginAuditBlocked, email, ip, nil, ""); err != nil {
+		return err
+	}
+	return &model.LoginThrottledError{RetryAfter: lockedUntil.Sub(now)}
+}
+
+// RecordFailure はログインの失敗を記録し、失敗回数が上限に達したアカウントまたはクライアントIPをロックします。
+// userID は存在するユーザーのパスワードを間違えた場合のユーザーIDで、監査ログに記録します。
+func (r *LoginThrottleRepository) RecordFailure(email, ip string, userID *int64) error {
+	now := time.Now()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// ウィンドウより古い失敗と、保持期間を過ぎた監査ログを削除
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE unixepoch(failed_at) <= unixepoch(?)", now.Add(-r.policy.Window).UTC()); err != nil {
+		return fmt.Errorf("failed to delete old login failures: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM login_audit_log WHERE unixepoch(created_at) < unixepoch(?)", now.Add(-loginAuditRetention).UTC()); err != nil {
+		return fmt.Errorf("failed to delete old login audit entries: %w", err)
+	}
+	if err := insertLoginAudit(tx, model.LoginAuditFailure, email, ip, userID, ""); err != nil {
+		return err
+	}
+
+	limits := []struct {
+		scope, identifier string
+		max               int
+	}{
+		{throttleScopeAccount, accountKey(email), r.policy.MaxAccountFailures},
+		{throttleScopeIP, ip, r.policy.MaxIPFailures},
+	}
+	for _, l := range limits {
+		if l.identifier == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO login_failures (scope, identifier, failed_at) VALUES (?, ?, ?)", l.scope, l.identifier, now.UTC()); err != nil {
+			return fmt.Errorf("failed to insert login failure: %w", err)
+		}
+		var failures int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM login_failures WHERE scope = ? AND identifier = ?", l.scope, l.identifier).Scan(&failures); err != nil {
+			return fmt.Errorf("query for login failures failed: %w", err)
+		}
+		if failures < l.max {
+			continue
+		}
+		duration, err := r.lock(tx, l.scope, l.identifier, now)
+		if err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("%s %s locked for %s after %d failed attempts", l.scope, l.identifier, duration, failures)
+		if err := insertLoginAudit(tx, model.LoginAuditLockout, email, ip, userID, detail); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// lock はアカウントまたはクライアントIPをロックし、ロックの期間を返します。
+// 前回のロックの終了から LockoutMax 以内に再びロックする場合は、連続したロックとして期間を倍にします。
+// ロック後は失敗回数を数え直します。
+func (r *LoginThrottleRepository) lock(tx *sql.Tx, scope, identifier string, now time.Time) (time.Duration, error) {
+	var lockedUntil time.Time
+	var lockouts int
+	err := tx.QueryRow("SELECT locked_until, lockouts FROM login_lockouts WHERE scope = ? AND identifier = ?", scope, identifier).
+		Scan(&lockedUntil, &lockouts)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("query for login lockout failed: %w", err)
+	}
+	if err == sql.ErrNoRows || now.Sub(lockedUntil) > r.policy.LockoutMax {
+		lockouts = 0
+	}
+	lockouts++
+	duration := r.policy.LockoutDuration(lockouts)
+
+	_, err = tx.Exec(`
+		INSERT INTO login_lockouts (scope, identifier, locked_until, lockouts) VALUES (?, ?, ?, ?)
+		ON CONFLICT (scope, identifier) DO UPDATE SET locked_until = excluded.locked_until, lockouts = excluded.lockouts
+	`, scope, identifier, now.Add(duration).UTC(), lockouts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock %s %s: %w", scope, identifier, err)
+	}
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE scope = ? AND identifier = ?", scope, identifier); err != nil {
+		return 0, fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return duration, nil
+}
+
+// RecordSuccess はログインの成功を記録し、アカウントの失敗回数と連続したロックの回数をリセットします。
+// クライアントIPの失敗回数はリセットしません (1つの正しいアカウントで他のアカウントへの試行を続けられないようにするため)。
+func (r *LoginThrottleRepository) RecordSuccess(email, ip string, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 成功だけが続く場合も監査ログが増え続けないよう、保持期間を過ぎた監査ログを削除
+	if _, err := tx.Exec("DELETE FROM login_audit_log WHERE unixepoch(created_at) < unixepoch(?)", time.Now().Add(-loginAuditRetention).UTC()); err != nil {
+		return fmt.Errorf("failed to delete old login audit entries: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE scope = ? AND identifier = ?", throttleScopeAccount, accountKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM login_lockouts WHERE scope = ? AND identifier = ?", throttleScopeAccount, accountKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login lockout: %w", err)
+	}
+	if err := insertLoginAudit(tx, model.LoginAuditSuccess, email, ip, &userID, ""); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordSuccessAfterFailures は、アカウントに失敗またはロックが記録されている場合だけ RecordSuccess と同じく成功を記録してリセットします。
+// Basic 認証 (CalDAV) はリクエストごとに認証するため、すべての成功を記録するとリクエストごとに書き込みと監査ログが増えます。
+func (r *LoginThrottleRepository) RecordSuccessAfterFailures(email, ip string, userID int64) error {
+	var failed bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM login_failures WHERE scope = ? AND identifier = ?)
+			OR EXISTS (SELECT 1 FROM login_lockouts WHERE scope = ? AND identifier = ?)
+	`, throttleScopeAccount, accountKey(email), throttleScopeAccount, accountKey(email)).Scan(&failed)
+	if err != nil {
+		return fmt.Errorf("query for login failures failed: %w", err)
+	}
+	if !failed {
+		return nil
+	}
+	return r.RecordSuccess(email, ip, userID)
+}
+
+// RecordPasswordResetRequest はパスワード再設定の要求を記録します。
+// Window の間の要求がメールアドレスごとまたはクライアントIPごとの上限に達している場合は、記録せずに *model.LoginThrottledError を返します。
+// ログインの失敗とは別に数えるため、再設定の要求によってアカウントのログインがロックされることはありません。
+// 登録されていないメールアドレスも同じように数えるため、制限から登録の有無は推測できません。ip が空の場合、IPごとの上限は確認しません。
+func (r *LoginThrottleRepository) RecordPasswordResetRequest(email, ip string) error {
+	now := time.Now()
+	windowStart := now.Add(-r.policy.Window).UTC()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	limits := []struct {
+		scope, identifier string
+		max               int
+	}{
+		{throttleScopeResetAccount, accountKey(email), r.policy.MaxAccountResets},
+		{throttleScopeResetIP, ip, r.policy.MaxIPResets},
+	}
+	for _, l := range limits {
+		if l.identifier == "" {
+			continue
+		}
+		var requests int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*) FROM login_failures
+			WHERE scope = ? AND identifier = ? AND unixepoch(failed_at) > unixepoch(?)
+		`, l.scope, l.identifier, windowStart).Scan(&requests); err != nil {
+			return fmt.Errorf("query for password reset requests failed: %w", err)
+		}
+		if requests < l.max {
+			continue
+		}
+		// 最も古い要求がウィンドウから外れると、次の要求を受け付けます
+		var oldest time.Time
+		if err := tx.QueryRow(`
+			SELECT failed_at FROM login_failures
+			WHERE scope = ? AND identifier = ? AND unixepoch(failed_at) > unixepoch(?)
+			ORDER BY unixepoch(failed_at) LIMIT 1
+		`, l.scope, l.identifier, windowStart).Scan(&oldest); err != nil {
+			return fmt.Errorf("query for password reset requests failed: %w", err)
+		}
+		return &model.LoginThrottledError{RetryAfter: oldest.Add(r.policy.Window).Sub(now)}
+	}
+
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE unixepoch(failed_at) <= unixepoch(?)", windowStart); err != nil {
+		return fmt.Errorf("failed to delete old login failures: %w", err)
+	}
+	for _, l := range limits {
+		if l.identifier == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO login_failures (scope, identifier, failed_at) VALUES (?, ?, ?)", l.scope, l.identifier, now.UTC()); err != nil {
+			return fmt.Errorf("failed to insert password reset request: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AuditLog は監査ログを新しい順に最大 limit 件返します。
+func (r *LoginThrottleRepository) AuditLog(limit int) ([]*model.LoginAuditEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT id, event, email, ip, user_id, detail, created_at FROM login_audit_log
+		ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query for login audit log failed: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*model.LoginAuditEntry{}
+	for rows.Next() {
+		var e model.LoginAuditEntry
+		var userID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Event, &e.Email, &e.IP, &userID, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan login audit row: %w", err)
+		}
+		if userID.Valid {
+			e.UserID = &userID.Int64
+		}
+		entries = append(entries, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during login audit rows iteration: %w", err)
+	}
+	return entries, nil
+}
+
+func insertLoginAudit(q querier, event model.LoginAuditEvent, email, ip string, userID *int64, detail string) error {
+	_, err := q.Exec("INSERT INTO login_audit_log (event, email, ip, user_id, detail) VALUES (?, ?, ?, ?, ?)", event, email, ip, userID, detail)
+	if err != nil {
+		return fmt.Errorf("failed to insert login audit entry: %w", err)
+	}
+	return nil
+}
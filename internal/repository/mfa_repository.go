@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"schedule-app/internal/totp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has two-factor authentication enabled.
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned when a user has no enabled (or, when confirming, no pending) second factor.
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong, already used or replayed.
+	ErrInvalidMFACode = errors.New("invalid two-factor authentication code")
+	// ErrInvalidMFAChallenge is returned when an MFA challenge token is unknown, expired or has too many failed attempts.
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor authentication challenge")
+)
+
+const (
+	// totpSkew は時計のずれを許容するため、前後何ステップのコードを受け付けるかです。
+	totpSkew = 1
+	// recoveryCodeCount は一度に発行するリカバリーコードの数です。
+	recoveryCodeCount = 10
+	// maxMFAChallengeAttempts は1つのチャレンジでコードを間違えられる回数です。
+	maxMFAChallengeAttempts = 5
+)
+
+// recoveryCodeEncoding はリカバリーコードの文字 (紛らわしい文字を含まない Base32 の小文字) です。
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFARepository は二要素認証 (TOTP とリカバリーコード) と、ログイン時のチャレンジのデータベース操作を扱います。
+type MFARepository struct {
+	db *sql.DB
+}
+
+// NewMFARepository は MFARepository の新しいインスタンスを生成します。
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// StartEnrollment は新しい TOTP の秘密鍵を生成して保存し、返します。
+// ConfirmEnrollment でコードを確認するまで二要素認証は有効になりません。登録中に再び呼び出すと秘密鍵を作り直します。
+func (r *MFARepository) StartEnrollment(userID int64) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// 有効な設定は上書きしない
+	result, err := r.db.Exec(`
+		INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE enabled_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to save TOTP secret of user %d: %w", userID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return "", ErrMFAAlreadyEnabled
+	}
+	return secret, nil
+}
+
+// ConfirmEnrollment は認証アプリのコードを確認して二要素認証を有効にし、リカバリーコードを発行して返します。
+// 登録中でない場合は ErrMFANotEnabled、コードが正しくない場合は ErrInvalidMFACode を返します。
+func (r *MFARepository) ConfirmEnrollment(userID int64, code string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabledAt sql.NullTime
+	err = tx.QueryRow("SELECT secret, enabled_at FROM user_mfa WHERE user_id = ?", userID).Scan(&secret, &enabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, fmt.Errorf("query for MFA settings failed: %w", err)
+	}
+	if enabledAt.Valid {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	if _, err := tx.Exec("UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP, last_used_step = ? WHERE user_id = ?", step, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable MFA for user %d: %w", userID, err)
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Enabled はユーザーが二要素認証を有効にしているかどうかを返します。
+func (r *MFARepository) Enabled(userID int64) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = ? AND enabled_at IS NOT NULL)", userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("query for MFA settings failed: %w", err)
+	}
+	return enabled, nil
+}
+
+// Status はユーザーの二要素認証の設定を返します。
+func (r *MFARepository) Status(userID int64) (*model.MFAStatus, error) {
+	var status model.MFAStatus
+	var enabledAt sql.NullTime
+	err := r.db.QueryRow("SELECT enabled_at FROM user_mfa WHERE user_id = ?", userID).Scan(&enabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("query for MFA settings failed: %w", err)
+	}
+	if !enabledAt.Valid {
+		return &status, nil
+	}
+
+	status.Enabled = true
+	status.EnabledAt = &enabledAt.Time
+	err = r.db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&status.RecoveryCodesRemaining)
+	if err != nil {
+		return nil, fmt.Errorf("query for recovery codes failed: %w", err)
+	}
+	return &status, nil
+}
+
+// Disable はコードを確認して二要素認証を無効にし、秘密鍵・リカバリーコード・チャレンジを削除します。
+func (r *MFARepository) Disable(userID int64, code string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		return err
+	}
+	for _, table := range []string{"user_mfa", "mfa_recovery_codes", "mfa_challenges"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes はコードを確認してリカバリーコードを発行し直します。以前のリカバリーコードは使えなくなります。
+func (r *MFARepository) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// CreateChallenge はパスワードを確認したユーザーのチャレンジを発行し、トークンと有効期限を返します。有効期間は ttl です。
+func (r *MFARepository) CreateChallenge(userID int64, ttl time.Duration) (string, time.Time, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if _, err := r.db.Exec("DELETE FROM mfa_challenges WHERE unixepoch(expires_at) < unixepoch('now')"); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to delete expired MFA challenges: %w", err)
+	}
+	expiresAt := time.Now().Add(ttl).UTC()
+	if _, err := r.db.Exec("INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)", hashToken(token), userID, expiresAt); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to insert MFA challenge: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// ChallengeUser は有効なチャレンジのユーザーIDを返します。無効な場合は ErrInvalidMFAChallenge を返します。
+func (r *MFARepository) ChallengeUser(token string) (int64, error) {
+	return findMFAChallenge(r.db, token)
+}
+
+// CompleteChallenge はチャレンジのコードを確認し、正しければチャレンジを削除してユーザーIDを返します。
+// コードが正しくない場合は間違えた回数を記録し、ユーザーIDとともに ErrInvalidMFACode を返します。
+func (r *MFARepository) CompleteChallenge(token, code string) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := findMFAChallenge(tx, token)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ?", hashToken(token)); err != nil {
+			return 0, fmt.Errorf("failed to record MFA challenge attempt: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return userID, ErrInvalidMFACode
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_challenges WHERE token_hash = ?", hashToken(token)); err != nil {
+		return 0, fmt.Errorf("failed to delete MFA challenge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// findMFAChallenge は期限内で、間違えた回数が上限に達していないチャレンジのユーザーIDを返します。
+func findMFAChallenge(q querier, token string) (int64, error) {
+	var userID int64
+	var expiresAt time.Time
+	var attempts int
+	err := q.QueryRow("SELECT user_id, expires_at, attempts FROM mfa_challenges WHERE token_hash = ?", hashToken(token)).
+		Scan(&userID, &expiresAt, &attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, fmt.Errorf("query for MFA challenge failed: %w", err)
+	}
+	if !time.Now().Before(expiresAt) || attempts >= maxMFAChallengeAttempts {
+		return 0, ErrInvalidMFAChallenge
+	}
+	return userID, nil
+}
+
+// verifyMFACode は TOTP のコードまたは未使用のリカバリーコードを確認します。
+// TOTP のコードは、一度使用したコードとそれ以前のコードを拒否します。リカバリーコードは使用済みにします。
+func verifyMFACode(q querier, userID int64, code string) error {
+	var secret string
+	var enabledAt sql.NullTime
+	var lastUsedStep int64
+	err := q.QueryRow("SELECT secret, enabled_at, last_used_step FROM user_mfa WHERE user_id = ?", userID).
+		Scan(&secret, &enabledAt, &lastUsedStep)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("query for MFA settings failed: %w", err)
+	}
+	if err == sql.ErrNoRows || !enabledAt.Valid {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(secret, code, time.Now(), totpSkew); ok {
+		if step <= lastUsedStep {
+			return ErrInvalidMFACode
+		}
+		// 同時に使用された場合に1回だけ成功するよう、ステップが進むことを条件に更新する
+		result, err := q.Exec("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+		if err != nil {
+			return fmt.Errorf("failed to update last used TOTP step: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result, err := q.Exec("UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE code_hash = ? AND user_id = ? AND used_at IS NULL",
+		hashToken(normalizeRecoveryCode(code)), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark recovery code as used: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes はユーザーのリカバリーコードをすべて削除し、新しいコードを発行して返します。
+func replaceRecoveryCodes(q querier, userID int64) ([]string, error) {
+	if _, err := q.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		s := recoveryCodeEncoding.EncodeToString(b)
+		codes[i] = s[:4] + "-" + s[4:]
+		if _, err := q.Exec("INSERT INTO mfa_recovery_codes (code_hash, user_id) VALUES (?, ?)", hashToken(s), userID); err != nil {
+			return nil, fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode は入力されたリカバリーコードから区切りの "-" と空白を除き、小文字にします。
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
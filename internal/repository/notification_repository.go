@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+)
+
+// NotificationRepository はアプリ内通知のデータベース操作を扱います。
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository は NotificationRepository の新しいインスタンスを生成します。
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create は通知を保存し、ID と作成日時を設定します。
+func (r *NotificationRepository) Create(n *model.Notification) error {
+	result, err := r.db.Exec("INSERT INTO notifications (user_id, type, schedule_id, title, body) VALUES (?, ?, ?, ?, ?)",
+		n.UserID, n.Type, n.ScheduleID, n.Title, n.Body)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	n.ID = id
+	if err := r.db.QueryRow("SELECT created_at FROM notifications WHERE id = ?", id).Scan(&n.CreatedAt); err != nil {
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+	return nil
+}
+
+// FindByUser はユーザーの通知を新しい順に最大 q.Limit 件取得します。q.UnreadOnly の場合は未読の通知のみを取得します。
+// 続きがある場合は、次のページの q.BeforeID に指定するIDを返します (ない場合は0)。
+func (r *NotificationRepository) FindByUser(userID int64, q *model.NotificationQuery) ([]*model.Notification, int64, error) {
+	query := `SELECT id, user_id, type, schedule_id, actor_id, title, body, read_at, created_at FROM notifications WHERE user_id = ?`
+	args := []interface{}{userID}
+	if q.UnreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	if q.BeforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, q.BeforeID)
+	}
+	// 次ページの有無を判定するために1件多く取得
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query for notifications failed: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []*model.Notification{}
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.ScheduleID, &n.ActorID, &n.Title, &n.Body, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+		notifications = append(notifications, &n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error during notification rows iteration: %w", err)
+	}
+
+	var next int64
+	if len(notifications) > q.Limit {
+		notifications = notifications[:q.Limit]
+		next = notifications[len(notifications)-1].ID
+	}
+	return notifications, next, nil
+}
+
+// CountUnread はユーザーの未読の通知の件数を返します。
+func (r *NotificationRepository) CountUnread(userID int64) (int, error) {
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead はユーザーの通知を既読にします。既読の通知はそのままです。
+func (r *NotificationRepository) MarkRead(userID, notificationID int64) error {
+	var readAt *time.Time
+	err := r.db.QueryRow("SELECT read_at FROM notifications WHERE id = ? AND user_id = ?", notificationID, userID).Scan(&readAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("notification with ID %d not found", notificationID)
+		}
+		return fmt.Errorf("query for notification failed: %w", err)
+	}
+	if readAt != nil {
+		return nil
+	}
+	if _, err := r.db.Exec("UPDATE notifications SET read_at = ? WHERE id = ?", time.Now().UTC(), notificationID); err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	return nil
+}
+
+// MarkAllRead はユーザーの未読の通知をすべて既読にし、既読にした件数を返します。
+func (r *NotificationRepository) MarkAllRead(userID int64) (int64, error) {
+	result, err := r.db.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrInvalidLoginState is returned when the state of an OpenID Connect callback is unknown, used or expired.
+	ErrInvalidLoginState = errors.New("invalid login state")
+	// ErrEmailNotVerified is returned when a new external identity cannot be provisioned or linked
+	// because the identity provider has not verified its email address.
+	ErrEmailNotVerified = errors.New("email address is not verified")
+	// ErrLinkedAccountNotVerified is returned when a new external identity matches the email address of an existing user
+	// who has not verified it. Anyone can register with an email address they do not own, so such an account is not linked.
+	ErrLinkedAccountNotVerified = errors.New("email address of the existing account is not verified")
+)
+
+// OIDCRepository は OpenID Connect ログインの状態と、外部IDプロバイダーのアカウントとユーザーの紐付けを扱います。
+type OIDCRepository struct {
+	db *sql.DB
+}
+
+// NewOIDCRepository は OIDCRepository の新しいインスタンスを生成します。
+func NewOIDCRepository(db *sql.DB) *OIDCRepository {
+	return &OIDCRepository{db: db}
+}
+
+// SaveLoginState は認可リクエストの state に対応する nonce とコード検証子を保存します。
+// state 自体は保存せず、SHA-256 ハッシュのみを保存します。
+func (r *OIDCRepository) SaveLoginState(state string, s *model.OIDCLoginState) error {
+	// 使われずに残った古い状態を削除
+	if _, err := r.db.Exec("DELETE FROM oidc_login_states WHERE unixepoch(created_at) < unixepoch('now', '-1 day')"); err != nil {
+		return fmt.Errorf("failed to delete old login states: %w", err)
+	}
+	_, err := r.db.Exec("INSERT INTO oidc_login_states (state_hash, nonce, code_verifier) VALUES (?, ?, ?)", hashToken(state), s.Nonce, s.CodeVerifier)
+	if err != nil {
+		return fmt.Errorf("failed to insert login state: %w", err)
+	}
+	return nil
+}
+
+// TakeLoginState は state に対応する状態を取り出して削除します。
+// 存在しない、または maxAge より古い場合は ErrInvalidLoginState を返します。
+func (r *OIDCRepository) TakeLoginState(state string, maxAge time.Duration) (*model.OIDCLoginState, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var s model.OIDCLoginState
+	var createdAt time.Time
+	err = tx.QueryRow("SELECT nonce, code_verifier, created_at FROM oidc_login_states WHERE state_hash = ?", hashToken(state)).
+		Scan(&s.Nonce, &s.CodeVerifier, &createdAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidLoginState
+		}
+		return nil, fmt.Errorf("query for login state failed: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM oidc_login_states WHERE state_hash = ?", hashToken(state)); err != nil {
+		return nil, fmt.Errorf("failed to delete login state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if time.Since(createdAt) > maxAge {
+		return nil, ErrInvalidLoginState
+	}
+	return &s, nil
+}
+
+// FindOrProvisionUser は外部IDプロバイダーのアカウントに紐付いたユーザーを返します。
+// 紐付いていない場合は、確認済みのメールアドレスが一致する既存のユーザーに紐付けるか、新しいユーザーを作成します (JIT プロビジョニング)。
+// メールアドレスが確認されていない場合は ErrEmailNotVerified を返します。
+// 一致する既存のユーザーがメールアドレスを確認していない場合は、紐付けずに ErrLinkedAccountNotVerified を返します
+// (他人のメールアドレスで事前に登録したアカウントを乗っ取らせないため)。created は新しいユーザーを作成したかどうかです。
+func (r *OIDCRepository) FindOrProvisionUser(identity *model.ExternalIdentity) (user *model.User, created bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		// 紐付け済み
+	case err != sql.ErrNoRows:
+		return nil, false, fmt.Errorf("query for user identity failed: %w", err)
+	case !identity.EmailVerified || identity.Email == "":
+		return nil, false, ErrEmailNotVerified
+	default:
+		var emailVerifiedAt sql.NullTime
+		err = tx.QueryRow("SELECT id, email_verified_at FROM users WHERE lower(email) = lower(?)", identity.Email).Scan(&userID, &emailVerifiedAt)
+		if err == sql.ErrNoRows {
+			userID, err = insertExternalUser(tx, identity)
+			created = true
+		} else if err == nil && !emailVerifiedAt.Valid {
+			return nil, false, ErrLinkedAccountNotVerified
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to provision user: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO user_identities (issuer, subject, user_id) VALUES (?, ?, ?)", identity.Issuer, identity.Subject, userID); err != nil {
+			return nil, false, fmt.Errorf("failed to link user identity: %w", err)
+		}
+		// IDプロバイダーが確認したメールアドレスなので、作成したユーザーを確認済みにする
+		if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = ?", userID); err != nil {
+			return nil, false, fmt.Errorf("failed to mark email as verified: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	user, err = NewUserRepository(r.db).FindUserByID(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, created, nil
+}
+
+// maxUsernameAttempts は外部IDプロバイダーのユーザー名が使われている場合に、連番を付けて試す回数です。
+const maxUsernameAttempts = 100
+
+// insertExternalUser は外部IDプロバイダーのアカウントに対応するユーザーを作成します。
+// パスワードは設定しないため (空のハッシュ)、パスワードではログインできません。
+func insertExternalUser(q querier, identity *model.ExternalIdentity) (int64, error) {
+	base := strings.TrimSpace(identity.Username)
+	// 制御文字を含むユーザー名は使用せず、メールアドレスから作成します
+	if model.HasControlCharacter(base) {
+		base = ""
+	}
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+		base = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, base)
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	username := base
+	for i := 2; i <= maxUsernameAttempts+1; i++ {
+		result, err := q.Exec("INSERT INTO users (username, email, password_hash) VALUES (?, ?, '')", username, identity.Email)
+		if err == nil {
+			return result.LastInsertId()
+		}
+		if !strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
+			return 0, fmt.Errorf("failed to insert user: %w", err)
+		}
+		username = base + strconv.Itoa(i)
+	}
+	return 0, fmt.Errorf("no available username for %q", base)
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+)
+
+// OutboxRepository はアカウントのメール (パスワードの再設定など) の送信キューのデータベース操作を扱います。
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+// NewOutboxRepository は OutboxRepository の新しいインスタンスを生成します。
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Enqueue はメールを送信キューに追加し、すぐに送信できるようにします。
+func (r *OutboxRepository) Enqueue(e *model.OutboxEmail) error {
+	now := time.Now().UTC()
+	result, err := r.db.Exec(`
+		INSERT INTO outbox_emails (recipient, subject, body, status, next_attempt_at, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Recipient, e.Subject, e.Body, model.InvitationPending, now, e.ExpiresAt.UTC(), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	if e.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	e.Status, e.NextAttemptAt, e.CreatedAt = model.InvitationPending, &now, now
+	return nil
+}
+
+// outboxEmailColumns は scanOutboxEmail で読み取る列です。
+const outboxEmailColumns = "id, recipient, subject, body, status, attempts, next_attempt_at, expires_at, last_error, created_at"
+
+// scanOutboxEmail は outboxEmailColumns の行を読み取ります。
+func scanOutboxEmail(row rowScanner) (*model.OutboxEmail, error) {
+	var e model.OutboxEmail
+	err := row.Scan(&e.ID, &e.Recipient, &e.Subject, &e.Body, &e.Status, &e.Attempts, &e.NextAttemptAt, &e.ExpiresAt, &e.LastError, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// DueEmails は送信予定の日時が now 以前の送信待ちのメールを、古い順に最大 limit 件返します。
+func (r *OutboxRepository) DueEmails(now time.Time, limit int) ([]*model.OutboxEmail, error) {
+	rows, err := r.db.Query(`
+		SELECT `+outboxEmailColumns+` FROM outbox_emails
+		WHERE status = ? AND unixepoch(next_attempt_at) <= unixepoch(?)
+		ORDER BY next_attempt_at, id LIMIT ?`, model.InvitationPending, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query for due emails failed: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []*model.OutboxEmail
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan email row: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during email rows iteration: %w", err)
+	}
+	return emails, nil
+}
+
+// Claim は送信するメールの送信予定の日時を leaseUntil に延ばして確保します。
+// 他のワーカーが先に確保した場合は false を返します。送信中にプロセスが終了した場合、メールは leaseUntil 以降に再送信されます。
+func (r *OutboxRepository) Claim(e *model.OutboxEmail, leaseUntil time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE outbox_emails SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND unixepoch(next_attempt_at) = unixepoch(?)`,
+		leaseUntil.UTC(), e.ID, model.InvitationPending, e.NextAttemptAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim email: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RecordAttempt は送信の結果を記録します。sendErr が nil の場合は送信済みにします。
+// 失敗した場合は retryAt に再送信します。retryAt が nil の場合は failed にします。
+// 送信済み・失敗にした時点で、リンクなどを残さないよう本文を消去します。
+func (r *OutboxRepository) RecordAttempt(e *model.OutboxEmail, sendErr error, retryAt *time.Time) error {
+	status, next, lastError := model.InvitationFailed, (*time.Time)(nil), ""
+	if sendErr == nil {
+		status = model.InvitationSent
+	} else {
+		lastError = sendErr.Error()
+		if retryAt != nil {
+			utc := retryAt.UTC()
+			status, next = model.InvitationPending, &utc
+		}
+	}
+	if _, err := r.db.Exec(`
+		UPDATE outbox_emails SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_error = ?, updated_at = ?,
+			body = CASE WHEN ? = ? THEN body ELSE '' END
+		WHERE id = ?`,
+		status, next, lastError, time.Now().UTC(), status, model.InvitationPending, e.ID); err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+// PruneEmails は before より前に作成され、送信済みまたは失敗したメールを削除します。
+func (r *OutboxRepository) PruneEmails(before time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM outbox_emails WHERE status != ? AND unixepoch(created_at) < unixepoch(?)", model.InvitationPending, before.UTC()); err != nil {
+		return fmt.Errorf("failed to prune emails: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPersonalAccessToken is returned when a personal access token is unknown, revoked or expired.
+var ErrInvalidPersonalAccessToken = errors.New("invalid or expired personal access token")
+
+const (
+	// personalTokenPrefixLength はトークンを見分けるために保存する先頭の文字数です (PersonalAccessTokenPrefix を含む)。
+	personalTokenPrefixLength = 12
+	// personalTokenUsageInterval は最終使用日時を更新する間隔です。リクエストのたびに書き込まないようにします。
+	personalTokenUsageInterval = time.Minute
+)
+
+// PersonalTokenRepository はパーソナルアクセストークンのデータベース操作を扱います。
+type PersonalTokenRepository struct {
+	db *sql.DB
+}
+
+// NewPersonalTokenRepository は PersonalTokenRepository の新しいインスタンスを生成します。
+func NewPersonalTokenRepository(db *sql.DB) *PersonalTokenRepository {
+	return &PersonalTokenRepository{db: db}
+}
+
+// Create はユーザーのトークンを発行し、保存した内容とトークンを返します。トークンはこの時にしか取得できません。
+// expiresAt が nil の場合、トークンは期限切れになりません。
+func (r *PersonalTokenRepository) Create(userID int64, name string, scopes []model.TokenScope, expiresAt *time.Time) (*model.PersonalAccessToken, string, error) {
+	random, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := model.PersonalAccessTokenPrefix + random
+
+	var expires any
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+	result, err := r.db.Exec("INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, name, hashToken(token), token[:personalTokenPrefixLength], joinScopes(scopes), expires)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to insert personal access token: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	pat, err := scanPersonalToken(r.db.QueryRow(personalTokenSelect+" WHERE t.id = ?", id))
+	if err != nil {
+		return nil, "", err
+	}
+	return pat, token, nil
+}
+
+// FindByUser はユーザーのトークンを新しい順に返します。期限切れのトークンも含みます。
+func (r *PersonalTokenRepository) FindByUser(userID int64) ([]*model.PersonalAccessToken, error) {
+	rows, err := r.db.Query(personalTokenSelect+" WHERE t.user_id = ? ORDER BY t.id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query for personal access tokens failed: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []*model.PersonalAccessToken{}
+	for rows.Next() {
+		pat, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, pat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during personal access token rows iteration: %w", err)
+	}
+	return tokens, nil
+}
+
+// Delete はユーザーのトークンを削除して無効にします。
+func (r *PersonalTokenRepository) Delete(userID, tokenID int64) error {
+	result, err := r.db.Exec("DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal access token: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("personal access token with ID %d not found", tokenID)
+	}
+	return nil
+}
+
+// Authenticate はトークンを検証し、トークンの内容を持ち主の現在のロールとともに返します。
+// 最終使用日時とクライアントIPを記録します (personalTokenUsageInterval ごと、またはIPが変わった場合)。
+func (r *PersonalTokenRepository) Authenticate(token, clientIP string) (*model.PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, model.PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	pat, err := scanPersonalToken(r.db.QueryRow(personalTokenSelect+" WHERE t.token_hash = ?", hashToken(token)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidPersonalAccessToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if pat.ExpiresAt != nil && !now.Before(*pat.ExpiresAt) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= personalTokenUsageInterval || pat.LastUsedIP != clientIP {
+		if _, err := r.db.Exec("UPDATE personal_access_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?", now.UTC(), clientIP, pat.ID); err != nil {
+			return nil, fmt.Errorf("failed to record personal access token usage: %w", err)
+		}
+		pat.LastUsedAt = &now
+		pat.LastUsedIP = clientIP
+	}
+	return pat, nil
+}
+
+// personalTokenSelect はトークンを持ち主のロールとともに取得するクエリです。
+const personalTokenSelect = `
+	SELECT t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.last_used_ip, t.created_at, u.role
+	FROM personal_access_tokens t JOIN users u ON u.id = t.user_id`
+
+// scanPersonalToken は personalTokenSelect の1行を読み取ります。行がない場合は sql.ErrNoRows を返します。
+func scanPersonalToken(row rowScanner) (*model.PersonalAccessToken, error) {
+	var pat model.PersonalAccessToken
+	var scopes string
+	err := row.Scan(&pat.ID, &pat.UserID, &pat.Name, &pat.Prefix, &scopes, &pat.ExpiresAt, &pat.LastUsedAt, &pat.LastUsedIP, &pat.CreatedAt, &pat.UserRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan personal access token row: %w", err)
+	}
+	for _, s := range strings.Fields(scopes) {
+		pat.Scopes = append(pat.Scopes, model.TokenScope(s))
+	}
+	return &pat, nil
+}
+
+// joinScopes はスコープを保存する形式 (空白区切り) に変換します。
+func joinScopes(scopes []model.TokenScope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery statuses of reminder_deliveries.
+const (
+	reminderPending = "pending"
+	reminderSent    = "sent"
+	reminderFailed  = "failed"
+)
+
+// ReminderRepository はリマインダーの設定と送信記録のデータベース操作を扱います。
+type ReminderRepository struct {
+	db *sql.DB
+}
+
+// NewReminderRepository は ReminderRepository の新しいインスタンスを生成します。
+func NewReminderRepository(db *sql.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+// Settings はユーザーのリマインダーの設定を返します。設定していない場合は既定のリマインダーなしの設定を返します。
+func (r *ReminderRepository) Settings(userID int64) (*model.ReminderSettings, error) {
+	var reminders string
+	settings := &model.ReminderSettings{}
+	err := r.db.QueryRow("SELECT default_reminders, webhook_url FROM reminder_settings WHERE user_id = ?", userID).Scan(&reminders, &settings.WebhookURL)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("query for reminder settings failed: %w", err)
+	}
+	settings.DefaultReminders = parseReminders(reminders)
+	return settings, nil
+}
+
+// SaveSettings はユーザーのリマインダーの設定を保存します。
+func (r *ReminderRepository) SaveSettings(userID int64, settings *model.ReminderSettings) error {
+	_, err := r.db.Exec(`
+		INSERT INTO reminder_settings (user_id, default_reminders, webhook_url, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET default_reminders = excluded.default_reminders, webhook_url = excluded.webhook_url, updated_at = excluded.updated_at`,
+		userID, formatReminders(settings.DefaultReminders), settings.WebhookURL, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save reminder settings: %w", err)
+	}
+	return nil
+}
+
+// ScheduleReminders はユーザーがスケジュールで受け取るリマインダーを返します。
+// スケジュールのリマインダーを設定していない場合は既定のリマインダーを返します (Custom は false)。
+func (r *ReminderRepository) ScheduleReminders(scheduleID, userID int64) (*model.ScheduleReminders, error) {
+	var reminders string
+	err := r.db.QueryRow("SELECT reminders FROM schedule_reminders WHERE schedule_id = ? AND user_id = ?", scheduleID, userID).Scan(&reminders)
+	if err == nil {
+		return &model.ScheduleReminders{Reminders: parseReminders(reminders), Custom: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("query for schedule reminders failed: %w", err)
+	}
+	settings, err := r.Settings(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ScheduleReminders{Reminders: settings.DefaultReminders}, nil
+}
+
+// SaveScheduleReminders はユーザーのスケジュールのリマインダーを保存します。空の場合、そのスケジュールのリマインダーは送信しません。
+func (r *ReminderRepository) SaveScheduleReminders(scheduleID, userID int64, reminders []model.Reminder) error {
+	_, err := r.db.Exec(`
+		INSERT INTO schedule_reminders (schedule_id, user_id, reminders, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (schedule_id, user_id) DO UPDATE SET reminders = excluded.reminders, updated_at = excluded.updated_at`,
+		scheduleID, userID, formatReminders(reminders), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save schedule reminders: %w", err)
+	}
+	return nil
+}
+
+// DeleteScheduleReminders はユーザーのスケジュールのリマインダーを削除し、既定のリマインダーに戻します。
+func (r *ReminderRepository) DeleteScheduleReminders(scheduleID, userID int64) error {
+	if _, err := r.db.Exec("DELETE FROM schedule_reminders WHERE schedule_id = ? AND user_id = ?", scheduleID, userID); err != nil {
+		return fmt.Errorf("failed to delete schedule reminders: %w", err)
+	}
+	return nil
+}
+
+// reminderRecipient はリマインダーを設定しているユーザーです。
+type reminderRecipient struct {
+	user       model.User
+	defaults   []model.Reminder
+	webhookURL string
+}
+
+// deliveryKey は reminder_deliveries の主キーです。
+type deliveryKey struct {
+	scheduleID, occurrenceStart, userID int64
+	channel                             model.ReminderChannel
+	minutesBefore                       int
+}
+
+func deliveryKeyOf(d *model.DueReminder) deliveryKey {
+	return deliveryKey{d.Schedule.ID, d.Schedule.StartTime.Unix(), d.User.ID, d.Channel, d.MinutesBefore}
+}
+
+// FindDue は now の時点で送信するリマインダーのうち、まだ送信していないものを送信予定の日時の順に返します。
+// リマインダーは発生の開始日時の MinutesBefore 分前から、開始日時の grace 後までの間に送信します
+// (サーバーの停止中に送信予定の日時を過ぎた場合も、開始前であれば送信します)。
+// 受け取るのは所有者 (ユーザーのカレンダーの場合) と、欠席と回答していない参加者です。
+// スケジュールが作成される前に送信予定の日時を過ぎていたリマインダーは送信しません。
+func (r *ReminderRepository) FindDue(now time.Time, grace time.Duration) ([]*model.DueReminder, error) {
+	// ステップ1: リマインダーを設定しているユーザーを取得
+	recipients, err := r.findRecipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, nil
+	}
+	userIDs := make([]int64, 0, len(recipients))
+	for id := range recipients {
+		userIDs = append(userIDs, id)
+	}
+
+	// ステップ2: 開始日時が (now - grace, now + 最大の MinutesBefore] の発生を持つスケジュールを取得
+	from := now.Add(-grace)
+	to := now.Add(model.MaxReminderMinutesBefore*time.Minute + time.Second)
+	schedules, err := findSchedulesOfUsers(r.db, userIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+
+	// ステップ3: スケジュール (上書きした発生の場合は系列も) のリマインダーと送信記録を取得
+	var scheduleIDs []interface{}
+	for _, s := range schedules {
+		scheduleIDs = append(scheduleIDs, s.ID)
+		if s.SeriesID != nil {
+			scheduleIDs = append(scheduleIDs, *s.SeriesID)
+		}
+	}
+	custom, err := r.findScheduleReminders(scheduleIDs)
+	if err != nil {
+		return nil, err
+	}
+	delivered, err := r.findDeliveries(scheduleIDs, from)
+	if err != nil {
+		return nil, err
+	}
+
+	// ステップ4: 各発生の受信者ごとに送信予定の日時を過ぎたリマインダーを選択
+	var due []*model.DueReminder
+	for _, s := range schedules {
+		occurrences, err := expandOccurrences(s, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, occ := range occurrences {
+			if !occ.StartTime.After(from) || !occ.StartTime.Before(to) {
+				continue
+			}
+			for _, userID := range reminderRecipientIDs(s) {
+				recipient, ok := recipients[userID]
+				if !ok {
+					continue
+				}
+				reminders, ok := custom[[2]int64{s.ID, userID}]
+				if !ok && s.SeriesID != nil {
+					reminders, ok = custom[[2]int64{*s.SeriesID, userID}]
+				}
+				if !ok {
+					reminders = recipient.defaults
+				}
+				for _, reminder := range reminders {
+					at := occ.StartTime.Add(-reminder.Lead())
+					if at.After(now) || at.Before(s.CreatedAt) {
+						continue
+					}
+					d := &model.DueReminder{Reminder: reminder, User: recipient.user, WebhookURL: recipient.webhookURL, Schedule: occ}
+					if !delivered[deliveryKeyOf(d)] {
+						due = append(due, d)
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].Schedule.StartTime.Add(-due[i].Lead()).Before(due[j].Schedule.StartTime.Add(-due[j].Lead()))
+	})
+	return due, nil
+}
+
+// reminderRecipientIDs はスケジュールのリマインダーを受け取るユーザー (所有者と、欠席と回答していない参加者) を返します。
+func reminderRecipientIDs(s *model.Schedule) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	if s.OwnerType == model.OwnerUser {
+		ids = append(ids, s.OwnerID)
+		seen[s.OwnerID] = true
+	}
+	for _, p := range s.Participants {
+		if p.Status != model.RSVPDeclined && !seen[p.ID] {
+			ids = append(ids, p.ID)
+			seen[p.ID] = true
+		}
+	}
+	return ids
+}
+
+// findRecipients は既定のリマインダーまたはスケジュールのリマインダーを設定しているユーザーを取得します。
+func (r *ReminderRepository) findRecipients() (map[int64]*reminderRecipient, error) {
+	rows, err := r.db.Query(`
+		SELECT u.id, u.username, u.email, COALESCE(rs.default_reminders, ''), COALESCE(rs.webhook_url, '')
+		FROM users u LEFT JOIN reminder_settings rs ON rs.user_id = u.id
+		WHERE rs.default_reminders != '' OR u.id IN (SELECT user_id FROM schedule_reminders)`)
+	if err != nil {
+		return nil, fmt.Errorf("query for reminder recipients failed: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := make(map[int64]*reminderRecipient)
+	for rows.Next() {
+		var rr reminderRecipient
+		var reminders string
+		if err := rows.Scan(&rr.user.ID, &rr.user.Username, &rr.user.Email, &reminders, &rr.webhookURL); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder recipient row: %w", err)
+		}
+		rr.defaults = parseReminders(reminders)
+		recipients[rr.user.ID] = &rr
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during reminder recipient rows iteration: %w", err)
+	}
+	return recipients, nil
+}
+
+// findScheduleReminders はスケジュールのリマインダーを (スケジュールID, ユーザーID) ごとに取得します。
+func (r *ReminderRepository) findScheduleReminders(scheduleIDs []interface{}) (map[[2]int64][]model.Reminder, error) {
+	rows, err := r.db.Query(`SELECT schedule_id, user_id, reminders FROM schedule_reminders
+		WHERE schedule_id IN (`+strings.Repeat("?,", len(scheduleIDs)-1)+`?)`, scheduleIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("query for schedule reminders failed: %w", err)
+	}
+	defer rows.Close()
+
+	custom := make(map[[2]int64][]model.Reminder)
+	for rows.Next() {
+		var scheduleID, userID int64
+		var reminders string
+		if err := rows.Scan(&scheduleID, &userID, &reminders); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule reminder row: %w", err)
+		}
+		custom[[2]int64{scheduleID, userID}] = parseReminders(reminders)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during schedule reminder rows iteration: %w", err)
+	}
+	return custom, nil
+}
+
+// findDeliveries は開始日時が from より後の発生について、送信済み (送信中を含む) のリマインダーを取得します。
+func (r *ReminderRepository) findDeliveries(scheduleIDs []interface{}, from time.Time) (map[deliveryKey]bool, error) {
+	args := append(append([]interface{}{}, scheduleIDs...), from.Unix())
+	rows, err := r.db.Query(`SELECT schedule_id, occurrence_start, user_id, channel, minutes_before FROM reminder_deliveries
+		WHERE schedule_id IN (`+strings.Repeat("?,", len(scheduleIDs)-1)+`?) AND occurrence_start > ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query for reminder deliveries failed: %w", err)
+	}
+	defer rows.Close()
+
+	delivered := make(map[deliveryKey]bool)
+	for rows.Next() {
+		var k deliveryKey
+		if err := rows.Scan(&k.scheduleID, &k.occurrenceStart, &k.userID, &k.channel, &k.minutesBefore); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder delivery row: %w", err)
+		}
+		delivered[k] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during reminder delivery rows iteration: %w", err)
+	}
+	return delivered, nil
+}
+
+// Claim はリマインダーの送信記録を追加します。すでに記録がある場合 (送信済み、または別のワーカーが送信中) は false を返します。
+// 送信する前に呼び出すことで、再起動をまたいでも同じリマインダーを2回送信しないようにします。
+func (r *ReminderRepository) Claim(d *model.DueReminder) (bool, error) {
+	k := deliveryKeyOf(d)
+	result, err := r.db.Exec(`INSERT INTO reminder_deliveries (schedule_id, occurrence_start, user_id, channel, minutes_before, status)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		k.scheduleID, k.occurrenceStart, k.userID, k.channel, k.minutesBefore, reminderPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim reminder: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// RecordDelivery は Claim したリマインダーの送信結果を記録します。deliveryErr が nil でない場合は失敗として記録します。
+func (r *ReminderRepository) RecordDelivery(d *model.DueReminder, at time.Time, deliveryErr error) error {
+	status, message := reminderSent, ""
+	if deliveryErr != nil {
+		status, message = reminderFailed, deliveryErr.Error()
+	}
+	k := deliveryKeyOf(d)
+	_, err := r.db.Exec(`UPDATE reminder_deliveries SET status = ?, error = ?, delivered_at = ?
+		WHERE schedule_id = ? AND occurrence_start = ? AND user_id = ? AND channel = ? AND minutes_before = ?`,
+		status, message, at.UTC(), k.scheduleID, k.occurrenceStart, k.userID, k.channel, k.minutesBefore)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder delivery: %w", err)
+	}
+	return nil
+}
+
+// PruneDeliveries は開始日時が before より前の発生の送信記録を削除します。
+func (r *ReminderRepository) PruneDeliveries(before time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM reminder_deliveries WHERE occurrence_start < ?", before.Unix()); err != nil {
+		return fmt.Errorf("failed to prune reminder deliveries: %w", err)
+	}
+	return nil
+}
+
+// formatReminders はリマインダーを保存する形式 (「チャネル:何分前」の空白区切り) に変換します。
+func formatReminders(reminders []model.Reminder) string {
+	s := make([]string, len(reminders))
+	for i, reminder := range reminders {
+		s[i] = fmt.Sprintf("%s:%d", reminder.Channel, reminder.MinutesBefore)
+	}
+	return strings.Join(s, " ")
+}
+
+// parseReminders は formatReminders の形式のリマインダーを読み取ります。不正な要素は無視します。
+func parseReminders(s string) []model.Reminder {
+	reminders := []model.Reminder{}
+	for _, field := range strings.Fields(s) {
+		channel, minutes, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(minutes)
+		if err != nil {
+			continue
+		}
+		reminders = append(reminders, model.Reminder{MinutesBefore: n, Channel: model.ReminderChannel(channel)})
+	}
+	return reminders
+}
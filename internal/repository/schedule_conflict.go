@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"fmt"
+	"schedule-app/internal/model"
+	"sort"
+	"time"
+)
+
+// ConflictError is returned by Create and Update when the saved schedule would overlap existing schedules
+// of its owner or participants and the request does not allow conflicts.
+type ConflictError struct {
+	Conflicts []*model.ScheduleConflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("schedule conflicts with %d existing schedule(s)", len(e.Conflicts))
+}
+
+// checkConflicts は保存後のスケジュール id が、所有者または参加者の既存スケジュールと重なる場合に ConflictError を返します。
+// 重なりは、保存するユーザー userID が空き状況 (free-busy 以上の権限) を参照できるユーザーについてのみ判定します。
+// 保存と同じトランザクション内で呼び出してください。
+func checkConflicts(q querier, id, userID int64) error {
+	s, err := findScheduleByID(q, id)
+	if err != nil {
+		return err
+	}
+	conflicts, err := findConflicts(q, s, userID)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// findConflicts はスケジュール s の発生と重なる、所有者または参加者の既存スケジュールを返します。
+// グループのカレンダーのスケジュールでは、参加者の既存スケジュールのみを対象とします。
+// s 自身と、同じ UID を持つ系列・単一発生の変更は対象外です。長さ0の発生は重なりとして扱いません。
+// 参加を辞退したスケジュールは、そのユーザーの予定として扱いません。
+// requesterID が空き状況を参照できないユーザーは判定の対象外です。
+func findConflicts(q querier, s *model.Schedule, requesterID int64) ([]*model.ScheduleConflict, error) {
+	occurrences, err := expandOccurrences(s, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	occurrences = withDuration(occurrences)
+	if len(occurrences) == 0 {
+		return nil, nil
+	}
+	from, to := occurrences[0].StartTime, occurrences[0].EndTime
+	for _, occ := range occurrences[1:] {
+		if occ.EndTime.After(to) {
+			to = occ.EndTime
+		}
+	}
+
+	// グループのカレンダーのスケジュールでは、参加者のみが対象
+	users := make(map[int64]bool)
+	if s.OwnerType == model.OwnerUser {
+		users[s.OwnerID] = true
+	}
+	for _, p := range s.Participants {
+		if p.Status != model.RSVPDeclined {
+			users[p.ID] = true
+		}
+	}
+	userIDs := make([]int64, 0, len(users))
+	for id := range users {
+		permission, err := userCalendarPermission(q, id, requesterID)
+		if err != nil {
+			return nil, err
+		}
+		if permission.Allows(model.PermissionFreeBusy) {
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	existing, err := findSchedulesOfUsers(q, userIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []*model.ScheduleConflict
+	for _, e := range existing {
+		if e.ID == s.ID || (s.UID != "" && e.UID == s.UID && e.OwnerID == s.OwnerID) {
+			continue
+		}
+		// 二重予約になるユーザー (既存スケジュールの所有者・参加者のうち、s にも関わるユーザー)
+		var involved []int64
+		for _, id := range userIDs {
+			if e.BusyFor(id) {
+				involved = append(involved, id)
+			}
+		}
+		if len(involved) == 0 {
+			continue
+		}
+
+		existingOccurrences, err := expandOccurrences(e, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if occ := firstOverlap(withDuration(existingOccurrences), occurrences); occ != nil {
+			conflicts = append(conflicts, &model.ScheduleConflict{
+				ScheduleID: e.ID,
+				UserIDs:    involved,
+				StartTime:  occ.StartTime,
+				EndTime:    occ.EndTime,
+			})
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if !conflicts[i].StartTime.Equal(conflicts[j].StartTime) {
+			return conflicts[i].StartTime.Before(conflicts[j].StartTime)
+		}
+		return conflicts[i].ScheduleID < conflicts[j].ScheduleID
+	})
+	return conflicts, nil
+}
+
+// withDuration は長さが0より大きい発生のみを返します。
+func withDuration(occurrences []*model.Schedule) []*model.Schedule {
+	var result []*model.Schedule
+	for _, occ := range occurrences {
+		if occ.EndTime.After(occ.StartTime) {
+			result = append(result, occ)
+		}
+	}
+	return result
+}
+
+// firstOverlap は candidates のいずれかと重なる existing の最初の発生を返します。どちらも開始時刻順である必要があります。
+func firstOverlap(existing, candidates []*model.Schedule) *model.Schedule {
+	i := 0
+	for _, e := range existing {
+		// e より前に終わる候補は以降の既存の発生とも重ならない
+		for i < len(candidates) && !candidates[i].EndTime.After(e.StartTime) {
+			i++
+		}
+		for j := i; j < len(candidates) && candidates[j].StartTime.Before(e.EndTime); j++ {
+			if candidates[j].EndTime.After(e.StartTime) {
+				return e
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"strings"
+)
+
+// ErrNotGroupMember is returned when a user invites a group they do not belong to.
+var ErrNotGroupMember = errors.New("not a member of the group")
+
+// groupMemberIDs はグループ招待の対象となるグループのメンバーIDを重複なく返します。
+// 招待するユーザー userID は、各グループのメンバーである必要があります (メンバー一覧が参加者として公開されるため)。
+func groupMemberIDs(q querier, groupIDs []int64, userID int64) ([]int64, error) {
+	var memberIDs []int64
+	for _, groupID := range groupIDs {
+		role, err := groupRole(q, groupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if role == model.RoleNone {
+			return nil, fmt.Errorf("user %d cannot invite group %d: %w", userID, groupID, ErrNotGroupMember)
+		}
+
+		rows, err := q.Query("SELECT user_id FROM group_members WHERE group_id = ? ORDER BY user_id", groupID)
+		if err != nil {
+			return nil, fmt.Errorf("query for group members failed: %w", err)
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan group member row: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("error during group member rows iteration: %w", err)
+		}
+		memberIDs = mergeIDs(memberIDs, ids)
+	}
+	return memberIDs, nil
+}
+
+// mergeIDs は a に含まれない b のIDを a の末尾に追加したリストを返します。
+func mergeIDs(a, b []int64) []int64 {
+	seen := make(map[int64]bool, len(a))
+	merged := append([]int64{}, a...)
+	for _, id := range a {
+		seen[id] = true
+	}
+	for _, id := range b {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
+
+// resolveGroupInvitations はリクエストのグループ招待を解決します。
+// リンクしない招待は、現在のメンバーを個別の参加者 participantIDs に追加します。
+// リンクする招待は、リンクするグループのIDを linkedGroupIDs に返します。
+func resolveGroupInvitations(q querier, groupIDs []int64, link bool, participantIDs []int64, userID int64) (participants, linkedGroupIDs []int64, err error) {
+	memberIDs, err := groupMemberIDs(q, groupIDs, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if link {
+		return participantIDs, mergeIDs(nil, groupIDs), nil
+	}
+	return mergeIDs(participantIDs, memberIDs), nil, nil
+}
+
+// replaceLinkedGroups はスケジュールにリンクしたグループを groupIDs に置き換え、参加者を同期します。
+func replaceLinkedGroups(q querier, scheduleID int64, groupIDs []int64) error {
+	if _, err := q.Exec("DELETE FROM schedule_participant_groups WHERE schedule_id = ?", scheduleID); err != nil {
+		return fmt.Errorf("failed to delete linked groups: %w", err)
+	}
+	for _, groupID := range groupIDs {
+		if _, err := q.Exec("INSERT INTO schedule_participant_groups (schedule_id, group_id) VALUES (?, ?)", scheduleID, groupID); err != nil {
+			return fmt.Errorf("failed to link group %d: %w", groupID, err)
+		}
+	}
+	return syncLinkedParticipants(q, scheduleID)
+}
+
+// syncLinkedParticipants はスケジュールの参加者を、リンクしたグループの現在のメンバーに合わせます。
+// メンバーでない参加者を direct = 0 で追加し、どのリンクしたグループのメンバーでもなくなった direct = 0 の参加者を削除します。
+// 個別に招待された参加者 (direct = 1) は変更しません。
+func syncLinkedParticipants(q querier, scheduleIDs ...int64) error {
+	if len(scheduleIDs) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(scheduleIDs))
+	for i, id := range scheduleIDs {
+		ids[i] = id
+	}
+	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
+
+	_, err := q.Exec(`
+		INSERT OR IGNORE INTO schedule_participants (schedule_id, user_id, direct)
+		SELECT spg.schedule_id, gm.user_id, 0
+		FROM schedule_participant_groups spg
+		JOIN group_members gm ON gm.group_id = spg.group_id
+		WHERE spg.schedule_id IN (`+placeholders+`)
+	`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to add members of linked groups: %w", err)
+	}
+
+	_, err = q.Exec(`
+		DELETE FROM schedule_participants
+		WHERE direct = 0 AND schedule_id IN (`+placeholders+`)
+		AND NOT EXISTS (
+			SELECT 1 FROM schedule_participant_groups spg
+			JOIN group_members gm ON gm.group_id = spg.group_id
+			WHERE spg.schedule_id = schedule_participants.schedule_id AND gm.user_id = schedule_participants.user_id
+		)
+	`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to remove former members of linked groups: %w", err)
+	}
+	return nil
+}
+
+// linkedScheduleIDs はグループをリンクしているスケジュールのIDを返します。
+func linkedScheduleIDs(q querier, groupID int64) ([]int64, error) {
+	rows, err := q.Query("SELECT schedule_id FROM schedule_participant_groups WHERE group_id = ?", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("query for linked schedules failed: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan linked schedule row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during linked schedule rows iteration: %w", err)
+	}
+	return ids, nil
+}
+
+// syncGroupSchedules はグループのメンバーが変わったときに、グループをリンクしているスケジュールの参加者を同期します。
+func syncGroupSchedules(q querier, groupID int64) error {
+	ids, err := linkedScheduleIDs(q, groupID)
+	if err != nil {
+		return err
+	}
+	return syncLinkedParticipants(q, ids...)
+}
+
+// attachLinkedGroups は複数のスケジュールにリンクしたグループのIDを1回のクエリで取得して設定します。
+func attachLinkedGroups(q querier, schedules []*model.Schedule) error {
+	byID := make(map[int64][]*model.Schedule)
+	var scheduleIDs []interface{}
+	for _, s := range schedules {
+		s.LinkedGroupIDs = nil
+		if _, ok := byID[s.ID]; !ok {
+			scheduleIDs = append(scheduleIDs, s.ID)
+		}
+		byID[s.ID] = append(byID[s.ID], s)
+	}
+	if len(scheduleIDs) == 0 {
+		return nil
+	}
+
+	rows, err := q.Query(`SELECT schedule_id, group_id FROM schedule_participant_groups
+		WHERE schedule_id IN (`+strings.Repeat("?,", len(scheduleIDs)-1)+`?) ORDER BY group_id`, scheduleIDs...)
+	if err != nil {
+		return fmt.Errorf("query for linked groups failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var scheduleID, groupID int64
+		if err := rows.Scan(&scheduleID, &groupID); err != nil {
+			return fmt.Errorf("failed to scan linked group row: %w", err)
+		}
+		for _, s := range byID[scheduleID] {
+			s.LinkedGroupIDs = append(s.LinkedGroupIDs, groupID)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error during linked group rows iteration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+)
+
+// notificationTimeLayout は通知の本文に記載する日時の形式です (UTC)。
+const notificationTimeLayout = "2006-01-02 15:04 MST"
+
+// notifyScheduleChange はスケジュールの作成・更新・削除を、所有者 (ユーザーのカレンダーの場合) と参加者に通知します。
+// extraIDs は通知に含める他のユーザー (更新で参加者から外れたユーザーなど) です。変更したユーザー自身には通知しません。
+// detail は本文の末尾に追加する説明 (繰り返しスケジュールの対象の発生など) です。
+func notifyScheduleChange(q querier, kind string, s *model.Schedule, actorID int64, detail string, extraIDs ...int64) error {
+	actor, err := usernameOf(q, actorID)
+	if err != nil {
+		return err
+	}
+	when := s.StartTime.UTC().Format(notificationTimeLayout)
+
+	for _, userID := range scheduleAudience(s, extraIDs) {
+		if userID == actorID {
+			continue
+		}
+		var title, body string
+		switch kind {
+		case model.NotificationScheduleCreated:
+			title = "New schedule: " + s.Title
+			if s.OwnedByUser(userID) {
+				body = fmt.Sprintf("%s added %q (%s) to your calendar.", actor, s.Title, when)
+			} else {
+				body = fmt.Sprintf("%s invited you to %q (%s).", actor, s.Title, when)
+			}
+		case model.NotificationScheduleUpdated:
+			title = "Schedule updated: " + s.Title
+			body = fmt.Sprintf("%s updated %q (%s).", actor, s.Title, when)
+		case model.NotificationScheduleDeleted:
+			title = "Schedule deleted: " + s.Title
+			body = fmt.Sprintf("%s deleted %q (%s).", actor, s.Title, when)
+		default:
+			return fmt.Errorf("unknown notification type %q", kind)
+		}
+		if detail != "" {
+			body += " " + detail
+		}
+		if err := insertNotification(q, userID, kind, s.ID, actorID, title, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyResponse は参加者の出欠の回答を、スケジュールの所有者 (グループのカレンダーの場合は作成者) に通知します。
+func notifyResponse(q querier, s *model.Schedule, req *model.RSVPRequest, actorID int64) error {
+	recipientID := s.CreatorID
+	if s.OwnerType == model.OwnerUser {
+		recipientID = s.OwnerID
+	}
+	if recipientID == actorID {
+		return nil
+	}
+	actor, err := usernameOf(q, actorID)
+	if err != nil {
+		return err
+	}
+
+	verb := map[string]string{
+		model.RSVPAccepted:  "accepted",
+		model.RSVPDeclined:  "declined",
+		model.RSVPTentative: "tentatively accepted",
+	}[req.Status]
+	body := fmt.Sprintf("%s %s %q (%s).", actor, verb, s.Title, s.StartTime.UTC().Format(notificationTimeLayout))
+	if req.Comment != "" {
+		body += fmt.Sprintf(" Comment: %s", req.Comment)
+	}
+	return insertNotification(q, recipientID, model.NotificationRSVP, s.ID, actorID, fmt.Sprintf("%s %s: %s", actor, verb, s.Title), body)
+}
+
+// scheduleAudience はスケジュールの所有者 (ユーザーのカレンダーの場合)・参加者・extraIDs を重複なく返します。
+func scheduleAudience(s *model.Schedule, extraIDs []int64) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	add := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if s.OwnerType == model.OwnerUser {
+		add(s.OwnerID)
+	}
+	for _, p := range s.Participants {
+		add(p.ID)
+	}
+	for _, id := range extraIDs {
+		add(id)
+	}
+	return ids
+}
+
+// occurrenceDetail は繰り返しスケジュールの一部の発生への変更を説明する文を返します。系列全体への変更の場合は空です。
+func occurrenceDetail(scope model.RecurrenceScope, occurrence *time.Time) string {
+	if occurrence == nil {
+		return ""
+	}
+	switch scope {
+	case model.ScopeThis:
+		return fmt.Sprintf("This applies only to the occurrence on %s.", occurrence.UTC().Format(notificationTimeLayout))
+	case model.ScopeFollowing:
+		return fmt.Sprintf("This applies to the occurrences from %s onward.", occurrence.UTC().Format(notificationTimeLayout))
+	}
+	return ""
+}
+
+// usernameOf はユーザー名を返します。
+func usernameOf(q querier, userID int64) (string, error) {
+	var username string
+	if err := q.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return "", fmt.Errorf("failed to get username of user %d: %w", userID, err)
+	}
+	return username, nil
+}
+
+// insertNotification は通知を1件保存します。
+func insertNotification(q querier, userID int64, kind string, scheduleID, actorID int64, title, body string) error {
+	_, err := q.Exec("INSERT INTO notifications (user_id, type, schedule_id, actor_id, title, body) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, kind, scheduleID, actorID, title, body)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+	return nil
+}
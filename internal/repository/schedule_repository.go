@@ -2,12 +2,41 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"schedule-app/internal/model"
+	"schedule-app/internal/recurrence"
+	"sort"
 	"strings"
 	"time"
 )
 
+// ErrNotRecurring is returned when an occurrence-scoped operation targets a non-recurring schedule.
+var ErrNotRecurring = errors.New("schedule is not recurring")
+
+// ErrInvalidOccurrence is returned when the given occurrence start does not belong to the recurrence.
+var ErrInvalidOccurrence = errors.New("invalid occurrence")
+
+// ErrPreconditionFailed is returned when the precondition of SaveByUID or DeleteByUID rejects the current schedules.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// scheduleColumns は schedules テーブルから取得するカラムの一覧です。scanSchedule と順序を合わせてください。
+const scheduleColumns = `id, uid, title, start_time, end_time, description, location, owner_id, owner_type, creator_id,
+	rrule, exdates, series_id, recurrence_id, sequence, created_at, updated_at`
+
+// querier は *sql.DB と *sql.Tx の共通インターフェースです。
+// トランザクション内外で同じ検索処理を使うために使用します。
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rowScanner は *sql.Row と *sql.Rows の共通インターフェースです。
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
 // ScheduleRepository はスケジュール関連のデータベース操作を扱います。
 type ScheduleRepository struct {
 	db *sql.DB
@@ -18,60 +47,242 @@ func NewScheduleRepository(db *sql.DB) *ScheduleRepository {
 	return &ScheduleRepository{db: db}
 }
 
+// scanSchedule は scheduleColumns の順序で1行を読み取ります。
+func scanSchedule(row rowScanner) (*model.Schedule, error) {
+	var s model.Schedule
+	var exdates string
+	var seriesID sql.NullInt64
+	var recurrenceID sql.NullTime
+	err := row.Scan(&s.ID, &s.UID, &s.Title, &s.StartTime, &s.EndTime, &s.Description, &s.Location, &s.OwnerID, &s.OwnerType, &s.CreatorID,
+		&s.RecurrenceRule, &exdates, &seriesID, &recurrenceID, &s.Sequence, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if s.ExDates, err = parseExDates(exdates); err != nil {
+		return nil, fmt.Errorf("failed to parse exdates of schedule %d: %w", s.ID, err)
+	}
+	if seriesID.Valid {
+		s.SeriesID = &seriesID.Int64
+	}
+	if recurrenceID.Valid {
+		s.RecurrenceID = &recurrenceID.Time
+	}
+	return &s, nil
+}
+
+// formatExDates は EXDATE のリストをカンマ区切りの RFC 3339 文字列に変換します。
+func formatExDates(exdates []time.Time) string {
+	values := make([]string, len(exdates))
+	for i, t := range exdates {
+		values[i] = t.UTC().Format(time.RFC3339)
+	}
+	return strings.Join(values, ",")
+}
+
+// parseExDates は formatExDates で保存された文字列を解析します。
+func parseExDates(s string) ([]time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var exdates []time.Time
+	for _, v := range strings.Split(s, ",") {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, err
+		}
+		exdates = append(exdates, t)
+	}
+	return exdates, nil
+}
+
 // Create は新しいスケジュールを作成し、データベースに保存します。
 // スケジュール作成と参加者追加を単一トランザクションで実行します。
-func (r *ScheduleRepository) Create(req *model.CreateScheduleRequest, creatorID int64) (*model.Schedule, error) {
+// 所有者 (ユーザーまたはグループ) のカレンダーへの write 権限が必要です。
+// 所有者・参加者の既存スケジュールと重なり、AllowConflicts が指定されていない場合は *ConflictError を返します。
+// 作成者以外の所有者と参加者には同じトランザクションで通知を作成し、webhook の配信キューに追加します。
+// 購読中のクライアントに発行するイベントをあわせて返します。
+func (r *ScheduleRepository) Create(req *model.CreateScheduleRequest, creatorID int64) (*model.Schedule, *model.ScheduleEvent, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback() // エラー発生時にロールバック
 
+	// 作成権限をチェック (所有者のカレンダーへの write 権限が必要)
+	s := scheduleFromRequest(req, creatorID)
+	if err := requirePermission(tx, s.OwnerType, s.OwnerID, creatorID, model.PermissionWrite); err != nil {
+		return nil, nil, err
+	}
+
 	// スケジュールを挿入
+	scheduleID, err := insertSchedule(tx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 参加者を `schedule_participants` テーブルに追加
+	// 招待したグループは、現在のメンバーを参加者として追加するか、グループをリンクします。
+	participantIDs, linkedGroupIDs := req.ParticipantIDs, []int64(nil)
+	if len(req.ParticipantGroupIDs) > 0 {
+		participantIDs, linkedGroupIDs, err = resolveGroupInvitations(tx, req.ParticipantGroupIDs, req.LinkGroups, req.ParticipantIDs, creatorID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := insertParticipants(tx, scheduleID, participantIDs); err != nil {
+		return nil, nil, err
+	}
+	if len(linkedGroupIDs) > 0 {
+		if err := replaceLinkedGroups(tx, scheduleID, linkedGroupIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 所有者・参加者の既存スケジュールとの重複をチェック
+	if !req.AllowConflicts {
+		if err := checkConflicts(tx, scheduleID, creatorID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 所有者・参加者に通知
+	created, err := findScheduleByID(tx, scheduleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := notifyScheduleChange(tx, model.NotificationScheduleCreated, created, creatorID, ""); err != nil {
+		return nil, nil, err
+	}
+	event := model.NewScheduleEvent(model.EventScheduleCreated, created, nil, creatorID)
+	if err := queueWebhooks(tx, event); err != nil {
+		return nil, nil, err
+	}
+
+	// トランザクションをコミット
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	schedule, err := r.FindByID(scheduleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schedule, event, nil
+}
+
+// scheduleFromRequest は作成リクエストから保存用のスケジュールを組み立てます。
+// 所有者の種類が指定されていない場合はユーザーのカレンダーとして扱います。
+func scheduleFromRequest(req *model.CreateScheduleRequest, creatorID int64) *model.Schedule {
+	ownerType := req.OwnerType
+	if ownerType == "" {
+		ownerType = model.OwnerUser
+	}
+	return &model.Schedule{
+		UID:            req.UID,
+		Title:          req.Title,
+		StartTime:      req.StartTime,
+		EndTime:        req.EndTime,
+		Description:    req.Description,
+		Location:       req.Location,
+		OwnerID:        req.OwnerID,
+		OwnerType:      ownerType,
+		CreatorID:      creatorID,
+		RecurrenceRule: req.RecurrenceRule,
+		ExDates:        req.ExDates,
+		RecurrenceID:   req.RecurrenceID,
+	}
+}
+
+// insertSchedule はスケジュール1行を挿入し、採番されたIDを返します。
+// UID が空の場合は model.ScheduleUID で採番します。
+func insertSchedule(q querier, s *model.Schedule) (int64, error) {
 	query := `
-		INSERT INTO schedules (title, start_time, end_time, description, location, owner_id, creator_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?);
+		INSERT INTO schedules (uid, title, start_time, end_time, description, location, owner_id, owner_type, creator_id, rrule, exdates, series_id, recurrence_id, sequence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
-	result, err := tx.Exec(query, req.Title, req.StartTime, req.EndTime, req.Description, req.Location, req.OwnerID, creatorID)
+	var seriesID, recurrenceID any
+	if s.SeriesID != nil {
+		seriesID = *s.SeriesID
+	}
+	if s.RecurrenceID != nil {
+		recurrenceID = *s.RecurrenceID
+	}
+	result, err := q.Exec(query, s.UID, s.Title, s.StartTime, s.EndTime, s.Description, s.Location, s.OwnerID, s.OwnerType, s.CreatorID,
+		s.RecurrenceRule, formatExDates(s.ExDates), seriesID, recurrenceID, s.Sequence)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert schedule: %w", err)
+		return 0, fmt.Errorf("failed to insert schedule: %w", err)
 	}
 	scheduleID, err := result.LastInsertId()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert ID: %w", err)
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	if s.UID == "" {
+		if _, err := q.Exec("UPDATE schedules SET uid = ? WHERE id = ?", model.ScheduleUID(scheduleID), scheduleID); err != nil {
+			return 0, fmt.Errorf("failed to assign uid: %w", err)
+		}
 	}
+	return scheduleID, nil
+}
 
-	// 参加者を `schedule_participants` テーブルに追加
-	if len(req.ParticipantIDs) > 0 {
-		stmt, err := tx.Prepare("INSERT INTO schedule_participants (schedule_id, user_id) VALUES (?, ?)")
-		if err != nil {
-			return nil, fmt.Errorf("failed to prepare participant statement: %w", err)
+// insertParticipants はスケジュールに参加者を追加します。
+func insertParticipants(q querier, scheduleID int64, participantIDs []int64) error {
+	for _, userID := range participantIDs {
+		if _, err := q.Exec("INSERT INTO schedule_participants (schedule_id, user_id) VALUES (?, ?)", scheduleID, userID); err != nil {
+			return fmt.Errorf("failed to insert participant %d: %w", userID, err)
 		}
-		defer stmt.Close()
-		for _, userID := range req.ParticipantIDs {
-			if _, err := stmt.Exec(scheduleID, userID); err != nil {
-				return nil, fmt.Errorf("failed to insert participant %d: %w", userID, err)
-			}
+	}
+	return nil
+}
+
+// replaceParticipants はスケジュールの個別に招待された参加者を participantIDs に置き換えます。
+// 引き続き参加するユーザー (リンクしたグループのメンバーとして参加し続けるユーザーを含む) の出欠の回答は保持します。
+func replaceParticipants(q querier, scheduleID int64, participantIDs []int64) error {
+	// 個別の参加者から外れたユーザーは、リンクしたグループのメンバーとしての参加に切り替え (同期で削除される)
+	args := []interface{}{scheduleID}
+	query := "UPDATE schedule_participants SET direct = 0 WHERE schedule_id = ?"
+	if len(participantIDs) > 0 {
+		query += " AND user_id NOT IN (" + strings.Repeat("?,", len(participantIDs)-1) + "?)"
+		for _, id := range participantIDs {
+			args = append(args, id)
 		}
 	}
+	if _, err := q.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update existing participants: %w", err)
+	}
 
-	// トランザクションをコミット
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	// 新しい参加者を追加
+	for _, userID := range participantIDs {
+		_, err := q.Exec(`INSERT INTO schedule_participants (schedule_id, user_id) VALUES (?, ?)
+			ON CONFLICT (schedule_id, user_id) DO UPDATE SET direct = 1`, scheduleID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to insert participant %d: %w", userID, err)
+		}
 	}
+	return syncLinkedParticipants(q, scheduleID)
+}
 
-	return r.FindByID(scheduleID)
+// copyResponses は元のスケジュール fromID の参加者の出欠の回答を、スケジュール toID の同じ参加者に複写します。
+// 系列から単一発生の変更や分割した系列を作成するときに、回答を引き継ぐために使用します。
+func copyResponses(q querier, fromID, toID int64) error {
+	query := `UPDATE schedule_participants AS dst
+		SET status = src.status, comment = src.comment, responded_at = src.responded_at
+		FROM schedule_participants AS src
+		WHERE src.schedule_id = ? AND dst.schedule_id = ? AND src.user_id = dst.user_id`
+	if _, err := q.Exec(query, fromID, toID); err != nil {
+		return fmt.Errorf("failed to copy responses from schedule %d to %d: %w", fromID, toID, err)
+	}
+	return nil
 }
 
 // FindByID はIDでスケジュールを検索し、参加者情報も取得します。
+// 繰り返しスケジュールの場合は展開せず、系列そのものを返します。
 func (r *ScheduleRepository) FindByID(id int64) (*model.Schedule, error) {
-	var s model.Schedule
-	query := `
-		SELECT id, title, start_time, end_time, description, location, owner_id, creator_id, created_at, updated_at
-		FROM schedules WHERE id = ?;
-	`
-	row := r.db.QueryRow(query, id)
-	err := row.Scan(&s.ID, &s.Title, &s.StartTime, &s.EndTime, &s.Description, &s.Location, &s.OwnerID, &s.CreatorID, &s.CreatedAt, &s.UpdatedAt)
+	return findScheduleByID(r.db, id)
+}
+
+func findScheduleByID(q querier, id int64) (*model.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE id = ?;`
+	s, err := scanSchedule(q.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("schedule with id %d not found", id)
@@ -80,36 +291,57 @@ func (r *ScheduleRepository) FindByID(id int64) (*model.Schedule, error) {
 	}
 
 	// 参加者情報を取得
-	participants, err := r.findParticipantsByScheduleID(s.ID)
+	participants, err := findParticipantsByScheduleID(q, s.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find participants for schedule %d: %w", s.ID, err)
 	}
 	s.Participants = participants
 
-	return &s, nil
+	if err := attachLinkedGroups(q, []*model.Schedule{s}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// participantColumns は参加者として取得するカラムの一覧です。scanParticipant と順序を合わせてください。
+const participantColumns = `u.id, u.username, u.email, u.created_at, sp.status, sp.comment, sp.responded_at, sp.direct`
+
+// scanParticipant は participantColumns の順序で参加者を読み取ります。dest は先頭に追加で読み取るカラムです。
+func scanParticipant(row rowScanner, dest ...interface{}) (*model.Participant, error) {
+	var p model.Participant
+	var respondedAt sql.NullTime
+	dest = append(dest, &p.ID, &p.Username, &p.Email, &p.CreatedAt, &p.Status, &p.Comment, &respondedAt, &p.Direct)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if respondedAt.Valid {
+		p.RespondedAt = &respondedAt.Time
+	}
+	return &p, nil
 }
 
 // findParticipantsByScheduleID は指定されたスケジュールIDの参加者リストを取得します。
-func (r *ScheduleRepository) findParticipantsByScheduleID(scheduleID int64) ([]*model.User, error) {
+func findParticipantsByScheduleID(q querier, scheduleID int64) ([]*model.Participant, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.created_at
+		SELECT ` + participantColumns + `
 		FROM users u
 		JOIN schedule_participants sp ON u.id = sp.user_id
 		WHERE sp.schedule_id = ?;
 	`
-	rows, err := r.db.Query(query, scheduleID)
+	rows, err := q.Query(query, scheduleID)
 	if err != nil {
 		return nil, fmt.Errorf("query for participants failed: %w", err)
 	}
 	defer rows.Close()
 
-	var participants []*model.User
+	var participants []*model.Participant
 	for rows.Next() {
-		var u model.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.CreatedAt); err != nil {
+		p, err := scanParticipant(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan participant row: %w", err)
 		}
-		participants = append(participants, &u)
+		participants = append(participants, p)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -119,105 +351,528 @@ func (r *ScheduleRepository) findParticipantsByScheduleID(scheduleID int64) ([]*
 	return participants, nil
 }
 
-// FindByOwnerID は指定された所有者のスケジュールをすべて取得します。N+1問題を回避するように最適化されています。
-func (r *ScheduleRepository) FindByOwnerID(ownerID int64) ([]*model.Schedule, error) {
-	// ステップ1: 所有者に関連するすべてのスケジュールを取得
-	query := `
-		SELECT id, title, start_time, end_time, description, location, owner_id, creator_id, created_at, updated_at
-		FROM schedules WHERE owner_id = ? ORDER BY start_time ASC;
-	`
-	rows, err := r.db.Query(query, ownerID)
+// FindByOwnerID は指定されたユーザーのカレンダーのスケジュールのうち、q.From〜q.To の時間窓と重なるものを
+// 開始日時・IDの昇順で最大 q.Limit 件取得します。続きがある場合は次ページのカーソルを返します。
+// 単発のスケジュールは時間窓とカーソルをSQLで絞り込みます。
+// 繰り返しスケジュールは時間窓内の各発生に展開され、各発生の RecurrenceID に元の開始日時が設定されます
+// (1つの繰り返しスケジュールにつき、カーソルより後の発生をページに必要な件数まで展開)。
+func (r *ScheduleRepository) FindByOwnerID(ownerID int64, q *model.ScheduleQuery) ([]*model.Schedule, *model.ScheduleCursor, error) {
+	schedules, next, err := r.findInCalendars("owner_type = ? AND owner_id = ?", []interface{}{model.OwnerUser, ownerID}, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query for schedules by owner id failed: %w", err)
+	}
+	return schedules, next, nil
+}
+
+// FindByGroupID はグループのカレンダーと、メンバー memberIDs のカレンダーのスケジュールを1つの一覧として取得します。
+// 時間窓・ページネーションは FindByOwnerID と同じです。
+func (r *ScheduleRepository) FindByGroupID(groupID int64, memberIDs []int64, q *model.ScheduleQuery) ([]*model.Schedule, *model.ScheduleCursor, error) {
+	owners := "(owner_type = ? AND owner_id = ?)"
+	args := []interface{}{model.OwnerGroup, groupID}
+	if len(memberIDs) > 0 {
+		owners = "(" + owners + " OR (owner_type = ? AND owner_id IN (" + strings.Repeat("?,", len(memberIDs)-1) + "?)))"
+		args = append(args, model.OwnerUser)
+		for _, id := range memberIDs {
+			args = append(args, id)
+		}
+	}
+	schedules, next, err := r.findInCalendars(owners, args, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query for schedules by group id failed: %w", err)
+	}
+	return schedules, next, nil
+}
+
+// findInCalendars は SQL の条件 owners (引数 ownerArgs) で選択したカレンダーのスケジュールを取得します。
+func (r *ScheduleRepository) findInCalendars(owners string, ownerArgs []interface{}, q *model.ScheduleQuery) ([]*model.Schedule, *model.ScheduleCursor, error) {
+	// ステップ1: 時間窓・カーソルに該当する単発のスケジュールを取得
+	// 日時の比較はタイムゾーンに依存しないよう unixepoch() で行います。
+	conditions := []string{owners, "rrule = ''"}
+	args := append([]interface{}{}, ownerArgs...)
+	if !q.To.IsZero() {
+		conditions = append(conditions, "unixepoch(start_time) < unixepoch(?)")
+		args = append(args, q.To)
+	}
+	if !q.From.IsZero() {
+		// 長さ0の予定は開始日時で判定 (recurrence.Overlaps と同じ条件)
+		conditions = append(conditions, "(unixepoch(end_time) > unixepoch(?) OR unixepoch(start_time) >= unixepoch(?))")
+		args = append(args, q.From, q.From)
+	}
+	if q.Cursor != nil {
+		conditions = append(conditions, "(unixepoch(start_time) > ? OR (unixepoch(start_time) = ? AND id > ?))")
+		args = append(args, q.Cursor.StartUnix, q.Cursor.StartUnix, q.Cursor.ID)
+	}
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY unixepoch(start_time), id`
+	if q.Limit > 0 {
+		// 次ページの有無を判定するために1件多く取得
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+	schedules, err := querySchedules(r.db, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// ステップ2: 時間窓の終了より前に始まる繰り返しスケジュールを取得して展開
+	seriesQuery := `SELECT ` + scheduleColumns + ` FROM schedules WHERE ` + owners + ` AND rrule != ''`
+	seriesArgs := append([]interface{}{}, ownerArgs...)
+	if !q.To.IsZero() {
+		seriesQuery += ` AND unixepoch(start_time) < unixepoch(?)`
+		seriesArgs = append(seriesArgs, q.To)
+	}
+	series, err := querySchedules(r.db, seriesQuery, seriesArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("query for schedules by owner id failed: %w", err)
+		return nil, nil, fmt.Errorf("query for recurring schedules failed: %w", err)
+	}
+	for _, s := range series {
+		if q.KeepSeries {
+			occurrences, err := expandPage(s, q.From, q.To, nil, 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(occurrences) > 0 && (q.Cursor == nil || q.Cursor.Precedes(s)) {
+				schedules = append(schedules, s)
+			}
+			continue
+		}
+		// 次ページの有無の判定に必要な q.Limit+1 件まで展開
+		occurrences, err := expandPage(s, q.From, q.To, q.Cursor, q.Limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		schedules = append(schedules, occurrences...)
+	}
+
+	// ステップ3: SQLと同じ順序 (開始日時の秒, ID) で並べ替え、ページを切り出す
+	sort.SliceStable(schedules, func(i, j int) bool {
+		a, b := schedules[i], schedules[j]
+		if a.StartTime.Unix() != b.StartTime.Unix() {
+			return a.StartTime.Unix() < b.StartTime.Unix()
+		}
+		return a.ID < b.ID
+	})
+	var next *model.ScheduleCursor
+	if q.Limit > 0 && len(schedules) > q.Limit {
+		schedules = schedules[:q.Limit]
+		next = model.CursorAfter(schedules[len(schedules)-1])
+	}
+
+	// ステップ4: ページに含まれるスケジュールの参加者とリンクしたグループを1回ずつのクエリで取得
+	if err := attachParticipants(r.db, schedules); err != nil {
+		return nil, nil, err
+	}
+	if err := attachLinkedGroups(r.db, schedules); err != nil {
+		return nil, nil, err
+	}
+
+	return schedules, next, nil
+}
+
+// querySchedules はクエリを実行し、scheduleColumns の順序で取得した行を返します。
+func querySchedules(q querier, query string, args ...interface{}) ([]*model.Schedule, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	// スケジュールをIDでマッピングし、IDのスライスを収集
-	scheduleMap := make(map[int64]*model.Schedule)
-	var scheduleIDs []int64
+	schedules := []*model.Schedule{}
 	for rows.Next() {
-		var s model.Schedule
-		err := rows.Scan(&s.ID, &s.Title, &s.StartTime, &s.EndTime, &s.Description, &s.Location, &s.OwnerID, &s.CreatorID, &s.CreatedAt, &s.UpdatedAt)
+		s, err := scanSchedule(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan schedule row: %w", err)
 		}
-		s.Participants = []*model.User{} // 参加者スライスを初期化
-		scheduleMap[s.ID] = &s
-		scheduleIDs = append(scheduleIDs, s.ID)
+		schedules = append(schedules, s)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error during schedule rows iteration: %w", err)
 	}
+	return schedules, nil
+}
+
+// attachParticipants は複数のスケジュールの参加者を1回のクエリで取得して設定します。N+1問題を回避します。
+// 展開された発生のように同じIDのスケジュールが複数含まれていても構いません。
+func attachParticipants(q querier, schedules []*model.Schedule) error {
+	byID := make(map[int64][]*model.Schedule)
+	var scheduleIDs []interface{}
+	for _, s := range schedules {
+		s.Participants = []*model.Participant{} // 参加者スライスを初期化
+		if _, ok := byID[s.ID]; !ok {
+			scheduleIDs = append(scheduleIDs, s.ID)
+		}
+		byID[s.ID] = append(byID[s.ID], s)
+	}
 
 	// スケジュールが存在しない場合は早期にリターン
 	if len(scheduleIDs) == 0 {
-		return []*model.Schedule{}, nil
+		return nil
 	}
 
-	// ステップ2: 収集したスケジュールIDを使って、すべての参加者を1回のクエリで取得
 	participantQuery := `
-		SELECT sp.schedule_id, u.id, u.username, u.email, u.created_at
+		SELECT sp.schedule_id, ` + participantColumns + `
 		FROM users u
 		JOIN schedule_participants sp ON u.id = sp.user_id
 		WHERE sp.schedule_id IN (` + strings.Repeat("?,", len(scheduleIDs)-1) + `?);
 	`
-	args := make([]interface{}, len(scheduleIDs))
-	for i, id := range scheduleIDs {
-		args[i] = id
-	}
-
-	participantRows, err := r.db.Query(participantQuery, args...)
+	participantRows, err := q.Query(participantQuery, scheduleIDs...)
 	if err != nil {
-		return nil, fmt.Errorf("query for participants failed: %w", err)
+		return fmt.Errorf("query for participants failed: %w", err)
 	}
 	defer participantRows.Close()
 
-	// ステップ3: 参加者を対応するスケジュールにマッピング
+	// 参加者を対応するスケジュールにマッピング
 	for participantRows.Next() {
 		var scheduleID int64
-		var u model.User
-		if err := participantRows.Scan(&scheduleID, &u.ID, &u.Username, &u.Email, &u.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan participant row: %w", err)
+		p, err := scanParticipant(participantRows, &scheduleID)
+		if err != nil {
+			return fmt.Errorf("failed to scan participant row: %w", err)
 		}
-		if schedule, ok := scheduleMap[scheduleID]; ok {
-			schedule.Participants = append(schedule.Participants, &u)
+		for _, s := range byID[scheduleID] {
+			s.Participants = append(s.Participants, p)
 		}
 	}
 	if err = participantRows.Err(); err != nil {
-		return nil, fmt.Errorf("error during participant rows iteration: %w", err)
+		return fmt.Errorf("error during participant rows iteration: %w", err)
 	}
+	return nil
+}
 
-	// マップからスケジュールのスライスを再構築
-	schedules := make([]*model.Schedule, 0, len(scheduleMap))
-	for _, id := range scheduleIDs { // 元の順序を維持
-		schedules = append(schedules, scheduleMap[id])
+// expandOccurrences は時間窓 [from, to) と重なるスケジュールの発生を返します。
+// 単発のスケジュールは重なる場合にそのまま返します。
+func expandOccurrences(s *model.Schedule, from, to time.Time) ([]*model.Schedule, error) {
+	if !s.IsRecurring() {
+		if recurrence.Overlaps(s.StartTime, s.EndTime, from, to) {
+			return []*model.Schedule{s}, nil
+		}
+		return nil, nil
 	}
 
-	return schedules, nil
+	rule, err := recurrence.Parse(s.RecurrenceRule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule for schedule %d: %w", s.ID, err)
+	}
+	duration := s.EndTime.Sub(s.StartTime)
+
+	var occurrences []*model.Schedule
+	for _, start := range rule.Between(s.StartTime, duration, from, to, s.ExDates) {
+		occurrences = append(occurrences, occurrenceOf(s, start, duration))
+	}
+	return occurrences, nil
+}
+
+// expandPage は繰り返しスケジュール s の発生のうち、時間窓 [from, to) と重なり cursor より後のものを、
+// 開始日時の順に最大 limit 件返します (limit が0以下または recurrence.MaxOccurrences を超える場合は MaxOccurrences 件)。
+// cursor がある場合はカーソルの開始日時から展開するため、後のページでも展開する発生の数は増えません。
+func expandPage(s *model.Schedule, from, to time.Time, cursor *model.ScheduleCursor, limit int) ([]*model.Schedule, error) {
+	rule, err := recurrence.Parse(s.RecurrenceRule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule for schedule %d: %w", s.ID, err)
+	}
+	if limit <= 0 || limit > recurrence.MaxOccurrences {
+		limit = recurrence.MaxOccurrences
+	}
+	if cursor != nil {
+		// カーソルより前に始まる発生はページに含まれないため、時間窓の開始をカーソルまで進める
+		if start := time.Unix(cursor.StartUnix, 0); start.After(from) {
+			from = start
+		}
+	}
+	duration := s.EndTime.Sub(s.StartTime)
+
+	var occurrences []*model.Schedule
+	rule.EachBetween(s.StartTime, duration, from, to, s.ExDates, func(start time.Time) bool {
+		occ := occurrenceOf(s, start, duration)
+		if cursor != nil && !cursor.Precedes(occ) {
+			return true
+		}
+		occurrences = append(occurrences, occ)
+		return len(occurrences) < limit
+	})
+	return occurrences, nil
+}
+
+// occurrenceOf は繰り返しスケジュール s の start に始まる発生を返します。
+func occurrenceOf(s *model.Schedule, start time.Time, duration time.Duration) *model.Schedule {
+	occ := *s
+	recurrenceID := start
+	occ.StartTime = start
+	occ.EndTime = start.Add(duration)
+	occ.RecurrenceID = &recurrenceID
+	return &occ
+}
+
+// validateOccurrence は occurrence が繰り返しスケジュール s の発生であるかを検証し、解析済みのルールを返します。
+func validateOccurrence(s *model.Schedule, occurrence *time.Time) (*recurrence.Rule, error) {
+	if !s.IsRecurring() {
+		return nil, ErrNotRecurring
+	}
+	if occurrence == nil {
+		return nil, fmt.Errorf("%w: occurrence start is required", ErrInvalidOccurrence)
+	}
+	rule, err := recurrence.Parse(s.RecurrenceRule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule for schedule %d: %w", s.ID, err)
+	}
+	// occurrence から始まる1秒の時間窓に開始する発生を探す (EXDATE は考慮しない)
+	occurrences := rule.Between(s.StartTime, 0, *occurrence, occurrence.Add(time.Second), nil)
+	if len(occurrences) == 0 || !occurrences[0].Equal(*occurrence) {
+		return nil, fmt.Errorf("%w: %s is not an occurrence of schedule %d", ErrInvalidOccurrence, occurrence.Format(time.RFC3339), s.ID)
+	}
+	return rule, nil
+}
+
+// requireIncludedOccurrence は occurrence が系列 s の EXDATE で除外されていないことを確認します。
+// 除外されている場合、その発生はすでに削除されたか、単一発生の変更 (別のスケジュール) になっているため、
+// ErrInvalidOccurrence を返します。変更になっている場合は、エラーに変更のスケジュールのIDを含めます。
+func requireIncludedOccurrence(q querier, s *model.Schedule, occurrence time.Time) error {
+	excluded := false
+	for _, ex := range s.ExDates {
+		if ex.Equal(occurrence) {
+			excluded = true
+			break
+		}
+	}
+	if !excluded {
+		return nil
+	}
+
+	var overrideID int64
+	err := q.QueryRow("SELECT id FROM schedules WHERE series_id = ? AND unixepoch(recurrence_id) = unixepoch(?)", s.ID, occurrence.UTC()).Scan(&overrideID)
+	switch {
+	case err == sql.ErrNoRows:
+		return fmt.Errorf("%w: occurrence %s of schedule %d has been deleted", ErrInvalidOccurrence, occurrence.Format(time.RFC3339), s.ID)
+	case err != nil:
+		return fmt.Errorf("query for override of schedule %d failed: %w", s.ID, err)
+	}
+	return fmt.Errorf("%w: occurrence %s of schedule %d has been changed; use schedule %d instead", ErrInvalidOccurrence, occurrence.Format(time.RFC3339), s.ID, overrideID)
+}
+
+// truncateRule は occurrence より前の発生だけが残るようにルールを切り詰め、
+// 切り詰めたルールと、occurrence 以降の発生を表すルールを返します。
+func truncateRule(rule *recurrence.Rule, dtstart, occurrence time.Time) (before, following *recurrence.Rule) {
+	b, f := *rule, *rule
+	if rule.Count > 0 {
+		b.Count = rule.CountBefore(dtstart, occurrence)
+		f.Count = rule.Count - b.Count
+	} else {
+		b.Until, b.UntilFloating, b.UntilDate = occurrence.Add(-time.Second), false, false
+	}
+	return &b, &f
+}
+
+// splitExDates は EXDATE を occurrence より前とそれ以降に分割します。
+func splitExDates(exdates []time.Time, occurrence time.Time) (before, following []time.Time) {
+	for _, ex := range exdates {
+		if ex.Before(occurrence) {
+			before = append(before, ex)
+		} else {
+			following = append(following, ex)
+		}
+	}
+	return before, following
+}
+
+// applyScheduleUpdate はリクエストで指定されたnilでないフィールドをスケジュールに反映します。
+func applyScheduleUpdate(s *model.Schedule, req *model.UpdateScheduleRequest) {
+	if req.Title != nil {
+		s.Title = *req.Title
+	}
+	if req.StartTime != nil {
+		s.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		s.EndTime = *req.EndTime
+	}
+	if req.Description != nil {
+		s.Description = *req.Description
+	}
+	if req.Location != nil {
+		s.Location = *req.Location
+	}
+	if req.RecurrenceRule != nil {
+		s.RecurrenceRule = *req.RecurrenceRule
+	}
+	if req.ExDates != nil {
+		s.ExDates = *req.ExDates
+	}
+}
+
+// participantIDsOf はスケジュールの個別に招待された参加者のIDのリストを返します。
+// リンクしたグループのメンバーとしてのみ参加しているユーザーは含みません。
+func participantIDsOf(s *model.Schedule) []int64 {
+	ids := make([]int64, 0, len(s.Participants))
+	for _, p := range s.Participants {
+		if p.Direct {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// findOverrides は系列 seriesID に属する単一発生の変更のうち、元の開始日時が occurrence 以降のもののIDを返します。
+// occurrence がゼロ値の場合はすべてを返します。
+func findOverrides(q querier, seriesID int64, occurrence time.Time) ([]int64, error) {
+	rows, err := q.Query("SELECT id, recurrence_id FROM schedules WHERE series_id = ? AND recurrence_id IS NOT NULL", seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("query for overrides failed: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var recurrenceID time.Time
+		if err := rows.Scan(&id, &recurrenceID); err != nil {
+			return nil, fmt.Errorf("failed to scan override row: %w", err)
+		}
+		if occurrence.IsZero() || !recurrenceID.Before(occurrence) {
+			ids = append(ids, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during override rows iteration: %w", err)
+	}
+	return ids, nil
+}
+
+// deleteScheduleRows はスケジュールとその参加者情報・リマインダーを削除します。
+func deleteScheduleRows(q querier, ids ...int64) error {
+	for _, id := range ids {
+		// 関連する参加者情報を削除 (CASCADE DELETEが設定されているが、念のため)
+		if _, err := q.Exec("DELETE FROM schedule_participants WHERE schedule_id = ?;", id); err != nil {
+			return fmt.Errorf("failed to delete participants for schedule %d: %w", id, err)
+		}
+		if _, err := q.Exec("DELETE FROM schedule_participant_groups WHERE schedule_id = ?;", id); err != nil {
+			return fmt.Errorf("failed to delete linked groups for schedule %d: %w", id, err)
+		}
+		if _, err := q.Exec("DELETE FROM schedule_reminders WHERE schedule_id = ?;", id); err != nil {
+			return fmt.Errorf("failed to delete reminders for schedule %d: %w", id, err)
+		}
+		if _, err := q.Exec("DELETE FROM schedules WHERE id = ?;", id); err != nil {
+			return fmt.Errorf("failed to delete schedule %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// updateRecurrence は系列のルールと EXDATE を更新し、SEQUENCE を増やします。
+func updateRecurrence(q querier, id int64, rrule string, exdates []time.Time) error {
+	_, err := q.Exec("UPDATE schedules SET rrule = ?, exdates = ?, sequence = sequence + 1, updated_at = ? WHERE id = ?", rrule, formatExDates(exdates), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update recurrence of schedule %d: %w", id, err)
+	}
+	return nil
 }
 
 // Update は既存のスケジュール情報を更新します。
 // リクエストで指定されたnilでないフィールドのみを動的に更新します。
-func (r *ScheduleRepository) Update(id int64, req *model.UpdateScheduleRequest, userID int64) (*model.Schedule, error) {
+// 繰り返しスケジュールの場合、req.Scope に応じて以下のように動作します。
+//   - ScopeAll: 系列全体を更新します。
+//   - ScopeThis: 対象の発生を EXDATE で除外し、変更内容を持つ単発のスケジュールを作成して返します。
+//   - ScopeFollowing: 系列を対象の発生の直前で打ち切り、以降の発生を新しい系列として作成して返します。
+//
+// 所有者のカレンダーへの write 権限が必要です。
+// 変更後のスケジュールが既存スケジュールと重なり、AllowConflicts が指定されていない場合は *ConflictError を返します。
+// 変更したユーザー以外の所有者と参加者 (変更で外れた参加者を含む) に通知し、webhook の配信キューに追加します。
+// 購読中のクライアントに発行するイベントをあわせて返します。
+func (r *ScheduleRepository) Update(id int64, req *model.UpdateScheduleRequest, userID int64) (*model.Schedule, *model.ScheduleEvent, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// 更新権限をチェック (作成者のみが更新可能)
-	var creatorID int64
-	err = tx.QueryRow("SELECT creator_id FROM schedules WHERE id = ?", id).Scan(&creatorID)
+	// 更新権限をチェック (所有者のカレンダーへの write 権限が必要)
+	current, err := findScheduleByID(tx, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("schedule with id %d not found", id)
+		return nil, nil, err
+	}
+	if err := requirePermission(tx, current.OwnerType, current.OwnerID, userID, model.PermissionWrite); err != nil {
+		return nil, nil, err
+	}
+
+	// 招待したグループを、個別の参加者の追加 (リンクしない場合) またはリンクするグループの置き換えに解決
+	if req.ParticipantGroupIDs != nil {
+		base := participantIDsOf(current)
+		if req.ParticipantIDs != nil {
+			base = *req.ParticipantIDs
+		}
+		participantIDs, linkedGroupIDs, err := resolveGroupInvitations(tx, *req.ParticipantGroupIDs, req.LinkGroups, base, userID)
+		if err != nil {
+			return nil, nil, err
 		}
-		return nil, fmt.Errorf("failed to query creator_id: %w", err)
+		resolved := *req
+		if req.LinkGroups {
+			resolved.ParticipantGroupIDs = &linkedGroupIDs
+		} else {
+			resolved.ParticipantIDs = &participantIDs
+			resolved.ParticipantGroupIDs = nil
+		}
+		req = &resolved
 	}
-	if creatorID != userID {
-		return nil, fmt.Errorf("user %d is not authorized to update schedule %d", userID, id)
+
+	resultID := id
+	switch req.Scope {
+	case model.ScopeThis:
+		resultID, err = r.updateOccurrence(tx, current, req)
+	case model.ScopeFollowing:
+		if req.OccurrenceStart != nil && req.OccurrenceStart.Equal(current.StartTime) {
+			err = r.updateAll(tx, id, req)
+		} else {
+			resultID, err = r.updateFollowing(tx, current, req)
+		}
+	default:
+		err = r.updateAll(tx, id, req)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 日時・繰り返し・参加者が変わる場合は、既存スケジュールとの重複をチェック
+	if !req.AllowConflicts && changesTiming(req) {
+		if err := checkConflicts(tx, resultID, userID); err != nil {
+			return nil, nil, err
+		}
 	}
 
+	// 変更後の所有者・参加者と、参加者から外れたユーザーに通知
+	updated, err := findScheduleByID(tx, resultID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var previousIDs []int64
+	for _, p := range current.Participants {
+		previousIDs = append(previousIDs, p.ID)
+	}
+	if err := notifyScheduleChange(tx, model.NotificationScheduleUpdated, updated, userID, occurrenceDetail(req.Scope, req.OccurrenceStart), previousIDs...); err != nil {
+		return nil, nil, err
+	}
+	event := model.NewScheduleEvent(model.EventScheduleUpdated, updated, current, userID)
+	event.Scope, event.OccurrenceStart = req.Scope, req.OccurrenceStart
+	if err := queueWebhooks(tx, event); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	schedule, err := r.FindByID(resultID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schedule, event, nil
+}
+
+// changesTiming は更新リクエストが日時・繰り返し・参加者のいずれかを変更するかを返します。
+func changesTiming(req *model.UpdateScheduleRequest) bool {
+	return req.StartTime != nil || req.EndTime != nil || req.RecurrenceRule != nil ||
+		req.ExDates != nil || req.ParticipantIDs != nil || req.ParticipantGroupIDs != nil
+}
+
+// updateAll はスケジュール (繰り返しの場合は系列全体) を更新します。
+// 参加者に更新した招待を送るため、内容または参加者を変更した場合は SEQUENCE を増やします。
+func (r *ScheduleRepository) updateAll(tx *sql.Tx, id int64, req *model.UpdateScheduleRequest) error {
 	var setClauses []string
 	var args []interface{}
 
@@ -241,84 +896,670 @@ func (r *ScheduleRepository) Update(id int64, req *model.UpdateScheduleRequest,
 		setClauses = append(setClauses, "location = ?")
 		args = append(args, *req.Location)
 	}
+	if req.RecurrenceRule != nil {
+		setClauses = append(setClauses, "rrule = ?")
+		args = append(args, *req.RecurrenceRule)
+	}
+	if req.ExDates != nil {
+		setClauses = append(setClauses, "exdates = ?")
+		args = append(args, formatExDates(*req.ExDates))
+	}
 
 	// スケジュール本体の更新
-	if len(setClauses) > 0 {
-		setClauses = append(setClauses, "updated_at = ?")
+	if len(setClauses) > 0 || req.ParticipantIDs != nil || req.ParticipantGroupIDs != nil {
+		setClauses = append(setClauses, "sequence = sequence + 1", "updated_at = ?")
 		args = append(args, time.Now())
 		query := fmt.Sprintf("UPDATE schedules SET %s WHERE id = ?", strings.Join(setClauses, ", "))
 		args = append(args, id)
 		if _, err := tx.Exec(query, args...); err != nil {
-			return nil, fmt.Errorf("failed to update schedule: %w", err)
+			return fmt.Errorf("failed to update schedule: %w", err)
 		}
 	}
 
-	// 参加者の更新
+	// 参加者・リンクしたグループの更新
 	if req.ParticipantIDs != nil {
-		// 既存の参加者を削除
-		if _, err := tx.Exec("DELETE FROM schedule_participants WHERE schedule_id = ?", id); err != nil {
-			return nil, fmt.Errorf("failed to delete existing participants: %w", err)
+		if err := replaceParticipants(tx, id, *req.ParticipantIDs); err != nil {
+			return err
 		}
-		// 新しい参加者を追加
-		if len(*req.ParticipantIDs) > 0 {
-			stmt, err := tx.Prepare("INSERT INTO schedule_participants (schedule_id, user_id) VALUES (?, ?)")
-			if err != nil {
-				return nil, fmt.Errorf("failed to prepare participant statement for update: %w", err)
+	}
+	if req.ParticipantGroupIDs != nil {
+		if err := replaceLinkedGroups(tx, id, *req.ParticipantGroupIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLinkedGroups は系列から作成したスケジュール toID に、系列にリンクしたグループ
+// (リクエストで指定された場合はそのグループ) をリンクします。
+func copyLinkedGroups(tx *sql.Tx, series *model.Schedule, toID int64, req *model.UpdateScheduleRequest) error {
+	groupIDs := series.LinkedGroupIDs
+	if req.ParticipantGroupIDs != nil {
+		groupIDs = *req.ParticipantGroupIDs
+	}
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	return replaceLinkedGroups(tx, toID, groupIDs)
+}
+
+// updateOccurrence は繰り返しスケジュールの単一の発生を変更し、作成した単発スケジュールのIDを返します。
+// すでに変更または削除した発生は変更できません (変更はそのスケジュールを直接更新します)。
+func (r *ScheduleRepository) updateOccurrence(tx *sql.Tx, series *model.Schedule, req *model.UpdateScheduleRequest) (int64, error) {
+	if _, err := validateOccurrence(series, req.OccurrenceStart); err != nil {
+		return 0, err
+	}
+	occurrence := *req.OccurrenceStart
+	if err := requireIncludedOccurrence(tx, series, occurrence); err != nil {
+		return 0, err
+	}
+
+	// 系列から対象の発生を除外
+	exdates := append(append([]time.Time{}, series.ExDates...), occurrence)
+	if err := updateRecurrence(tx, series.ID, series.RecurrenceRule, exdates); err != nil {
+		return 0, err
+	}
+
+	// 変更内容を持つ単発のスケジュールを作成
+	override := *series
+	override.StartTime = occurrence
+	override.EndTime = occurrence.Add(series.EndTime.Sub(series.StartTime))
+	applyScheduleUpdate(&override, req)
+	override.RecurrenceRule = ""
+	override.ExDates = nil
+	override.SeriesID = &series.ID
+	override.RecurrenceID = &occurrence
+	override.Sequence = series.Sequence + 1 // 系列の EXDATE の追加より新しい変更として扱う
+	overrideID, err := insertSchedule(tx, &override)
+	if err != nil {
+		return 0, err
+	}
+
+	participantIDs := participantIDsOf(series)
+	if req.ParticipantIDs != nil {
+		participantIDs = *req.ParticipantIDs
+	}
+	if err := insertParticipants(tx, overrideID, participantIDs); err != nil {
+		return 0, err
+	}
+	if err := copyLinkedGroups(tx, series, overrideID, req); err != nil {
+		return 0, err
+	}
+	if err := copyResponses(tx, series.ID, overrideID); err != nil {
+		return 0, err
+	}
+	return overrideID, nil
+}
+
+// updateFollowing は繰り返しスケジュールを対象の発生で分割し、以降の発生に変更を適用した新しい系列のIDを返します。
+func (r *ScheduleRepository) updateFollowing(tx *sql.Tx, series *model.Schedule, req *model.UpdateScheduleRequest) (int64, error) {
+	rule, err := validateOccurrence(series, req.OccurrenceStart)
+	if err != nil {
+		return 0, err
+	}
+	occurrence := *req.OccurrenceStart
+
+	// 元の系列を対象の発生の直前で打ち切る
+	beforeRule, followingRule := truncateRule(rule, series.StartTime, occurrence)
+	beforeExDates, followingExDates := splitExDates(series.ExDates, occurrence)
+	if err := updateRecurrence(tx, series.ID, beforeRule.String(), beforeExDates); err != nil {
+		return 0, err
+	}
+
+	// 以降の発生を新しい系列として作成
+	next := *series
+	next.StartTime = occurrence
+	next.EndTime = occurrence.Add(series.EndTime.Sub(series.StartTime))
+	next.RecurrenceRule = followingRule.String()
+	next.ExDates = followingExDates
+	applyScheduleUpdate(&next, req)
+	next.UID = "" // 新しい系列には新しい UID を採番
+	next.Sequence = 0
+	next.SeriesID = &series.ID
+	next.RecurrenceID = nil
+	nextID, err := insertSchedule(tx, &next)
+	if err != nil {
+		return 0, err
+	}
+
+	participantIDs := participantIDsOf(series)
+	if req.ParticipantIDs != nil {
+		participantIDs = *req.ParticipantIDs
+	}
+	if err := insertParticipants(tx, nextID, participantIDs); err != nil {
+		return 0, err
+	}
+	if err := copyLinkedGroups(tx, series, nextID, req); err != nil {
+		return 0, err
+	}
+	if err := copyResponses(tx, series.ID, nextID); err != nil {
+		return 0, err
+	}
+
+	// 以降の発生に対する単一発生の変更を新しい系列に付け替える
+	overrideIDs, err := findOverrides(tx, series.ID, occurrence)
+	if err != nil {
+		return 0, err
+	}
+	// 単一発生の変更は系列と同じ UID を持つため、新しい系列の UID に合わせる
+	for _, overrideID := range overrideIDs {
+		if _, err := tx.Exec("UPDATE schedules SET series_id = ?, uid = ? WHERE id = ?", nextID, model.ScheduleUID(nextID), overrideID); err != nil {
+			return 0, fmt.Errorf("failed to move override %d to schedule %d: %w", overrideID, nextID, err)
+		}
+	}
+	return nextID, nil
+}
+
+// Delete はIDでスケジュールを削除します。所有者のカレンダーへの write 権限が必要です。
+// 繰り返しスケジュールの場合、req.Scope に応じて単一の発生、以降の発生、または系列全体を削除します。
+// 削除したユーザー以外の所有者と参加者に通知し、webhook の配信キューに追加します。
+// 購読中のクライアントに発行するイベントを返します。
+func (r *ScheduleRepository) Delete(id int64, req *model.DeleteScheduleRequest, userID int64) (*model.ScheduleEvent, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 削除権限をチェック
+	current, err := findScheduleByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePermission(tx, current.OwnerType, current.OwnerID, userID, model.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Scope == model.ScopeThis:
+		if _, err := validateOccurrence(current, req.OccurrenceStart); err != nil {
+			return nil, err
+		}
+		if err := requireIncludedOccurrence(tx, current, *req.OccurrenceStart); err != nil {
+			return nil, err
+		}
+		exdates := append(append([]time.Time{}, current.ExDates...), *req.OccurrenceStart)
+		if err := updateRecurrence(tx, id, current.RecurrenceRule, exdates); err != nil {
+			return nil, err
+		}
+	case req.Scope == model.ScopeFollowing && !(req.OccurrenceStart != nil && req.OccurrenceStart.Equal(current.StartTime)):
+		rule, err := validateOccurrence(current, req.OccurrenceStart)
+		if err != nil {
+			return nil, err
+		}
+		beforeRule, _ := truncateRule(rule, current.StartTime, *req.OccurrenceStart)
+		beforeExDates, _ := splitExDates(current.ExDates, *req.OccurrenceStart)
+		if err := updateRecurrence(tx, id, beforeRule.String(), beforeExDates); err != nil {
+			return nil, err
+		}
+		overrideIDs, err := findOverrides(tx, id, *req.OccurrenceStart)
+		if err != nil {
+			return nil, err
+		}
+		if err := deleteScheduleRows(tx, overrideIDs...); err != nil {
+			return nil, err
+		}
+	default:
+		// 系列全体の削除では単一発生の変更もあわせて削除
+		overrideIDs, err := findOverrides(tx, id, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if err := deleteScheduleRows(tx, append(overrideIDs, id)...); err != nil {
+			return nil, err
+		}
+	}
+
+	// 所有者・参加者に通知
+	if err := notifyScheduleChange(tx, model.NotificationScheduleDeleted, current, userID, occurrenceDetail(req.Scope, req.OccurrenceStart)); err != nil {
+		return nil, err
+	}
+	event := model.NewScheduleEvent(model.EventScheduleDeleted, current, nil, userID)
+	event.Scope, event.OccurrenceStart = req.Scope, req.OccurrenceStart
+	if err := queueWebhooks(tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return event, nil
+}
+
+// Respond は参加者 userID のスケジュールへの出欠の回答を記録し、更新後のスケジュールを返します。
+// 繰り返しスケジュールの場合は系列全体への回答になります。参加者以外は回答できません。
+// 回答はスケジュールの所有者 (グループのカレンダーの場合は作成者) に通知します。
+func (r *ScheduleRepository) Respond(id int64, req *model.RSVPRequest, userID int64) (*model.Schedule, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := findScheduleByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec("UPDATE schedule_participants SET status = ?, comment = ?, responded_at = ? WHERE schedule_id = ? AND user_id = ?",
+		req.Status, req.Comment, time.Now().UTC(), id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update response: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to get affected rows: %w", err)
+	} else if n == 0 {
+		return nil, fmt.Errorf("user %d is not authorized to respond to schedule %d: not a participant", userID, id)
+	}
+
+	// 購読フィードや CalDAV クライアントが変更を検知できるよう、スケジュールの更新日時を進める
+	if _, err := tx.Exec("UPDATE schedules SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to touch schedule %d: %w", id, err)
+	}
+
+	// 所有者に通知
+	if err := notifyResponse(tx, current, req, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return r.FindByID(id)
+}
+
+// Import は iCalendar から変換した複数のスケジュールを単一トランザクションで作成し、
+// リクエストと同じ順序で作成したスケジュールのIDを返します。
+// 所有者のカレンダーに同じ UID (と RECURRENCE-ID) の予定がすでにある場合は作成せず、IDは0になります。
+// RecurrenceID を持つリクエストは、同じ UID の系列があれば単一発生の変更として紐付け、系列からその発生を除外します。
+// そのため系列を先に並べてください。各所有者のカレンダーへの write 権限が必要です。
+// 既存の予定の取り込みのため、Create と異なり重複の確認・通知の作成は行いません。
+func (r *ScheduleRepository) Import(reqs []*model.CreateScheduleRequest, creatorID int64) ([]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	checked := make(map[int64]bool)
+	ids := make([]int64, len(reqs))
+	for i, req := range reqs {
+		if !checked[req.OwnerID] {
+			if err := requirePermission(tx, model.OwnerUser, req.OwnerID, creatorID, model.PermissionWrite); err != nil {
+				return nil, err
 			}
-			defer stmt.Close()
-			for _, userID := range *req.ParticipantIDs {
-				if _, err := stmt.Exec(id, userID); err != nil {
-					return nil, fmt.Errorf("failed to insert participant %d for update: %w", userID, err)
-				}
+			checked[req.OwnerID] = true
+		}
+
+		exists, err := uidExists(tx, req.OwnerID, req.UID, req.RecurrenceID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+
+		s := scheduleFromRequest(req, creatorID)
+		if req.RecurrenceID != nil {
+			if err := linkOverride(tx, s); err != nil {
+				return nil, err
 			}
 		}
+		scheduleID, err := insertSchedule(tx, s)
+		if err != nil {
+			return nil, err
+		}
+		if err := insertParticipants(tx, scheduleID, req.ParticipantIDs); err != nil {
+			return nil, err
+		}
+		ids[i] = scheduleID
 	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return ids, nil
+}
 
-	return r.FindByID(id)
+// uidExists はユーザー ownerID のカレンダーに同じ UID と RECURRENCE-ID を持つ予定があるかを判定します。
+func uidExists(q querier, ownerID int64, uid string, recurrenceID *time.Time) (bool, error) {
+	var arg any
+	if recurrenceID != nil {
+		arg = *recurrenceID
+	}
+	var n int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM schedules
+		WHERE owner_type = ? AND owner_id = ? AND uid = ? AND ifnull(unixepoch(recurrence_id), 0) = ifnull(unixepoch(?), 0)
+	`, model.OwnerUser, ownerID, uid, arg).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("query for uid failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// linkOverride は単一発生の変更 s を同じ UID の系列に紐付け、系列の EXDATE に元の発生を追加します。
+// 系列が見つからない場合は単発のスケジュールとして扱います。
+func linkOverride(q querier, s *model.Schedule) error {
+	row := q.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE owner_type = ? AND owner_id = ? AND uid = ? AND recurrence_id IS NULL AND rrule != ''`,
+		s.OwnerType, s.OwnerID, s.UID)
+	series, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("query for series failed: %w", err)
+	}
+
+	s.SeriesID = &series.ID
+	for _, ex := range series.ExDates {
+		if ex.Equal(*s.RecurrenceID) {
+			return nil
+		}
+	}
+	return updateRecurrence(q, series.ID, series.RecurrenceRule, append(series.ExDates, *s.RecurrenceID))
+}
+
+// FindByUID はユーザー ownerID のカレンダーから UID が一致するスケジュール (系列と単一発生の変更) を参加者情報とともに取得します。
+// 系列を先頭に、単一発生の変更を元の開始日時の順で返します。
+func (r *ScheduleRepository) FindByUID(ownerID int64, uid string) ([]*model.Schedule, error) {
+	schedules, err := findSchedulesByUID(r.db, ownerID, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("schedule with uid %q not found", uid)
+	}
+	if err := attachParticipants(r.db, schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func findSchedulesByUID(q querier, ownerID int64, uid string) ([]*model.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE owner_type = ? AND owner_id = ? AND uid = ?
+		ORDER BY recurrence_id IS NOT NULL, unixepoch(recurrence_id), id`
+	schedules, err := querySchedules(q, query, model.OwnerUser, ownerID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("query for schedules by uid failed: %w", err)
+	}
+	return schedules, nil
 }
 
-// Delete はIDでスケジュールを削除します。作成者のみが削除可能です。
-func (r *ScheduleRepository) Delete(id int64, userID int64) error {
+// UIDPrecondition は SaveByUID / DeleteByUID が変更の前に、同じトランザクション内で現在のスケジュール
+// (系列と単一発生の変更。存在しない場合は空) を検証する関数です。CalDAV の If-Match / If-None-Match の判定に使用します。
+// false を返した場合、変更せずに ErrPreconditionFailed を返します。
+type UIDPrecondition func(current []*model.Schedule) bool
+
+// SaveByUID は UID が同じスケジュール (系列と単一発生の変更) を reqs の内容で置き換えます。
+// CalDAV のように、同じ UID の予定を1つのリソースとしてまとめて保存するために使用します。
+// 既存の予定のうち RecurrenceID が一致するものはIDを保ったまま更新し、reqs に含まれないものは削除します。
+// 所有者のカレンダーへの write 権限が必要です。新しく作成した場合は created が true になります。
+// precondition が nil でない場合は、現在のスケジュールを検証してから保存します。
+// 所有者と参加者には同じトランザクションで作成・更新の通知を作成します。
+// CalDAV クライアントは利用者のカレンダーアプリですでに保存した予定を同期するため、Import と同様に重複の確認は行いません
+// (409 を返しても、クライアントには重複を許可して保存し直す手段がなく、同期が失敗し続けるため)。
+func (r *ScheduleRepository) SaveByUID(ownerID int64, uid string, reqs []*model.CreateScheduleRequest, userID int64, precondition UIDPrecondition) (created bool, err error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// 削除権限をチェック
-	var creatorID int64
-	err = tx.QueryRow("SELECT creator_id FROM schedules WHERE id = ?", id).Scan(&creatorID)
+	if err := requirePermission(tx, model.OwnerUser, ownerID, userID, model.PermissionWrite); err != nil {
+		return false, err
+	}
+	existing, err := findCurrentByUID(tx, ownerID, uid, precondition)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("schedule with id %d not found", id)
+		return false, err
+	}
+	byRecurrenceID := make(map[int64]*model.Schedule)
+	for _, s := range existing {
+		byRecurrenceID[recurrenceKey(s.RecurrenceID)] = s
+	}
+
+	// 単一発生の変更を紐付けられるよう系列を先に保存する
+	reqs = append([]*model.CreateScheduleRequest{}, reqs...)
+	sort.SliceStable(reqs, func(i, j int) bool {
+		return reqs[i].RecurrenceID == nil && reqs[j].RecurrenceID != nil
+	})
+
+	var seriesID *int64
+	var savedIDs []int64
+	kept := make(map[int64]bool)
+	for _, req := range reqs {
+		req.OwnerID, req.UID = ownerID, uid
+		if req.RecurrenceID == nil && req.RecurrenceRule != "" {
+			// 変更された発生は系列の EXDATE にも含めて保存する (展開時に重複させないため)
+			req.ExDates = append(append([]time.Time{}, req.ExDates...), overriddenOccurrences(reqs)...)
 		}
-		return fmt.Errorf("failed to query creator_id for deletion: %w", err)
+
+		var id int64
+		if current, ok := byRecurrenceID[recurrenceKey(req.RecurrenceID)]; ok {
+			id = current.ID
+			if err := r.updateAll(tx, id, updateRequestFrom(req)); err != nil {
+				return false, err
+			}
+			if req.RecurrenceID != nil && seriesID != nil {
+				if _, err := tx.Exec("UPDATE schedules SET series_id = ? WHERE id = ?", *seriesID, id); err != nil {
+					return false, fmt.Errorf("failed to link override %d to schedule %d: %w", id, *seriesID, err)
+				}
+			}
+			kept[id] = true
+		} else {
+			s := scheduleFromRequest(req, userID)
+			if req.RecurrenceID != nil {
+				s.SeriesID = seriesID
+			}
+			if id, err = insertSchedule(tx, s); err != nil {
+				return false, err
+			}
+			if err := insertParticipants(tx, id, req.ParticipantIDs); err != nil {
+				return false, err
+			}
+		}
+		if req.RecurrenceID == nil && req.RecurrenceRule != "" {
+			seriesID = &id
+		}
+		savedIDs = append(savedIDs, id)
 	}
-	if creatorID != userID {
-		return fmt.Errorf("user %d is not authorized to delete schedule %d", userID, id)
+
+	var removed []int64
+	for _, s := range existing {
+		if !kept[s.ID] {
+			removed = append(removed, s.ID)
+		}
+	}
+	if err := deleteScheduleRows(tx, removed...); err != nil {
+		return false, err
+	}
+
+	// 所有者・参加者 (単一発生の変更と、変更で外れた参加者を含む) に通知
+	if len(savedIDs) > 0 {
+		saved, err := findScheduleByID(tx, savedIDs[0])
+		if err != nil {
+			return false, err
+		}
+		kind := model.NotificationScheduleUpdated
+		if len(existing) == 0 {
+			kind = model.NotificationScheduleCreated
+		}
+		extraIDs := audienceIDsOf(existing)
+		for _, req := range reqs[1:] {
+			extraIDs = append(extraIDs, req.ParticipantIDs...)
+		}
+		if err := notifyScheduleChange(tx, kind, saved, userID, "", extraIDs...); err != nil {
+			return false, err
+		}
 	}
 
-	// 関連する参加者情報を削除 (CASCADE DELETEが設定されているが、念のため)
-	if _, err := tx.Exec("DELETE FROM schedule_participants WHERE schedule_id = ?;", id); err != nil {
-		return fmt.Errorf("failed to delete participants for schedule %d: %w", id, err)
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return len(existing) == 0, nil
+}
 
-	// スケジュールを削除
-	result, err := tx.Exec("DELETE FROM schedules WHERE id = ?;", id)
+// DeleteByUID は UID が同じスケジュール (系列と単一発生の変更) をすべて削除します。
+// 所有者のカレンダーへの write 権限が必要です。
+// precondition が nil でない場合は、現在のスケジュールを検証してから削除します。
+// 所有者と参加者には同じトランザクションで削除の通知を作成します。
+func (r *ScheduleRepository) DeleteByUID(ownerID int64, uid string, userID int64, precondition UIDPrecondition) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to delete schedule: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := requirePermission(tx, model.OwnerUser, ownerID, userID, model.PermissionWrite); err != nil {
+		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	existing, err := findCurrentByUID(tx, ownerID, uid, precondition)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("schedule with uid %q not found", uid)
+	}
+	var ids []int64
+	for _, s := range existing {
+		ids = append(ids, s.ID)
+	}
+	if err := deleteScheduleRows(tx, ids...); err != nil {
+		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("schedule with id %d not found for deletion", id)
+
+	// 系列 (単一発生の変更のみの場合は最初の変更) の所有者と、すべての参加者に通知
+	if err := notifyScheduleChange(tx, model.NotificationScheduleDeleted, existing[0], userID, "", audienceIDsOf(existing[1:])...); err != nil {
+		return err
 	}
 
 	return tx.Commit()
-}
\ No newline at end of file
+}
+
+// audienceIDsOf は複数のスケジュールの参加者のユーザーIDを返します。重複を含むことがあります。
+func audienceIDsOf(schedules []*model.Schedule) []int64 {
+	var ids []int64
+	for _, s := range schedules {
+		for _, p := range s.Participants {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// findCurrentByUID は変更の対象となる UID が同じスケジュールを参加者情報とともに取得し、precondition で検証します。
+// 検証は取得と同じトランザクション内で行うため、他のリクエストによる変更と競合しません。
+func findCurrentByUID(tx *sql.Tx, ownerID int64, uid string, precondition UIDPrecondition) ([]*model.Schedule, error) {
+	existing, err := findSchedulesByUID(tx, ownerID, uid)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachParticipants(tx, existing); err != nil {
+		return nil, err
+	}
+	if precondition != nil && !precondition(existing) {
+		return nil, ErrPreconditionFailed
+	}
+	return existing, nil
+}
+
+// recurrenceKey は RecurrenceID を比較用のキーに変換します。系列や単発の予定は0です。
+func recurrenceKey(recurrenceID *time.Time) int64 {
+	if recurrenceID == nil {
+		return 0
+	}
+	return recurrenceID.Unix()
+}
+
+// overriddenOccurrences は reqs に含まれる単一発生の変更の元の開始日時を返します。
+func overriddenOccurrences(reqs []*model.CreateScheduleRequest) []time.Time {
+	var occurrences []time.Time
+	for _, req := range reqs {
+		if req.RecurrenceID != nil {
+			occurrences = append(occurrences, *req.RecurrenceID)
+		}
+	}
+	return occurrences
+}
+
+// updateRequestFrom は作成リクエストを、すべてのフィールドを置き換える更新リクエストに変換します。
+func updateRequestFrom(req *model.CreateScheduleRequest) *model.UpdateScheduleRequest {
+	participantIDs := append([]int64{}, req.ParticipantIDs...)
+	exdates := append([]time.Time{}, req.ExDates...)
+	return &model.UpdateScheduleRequest{
+		Title:          &req.Title,
+		StartTime:      &req.StartTime,
+		EndTime:        &req.EndTime,
+		Description:    &req.Description,
+		Location:       &req.Location,
+		ParticipantIDs: &participantIDs,
+		RecurrenceRule: &req.RecurrenceRule,
+		ExDates:        &exdates,
+	}
+}
+
+// FindBusyIntervals は各ユーザーが所有者または参加者であるスケジュールのうち、期間 [from, to) と重なる時間帯を
+// ユーザーIDごとに返します。繰り返しスケジュールは各発生に展開します。時間帯は結合・切り詰めしません。
+// 参加を辞退したスケジュールはそのユーザーの予定として扱いません。
+func (r *ScheduleRepository) FindBusyIntervals(userIDs []int64, from, to time.Time) (map[int64][]model.BusyInterval, error) {
+	busy := make(map[int64][]model.BusyInterval)
+	if len(userIDs) == 0 {
+		return busy, nil
+	}
+
+	requested := make(map[int64]bool)
+	for _, id := range userIDs {
+		requested[id] = true
+	}
+	schedules, err := findSchedulesOfUsers(r.db, userIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range schedules {
+		occurrences, err := expandOccurrences(s, from, to)
+		if err != nil {
+			return nil, err
+		}
+		// 所有者と参加者 (辞退したユーザーを除く) のうち、要求されたユーザーの時間帯として記録
+		for userID := range requested {
+			if !s.BusyFor(userID) {
+				continue
+			}
+			for _, occ := range occurrences {
+				busy[userID] = append(busy[userID], model.BusyInterval{Start: occ.StartTime, End: occ.EndTime})
+			}
+		}
+	}
+	return busy, nil
+}
+
+// findSchedulesOfUsers は各ユーザーが所有者または参加者であるスケジュールのうち、期間 [from, to) と重なり得るものを
+// 参加者付きで返します。繰り返しスケジュールは期間の終了より前に始まるものをすべて含むため、呼び出し側で展開してください。
+func findSchedulesOfUsers(q querier, userIDs []int64, from, to time.Time) ([]*model.Schedule, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = id
+	}
+	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
+
+	// 単発の予定は時間窓で絞り込み、繰り返しスケジュールは時間窓の終了より前に始まるものを取得
+	query := `SELECT ` + scheduleColumns + ` FROM schedules
+		WHERE ((owner_type = ? AND owner_id IN (` + placeholders + `))
+			OR id IN (SELECT schedule_id FROM schedule_participants WHERE user_id IN (` + placeholders + `)))
+		AND unixepoch(start_time) < unixepoch(?)
+		AND (rrule != '' OR unixepoch(end_time) > unixepoch(?))`
+	args := append(append(append([]interface{}{model.OwnerUser}, ids...), ids...), to, from)
+	schedules, err := querySchedules(q, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query for schedules of users failed: %w", err)
+	}
+	if err := attachParticipants(q, schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
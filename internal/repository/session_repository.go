@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown or expired.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is used again.
+	// The session is revoked because the token has probably been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	// ErrSessionRevoked is returned when the session has been logged out or revoked.
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
+
+// SessionRepository はログインセッションとリフレッシュトークンのデータベース操作を扱います。
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository は SessionRepository の新しいインスタンスを生成します。
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create はユーザーの新しいセッションを作成し、セッションと最初のリフレッシュトークンを返します。
+// リフレッシュトークンの有効期間は refreshTTL です。
+func (r *SessionRepository) Create(userID int64, refreshTTL time.Duration) (*model.Session, string, error) {
+	sessionID, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 期限切れのリフレッシュトークンを削除
+	if _, err := tx.Exec("DELETE FROM refresh_tokens WHERE unixepoch(expires_at) < unixepoch('now')"); err != nil {
+		return nil, "", fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO sessions (id, user_id) VALUES (?, ?)", sessionID, userID); err != nil {
+		return nil, "", fmt.Errorf("failed to insert session: %w", err)
+	}
+	refreshToken, err := insertRefreshToken(tx, sessionID, refreshTTL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := findSession(tx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return session, refreshToken, nil
+}
+
+// Refresh はリフレッシュトークンを使用済みにし、同じセッションの新しいリフレッシュトークンを発行します。
+// 使用済みのトークンが再び使われた場合はセッションを無効にし、ErrRefreshTokenReused を返します。
+func (r *SessionRepository) Refresh(refreshToken string, refreshTTL time.Duration) (*model.Session, string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRow("SELECT session_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?", hashToken(refreshToken)).
+		Scan(&sessionID, &expiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", ErrInvalidRefreshToken
+		}
+		return nil, "", fmt.Errorf("query for refresh token failed: %w", err)
+	}
+
+	session, err := findSession(tx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if session.RevokedAt != nil {
+		return nil, "", ErrSessionRevoked
+	}
+	if usedAt.Valid {
+		// 漏洩したトークンによる利用を防ぐため、セッションごと無効にする
+		if err := revokeSession(tx, sessionID); err != nil {
+			return nil, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if !time.Now().Before(expiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE token_hash = ?", hashToken(refreshToken)); err != nil {
+		return nil, "", fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	newToken, err := insertRefreshToken(tx, sessionID, refreshTTL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return session, newToken, nil
+}
+
+// Revoke はセッションを無効にします (ログアウト)。以降、そのセッションのアクセストークンとリフレッシュトークンは使えません。
+func (r *SessionRepository) Revoke(sessionID string) error {
+	if _, err := findSession(r.db, sessionID); err != nil {
+		return err
+	}
+	return revokeSession(r.db, sessionID)
+}
+
+// RevokeAllForUser はユーザーのすべてのセッションを無効にします。
+func (r *SessionRepository) RevokeAllForUser(userID int64) error {
+	return revokeUserSessions(r.db, userID)
+}
+
+// CheckActive はセッションが存在し、無効にされていないことを確認します。
+// AuthMiddleware がアクセストークンの jti を検証するために使用します。
+func (r *SessionRepository) CheckActive(sessionID string) error {
+	session, err := findSession(r.db, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func findSession(q querier, sessionID string) (*model.Session, error) {
+	var s model.Session
+	err := q.QueryRow("SELECT id, user_id, created_at, revoked_at FROM sessions WHERE id = ?", sessionID).
+		Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("query for session failed: %w", err)
+	}
+	return &s, nil
+}
+
+func revokeSession(q querier, sessionID string) error {
+	if _, err := q.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func revokeUserSessions(q querier, userID int64) error {
+	if _, err := q.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// insertRefreshToken はセッションの新しいリフレッシュトークンを発行し、ハッシュを保存します。
+func insertRefreshToken(q querier, sessionID string, ttl time.Duration) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl).UTC()
+	if _, err := q.Exec("INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES (?, ?, ?)", hashToken(token), sessionID, expiresAt); err != nil {
+		return "", fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"schedule-app/internal/model"
+)
+
+// ShareRepository はカレンダーの共有設定 (アクセス権) のデータベース操作を扱います。
+type ShareRepository struct {
+	db *sql.DB
+}
+
+// NewShareRepository は ShareRepository の新しいインスタンスを生成します。
+func NewShareRepository(db *sql.DB) *ShareRepository {
+	return &ShareRepository{db: db}
+}
+
+// shareColumns は calendar_shares テーブルから取得するカラムの一覧です。scanShare と順序を合わせてください。
+const shareColumns = `id, owner_id, grantee_type, grantee_id, permission, created_at, updated_at`
+
+func scanShare(row rowScanner) (*model.CalendarShare, error) {
+	var s model.CalendarShare
+	if err := row.Scan(&s.ID, &s.OwnerID, &s.GranteeType, &s.GranteeID, &s.Permission, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Grant は所有者のカレンダーへのアクセス権を共有先に付与します。
+// 既に共有されている場合は権限を置き換え、created に false を返します。
+func (r *ShareRepository) Grant(ownerID int64, granteeType string, granteeID int64, permission model.SharePermission) (share *model.CalendarShare, created bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow("SELECT id FROM calendar_shares WHERE owner_id = ? AND grantee_type = ? AND grantee_id = ?",
+		ownerID, granteeType, granteeID).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec("INSERT INTO calendar_shares (owner_id, grantee_type, grantee_id, permission) VALUES (?, ?, ?, ?)",
+			ownerID, granteeType, granteeID, permission)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to insert share: %w", err)
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return nil, false, fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+		created = true
+	case err != nil:
+		return nil, false, fmt.Errorf("query for share failed: %w", err)
+	default:
+		if _, err := tx.Exec("UPDATE calendar_shares SET permission = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", permission, id); err != nil {
+			return nil, false, fmt.Errorf("failed to update share %d: %w", id, err)
+		}
+	}
+
+	share, err = scanShare(tx.QueryRow("SELECT "+shareColumns+" FROM calendar_shares WHERE id = ?", id))
+	if err != nil {
+		return nil, false, fmt.Errorf("query for share by id failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return share, created, nil
+}
+
+// FindByOwnerID は所有者のカレンダーの共有設定の一覧を作成順に返します。
+func (r *ShareRepository) FindByOwnerID(ownerID int64) ([]*model.CalendarShare, error) {
+	rows, err := r.db.Query("SELECT "+shareColumns+" FROM calendar_shares WHERE owner_id = ? ORDER BY id", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("query for shares failed: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*model.CalendarShare{}
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share row: %w", err)
+		}
+		shares = append(shares, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during share rows iteration: %w", err)
+	}
+	return shares, nil
+}
+
+// Revoke は所有者のカレンダーの共有設定を削除します。
+func (r *ShareRepository) Revoke(ownerID, shareID int64) error {
+	result, err := r.db.Exec("DELETE FROM calendar_shares WHERE id = ? AND owner_id = ?", shareID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("share with id %d not found", shareID)
+	}
+	return nil
+}
+
+// Permission はユーザー userID がカレンダー (ownerType と ownerID で示すユーザーまたはグループのカレンダー) に対して持つ権限を返します。
+func (r *ShareRepository) Permission(ownerType string, ownerID, userID int64) (model.SharePermission, error) {
+	return calendarPermission(r.db, ownerType, ownerID, userID)
+}
+
+// calendarPermission はユーザー userID がカレンダー (ownerType と ownerID で示すユーザーまたはグループのカレンダー) に対して持つ権限を返します。
+func calendarPermission(q querier, ownerType string, ownerID, userID int64) (model.SharePermission, error) {
+	if ownerType == model.OwnerGroup {
+		role, err := groupRole(q, ownerID, userID)
+		if err != nil {
+			return model.PermissionNone, err
+		}
+		return role.CalendarPermission(), nil
+	}
+	return userCalendarPermission(q, ownerID, userID)
+}
+
+// userCalendarPermission はユーザー userID がユーザー ownerID のカレンダーに対して持つ権限を返します。
+// 所有者自身は常に manage 権限を持ちます。それ以外は、ユーザーへの共有と所属するグループへの共有のうち最も高い権限を返し、
+// 共有されていない場合は PermissionNone を返します。
+func userCalendarPermission(q querier, ownerID, userID int64) (model.SharePermission, error) {
+	if ownerID == userID {
+		return model.PermissionManage, nil
+	}
+	rows, err := q.Query(`
+		SELECT permission FROM calendar_shares
+		WHERE owner_id = ? AND ((grantee_type = ? AND grantee_id = ?)
+			OR (grantee_type = ? AND grantee_id IN (SELECT group_id FROM group_members WHERE user_id = ?)))
+	`, ownerID, model.GranteeUser, userID, model.GranteeGroup, userID)
+	if err != nil {
+		return model.PermissionNone, fmt.Errorf("query for calendar permission failed: %w", err)
+	}
+	defer rows.Close()
+
+	permission := model.PermissionNone
+	for rows.Next() {
+		var p model.SharePermission
+		if err := rows.Scan(&p); err != nil {
+			return model.PermissionNone, fmt.Errorf("failed to scan permission row: %w", err)
+		}
+		permission = permission.Max(p)
+	}
+	if err = rows.Err(); err != nil {
+		return model.PermissionNone, fmt.Errorf("error during permission rows iteration: %w", err)
+	}
+	return permission, nil
+}
+
+// requirePermission はユーザー userID がカレンダー (ownerType と ownerID) に required 以上の権限を持たない場合にエラーを返します。
+func requirePermission(q querier, ownerType string, ownerID, userID int64, required model.SharePermission) error {
+	permission, err := calendarPermission(q, ownerType, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	if !permission.Allows(required) {
+		return fmt.Errorf("user %d is not authorized to %s %s calendar %d", userID, required, ownerType, ownerID)
+	}
+	return nil
+}
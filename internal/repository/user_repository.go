@@ -13,6 +13,12 @@ import (
 // ErrDuplicateEntry is returned when a database insert fails due to a UNIQUE constraint.
 var ErrDuplicateEntry = errors.New("duplicate entry")
 
+// ErrLastAdmin is returned when a change would leave the system without any admin.
+var ErrLastAdmin = errors.New("at least one admin is required")
+
+// ErrAdminExists is returned when bootstrapping an admin although an admin already exists.
+var ErrAdminExists = errors.New("an admin already exists")
+
 // UserRepository はユーザー関連のデータベース操作を扱います。
 type UserRepository struct {
 	db *sql.DB
@@ -53,10 +59,10 @@ func (r *UserRepository) CreateUser(req *model.RegisterUserRequest) (*model.User
 // FindUserByID はIDでユーザーを検索します。
 func (r *UserRepository) FindUserByID(id int64) (*model.User, error) {
 	var user model.User
-	query := "SELECT id, username, email, password_hash, created_at FROM users WHERE id = ? LIMIT 1;"
+	query := "SELECT id, username, email, password_hash, role, email_verified_at, created_at FROM users WHERE id = ? LIMIT 1;"
 	row := r.db.QueryRow(query, id)
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user with id %d not found", id)
@@ -68,7 +74,7 @@ func (r *UserRepository) FindUserByID(id int64) (*model.User, error) {
 
 // FindAll はすべてのユーザーを取得します。
 func (r *UserRepository) FindAll() ([]*model.User, error) {
-	query := "SELECT id, username, email, password_hash, created_at FROM users ORDER BY id;"
+	query := "SELECT id, username, email, password_hash, role, email_verified_at, created_at FROM users ORDER BY id;"
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("query for all users failed: %w", err)
@@ -78,7 +84,7 @@ func (r *UserRepository) FindAll() ([]*model.User, error) {
 	var users []*model.User
 	for rows.Next() {
 		var user model.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 		users = append(users, &user)
@@ -94,10 +100,10 @@ func (r *UserRepository) FindAll() ([]*model.User, error) {
 // FindUserByEmail はEmailでユーザーを検索します。
 func (r *UserRepository) FindUserByEmail(email string) (*model.User, error) {
 	var user model.User
-	query := "SELECT id, username, email, password_hash, created_at FROM users WHERE email = ? LIMIT 1;"
+	query := "SELECT id, username, email, password_hash, role, email_verified_at, created_at FROM users WHERE email = ? LIMIT 1;"
 	row := r.db.QueryRow(query, email)
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.EmailVerifiedAt, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// 認証失敗時はエラーメッセージを曖昧にするため、ハンドラ側で「ユーザーが見つからない」ことを直接返さないようにする
@@ -106,4 +112,63 @@ func (r *UserRepository) FindUserByEmail(email string) (*model.User, error) {
 		return nil, fmt.Errorf("query for user by email failed: %w", err)
 	}
 	return &user, nil
+}
+
+// UpdateRole はユーザーのロールを変更します。
+// 最後の管理者を一般ユーザーに戻すことはできません (ErrLastAdmin)。
+func (r *UserRepository) UpdateRole(id int64, role model.UserRole) (*model.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current model.UserRole
+	if err := tx.QueryRow("SELECT role FROM users WHERE id = ?", id).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user with id %d not found", id)
+		}
+		return nil, fmt.Errorf("query for user role failed: %w", err)
+	}
+	if current == model.UserRoleAdmin && role != model.UserRoleAdmin {
+		var admins int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", model.UserRoleAdmin).Scan(&admins); err != nil {
+			return nil, fmt.Errorf("query for admins failed: %w", err)
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, id); err != nil {
+		return nil, fmt.Errorf("failed to update role of user %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return r.FindUserByID(id)
+}
+
+// BootstrapAdmin は管理者がまだ1人もいない場合に限り、ユーザーを管理者にします。
+// 既に管理者がいる場合は ErrAdminExists を返します。
+func (r *UserRepository) BootstrapAdmin(id int64) (*model.User, error) {
+	// 管理者の有無の確認と更新を1つの文で行い、同時に実行されても管理者が1人だけになるようにする
+	result, err := r.db.Exec(`
+		UPDATE users SET role = ?
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM users WHERE role = ?)
+	`, model.UserRoleAdmin, id, model.UserRoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bootstrap admin: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		if _, err := r.FindUserByID(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrAdminExists
+	}
+	return r.FindUserByID(id)
 }
\ No newline at end of file
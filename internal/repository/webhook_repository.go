@@ -0,0 +1,386 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"schedule-app/internal/model"
+	"strings"
+	"time"
+)
+
+// webhookSecretPrefix は webhook の署名の鍵の接頭辞です。
+const webhookSecretPrefix = "whsec_"
+
+// webhookEventIDPrefix は webhook のペイロードのイベントIDの接頭辞です。
+const webhookEventIDPrefix = "evt_"
+
+// ErrDeliveryPending は送信待ちの配信を再送信しようとしたことを表します。
+var ErrDeliveryPending = errors.New("delivery is still pending")
+
+// WebhookRepository は webhook の購読と配信キュー・送信ログのデータベース操作を扱います。
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+// NewWebhookRepository は WebhookRepository の新しいインスタンスを生成します。
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// Create は購読を登録し、ID・署名の鍵・作成日時を設定します。
+func (r *WebhookRepository) Create(sub *model.WebhookSubscription) error {
+	secret, err := generateToken()
+	if err != nil {
+		return err
+	}
+	sub.Secret = webhookSecretPrefix + secret
+
+	result, err := r.db.Exec("INSERT INTO webhook_subscriptions (user_id, scope, url, secret, event_types) VALUES (?, ?, ?, ?, ?)",
+		sub.UserID, sub.Scope, sub.URL, sub.Secret, formatEventTypes(sub.EventTypes))
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook subscription: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	created, err := r.FindByID(id)
+	if err != nil {
+		return err
+	}
+	*sub = *created
+	return nil
+}
+
+// webhookSubscriptionColumns は scanWebhookSubscription で読み取る列です。
+const webhookSubscriptionColumns = "id, user_id, scope, url, secret, event_types, created_at"
+
+// scanWebhookSubscription は webhookSubscriptionColumns の行を読み取ります。
+func scanWebhookSubscription(row rowScanner) (*model.WebhookSubscription, error) {
+	var sub model.WebhookSubscription
+	var eventTypes string
+	if err := row.Scan(&sub.ID, &sub.UserID, &sub.Scope, &sub.URL, &sub.Secret, &eventTypes, &sub.CreatedAt); err != nil {
+		return nil, err
+	}
+	sub.EventTypes = parseEventTypes(eventTypes)
+	return &sub, nil
+}
+
+// FindByID はIDで購読を取得します。
+func (r *WebhookRepository) FindByID(id int64) (*model.WebhookSubscription, error) {
+	sub, err := scanWebhookSubscription(r.db.QueryRow("SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("webhook subscription with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("query for webhook subscription failed: %w", err)
+	}
+	return sub, nil
+}
+
+// FindByScope は scope の購読を登録の古い順に返します。scope が user の場合は userID が登録した購読のみを返します。
+func (r *WebhookRepository) FindByScope(scope model.WebhookScope, userID int64) ([]*model.WebhookSubscription, error) {
+	query := "SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions WHERE scope = ?"
+	args := []interface{}{scope}
+	if scope == model.WebhookScopeUser {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	return findWebhookSubscriptions(r.db, query+" ORDER BY id", args...)
+}
+
+// findWebhookSubscriptions は購読の一覧を取得します。
+func findWebhookSubscriptions(q querier, query string, args ...interface{}) ([]*model.WebhookSubscription, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query for webhook subscriptions failed: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []*model.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription row: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during webhook subscription rows iteration: %w", err)
+	}
+	return subs, nil
+}
+
+// Delete は購読と、その配信キュー・送信ログを削除します。
+func (r *WebhookRepository) Delete(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook subscription with ID %d not found", id)
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_delivery_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE subscription_id = ?)", id); err != nil {
+		return fmt.Errorf("failed to delete webhook delivery attempts: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE subscription_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	return tx.Commit()
+}
+
+// queueWebhooks はイベントを受信する購読ごとに配信キューに追加します。
+// スケジュールの変更と同じトランザクションで呼び出すため、変更を保存した場合は必ず配信され、ロールバックした場合は配信されません。
+// scope が user の購読は、登録したユーザーがスケジュールを閲覧できる場合
+// (カレンダーの所有者・参加者、または所有者のカレンダーへの read 権限がある場合) のみ追加します。
+// ストリームのイベントIDはコミット後の発行時に割り当てるため、webhook のイベントIDはここで生成します。
+func queueWebhooks(q querier, e *model.ScheduleEvent) error {
+	subs, err := findWebhookSubscriptions(q, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+	eventID, err := generateToken()
+	if err != nil {
+		return err
+	}
+	eventID = webhookEventIDPrefix + eventID
+	now := time.Now().UTC()
+	payload, err := json.Marshal(&model.WebhookPayload{ID: eventID, Type: e.Type, CreatedAt: now, Data: e})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	for _, sub := range subs {
+		if !sub.Accepts(e.Type) {
+			continue
+		}
+		if sub.Scope == model.WebhookScopeUser && !e.VisibleTo(sub.UserID) {
+			permission, err := calendarPermission(q, e.OwnerType, e.OwnerID, sub.UserID)
+			if err != nil {
+				return err
+			}
+			if !permission.Allows(model.PermissionRead) {
+				continue
+			}
+		}
+		if _, err := q.Exec(`
+			INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			sub.ID, eventID, e.Type, string(payload), model.WebhookPending, now, now, now); err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// webhookDeliveryColumns は scanWebhookDelivery で読み取る列です (テーブルの別名は d)。
+const webhookDeliveryColumns = "d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at"
+
+// scanWebhookDelivery は webhookDeliveryColumns の行を読み取ります。extra は続く列の読み取り先です。
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload string
+	dest := append([]interface{}{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	return &d, nil
+}
+
+// DueDeliveries は送信予定の日時を過ぎた送信待ちの配信を、送信先の URL と署名の鍵とともに古い順に最大 limit 件返します。
+func (r *WebhookRepository) DueDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webhookDeliveryColumns+`, s.url, s.secret
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND unixepoch(d.next_attempt_at) <= unixepoch(?)
+		ORDER BY d.next_attempt_at, d.id LIMIT ?`, model.WebhookPending, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query for due webhook deliveries failed: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during webhook delivery rows iteration: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Claim は送信する配信の送信予定の日時を leaseUntil に延ばして確保します。
+// 他のワーカーが先に確保した場合は false を返します。送信中にプロセスが終了した場合、配信は leaseUntil 以降に再送信されます。
+func (r *WebhookRepository) Claim(d *model.WebhookDelivery, leaseUntil time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND unixepoch(next_attempt_at) = unixepoch(?)`,
+		leaseUntil.UTC(), d.ID, model.WebhookPending, d.NextAttemptAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RecordAttempt は送信の試行を送信ログに記録し、配信の状態を更新します。
+// 失敗した場合は retryAt に再送信します。retryAt が nil の場合は配信を failed にします。
+func (r *WebhookRepository) RecordAttempt(d *model.WebhookDelivery, attempt *model.WebhookAttempt, retryAt *time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms, attempted_at) VALUES (?, ?, ?, ?, ?)",
+		d.ID, attempt.StatusCode, attempt.Error, attempt.DurationMS, attempt.AttemptedAt.UTC()); err != nil {
+		return fmt.Errorf("failed to insert webhook delivery attempt: %w", err)
+	}
+
+	status, next := model.WebhookFailed, (*time.Time)(nil)
+	if attempt.Succeeded() {
+		status = model.WebhookSucceeded
+	} else if retryAt != nil {
+		status, next = model.WebhookPending, retryAt
+	}
+	if next != nil {
+		utc := next.UTC()
+		next = &utc
+	}
+	if _, err := tx.Exec("UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+		status, next, time.Now().UTC(), d.ID); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Deliveries は購読の配信を新しい順に最大 limit 件、送信ログとともに返します。
+func (r *WebhookRepository) Deliveries(subscriptionID int64, limit int) ([]*model.WebhookDelivery, error) {
+	rows, err := r.db.Query("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries d WHERE d.subscription_id = ? ORDER BY d.id DESC LIMIT ?", subscriptionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query for webhook deliveries failed: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDelivery{}
+	byID := make(map[int64]*model.WebhookDelivery)
+	var ids []interface{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, d)
+		byID[d.ID] = d
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during webhook delivery rows iteration: %w", err)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	attemptRows, err := r.db.Query(`
+		SELECT delivery_id, status_code, error, duration_ms, attempted_at FROM webhook_delivery_attempts
+		WHERE delivery_id IN (`+strings.Repeat("?,", len(ids)-1)+`?) ORDER BY id`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("query for webhook delivery attempts failed: %w", err)
+	}
+	defer attemptRows.Close()
+	for attemptRows.Next() {
+		var deliveryID int64
+		var a model.WebhookAttempt
+		if err := attemptRows.Scan(&deliveryID, &a.StatusCode, &a.Error, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery attempt row: %w", err)
+		}
+		d := byID[deliveryID]
+		d.AttemptLog = append(d.AttemptLog, &a)
+	}
+	if err := attemptRows.Err(); err != nil {
+		return nil, fmt.Errorf("error during webhook delivery attempt rows iteration: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver は購読の送信済み・失敗した配信を送信待ちに戻し、すぐに再送信します。
+// 試行回数は0に戻し、送信ログは残します。送信待ちの配信の場合は ErrDeliveryPending を返します。
+func (r *WebhookRepository) Redeliver(subscriptionID, deliveryID int64) error {
+	var status model.WebhookDeliveryStatus
+	err := r.db.QueryRow("SELECT status FROM webhook_deliveries WHERE id = ? AND subscription_id = ?", deliveryID, subscriptionID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("webhook delivery with ID %d not found", deliveryID)
+		}
+		return fmt.Errorf("query for webhook delivery failed: %w", err)
+	}
+	if status == model.WebhookPending {
+		return ErrDeliveryPending
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ? WHERE id = ? AND status = ?",
+		model.WebhookPending, now, now, deliveryID, status); err != nil {
+		return fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// PruneDeliveries は before より前に作成され、送信済みまたは失敗した配信とその送信ログを削除します。
+func (r *WebhookRepository) PruneDeliveries(before time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const expired = "SELECT id FROM webhook_deliveries WHERE status != ? AND unixepoch(created_at) < unixepoch(?)"
+	if _, err := tx.Exec("DELETE FROM webhook_delivery_attempts WHERE delivery_id IN ("+expired+")", model.WebhookPending, before.UTC()); err != nil {
+		return fmt.Errorf("failed to prune webhook delivery attempts: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE id IN ("+expired+")", model.WebhookPending, before.UTC()); err != nil {
+		return fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	return tx.Commit()
+}
+
+// formatEventTypes はイベントの種類をスペース区切りの文字列に変換します。
+func formatEventTypes(types []model.ScheduleEventType) string {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = string(t)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseEventTypes は formatEventTypes の文字列をイベントの種類に変換します。
+func parseEventTypes(s string) []model.ScheduleEventType {
+	types := []model.ScheduleEventType{}
+	for _, part := range strings.Fields(s) {
+		types = append(types, model.ScheduleEventType(part))
+	}
+	return types
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress は送信先がループバック・プライベート・リンクローカルなどの内部のアドレスの場合のエラーです。
+var ErrForbiddenAddress = errors.New("webhook destination is not a public address")
+
+// NewClient は webhook (購読の配信とリマインダー) の送信に使用する http.Client を返します。
+// webhook の URL は利用者が登録するため、サーバーから内部のネットワークにリクエストを送らせる (SSRF) ことができないよう、
+// 名前解決の後に接続するアドレスを検証し、公開されたアドレス以外には接続しません。
+// リダイレクトには従わず、3xx の応答はそのまま返します (2xx 以外のため配信の失敗になります)。
+// 環境変数のプロキシも使用しません (プロキシ経由ではアドレスを検証できないため)。
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Control は名前解決の後、接続するアドレスごとに呼ばれるため、DNS の応答を差し替えられても検証を回避できない
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// forbiddenPrefixes は IsGlobalUnicast などで判定できない、公開されていないアドレスの範囲です。
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // キャリアグレード NAT (RFC 6598)
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF プロトコルの割り当て (RFC 6890)
+	netip.MustParsePrefix("198.18.0.0/15"), // ベンチマーク (RFC 2544)
+	netip.MustParsePrefix("240.0.0.0/4"),   // 予約済み (RFC 1112)
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64 (RFC 6052)。内部の IPv4 アドレスに変換される
+	netip.MustParsePrefix("2001:db8::/32"), // ドキュメント用 (RFC 3849)
+}
+
+// publicAddr は addr がインターネット上の公開されたユニキャストアドレスかどうかを返します。
+// ループバック・プライベート (RFC 1918, RFC 4193)・リンクローカル (クラウドのメタデータサービスを含む)・
+// 未指定・マルチキャストのアドレスと、forbiddenPrefixes の範囲のアドレスは公開されたアドレスではありません。
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
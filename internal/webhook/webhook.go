@@ -0,0 +1,167 @@
+// Package webhook は webhook の配信キューを処理するバックグラウンドのワーカーを提供します。
+// 配信は HMAC-SHA256 で署名して POST し、失敗した場合は間隔を倍々に延ばして再送信します。
+// 現在時刻は clock.Clock から取得するため、テストでは clock.Fake で時刻を進めて RunOnce を呼び出します。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"schedule-app/internal/clock"
+	"schedule-app/internal/model"
+	"schedule-app/internal/repository"
+	"strconv"
+	"time"
+)
+
+// webhook のリクエストヘッダー
+const (
+	HeaderID        = "X-Webhook-ID"        // 配信のID (再送信しても同じ)
+	HeaderEvent     = "X-Webhook-Event"     // イベントの種類
+	HeaderTimestamp = "X-Webhook-Timestamp" // 送信日時 (Unix 時間)
+	HeaderSignature = "X-Webhook-Signature" // "sha256=" と署名 (16進数)
+)
+
+const (
+	// batchSize は1回の RunOnce で送信する配信の最大件数です。
+	batchSize = 50
+	// deliveryTimeout は1回の送信の制限時間です。
+	deliveryTimeout = 10 * time.Second
+	// lease は送信中の配信を確保する期間です。deliveryTimeout より長くします。
+	lease = time.Minute
+	// backoffBase と backoffMax は再送信までの待ち時間の初期値と上限です。
+	backoffBase = 30 * time.Second
+	backoffMax  = time.Hour
+	// deliveryRetention は送信済み・失敗した配信と送信ログを保持する期間です。
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+// Backoff は attempts 回目の送信に失敗した後、再送信するまでの待ち時間を返します (30秒から倍々、最大1時間)。
+func Backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, backoffMax)
+}
+
+// Sign は webhook の署名 (HeaderSignature の値) を返します。
+// 署名は "<timestamp>.<body>" の HMAC-SHA256 で、鍵は購読の secret です。
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Worker は一定間隔で送信予定の日時を過ぎた配信を送信します。
+// 送信の前に配信を確保するため、複数のワーカーがあっても同時に同じ配信を送信しません。
+// 送信中にプロセスが終了した場合は再送信するため、受信側は HeaderID で重複を除いてください。
+type Worker struct {
+	repo     *repository.WebhookRepository
+	client   *http.Client
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// NewWorker は Worker の新しいインスタンスを生成します。
+func NewWorker(repo *repository.WebhookRepository, client *http.Client, clk clock.Clock, interval time.Duration) *Worker {
+	return &Worker{repo: repo, client: client, clock: clk, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("ERROR: Failed to send webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce は送信予定の日時を過ぎた配信を送信し、送信に成功した件数を返します。
+// 失敗した配信は送信ログに記録し、MaxWebhookAttempts 回に達するまで Backoff の後に再送信します。
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := w.clock.Now()
+	due, err := w.repo.DueDeliveries(now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range due {
+		claimed, err := w.repo.Claim(d, now.Add(lease))
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		attempt := w.send(ctx, d)
+		var retryAt *time.Time
+		if attempt.Succeeded() {
+			sent++
+		} else {
+			log.Printf("WARNING: Failed to send webhook delivery %d to %s: %s", d.ID, d.URL, attempt.Error)
+			if d.Attempts+1 < model.MaxWebhookAttempts {
+				t := w.clock.Now().Add(Backoff(d.Attempts + 1))
+				retryAt = &t
+			}
+		}
+		if err := w.repo.RecordAttempt(d, attempt, retryAt); err != nil {
+			return sent, err
+		}
+	}
+
+	if err := w.repo.PruneDeliveries(now.Add(-deliveryRetention)); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+// send は配信を1回送信し、結果を返します。2xx 以外の応答は失敗です。
+func (w *Worker) send(ctx context.Context, d *model.WebhookDelivery) *model.WebhookAttempt {
+	attempt := &model.WebhookAttempt{AttemptedAt: w.clock.Now()}
+	started := time.Now()
+	defer func() { attempt.DurationMS = time.Since(started).Milliseconds() }()
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = fmt.Sprintf("invalid webhook URL: %v", err)
+		return attempt
+	}
+	timestamp := w.clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderEvent, string(d.EventType))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("webhook request failed: %v", err)
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	attempt.StatusCode = &resp.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("webhook responded with status %d", resp.StatusCode)
+	}
+	return attempt
+}
@@ -27,18 +27,25 @@ document.addEventListener('DOMContentLoaded', () => {
     // --- Event Listeners ---
     prevWeekBtn.addEventListener('click', () => {
         currentDate.setDate(currentDate.getDate() - 7);
-        renderWeeklyCalendar(schedulesCache);
+        fetchSchedules();
     });
 
     nextWeekBtn.addEventListener('click', () => {
         currentDate.setDate(currentDate.getDate() + 7);
-        renderWeeklyCalendar(schedulesCache);
+        fetchSchedules();
     });
 
     // --- Utility Functions ---
     const getToken = () => localStorage.getItem('jwt_token');
-    const setToken = (token) => localStorage.setItem('jwt_token', token);
-    const clearToken = () => localStorage.removeItem('jwt_token');
+    const getRefreshToken = () => localStorage.getItem('refresh_token');
+    const setTokens = (data) => {
+        localStorage.setItem('jwt_token', data.token);
+        localStorage.setItem('refresh_token', data.refresh_token);
+    };
+    const clearToken = () => {
+        localStorage.removeItem('jwt_token');
+        localStorage.removeItem('refresh_token');
+    };
 
     const parseJwt = (token) => {
         try {
@@ -67,10 +74,11 @@ document.addEventListener('DOMContentLoaded', () => {
             `;
             document.getElementById('logout-btn').addEventListener('click', handleLogout);
             fetchSchedules();
+            connectEventStream();
 
-            // 管理者(user_id=1)の場合、管理者パネルを表示
+            // 管理者ロールの場合、管理者パネルを表示
             const adminPanel = document.getElementById('admin-panel');
-            if (currentUser.user_id === 1) {
+            if (currentUser.role === 'admin') {
                 adminPanel.classList.remove('hidden');
                 fetchUsers();
             } else {
@@ -92,7 +100,26 @@ document.addEventListener('DOMContentLoaded', () => {
     });
 
     // --- API Call Functions ---
-    const apiFetch = async (endpoint, options = {}) => {
+    // アクセストークンの期限が切れた場合に、リフレッシュトークンで再発行します。
+    const refreshTokens = async () => {
+        const refreshToken = getRefreshToken();
+        if (!refreshToken) {
+            return false;
+        }
+        const response = await fetch(`${API_URL}/users/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (!response.ok) {
+            clearToken();
+            return false;
+        }
+        setTokens(await response.json());
+        return true;
+    };
+
+    const apiFetch = async (endpoint, options = {}, retry = true) => {
         const token = getToken();
         const headers = {
             'Content-Type': 'application/json',
@@ -104,12 +131,16 @@ document.addEventListener('DOMContentLoaded', () => {
 
         const response = await fetch(`${API_URL}${endpoint}`, { ...options, headers });
 
+        if (response.status === 401 && token && retry && await refreshTokens()) {
+            return apiFetch(endpoint, options, false);
+        }
+
         if (!response.ok) {
             const errorText = await response.text();
             throw new Error(`API Error: ${response.status} ${errorText}`);
         }
 
-        if (response.status === 204) { // No Content
+        if (response.status === 204 || response.status === 202) { // No Content, Accepted
             return null;
         }
         return response.json();
@@ -121,11 +152,22 @@ document.addEventListener('DOMContentLoaded', () => {
         const email = document.getElementById('login-email').value;
         const password = document.getElementById('login-password').value;
         try {
-            const data = await apiFetch('/users/login', {
+            let data = await apiFetch('/users/login', {
                 method: 'POST',
                 body: JSON.stringify({ email, password }),
             });
-            setToken(data.token);
+            // 二要素認証が有効な場合は、認証アプリのコードでログインを完了する
+            if (data.mfa_required) {
+                const code = prompt('認証アプリのコード (またはリカバリーコード) を入力してください');
+                if (!code) {
+                    return;
+                }
+                data = await apiFetch('/users/login/mfa', {
+                    method: 'POST',
+                    body: JSON.stringify({ mfa_token: data.mfa_token, code: code.trim() }),
+                });
+            }
+            setTokens(data);
             showScheduleUI();
         } catch (error) {
             alert(`Login failed: ${error.message}`);
@@ -142,14 +184,72 @@ document.addEventListener('DOMContentLoaded', () => {
                 method: 'POST',
                 body: JSON.stringify({ username, email, password }),
             });
-            alert('Registration successful! Please log in.');
+            alert('Registration successful! Please confirm your email address with the link we sent you, then log in.');
             showLoginLink.click();
         } catch (error) {
             alert(`Registration failed: ${error.message}`);
         }
     });
 
-    const handleLogout = () => {
+    document.getElementById('forgot-password-link').addEventListener('click', async (e) => {
+        e.preventDefault();
+        const email = prompt('登録したメールアドレスを入力してください');
+        if (!email) {
+            return;
+        }
+        try {
+            await apiFetch('/users/forgot-password', {
+                method: 'POST',
+                body: JSON.stringify({ email }),
+            });
+            alert('If the address is registered, we sent a link to reset your password.');
+        } catch (error) {
+            alert(`Password reset failed: ${error.message}`);
+        }
+    });
+
+    // メールのリンク (?verify_email_token=... / ?reset_password_token=...) から開かれた場合の処理
+    const handleEmailLink = async () => {
+        const params = new URLSearchParams(window.location.search);
+        const verifyToken = params.get('verify_email_token');
+        const resetToken = params.get('reset_password_token');
+        if (!verifyToken && !resetToken) {
+            return;
+        }
+        // リロードで同じトークンを再送信しないよう、URL からトークンを削除
+        window.history.replaceState(null, '', window.location.pathname);
+
+        try {
+            if (verifyToken) {
+                await apiFetch('/users/verify-email', {
+                    method: 'POST',
+                    body: JSON.stringify({ token: verifyToken }),
+                });
+                alert('Your email address has been confirmed.');
+                return;
+            }
+            const password = prompt('新しいパスワードを入力してください (8文字以上)');
+            if (!password) {
+                return;
+            }
+            await apiFetch('/users/reset-password', {
+                method: 'POST',
+                body: JSON.stringify({ token: resetToken, password }),
+            });
+            clearToken();
+            alert('Your password has been reset. Please log in with the new password.');
+        } catch (error) {
+            alert(`Failed: ${error.message}`);
+        }
+    };
+
+    const handleLogout = async () => {
+        try {
+            await apiFetch('/users/logout', { method: 'POST' });
+        } catch (error) {
+            // セッションが既に無効な場合もローカルのトークンは削除する
+        }
+        stopEventStream();
         clearToken();
         currentUser = null;
         document.getElementById('admin-panel').classList.add('hidden');
@@ -158,10 +258,41 @@ document.addEventListener('DOMContentLoaded', () => {
     };
 
     // --- Schedule Logic ---
+    // 表示中の週の開始 (月曜 0:00) と終了 (翌週月曜 0:00) を返す
+    const getWeekRange = (date) => {
+        const start = new Date(date);
+        start.setHours(0, 0, 0, 0);
+        start.setDate(start.getDate() - (start.getDay() || 7) + 1); // Monday
+        const end = new Date(start);
+        end.setDate(end.getDate() + 7);
+        return { start, end };
+    };
+
+    // スケジュールの一覧 (path) を、next_cursor をたどってすべて取得する
+    const fetchAllSchedules = async (path, params = new URLSearchParams()) => {
+        const schedules = [];
+        let cursor = '';
+        do {
+            if (cursor) {
+                params.set('cursor', cursor);
+            }
+            const query = params.toString();
+            const page = await apiFetch(query ? `${path}?${query}` : path);
+            schedules.push(...page.schedules);
+            cursor = page.next_cursor;
+        } while (cursor);
+        return schedules;
+    };
+
+    // 指定した期間のスケジュールを、next_cursor をたどってすべて取得する
+    const fetchSchedulesInRange = (ownerId, from, to) =>
+        fetchAllSchedules(`/users/${ownerId}/schedules`, new URLSearchParams({ from: from.toISOString(), to: to.toISOString() }));
+
     const fetchSchedules = async () => {
         if (!currentUser) return;
         try {
-            schedulesCache = await apiFetch(`/users/${currentUser.user_id}/schedules`) || [];
+            const { start, end } = getWeekRange(currentDate);
+            schedulesCache = await fetchSchedulesInRange(currentUser.user_id, start, end);
             renderWeeklyCalendar(schedulesCache);
         } catch (error) {
             alert(`Failed to fetch schedules: ${error.message}`);
@@ -176,11 +307,7 @@ document.addEventListener('DOMContentLoaded', () => {
         timeAxis.innerHTML = '';
         scheduleGrid.innerHTML = '';
 
-        const startOfWeek = new Date(currentDate);
-        startOfWeek.setDate(startOfWeek.getDate() - (startOfWeek.getDay() || 7) + 1); // Monday
-
-        const endOfWeek = new Date(startOfWeek);
-        endOfWeek.setDate(endOfWeek.getDate() + 6); // Sunday
+        const { start: startOfWeek, end: endOfWeek } = getWeekRange(currentDate);
 
         calendarMonthYear.textContent = `${startOfWeek.getFullYear()}年 ${startOfWeek.getMonth() + 1}月`;
 
@@ -234,7 +361,7 @@ document.addEventListener('DOMContentLoaded', () => {
             const dayIndex = (startTime.getDay() + 6) % 7; // Monday is 0
 
             // Ensure the schedule is within the current week
-            if (startTime < startOfWeek || startTime > endOfWeek) {
+            if (startTime < startOfWeek || startTime >= endOfWeek) {
                 return;
             }
 
@@ -321,9 +448,100 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
-    // --- Admin Logic ---
-    const adminCreateScheduleForm = document.getElementById('admin-create-schedule-form');
+    // --- Real-time Updates ---
+    // 他のユーザーによるスケジュールの変更を Server-Sent Events で受け取り、表示中の週を再読み込みする。
+    // EventSource は Authorization ヘッダーを送信できないため、fetch でストリームを読み取る。
+    let eventStreamController = null;
+    let lastEventId = '';
+    let eventRetryDelay = 3000;
+    let refreshTimer = null;
+
+    // 連続した変更をまとめて1回だけ再読み込みする
+    const scheduleRefresh = () => {
+        clearTimeout(refreshTimer);
+        refreshTimer = setTimeout(fetchSchedules, 300);
+    };
+
+    // text/event-stream を1行ずつ解析し、イベントごとに onEvent を呼び出す
+    const readEventStream = async (body, onEvent) => {
+        const reader = body.pipeThrough(new TextDecoderStream()).getReader();
+        let buffer = '';
+        let event = { type: '', data: '' };
+        for (;;) {
+            const { value, done } = await reader.read();
+            if (done) {
+                return;
+            }
+            buffer += value;
+            const lines = buffer.split('\n');
+            buffer = lines.pop();
+            for (const rawLine of lines) {
+                const line = rawLine.replace(/\r$/, '');
+                if (line === '') {
+                    if (event.type) {
+                        onEvent(event.type, event.data);
+                    }
+                    event = { type: '', data: '' };
+                    continue;
+                }
+                if (line.startsWith(':')) {
+                    continue; // ハートビート
+                }
+                const index = line.indexOf(':');
+                const field = index < 0 ? line : line.slice(0, index);
+                const fieldValue = index < 0 ? '' : line.slice(index + 1).replace(/^ /, '');
+                if (field === 'id') {
+                    lastEventId = fieldValue;
+                } else if (field === 'event') {
+                    event.type = fieldValue;
+                } else if (field === 'data') {
+                    event.data = event.data ? `${event.data}\n${fieldValue}` : fieldValue;
+                } else if (field === 'retry' && /^\d+$/.test(fieldValue)) {
+                    eventRetryDelay = parseInt(fieldValue, 10);
+                }
+            }
+        }
+    };
+
+    const connectEventStream = async () => {
+        stopEventStream();
+        const controller = new AbortController();
+        eventStreamController = controller;
+        while (!controller.signal.aborted) {
+            try {
+                const headers = { 'Authorization': `Bearer ${getToken()}` };
+                if (lastEventId) {
+                    headers['Last-Event-ID'] = lastEventId;
+                }
+                const response = await fetch(`${API_URL}/events/stream`, { headers, signal: controller.signal });
+                if (response.status === 401) {
+                    if (!(await refreshTokens())) {
+                        return;
+                    }
+                    continue;
+                }
+                if (response.ok) {
+                    // schedule.created / schedule.updated / schedule.deleted、または再開できない場合の reset
+                    await readEventStream(response.body, () => scheduleRefresh());
+                }
+            } catch (error) {
+                // 切断された場合は待ってから再接続する
+            }
+            if (!controller.signal.aborted) {
+                await new Promise(resolve => setTimeout(resolve, eventRetryDelay));
+            }
+        }
+    };
 
+    const stopEventStream = () => {
+        if (eventStreamController) {
+            eventStreamController.abort();
+            eventStreamController = null;
+        }
+        lastEventId = '';
+    };
+
+    // --- Admin Logic ---
     const fetchUsers = async () => {
         try {
             const users = await apiFetch('/admin/users');
@@ -346,7 +564,7 @@ document.addEventListener('DOMContentLoaded', () => {
             item.innerHTML = `
                 <span>${user.username} (ID: ${user.id}, Email: ${user.email})</span>
                 <button class="manage-schedules-btn" data-user-id="${user.id}" data-user-name="${user.username}">
-                    スケジュール管理
+                    スケジュール閲覧
                 </button>
             `;
             userList.appendChild(item);
@@ -364,10 +582,8 @@ document.addEventListener('DOMContentLoaded', () => {
     const handleManageSchedules = (userId, userName) => {
         const adminScheduleView = document.getElementById('admin-schedule-view');
         const selectedUserName = document.getElementById('admin-selected-user-name');
-        const ownerIdInput = document.getElementById('admin-owner-id');
 
         selectedUserName.textContent = `${userName}のスケジュール`;
-        ownerIdInput.value = userId;
         adminScheduleView.classList.remove('hidden');
 
         fetchAdminSchedules(userId);
@@ -375,15 +591,16 @@ document.addEventListener('DOMContentLoaded', () => {
 
     const fetchAdminSchedules = async (userId) => {
         try {
-            const schedules = await apiFetch(`/users/${userId}/schedules`);
-            renderAdminSchedules(schedules, userId);
+            // 管理者用のエンドポイントは共有の権限によらずスケジュールを返す
+            const schedules = await fetchAllSchedules(`/admin/users/${userId}/schedules`);
+            renderAdminSchedules(schedules);
         } catch (error) {
             alert(`Failed to fetch schedules for user ${userId}: ${error.message}`);
             document.getElementById('admin-schedule-list').innerHTML = `<p class="error">スケジュールの読み込みに失敗しました。</p>`;
         }
     };
 
-    const renderAdminSchedules = (schedules, ownerId) => {
+    const renderAdminSchedules = (schedules) => {
         const adminScheduleList = document.getElementById('admin-schedule-list');
         adminScheduleList.innerHTML = '';
         if (!schedules || schedules.length === 0) {
@@ -399,68 +616,17 @@ document.addEventListener('DOMContentLoaded', () => {
                 <p><strong>終了:</strong> ${new Date(s.end_time).toLocaleString()}</p>
                 <p>${s.description || ''}</p>
                 <p><em>場所: ${s.location || 'N/A'}</em></p>
-                <div class="actions">
-                    <button class="admin-delete-btn" data-id="${s.id}" data-owner-id="${ownerId}">削除</button>
-                </div>
             `;
             adminScheduleList.appendChild(item);
         });
-
-        document.querySelectorAll('.admin-delete-btn').forEach(button => {
-            button.addEventListener('click', async (e) => {
-                const scheduleId = e.target.dataset.id;
-                const currentOwnerId = e.target.dataset.ownerId;
-                if (confirm('このスケジュールを本当に削除しますか？')) {
-                    try {
-                        await apiFetch(`/schedules/${scheduleId}`, { method: 'DELETE' });
-                        fetchAdminSchedules(currentOwnerId);
-                    } catch (error) {
-                        alert(`Failed to delete schedule: ${error.message}`);
-                    }
-                }
-            });
-        });
     };
 
-    adminCreateScheduleForm.addEventListener('submit', async (e) => {
-        e.preventDefault();
-        const ownerId = document.getElementById('admin-owner-id').value;
-        const title = document.getElementById('admin-schedule-title').value;
-        const startTime = document.getElementById('admin-schedule-start-time').value;
-        const endTime = document.getElementById('admin-schedule-end-time').value;
-        const description = document.getElementById('admin-schedule-description').value;
-        const location = document.getElementById('admin-schedule-location').value;
-
-        if (!ownerId) {
-            alert('ユーザーが選択されていません。');
-            return;
-        }
-
-        try {
-            await apiFetch('/schedules', {
-                method: 'POST',
-                body: JSON.stringify({
-                    title,
-                    start_time: new Date(startTime).toISOString(),
-                    end_time: new Date(endTime).toISOString(),
-                    description,
-                    location,
-                    owner_id: parseInt(ownerId, 10),
-                }),
-            });
-            adminCreateScheduleForm.reset();
-            // keep ownerId hidden input value
-            document.getElementById('admin-owner-id').value = ownerId;
-            fetchAdminSchedules(ownerId);
-        } catch (error) {
-            alert(`Failed to create schedule: ${error.message}`);
+    // --- Initial Check ---
+    handleEmailLink().finally(() => {
+        if (getToken()) {
+            showScheduleUI();
+        } else {
+            showAuthUI();
         }
     });
-
-    // --- Initial Check ---
-    if (getToken()) {
-        showScheduleUI();
-    } else {
-        showAuthUI();
-    }
 });
\ No newline at end of file